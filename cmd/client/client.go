@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/size12/gophkeeper/internal/client"
@@ -10,11 +13,29 @@ import (
 )
 
 func main() {
-	cfg := config.GetClientConfig()
+	cfg, err := config.LoadClientConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalln("Failed load config:", err)
+	}
 
-	c := handlers.NewClientConn(cfg.ServerAddress)
+	var clientOptions []handlers.ClientOption
+	if cfg.TLSCAFile != "" || cfg.TLSServerPin != "" {
+		tlsConfig, err := handlers.NewClientTLSConfig(cfg.TLSCAFile, cfg.TLSServerPin, cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalln("Failed load TLS config:", err)
+		}
+		clientOptions = append(clientOptions, handlers.WithClientTLS(tlsConfig))
+	}
+
+	c := handlers.NewClientConn(cfg.ServerAddress, clientOptions...)
 
 	h := handlers.NewClientHandlers(c)
+	if cfg.AuthMethod == "srp" {
+		h.AuthMethod = handlers.AuthSRP
+	}
 
 	tui := client.NewTUI(h)
 
@@ -2,35 +2,323 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/size12/gophkeeper/internal/config"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/events"
 	"github.com/size12/gophkeeper/internal/handlers"
+	"github.com/size12/gophkeeper/internal/logging"
+	"github.com/size12/gophkeeper/internal/metrics"
+	"github.com/size12/gophkeeper/internal/ratelimit"
 	"github.com/size12/gophkeeper/internal/storage"
 )
 
 func main() {
-	cfg := config.GetServerConfig()
+	cfg, err := config.LoadServerConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalln("Failed load config:", err)
+	}
 
-	db := storage.NewDBStorage(cfg.DBConnectionURL)
-	db.MigrateUP()
+	logger, err := logging.NewLogger(os.Stderr, cfg.LogLevel)
+	if err != nil {
+		log.Fatalln("Failed create logger:", err)
+	}
+	slog.SetDefault(logger)
 
-	files := storage.NewFileStorage(cfg.FilesDirectory)
+	var db serverDB
+	var files serverFiles
+	// sqlDB is connection of DB storage, it's nil in dev mode.
+	var sqlDB *sql.DB
+
+	if cfg.Dev {
+		slog.Warn("Server runs in dev mode, data is kept in memory and lost on exit")
+		db = storage.NewMemoryStorage()
+		files = storage.NewMemoryFileStorage()
+	} else {
+		dbStorage := newDBStorage(cfg)
+		db, sqlDB = dbStorage, dbStorage.DB
+		files = storage.NewFileStorage(cfg.FilesDirectory)
+	}
 
 	serverStorage := storage.NewStorage(db, files)
+	serverStorage.Quota = entity.Quota{
+		MaxBytes:      cfg.QuotaBytes,
+		MaxRecords:    cfg.QuotaRecords,
+		MaxRecordSize: cfg.QuotaRecordSize,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Records could be updated, but their staged files weren't moved in place, and users could be deleted,
+	// but their files weren't deleted, before server stopped.
+	sweep(ctx, serverStorage, cfg.TombstoneRetention)
+	go watchSweep(ctx, serverStorage, cfg.TombstoneRetention)
+
+	// Files, which were uploaded before sizes of records were counted, have zero size until it's read from disk.
+	updated, err := serverStorage.BackfillFileSizes(ctx)
+	if err != nil {
+		slog.Error("Failed set sizes of file records", "error", err)
+	} else if updated > 0 {
+		slog.Info("Set sizes of file records", "records", updated)
+	}
+
+	var broker events.Broker = events.NewMemoryBroker()
+	if cfg.EventsBackend == "postgres" {
+		postgresBroker := events.NewPostgresBroker(sqlDB)
+		go postgresBroker.Listen(ctx)
+		broker = postgresBroker
+	}
+
+	handlersAuth, err := newAuthenticator(cfg)
+	if err != nil {
+		slog.Error("Failed load JWT keys", "error", err)
+		os.Exit(1)
+	}
+	handlersAuth.TTL = cfg.AccessTokenTTL
+
+	serverHandlers := handlers.NewServerHandlers(serverStorage, serverStorage, handlersAuth, broker)
+	serverHandlers.AccessTokenTTL = cfg.AccessTokenTTL
+	serverHandlers.RefreshTokenTTL = cfg.RefreshTokenTTL
+	if key := cfg.SRPSaltKey(); len(key) != 0 {
+		serverHandlers.SRPSaltKey = key
+	} else {
+		slog.Warn("srp_salt_secret isn't set, fake SRP salts of unknown logins change after restart")
+	}
+	if cfg.LoginLimitBackend == "postgres" {
+		serverHandlers.Limiter = ratelimit.NewPostgresLimiter(sqlDB, ratelimit.DefaultPolicy)
+	}
+
+	serverOptions := []handlers.ServerOption{handlers.WithHealthChecks(db, files)}
+	if cfg.Reflection {
+		serverOptions = append(serverOptions, handlers.WithReflection())
+	}
+
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := handlers.NewServerTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			slog.Error("Failed load TLS config", "error", err)
+			os.Exit(1)
+		}
+		serverOptions = append(serverOptions, handlers.WithServerTLS(tlsConfig))
+
+		if cfg.TLSClientCAFile != "" {
+			serverOptions = append(serverOptions, handlers.WithCertificateUsers(serverStorage))
+		}
+	}
+
+	server := handlers.NewServerConn(serverHandlers, handlersAuth, serverOptions...)
+	go server.Run(ctx, cfg.RunAddress)
 
-	handlersAuth := handlers.NewAuthenticatorJWT([]byte("secret ewfwfw key"))
-	serverHandlers := handlers.NewServerHandlers(serverStorage, handlersAuth)
+	var metricsServer *http.Server
+	if cfg.MetricsAddress != "" {
+		metrics.RegisterActiveSessions(func() float64 {
+			count, err := db.CountActiveSessions(ctx, time.Now().Add(-cfg.RefreshTokenTTL))
+			if err != nil {
+				return 0
+			}
+			return float64(count)
+		})
 
-	server := handlers.NewServerConn(serverHandlers)
-	go server.Run(context.Background(), cfg.RunAddress)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.MetricsAddress, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+		go func() {
+			err := metricsServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Failed run metrics server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			reloadSigningKey(handlersAuth)
+		}
+	}()
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	<-sigint
 
+	if metricsServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		metricsServer.Shutdown(shutdownCtx)
+	}
+
 	server.Stop()
 }
+
+// serverDB is DB storage of server. It's checked by health checks and counts active sessions for metrics.
+type serverDB interface {
+	storage.Storager
+	handlers.HealthChecker
+	CountActiveSessions(ctx context.Context, since time.Time) (int64, error)
+}
+
+// serverFiles is file storage of server, which is checked by health checks.
+type serverFiles interface {
+	storage.FileStorager
+	handlers.HealthChecker
+}
+
+// sweepInterval is interval between sweeps of files, which were left after failures of file storage,
+// and of old tombstones of deleted records.
+const sweepInterval = time.Hour
+
+// sweep moves journaled staged files in place, deletes files of deleted users and prunes tombstones,
+// which are older than retention.
+func sweep(ctx context.Context, serverStorage *storage.Storage, retention time.Duration) {
+	committed, err := serverStorage.CommitStagedFiles(ctx)
+	if err != nil {
+		slog.Error("Failed commit staged files of records", "error", err)
+	} else if committed > 0 {
+		slog.Info("Committed staged files of records", "files", committed)
+	}
+
+	deleted, err := serverStorage.PurgeDeletedFiles(ctx)
+	if err != nil {
+		slog.Error("Failed delete files of deleted users", "error", err)
+	} else if deleted > 0 {
+		slog.Info("Deleted files of deleted users", "files", deleted)
+	}
+
+	pruned, err := serverStorage.PruneTombstones(ctx, time.Now().Add(-retention))
+	if err != nil {
+		slog.Error("Failed prune tombstones of deleted records", "error", err)
+	} else if pruned > 0 {
+		slog.Info("Pruned tombstones of deleted records", "records", pruned)
+	}
+}
+
+// watchSweep sweeps storage until context is done.
+func watchSweep(ctx context.Context, serverStorage *storage.Storage, retention time.Duration) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep(ctx, serverStorage, retention)
+		}
+	}
+}
+
+// newDBStorage connects to SQLite or PostgreSQL database by scheme of db_url and migrates it.
+func newDBStorage(cfg config.Server) *storage.DBStorage {
+	if path, ok := cfg.SQLitePath(); ok {
+		db := storage.NewSQLiteStorage(path)
+		db.MigrateUP()
+		return db.DBStorage
+	}
+
+	db := storage.NewDBStorage(cfg.DBConnectionURL)
+	db.MigrateUP()
+	return db
+}
+
+// devJWTSecretSize is size of random secret of access tokens in dev mode.
+const devJWTSecretSize = 32
+
+// newAuthenticator gets authenticator with signing keys from config. Key file is preferred to secret.
+func newAuthenticator(cfg config.Server) (*handlers.AuthenticatorJWT, error) {
+	var previous []handlers.SigningKey
+	if cfg.JWTPreviousSecret != "" {
+		previous = append(previous, handlers.NewHMACKey([]byte(cfg.JWTPreviousSecret)))
+	}
+
+	for _, path := range cfg.PreviousKeyFiles() {
+		key, err := handlers.LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+
+	current, ok, err := currentSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		// Only dev mode runs without keys. Tokens of random secret become invalid after restart like all data.
+		secret := make([]byte, devJWTSecretSize)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+		return handlers.NewAuthenticatorJWTWithKeys(handlers.NewHMACKey(secret), previous...)
+	}
+
+	if cfg.JWTKeyFile != "" && cfg.JWTSecret != "" {
+		previous = append(previous, handlers.NewHMACKey([]byte(cfg.JWTSecret)))
+	}
+
+	return handlers.NewAuthenticatorJWTWithKeys(current, previous...)
+}
+
+// currentSigningKey gets key, which signs access tokens, from config. Key file is preferred to secret.
+// Returns false, if neither of them is set.
+func currentSigningKey(cfg config.Server) (handlers.SigningKey, bool, error) {
+	if cfg.JWTKeyFile != "" {
+		key, err := handlers.LoadSigningKey(cfg.JWTKeyFile)
+		return key, err == nil, err
+	}
+
+	if cfg.JWTSecret != "" {
+		return handlers.NewHMACKey([]byte(cfg.JWTSecret)), true, nil
+	}
+
+	return handlers.SigningKey{}, false, nil
+}
+
+// reloadSigningKey loads config again and makes its key current, so key is rotated without restart.
+// Previous key verifies its tokens until they expire.
+func reloadSigningKey(auth *handlers.AuthenticatorJWT) {
+	cfg, err := config.LoadServerConfig(os.Args[1:])
+	if err != nil {
+		slog.Error("Failed reload config", "error", err)
+		return
+	}
+
+	key, ok, err := currentSigningKey(cfg)
+	if err != nil {
+		slog.Error("Failed load JWT key", "error", err)
+		return
+	}
+
+	if !ok {
+		slog.Warn("JWT key isn't set in config, current key is kept")
+		return
+	}
+
+	err = auth.RotateKey(key)
+	if err != nil {
+		slog.Error("Failed rotate JWT key", "error", err)
+		return
+	}
+
+	slog.Info("JWT key is reloaded", "kid", key.ID)
+}
@@ -1,10 +1,15 @@
 package client
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"os"
 	"path"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -19,8 +24,13 @@ type TUI struct {
 	*tview.Application
 	pages  *tview.Pages
 	Client *handlers.Client
+	// stopWatch stops watching record events of previous session.
+	stopWatch context.CancelFunc
 }
 
+// watchRetryDelay is pause before watching record events again after lost connection.
+const watchRetryDelay = 5 * time.Second
+
 // NewTUI gets new terminal user interface for client.
 func NewTUI(client *handlers.Client) *TUI {
 	app := tview.NewApplication()
@@ -39,126 +49,941 @@ func NewTUI(client *handlers.Client) *TUI {
 		pages:       pages,
 	}
 
-	tui.authPage("")
+	tui.authPage("")
+
+	return tui
+}
+
+// authPage switches to authentication page, where user can log in or register.
+func (app *TUI) authPage(message string) {
+	credentials := entity.UserCredentials{}
+	form := tview.NewForm()
+
+	form.AddInputField("Login", "", 20, nil, func(login string) {
+		credentials.Login = login
+	})
+
+	form.AddPasswordField("Password", "", 20, '*', func(password string) {
+		credentials.Password = password
+	})
+
+	form.AddPasswordField("Master Key", "", 20, '*', func(masterKey string) {
+		credentials.MasterKey = []byte(masterKey)
+	})
+
+	form.AddButton("Login", func() {
+		err := app.Client.Login(credentials)
+
+		if message, ok := lockoutMessage(err); ok {
+			app.authPage(message)
+			return
+		}
+
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.authPage("Wrong credentials. Please try again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrTOTPRequired) {
+			app.totpLoginPage("")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.authPage("Some fields are empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrUnknown) || err != nil {
+			app.authPage("Something is wrong. Please try again later.")
+			return
+		}
+
+		app.signedIn("Logged successfully.")
+	})
+
+	form.AddButton("Register", func() {
+		err := app.Client.Register(credentials)
+
+		if errors.Is(err, storage.ErrLoginExists) {
+			app.authPage("Such login exists. Please try again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.authPage("Some fields are empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrUnknown) || err != nil {
+			app.authPage("Something is wrong. Please try again later.")
+			return
+		}
+
+		app.watchRecords()
+		app.recordsInfoPage("Registered successfully.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	app.pages.AddPage("authentication", frame, true, true)
+	app.pages.SwitchToPage("authentication")
+}
+
+// signedIn starts watching of records after login. If vault has records of old client versions, user is asked
+// to migrate them first, because they can't be opened before it.
+func (app *TUI) signedIn(message string) {
+	app.watchRecords()
+
+	legacy, err := app.Client.HasLegacyRecords()
+	if err == nil && legacy {
+		app.legacyRecordsPage("")
+		return
+	}
+
+	app.recordsInfoPage(message)
+}
+
+// legacyRecordsPage switches to page, where records of old client versions are sealed with master key of user.
+// Such records can't be opened until then, so user can only migrate them or log out.
+func (app *TUI) legacyRecordsPage(message string) {
+	var masterKey string
+
+	form := tview.NewForm()
+
+	form.AddPasswordField("Master key", "", 20, '*', func(text string) {
+		masterKey = text
+	})
+
+	form.AddButton("Migrate", func() {
+		if masterKey == "" {
+			app.legacyRecordsPage("Master key can't be empty.")
+			return
+		}
+
+		app.rotationPage([]byte(masterKey), []byte(masterKey))
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Migrate records", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("Some records were saved by old client version with publicly known key.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("They will be downloaded, sealed with your master key and uploaded back.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - log out.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.logout()
+		}
+		return event
+	})
+
+	app.pages.AddPage("legacyRecords", frame, true, true)
+	app.pages.SwitchToPage("legacyRecords")
+}
+
+// lockoutMessage returns message for user, if login is locked out after too many failed attempts.
+func lockoutMessage(err error) (string, bool) {
+	var lockout *handlers.LockoutError
+	if !errors.As(err, &lockout) {
+		return "", false
+	}
+
+	return fmt.Sprintf("Too many failed attempts. Try again in %v.", lockout.RetryAfter.Round(time.Second)), true
+}
+
+// totpLoginPage switches to second step of login, where user enters TOTP code or backup code.
+func (app *TUI) totpLoginPage(message string) {
+	var code string
+	form := tview.NewForm()
+
+	form.AddInputField("Code", "", 20, nil, func(text string) {
+		code = text
+	})
+
+	form.AddButton("Verify", func() {
+		err := app.Client.LoginTOTP(code)
+
+		if message, ok := lockoutMessage(err); ok {
+			app.totpLoginPage(message)
+			return
+		}
+
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.totpLoginPage("Wrong code. Please try again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.totpLoginPage("Code is empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Login expired. Please login again.")
+			return
+		}
+
+		if err != nil {
+			app.authPage("Something is wrong. Please try again later.")
+			return
+		}
+
+		app.signedIn("Logged successfully.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Two-factor authentication", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("Enter code from authenticator app or backup code.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the login.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.authPage("")
+		}
+		return event
+	})
+
+	app.pages.AddPage("totpLogin", frame, true, true)
+	app.pages.SwitchToPage("totpLogin")
+}
+
+// watchRecords refreshes records page, when records are changed by any client. Previous watching is stopped.
+func (app *TUI) watchRecords() {
+	if app.stopWatch != nil {
+		app.stopWatch()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.stopWatch = cancel
+
+	go func() {
+		for {
+			err := app.Client.WatchRecords(ctx, func(event entity.RecordEvent) {
+				app.QueueUpdateDraw(func() {
+					if page, _ := app.pages.GetFrontPage(); page == "records" {
+						app.recordsInfoPage("Records were changed.")
+					}
+				})
+			})
+
+			if ctx.Err() != nil || errors.Is(err, storage.ErrUserUnauthorized) {
+				return
+			}
+
+			// Server ends watching, when access token expires, then it's started again with fresh token.
+			if err == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryDelay):
+			}
+		}
+	}()
+}
+
+// logout ends session and switches to authentication page.
+func (app *TUI) logout() {
+	if app.stopWatch != nil {
+		app.stopWatch()
+	}
+
+	err := app.Client.Logout()
+	if err != nil && !errors.Is(err, storage.ErrUserUnauthorized) {
+		app.authPage("Logged out, but server didn't end session.")
+		return
+	}
+
+	app.authPage("Logged out.")
+}
+
+// recordInfoPage switches to page, where are all records shown. You can choose one.
+func (app *TUI) recordsInfoPage(message string) {
+	records, err := app.Client.SyncRecords()
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		app.authPage("Session expired. Please login again.")
+		return
+	}
+
+	if errors.Is(err, storage.ErrUnknown) || err != nil {
+		message = "Something is wrong. Please try later."
+		return
+	}
+
+	list := tview.NewList()
+
+	for _, record := range records {
+
+		f := func(record entity.Record) func() {
+			return func() {
+				app.recordPage(record.ID, "")
+			}
+		}(record)
+
+		if record.Metadata == "" {
+			record.Metadata = "no metadata"
+		}
+
+		list.AddItem(record.ID, record.Type.String()+" | "+record.Metadata, '*', f)
+	}
+
+	listFrame := tview.NewFrame(list).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Up/Down - switch between records | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+N - create new record       | Ctrl+U - refresh", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+F - search records          | Ctrl+S - sessions", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+P - change password         | Ctrl+R - change master key", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+T - two-factor auth         | Ctrl+L - logout", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+A - audit log               | Ctrl+D - delete account", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	if usage, err := app.Client.GetUsage(); err == nil {
+		listFrame.AddText(usageText(usage), true, tview.AlignRight, tcell.ColorWhite)
+	}
+
+	listFrame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlL {
+			app.logout()
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlS {
+			app.sessionsPage("")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlP {
+			app.changePasswordPage("")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlR {
+			app.masterKeyPage("")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlT {
+			app.totpPage("")
+		}
+		if event.Key() == tcell.KeyCtrlD {
+			app.deleteAccountPage("")
+		}
+		if event.Key() == tcell.KeyCtrlA {
+			app.auditPage("")
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlN {
+			app.createRecordPage("")
+		}
+		if event.Key() == tcell.KeyCtrlF {
+			app.searchPage("")
+		}
+		if event.Key() == tcell.KeyCtrlU {
+			app.recordsInfoPage("Refreshed.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("records", listFrame, true, true)
+	app.pages.SwitchToPage("records")
+}
+
+// usageText returns line with usage of user, like "Used 1.5 MiB of 10.0 MiB | 3 of 100 records".
+func usageText(usage entity.Usage) string {
+	bytes := "Used " + formatBytes(usage.Bytes)
+	if usage.Quota.MaxBytes > 0 {
+		bytes += " of " + formatBytes(usage.Quota.MaxBytes)
+	}
+
+	records := fmt.Sprintf("%d records", usage.Records)
+	if usage.Quota.MaxRecords > 0 {
+		records = fmt.Sprintf("%d of %d records", usage.Records, usage.Quota.MaxRecords)
+	}
+
+	return bytes + " | " + records
+}
+
+// formatBytes returns size in bytes, KiB, MiB or GiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / unit
+	for _, suffix := range []string{"KiB", "MiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+
+	return fmt.Sprintf("%.1f GiB", value)
+}
+
+// sessionsPage switches to page with active sessions of user. Chosen session is revoked.
+func (app *TUI) sessionsPage(message string) {
+	sessions, err := app.Client.ListSessions()
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		app.authPage("Session expired. Please login again.")
+		return
+	}
+
+	if err != nil {
+		app.recordsInfoPage("Failed get sessions.")
+		return
+	}
+
+	list := tview.NewList()
+
+	for _, session := range sessions {
+		f := func(session entity.SessionInfo) func() {
+			return func() {
+				if session.Current {
+					app.logout()
+					return
+				}
+
+				err := app.Client.RevokeSession(session.ID)
+
+				if errors.Is(err, storage.ErrUserUnauthorized) {
+					app.authPage("Session expired. Please login again.")
+					return
+				}
+
+				if errors.Is(err, storage.ErrNotFound) {
+					app.sessionsPage("Session already ended.")
+					return
+				}
+
+				if err != nil {
+					app.sessionsPage("Something is wrong. Please try later.")
+					return
+				}
+
+				app.sessionsPage("Session revoked.")
+			}
+		}(session)
+
+		name := session.Device.Name
+		if session.Current {
+			name += " (this device)"
+		}
+
+		list.AddItem(name, session.Device.IP+" | "+session.Device.UserAgent+" | last seen "+session.LastSeenAt.Format(time.DateTime), '*', f)
+	}
+
+	frame := tview.NewFrame(list).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Active sessions", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("Up/Down - switch between sessions | Enter - revoke session | ESC - return to the menu", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("sessions", frame, true, true)
+	app.pages.SwitchToPage("sessions")
+}
+
+// auditPage switches to page, where user chooses time range of audit log. Empty date doesn't limit range.
+func (app *TUI) auditPage(message string) {
+	var from, to string
+
+	form := tview.NewForm()
+
+	form.AddInputField("From (YYYY-MM-DD)", "", 20, nil, func(text string) {
+		from = text
+	})
+
+	form.AddInputField("To (YYYY-MM-DD)", "", 20, nil, func(text string) {
+		to = text
+	})
+
+	form.AddButton("Show", func() {
+		query := entity.AuditQuery{}
+
+		if from != "" {
+			date, err := time.ParseInLocation(time.DateOnly, from, time.Local)
+			if err != nil {
+				app.auditPage("Bad date format.")
+				return
+			}
+			query.From = date
+		}
+
+		if to != "" {
+			date, err := time.ParseInLocation(time.DateOnly, to, time.Local)
+			if err != nil {
+				app.auditPage("Bad date format.")
+				return
+			}
+			query.To = date.AddDate(0, 0, 1)
+		}
+
+		app.auditEventsPage(query)
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Audit log", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the menu.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("audit", frame, true, true)
+	app.pages.SwitchToPage("audit")
+}
+
+// auditEventsPage switches to page with audit events of user in time range, newest first.
+func (app *TUI) auditEventsPage(query entity.AuditQuery) {
+	events, err := app.Client.ListAuditEvents(query)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		app.authPage("Session expired. Please login again.")
+		return
+	}
+
+	if errors.Is(err, storage.ErrBadQuery) {
+		app.auditPage("End of range is before its start.")
+		return
+	}
+
+	if err != nil {
+		app.auditPage("Failed get audit log.")
+		return
+	}
+
+	list := tview.NewList()
+
+	for _, event := range events {
+		name := string(event.Action)
+		if event.RecordID != "" {
+			name += " " + event.RecordID
+		}
+
+		list.AddItem(name, event.Time.Format(time.DateTime)+" | "+event.IP+" | "+event.Result, '*', nil)
+	}
+
+	message := fmt.Sprintf("Found events: %d", len(events))
+
+	frame := tview.NewFrame(list).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Audit log", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("Up/Down - switch between events | ESC - choose another range", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.auditPage("")
+		}
+		return event
+	})
+
+	app.pages.AddPage("auditEvents", frame, true, true)
+	app.pages.SwitchToPage("auditEvents")
+}
+
+// changePasswordPage switches to page, where user changes password. Other sessions of user are ended.
+func (app *TUI) changePasswordPage(message string) {
+	var oldPassword, newPassword, repeatPassword string
+
+	form := tview.NewForm()
+
+	form.AddPasswordField("Current password", "", 20, '*', func(text string) {
+		oldPassword = text
+	})
+
+	form.AddPasswordField("New password", "", 20, '*', func(text string) {
+		newPassword = text
+	})
+
+	form.AddPasswordField("Repeat new password", "", 20, '*', func(text string) {
+		repeatPassword = text
+	})
+
+	form.AddButton("OK", func() {
+		if newPassword != repeatPassword {
+			app.changePasswordPage("New passwords don't match.")
+			return
+		}
+
+		err := app.Client.ChangePassword(oldPassword, newPassword)
+
+		if message, ok := lockoutMessage(err); ok {
+			app.changePasswordPage(message)
+			return
+		}
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.changePasswordPage("Passwords can't be empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.changePasswordPage("Wrong current password.")
+			return
+		}
+
+		if err != nil {
+			app.changePasswordPage("Something is wrong. Please try later.")
+			return
+		}
+
+		app.recordsInfoPage("Password changed. Other sessions are ended.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Change password", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the menu.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("changePassword", frame, true, true)
+	app.pages.SwitchToPage("changePassword")
+}
+
+// deleteAccountConfirmation is text, which user types to confirm deletion of account.
+const deleteAccountConfirmation = "DELETE"
+
+// deleteAccountPage switches to page, where user deletes account with all records after entering password.
+func (app *TUI) deleteAccountPage(message string) {
+	var password, confirmation string
+
+	form := tview.NewForm()
+
+	form.AddPasswordField("Password", "", 20, '*', func(text string) {
+		password = text
+	})
+
+	form.AddInputField("Type "+deleteAccountConfirmation+" to confirm", "", 20, nil, func(text string) {
+		confirmation = text
+	})
+
+	form.AddButton("Delete account", func() {
+		if confirmation != deleteAccountConfirmation {
+			app.deleteAccountPage("Deletion isn't confirmed.")
+			return
+		}
+
+		err := app.Client.DeleteAccount(password)
+
+		if message, ok := lockoutMessage(err); ok {
+			app.deleteAccountPage(message)
+			return
+		}
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.deleteAccountPage("Password can't be empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.deleteAccountPage("Wrong password.")
+			return
+		}
+
+		if err != nil {
+			app.deleteAccountPage("Something is wrong. Please try later.")
+			return
+		}
+
+		if app.stopWatch != nil {
+			app.stopWatch()
+		}
+
+		app.authPage("Account deleted.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Delete account", true, tview.AlignCenter, tcell.ColorRed).
+		AddText("All records and files will be deleted forever.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the menu.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("deleteAccount", frame, true, true)
+	app.pages.SwitchToPage("deleteAccount")
+}
+
+// totpPage switches to page, where user enables or disables two-factor authentication.
+func (app *TUI) totpPage(message string) {
+	var code, password string
+	form := tview.NewForm()
+
+	form.AddInputField("Code (to disable)", "", 20, nil, func(text string) {
+		code = text
+	})
+
+	form.AddPasswordField("Password (to disable)", "", 20, '*', func(text string) {
+		password = text
+	})
+
+	form.AddButton("Enable", func() {
+		enrollment, err := app.Client.EnableTOTP()
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrTOTPEnabled) {
+			app.totpPage("Two-factor authentication is already enabled.")
+			return
+		}
+
+		if err != nil {
+			app.totpPage("Something is wrong. Please try later.")
+			return
+		}
+
+		app.totpEnrollPage(enrollment, "")
+	})
+
+	form.AddButton("Disable", func() {
+		err := app.Client.DisableTOTP(code, password)
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
+
+		if message, ok := lockoutMessage(err); ok {
+			app.totpPage(message)
+			return
+		}
+
+		if errors.Is(err, handlers.ErrFieldIsEmpty) {
+			app.totpPage("Code or password is empty.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrNotFound) {
+			app.totpPage("Two-factor authentication isn't enabled.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.totpPage("Wrong code or password.")
+			return
+		}
+
+		if err != nil {
+			app.totpPage("Something is wrong. Please try later.")
+			return
+		}
+
+		app.recordsInfoPage("Two-factor authentication disabled.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Two-factor authentication", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the menu.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
 
-	return tui
+	app.pages.AddPage("totp", frame, true, true)
+	app.pages.SwitchToPage("totp")
 }
 
-// authPage switches to authentication page, where user can log in or register.
-func (app *TUI) authPage(message string) {
-	credentials := entity.UserCredentials{}
-	form := tview.NewForm()
+// totpEnrollPage shows new TOTP secret and backup codes. Secret is confirmed by code from authenticator app.
+func (app *TUI) totpEnrollPage(enrollment entity.TOTPEnrollment, message string) {
+	text := "Secret: " + enrollment.Secret + "\n\n" + enrollment.URI + "\n\nBackup codes, each can be used once:\n" +
+		strings.Join(enrollment.BackupCodes, "\n")
 
-	form.AddInputField("Login", "", 20, nil, func(login string) {
-		credentials.Login = login
-	})
+	var code string
+	form := tview.NewForm()
 
-	form.AddPasswordField("Password", "", 20, '*', func(password string) {
-		credentials.Password = password
+	form.AddInputField("Code", "", 20, nil, func(text string) {
+		code = text
 	})
 
-	form.AddPasswordField("Master Key", "", 20, '*', func(masterKey string) {
-		credentials.MasterKey = []byte(masterKey)
-	})
+	form.AddButton("Confirm", func() {
+		err := app.Client.ConfirmTOTP(code)
 
-	form.AddButton("Login", func() {
-		err := app.Client.Login(credentials)
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
 
-		if errors.Is(err, storage.ErrWrongCredentials) {
-			app.authPage("Wrong credentials. Please try again.")
+		if message, ok := lockoutMessage(err); ok {
+			app.totpEnrollPage(enrollment, message)
 			return
 		}
 
 		if errors.Is(err, handlers.ErrFieldIsEmpty) {
-			app.authPage("Some fields are empty.")
+			app.totpEnrollPage(enrollment, "Code is empty.")
 			return
 		}
 
-		if errors.Is(err, storage.ErrUnknown) || err != nil {
-			app.authPage("Something is wrong. Please try again later.")
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			app.totpEnrollPage(enrollment, "Wrong code.")
+			return
+		}
+
+		if err != nil {
+			app.totpEnrollPage(enrollment, "Something is wrong. Please try later.")
 			return
 		}
 
-		app.recordsInfoPage("Logged successfully.")
+		app.recordsInfoPage("Two-factor authentication enabled.")
 	})
 
-	form.AddButton("Register", func() {
-		err := app.Client.Register(credentials)
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewTextView().SetText(text).SetTextColor(tcell.ColorYellow), 0, 1, false).
+		AddItem(form, 5, 0, true)
 
-		if errors.Is(err, storage.ErrLoginExists) {
-			app.authPage("Such login exists. Please try again.")
-			return
+	frame := tview.NewFrame(flex).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Add secret to authenticator app and enter its code", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("ESC - return to the menu, secret stays not confirmed.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
 		}
+		return event
+	})
 
-		if errors.Is(err, handlers.ErrFieldIsEmpty) {
-			app.authPage("Some fields are empty.")
+	app.pages.AddPage("totpEnroll", frame, true, true)
+	app.pages.SwitchToPage("totpEnroll")
+}
+
+// masterKeyPage switches to page, where user changes master key. All records are sealed with new master key.
+func (app *TUI) masterKeyPage(message string) {
+	var oldMasterKey, newMasterKey, repeatMasterKey string
+
+	form := tview.NewForm()
+
+	form.AddPasswordField("Current master key", "", 20, '*', func(text string) {
+		oldMasterKey = text
+	})
+
+	form.AddPasswordField("New master key", "", 20, '*', func(text string) {
+		newMasterKey = text
+	})
+
+	form.AddPasswordField("Repeat new master key", "", 20, '*', func(text string) {
+		repeatMasterKey = text
+	})
+
+	form.AddButton("OK", func() {
+		if newMasterKey != repeatMasterKey {
+			app.masterKeyPage("New master keys don't match.")
 			return
 		}
 
-		if errors.Is(err, storage.ErrUnknown) || err != nil {
-			app.authPage("Something is wrong. Please try again later.")
+		if oldMasterKey == "" || newMasterKey == "" {
+			app.masterKeyPage("Master keys can't be empty.")
 			return
 		}
 
-		app.recordsInfoPage("Registered successfully.")
+		app.rotationPage([]byte(oldMasterKey), []byte(newMasterKey))
 	})
 
 	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Change master key", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("All records will be downloaded, sealed with new master key and uploaded back.", false, tview.AlignLeft, tcell.ColorWhite).
 		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the menu.", false, tview.AlignLeft, tcell.ColorWhite).
 		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
 
-	app.pages.AddPage("authentication", frame, true, true)
-	app.pages.SwitchToPage("authentication")
-}
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
 
-// recordInfoPage switches to page, where are all records shown. You can choose one.
-func (app *TUI) recordsInfoPage(message string) {
-	records, err := app.Client.GetRecordsInfo()
+	app.pages.AddPage("masterKey", frame, true, true)
+	app.pages.SwitchToPage("masterKey")
+}
 
-	if errors.Is(err, storage.ErrUserUnauthorized) {
-		app.authPage("Session expired. Please login again.")
-		return
-	}
+// rotationPage switches to page with progress of master key rotation and rotates it in background.
+func (app *TUI) rotationPage(oldMasterKey, newMasterKey []byte) {
+	progress := tview.NewTextView().SetText("Preparing records...")
 
-	if errors.Is(err, storage.ErrUnknown) || err != nil {
-		message = "Something is wrong. Please try later."
-		return
-	}
+	frame := tview.NewFrame(progress).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Changing master key", true, tview.AlignCenter, tcell.ColorGreen).
+		AddText("Please wait, vault isn't changed until all records are sealed.", false, tview.AlignLeft, tcell.ColorWhite)
 
-	list := tview.NewList()
+	app.pages.AddPage("rotation", frame, true, true)
+	app.pages.SwitchToPage("rotation")
 
-	for _, record := range records {
+	go func() {
+		err := app.Client.RotateMasterKey(oldMasterKey, newMasterKey, func(done, total int) {
+			app.QueueUpdateDraw(func() {
+				progress.SetText(fmt.Sprintf("Sealed %d of %d records.", done, total))
+			})
+		})
 
-		f := func(record entity.Record) func() {
-			return func() {
-				app.recordPage(record.ID, "")
+		app.QueueUpdateDraw(func() {
+			if errors.Is(err, storage.ErrUserUnauthorized) {
+				app.authPage("Session expired. Please login again.")
+				return
 			}
-		}(record)
-
-		if record.Metadata == "" {
-			record.Metadata = "no metadata"
-		}
 
-		list.AddItem(record.ID, record.Type.String()+" | "+record.Metadata, '*', f)
-	}
+			if errors.Is(err, handlers.ErrWrongMasterKey) {
+				app.masterKeyPage("Wrong current master key.")
+				return
+			}
 
-	listFrame := tview.NewFrame(list).SetBorders(0, 0, 0, 1, 4, 4).
-		AddText("Up/Down - switch between records | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
-		AddText("Ctrl+N - create new record       | Ctrl+U - refresh", false, tview.AlignLeft, tcell.ColorWhite).
-		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+			if errors.Is(err, storage.ErrRevisionConflict) || errors.Is(err, storage.ErrNotFound) {
+				app.masterKeyPage("Records were changed meanwhile. Please try again.")
+				return
+			}
 
-	listFrame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyCtrlN {
-			app.createRecordPage("")
-		}
-		if event.Key() == tcell.KeyCtrlU {
-			app.recordsInfoPage("Refreshed.")
-		}
-		return event
-	})
+			if err != nil {
+				app.masterKeyPage("Something is wrong. Master key isn't changed.")
+				return
+			}
 
-	app.pages.AddPage("records", listFrame, true, true)
-	app.pages.SwitchToPage("records")
+			app.recordsInfoPage("Master key changed.")
+		})
+	}()
 }
 
 // recordPage switches to record page, where you can see decrypted record data, copy this data, or delete record.
@@ -175,6 +1000,11 @@ func (app *TUI) recordPage(recordID string, message string) {
 		return
 	}
 
+	if errors.Is(err, handlers.ErrLegacyRecords) {
+		app.legacyRecordsPage("This record was saved by old client version.")
+		return
+	}
+
 	if err != nil {
 		app.recordsInfoPage("Failed get record.")
 		return
@@ -186,7 +1016,7 @@ func (app *TUI) recordPage(recordID string, message string) {
 
 	frame := tview.NewFrame(tview.NewTextView().SetText(string(record.Data)).SetTextColor(tcell.ColorYellow).SetDisabled(true)).SetBorders(0, 0, 0, 1, 4, 4).
 		AddText(record.Metadata+" | "+record.Type.String(), true, tview.AlignCenter, tcell.ColorGreen).
-		AddText("Ctrl+K - copy | Ctrl+U - delete | ESC - return to the menu", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+K - copy | Ctrl+E - edit | Ctrl+U - delete | ESC - return to the menu", false, tview.AlignLeft, tcell.ColorWhite).
 		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
 
 	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -198,6 +1028,9 @@ func (app *TUI) recordPage(recordID string, message string) {
 			app.recordPage(recordID, "Copied successfully.")
 			clipboard.Write(clipboard.FmtText, record.Data)
 		}
+		if event.Key() == tcell.KeyCtrlE {
+			app.editRecordPage(record)
+		}
 		if event.Key() == tcell.KeyCtrlU {
 			err := app.Client.DeleteRecord(recordID)
 
@@ -231,6 +1064,92 @@ func (app *TUI) recordPage(recordID string, message string) {
 	app.pages.SwitchToPage("record")
 }
 
+// editRecordPage switches to page, where you can change text or credentials record.
+func (app *TUI) editRecordPage(record entity.Record) {
+	if record.Metadata == "no metadata" {
+		record.Metadata = ""
+	}
+
+	form := tview.NewForm()
+
+	switch record.Type {
+	case entity.TypeText:
+		form.AddTextArea("Text", string(record.Data), 30, 5, 0, func(text string) {
+			record.Data = []byte(text)
+		})
+	case entity.TypeLoginAndPassword:
+		loginAndPassword := entity.LoginAndPassword{}
+		loginAndPassword.Login, loginAndPassword.Password, _ = strings.Cut(string(record.Data), ":")
+
+		form.AddInputField("Login", loginAndPassword.Login, 20, nil, func(text string) {
+			loginAndPassword.Login = text
+			record.Data, _ = loginAndPassword.Bytes()
+		})
+
+		form.AddInputField("Password", loginAndPassword.Password, 20, nil, func(text string) {
+			loginAndPassword.Password = text
+			record.Data, _ = loginAndPassword.Bytes()
+		})
+	default:
+		app.recordPage(record.ID, "Editing is not supported for this record type.")
+		return
+	}
+
+	form.AddInputField("Metadata", record.Metadata, 20, nil, func(text string) {
+		record.Metadata = text
+	})
+
+	form.AddButton("OK", func() {
+		_, err := app.Client.UpdateRecord(record)
+
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			app.authPage("Session expired. Please login again.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrRevisionConflict) {
+			app.recordPage(record.ID, "Record was changed on another device. Check it and try again.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrNotFound) {
+			app.recordsInfoPage("Not found this record.")
+			return
+		}
+
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			app.recordPage(record.ID, "Record is larger than storage quota allows.")
+			return
+		}
+
+		if errors.Is(err, handlers.ErrWrongMasterKey) {
+			app.authPage("Wrong master key. Please login again.")
+			return
+		}
+
+		if err != nil {
+			app.recordPage(record.ID, "Something is wrong. Please try later.")
+			return
+		}
+
+		app.recordPage(record.ID, "Updated record successfully.")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - return to the record.", false, tview.AlignLeft, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordPage(record.ID, "")
+		}
+		return event
+	})
+
+	app.pages.AddPage("editRecord", frame, true, true)
+	app.pages.SwitchToPage("editRecord")
+}
+
 // createTextRecord creates new text record.
 func (app *TUI) createTextRecord() {
 	record := entity.Record{Type: entity.TypeText}
@@ -252,6 +1171,11 @@ func (app *TUI) createTextRecord() {
 			return
 		}
 
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			app.recordsInfoPage("Storage quota exceeded. Delete some records first.")
+			return
+		}
+
 		if errors.Is(err, storage.ErrUnknown) {
 			app.recordsInfoPage("Something is wrong. Please try later.")
 			return
@@ -308,6 +1232,11 @@ func (app *TUI) createCredentialsRecord() {
 			return
 		}
 
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			app.recordsInfoPage("Storage quota exceeded. Delete some records first.")
+			return
+		}
+
 		if errors.Is(err, storage.ErrUnknown) {
 			app.recordsInfoPage("Something is wrong. Please try later.")
 			return
@@ -399,6 +1328,11 @@ func (app *TUI) createCardRecord() {
 			return
 		}
 
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			app.recordsInfoPage("Storage quota exceeded. Delete some records first.")
+			return
+		}
+
 		if errors.Is(err, storage.ErrUnknown) {
 			app.recordsInfoPage("Something is wrong. Please try later.")
 			return
@@ -442,21 +1376,25 @@ func (app *TUI) createFileRecord() {
 		filename := path.Base(file.FilePath)
 		record.Metadata = filename
 
-		data, err := file.Bytes()
+		f, err := os.Open(file.FilePath)
 		if err != nil {
 			app.recordsInfoPage("Failed opened file.")
 			return
 		}
+		defer f.Close()
 
-		record.Data = data
-
-		err = app.Client.CreateRecord(record)
+		err = app.Client.UploadFile(record, f)
 
 		if errors.Is(err, storage.ErrUserUnauthorized) {
 			app.authPage("Session expired. Please login again.")
 			return
 		}
 
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			app.recordsInfoPage("Storage quota exceeded. Delete some records first.")
+			return
+		}
+
 		if errors.Is(err, storage.ErrUnknown) {
 			app.recordsInfoPage("Something is wrong. Please try later.")
 			return
@@ -517,3 +1455,112 @@ func (app *TUI) createRecordPage(message string) {
 	app.pages.AddPage("create", frame, true, true)
 	app.pages.SwitchToPage("create")
 }
+
+// searchPage creates page, where you can set filters and order of records.
+func (app *TUI) searchPage(message string) {
+	query := entity.RecordsQuery{}
+	form := tview.NewForm()
+
+	form.AddInputField("Metadata contains", "", 20, nil, func(metadata string) {
+		query.Metadata = metadata
+	})
+
+	types := []entity.RecordType{entity.TypeText, entity.TypeLoginAndPassword, entity.TypeCreditCard, entity.TypeFile}
+	typeOptions := []string{"Any"}
+	for _, recordType := range types {
+		typeOptions = append(typeOptions, recordType.String())
+	}
+
+	form.AddDropDown("Type", typeOptions, 0, func(option string, optionIndex int) {
+		query.Types = nil
+		if optionIndex > 0 {
+			query.Types = []entity.RecordType{types[optionIndex-1]}
+		}
+	})
+
+	sorts := []entity.RecordsSort{entity.SortByMetadata, entity.SortByMetadataDesc, entity.SortByRevisionDesc, entity.SortByRevision}
+	form.AddDropDown("Order", []string{"Metadata A-Z", "Metadata Z-A", "Recently changed first", "Recently changed last"}, 0, func(option string, optionIndex int) {
+		if optionIndex >= 0 {
+			query.Sort = sorts[optionIndex]
+		}
+	})
+
+	form.AddButton("Search", func() {
+		app.searchResultsPage(query, "")
+	})
+
+	frame := tview.NewFrame(form).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("TAB - switch between fields | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("ESC - exit to all records.", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("search", frame, true, true)
+	app.pages.SwitchToPage("search")
+}
+
+// searchResultsPage switches to page with one page of found records. Last item of list opens next page.
+func (app *TUI) searchResultsPage(query entity.RecordsQuery, message string) {
+	page, err := app.Client.GetRecordsInfo(query)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		app.authPage("Session expired. Please login again.")
+		return
+	}
+
+	if err != nil {
+		app.searchPage("Something is wrong. Please try later.")
+		return
+	}
+
+	list := tview.NewList()
+
+	for _, record := range page.Records {
+		f := func(record entity.Record) func() {
+			return func() {
+				app.recordPage(record.ID, "")
+			}
+		}(record)
+
+		if record.Metadata == "" {
+			record.Metadata = "no metadata"
+		}
+
+		list.AddItem(record.ID, record.Type.String()+" | "+record.Metadata, '*', f)
+	}
+
+	if page.NextPageToken != "" {
+		list.AddItem("Next page", "", '>', func() {
+			query.PageToken = page.NextPageToken
+			app.searchResultsPage(query, "")
+		})
+	}
+
+	if len(page.Records) == 0 {
+		message = "Nothing found."
+	}
+
+	frame := tview.NewFrame(list).SetBorders(0, 0, 0, 1, 4, 4).
+		AddText("Up/Down - switch between records | Enter - choose this option", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText("Ctrl+F - new search              | ESC - exit to all records", false, tview.AlignLeft, tcell.ColorWhite).
+		AddText(message, false, tview.AlignRight, tcell.ColorWhite)
+
+	frame.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlF {
+			app.searchPage("")
+		}
+		if event.Key() == tcell.KeyESC {
+			app.recordsInfoPage("Returned to menu.")
+		}
+		return event
+	})
+
+	app.pages.AddPage("searchResults", frame, true, true)
+	app.pages.SwitchToPage("searchResults")
+}
@@ -1,13 +1,80 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Client struct for client config.
 type Client struct {
 	ServerAddress string
+	// TLSCAFile is CA to verify server certificate. Without CA and pin client connects without TLS.
+	TLSCAFile string
+	// TLSServerPin is hex SHA-256 of server certificate, it's checked instead of CA verification if CA isn't set.
+	TLSServerPin string
+	// TLSCertFile and TLSKeyFile are client certificate and key for mTLS authentication.
+	TLSCertFile string
+	TLSKeyFile  string
+	// AuthMethod is "password" or "srp". With "srp" password isn't sent to server, user should be registered with it.
+	AuthMethod string
 }
 
-// GetClientConfig gets client config.
+// GetClientConfig gets default client config.
 func GetClientConfig() Client {
 	return Client{
 		ServerAddress: ":3200",
+		AuthMethod:    "password",
+	}
+}
+
+// LoadClientConfig loads client config from config file, environment variables and args. Config is validated.
+func LoadClientConfig(args []string) (Client, error) {
+	cfg := GetClientConfig()
+
+	err := load("client", args, cfg.options())
+	if err != nil {
+		return Client{}, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Client{}, err
+	}
+
+	return cfg, nil
+}
+
+// options returns options of client config.
+func (cfg *Client) options() []option {
+	return []option{
+		stringOption("server_address", &cfg.ServerAddress, "address of gRPC server"),
+		stringOption("tls_ca_file", &cfg.TLSCAFile, "CA of server certificate in PEM"),
+		stringOption("tls_server_pin", &cfg.TLSServerPin, "hex SHA-256 of server certificate"),
+		stringOption("tls_cert_file", &cfg.TLSCertFile, "client certificate in PEM"),
+		stringOption("tls_key_file", &cfg.TLSKeyFile, "client key in PEM"),
+		stringOption("auth_method", &cfg.AuthMethod, `authentication method: "password" or "srp"`),
 	}
 }
+
+// Validate returns all errors of client config.
+func (cfg Client) Validate() error {
+	var errs []error
+
+	if cfg.ServerAddress == "" {
+		errs = append(errs, errors.New("server_address is required"))
+	}
+
+	if cfg.AuthMethod != "password" && cfg.AuthMethod != "srp" {
+		errs = append(errs, fmt.Errorf(`auth_method should be "password" or "srp", got %q`, cfg.AuthMethod))
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file should be set together"))
+	}
+
+	if cfg.TLSCertFile != "" && cfg.TLSCAFile == "" && cfg.TLSServerPin == "" {
+		errs = append(errs, errors.New("tls_cert_file requires tls_ca_file or tls_server_pin"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,3 +19,221 @@ func TestGetServerConfig(t *testing.T) {
 	cfg := GetServerConfig()
 	assert.NotEmpty(t, cfg)
 }
+
+func TestLoadServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	secret := strings.Repeat("s", minJWTSecretLength)
+
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	tc := []struct {
+		name  string
+		env   map[string]string
+		args  func() []string
+		valid func(cfg Server, err error)
+	}{
+		{
+			"Load config from flags",
+			nil,
+			func() []string {
+				return []string{"-db-url", "postgres://db", "-jwt-secret", secret, "-reflection", "-access-token-ttl", "5m"}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "postgres://db", cfg.DBConnectionURL)
+				assert.Equal(t, secret, cfg.JWTSecret)
+				assert.True(t, cfg.Reflection)
+				assert.Equal(t, 5*time.Minute, cfg.AccessTokenTTL)
+				assert.Equal(t, ":3200", cfg.RunAddress)
+			},
+		},
+		{
+			"Flag overrides environment variable, which overrides YAML file",
+			map[string]string{"GOPHKEEPER_RUN_ADDRESS": ":4000", "GOPHKEEPER_FILES_DIRECTORY": "env-files"},
+			func() []string {
+				path := writeFile("server.yaml", "db_url: postgres://file\njwt_secret: "+secret+"\nrun_address: :5000\nfiles_directory: file-files\nmetrics_address: :7000\nrefresh_token_ttl: 48h\n")
+				return []string{"-config", path, "-run-address", ":3000"}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "postgres://file", cfg.DBConnectionURL)
+				assert.Equal(t, ":3000", cfg.RunAddress)
+				assert.Equal(t, "env-files", cfg.FilesDirectory)
+				assert.Equal(t, ":7000", cfg.MetricsAddress)
+				assert.Equal(t, 48*time.Hour, cfg.RefreshTokenTTL)
+			},
+		},
+		{
+			"Load JSON file from environment variable",
+			map[string]string{},
+			func() []string {
+				path := writeFile("server.json", `{"db_url": "postgres://json", "jwt_secret": "`+secret+`", "reflection": true, "quota_bytes": 1073741824}`)
+				t.Setenv("GOPHKEEPER_CONFIG", path)
+				return nil
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "postgres://json", cfg.DBConnectionURL)
+				assert.True(t, cfg.Reflection)
+				assert.Equal(t, int64(1073741824), cfg.QuotaBytes)
+			},
+		},
+		{
+			"Load signing key files from YAML list",
+			nil,
+			func() []string {
+				path := writeFile("keys.yaml", "db_url: postgres://db\njwt_key_file: current.pem\njwt_previous_key_files:\n  - old.pem\n  - older.pem\n")
+				return []string{"-config", path}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "current.pem", cfg.JWTKeyFile)
+				assert.Empty(t, cfg.JWTSecret)
+				assert.Equal(t, []string{"old.pem", "older.pem"}, cfg.PreviousKeyFiles())
+			},
+		},
+		{
+			"Load config without signing key",
+			nil,
+			func() []string {
+				return []string{"-db-url", "postgres://db"}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, "jwt_secret or jwt_key_file is required")
+			},
+		},
+		{
+			"Load SRP salt secret",
+			nil,
+			func() []string {
+				return []string{"-db-url", "postgres://db", "-jwt-secret", secret, "-srp-salt-secret", "short"}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, "srp_salt_secret should have at least")
+			},
+		},
+		{
+			"Use JWT secret as SRP salt key without SRP salt secret",
+			nil,
+			func() []string {
+				return []string{"-db-url", "postgres://db", "-jwt-secret", secret}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []byte(secret), cfg.SRPSaltKey())
+			},
+		},
+		{
+			"Load SQLite database URL",
+			nil,
+			func() []string {
+				return []string{"-db-url", "sqlite://data/gophkeeper.db", "-jwt-secret", secret}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				path, ok := cfg.SQLitePath()
+				assert.True(t, ok)
+				assert.Equal(t, "data/gophkeeper.db", path)
+			},
+		},
+		{
+			"Load SQLite database URL with postgres backends",
+			nil,
+			func() []string {
+				return []string{"-db-url", "sqlite://", "-jwt-secret", secret, "-events-backend", "postgres"}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, "should have path to SQLite database file")
+				assert.ErrorContains(t, err, `can't be "postgres" with SQLite database`)
+			},
+		},
+		{
+			"Load dev mode without DB and signing key",
+			nil,
+			func() []string {
+				return []string{"--dev"}
+			},
+			func(cfg Server, err error) {
+				assert.NoError(t, err)
+				assert.True(t, cfg.Dev)
+				assert.Empty(t, cfg.DBConnectionURL)
+			},
+		},
+		{
+			"Load dev mode with postgres backend",
+			nil,
+			func() []string {
+				return []string{"--dev", "-login-limit-backend", "postgres"}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, `can't be "postgres" in dev mode`)
+			},
+		},
+		{
+			"Load file with unknown option",
+			nil,
+			func() []string {
+				return []string{"-config", writeFile("typo.yaml", "db_ulr: postgres://db\n")}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, `unknown option "db_ulr"`)
+			},
+		},
+		{
+			"Load bad duration from environment variable",
+			map[string]string{"GOPHKEEPER_ACCESS_TOKEN_TTL": "soon"},
+			func() []string {
+				return []string{"-db-url", "postgres://db", "-jwt-secret", secret}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, "GOPHKEEPER_ACCESS_TOKEN_TTL")
+			},
+		},
+		{
+			"Load invalid config",
+			nil,
+			func() []string {
+				return []string{"-jwt-secret", "short", "-events-backend", "redis", "-tls-cert-file", "cert.pem"}
+			},
+			func(cfg Server, err error) {
+				assert.ErrorContains(t, err, "db_url is required")
+				assert.ErrorContains(t, err, "jwt_secret should have at least")
+				assert.ErrorContains(t, err, "events_backend")
+				assert.ErrorContains(t, err, "tls_cert_file and tls_key_file should be set together")
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		t.Setenv("GOPHKEEPER_CONFIG", "")
+		for key, value := range test.env {
+			t.Setenv(key, value)
+		}
+
+		cfg, err := LoadServerConfig(test.args())
+		test.valid(cfg, err)
+
+		for key := range test.env {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	t.Setenv("GOPHKEEPER_CONFIG", "")
+	t.Setenv("GOPHKEEPER_AUTH_METHOD", "srp")
+
+	cfg, err := LoadClientConfig([]string{"-server-address", "keeper.example.com:3200"})
+	assert.NoError(t, err)
+	assert.Equal(t, "keeper.example.com:3200", cfg.ServerAddress)
+	assert.Equal(t, "srp", cfg.AuthMethod)
+
+	_, err = LoadClientConfig([]string{"-auth-method", "token", "-tls-cert-file", "cert.pem", "-tls-key-file", "key.pem"})
+	assert.ErrorContains(t, err, "auth_method")
+	assert.ErrorContains(t, err, "tls_cert_file requires tls_ca_file or tls_server_pin")
+}
@@ -0,0 +1,292 @@
+// Package config loads configs of server and client.
+//
+// Each option is set by config file, environment variable or command-line flag. Later source overrides earlier one:
+// default value, config file, environment variable, flag. For example, option "run_address" is key "run_address"
+// in file, environment variable GOPHKEEPER_RUN_ADDRESS and flag -run-address.
+//
+// Config file is YAML or JSON by its extension, it's set by flag -config or environment variable GOPHKEEPER_CONFIG.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is prefix of environment variables of options.
+const envPrefix = "GOPHKEEPER_"
+
+// configFileEnv is environment variable with path to config file.
+const configFileEnv = envPrefix + "CONFIG"
+
+// option is config field, which can be set by file, environment variable and flag.
+type option struct {
+	key   string
+	usage string
+	value flag.Value
+	// isBool makes flag work without value, like -reflection.
+	isBool bool
+}
+
+// flagName returns name of flag of option.
+func (opt option) flagName() string {
+	return strings.ReplaceAll(opt.key, "_", "-")
+}
+
+// envName returns name of environment variable of option.
+func (opt option) envName() string {
+	return envPrefix + strings.ToUpper(opt.key)
+}
+
+// stringOption returns option of string field.
+func stringOption(key string, field *string, usage string) option {
+	return option{key: key, usage: usage, value: (*stringValue)(field)}
+}
+
+// boolOption returns option of bool field.
+func boolOption(key string, field *bool, usage string) option {
+	return option{key: key, usage: usage, value: (*boolValue)(field), isBool: true}
+}
+
+// int64Option returns option of int64 field.
+func int64Option(key string, field *int64, usage string) option {
+	return option{key: key, usage: usage, value: (*int64Value)(field)}
+}
+
+// durationOption returns option of duration field.
+func durationOption(key string, field *time.Duration, usage string) option {
+	return option{key: key, usage: usage, value: (*durationValue)(field)}
+}
+
+// load sets options from config file, environment variables and args. Args are parsed as flags of command name.
+func load(name string, args []string, options []option) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv(configFileEnv), "path to YAML or JSON config file, also "+configFileEnv)
+
+	set := make(map[string]string)
+	for _, opt := range options {
+		flags.Var(&flagValue{option: opt, set: set}, opt.flagName(), fmt.Sprintf("%s, also %s", opt.usage, opt.envName()))
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *configFile != "" {
+		err = loadFile(*configFile, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := os.LookupEnv(opt.envName())
+		if !ok {
+			continue
+		}
+
+		err = opt.value.Set(value)
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", opt.envName(), err)
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := set[opt.key]
+		if !ok {
+			continue
+		}
+
+		err = opt.value.Set(value)
+		if err != nil {
+			return fmt.Errorf("flag -%s: %w", opt.flagName(), err)
+		}
+	}
+
+	return nil
+}
+
+// loadFile sets options from YAML or JSON file. Unknown keys are errors, so typos aren't ignored.
+func loadFile(path string, options []option) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: extension should be .yaml, .yml or .json", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]option, len(options))
+	for _, opt := range options {
+		byKey[opt.key] = opt
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		value := values[key]
+		opt, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("config file %s: unknown option %q", path, key))
+			continue
+		}
+
+		s, ok := fileValue(value)
+		if !ok {
+			errs = append(errs, fmt.Errorf("config file %s: option %q should be string, number, bool or list of them", path, key))
+			continue
+		}
+
+		err = opt.value.Set(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file %s: option %q: %w", path, key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fileValue returns value of option from config file as string. List is joined by comma like value of flag.
+func fileValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string, bool, int:
+		return fmt.Sprint(value), true
+	case float64:
+		// JSON numbers are float64, big ones shouldn't become like 1e+09.
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := fileValue(item)
+			if !ok || strings.Contains(s, ",") {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), true
+	default:
+		return "", false
+	}
+}
+
+// flagValue is flag of option. Value of flag is saved and set after config file and environment variables.
+type flagValue struct {
+	option
+	set map[string]string
+}
+
+// Set saves value of flag.
+func (value *flagValue) Set(s string) error {
+	value.set[value.key] = s
+	return nil
+}
+
+// String returns default value of option.
+func (value *flagValue) String() string {
+	if value.option.value == nil {
+		return ""
+	}
+	return value.option.value.String()
+}
+
+// IsBoolFlag makes bool flag work without value.
+func (value *flagValue) IsBoolFlag() bool {
+	return value.isBool
+}
+
+// stringValue is flag.Value of string field.
+type stringValue string
+
+// Set sets field.
+func (value *stringValue) Set(s string) error {
+	*value = stringValue(s)
+	return nil
+}
+
+// String returns field.
+func (value *stringValue) String() string {
+	return string(*value)
+}
+
+// boolValue is flag.Value of bool field.
+type boolValue bool
+
+// Set parses field like "true" or "0".
+func (value *boolValue) Set(s string) error {
+	parsed, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("bad bool %q", s)
+	}
+
+	*value = boolValue(parsed)
+	return nil
+}
+
+// String returns field.
+func (value *boolValue) String() string {
+	return strconv.FormatBool(bool(*value))
+}
+
+// int64Value is flag.Value of int64 field.
+type int64Value int64
+
+// Set parses field like "1048576".
+func (value *int64Value) Set(s string) error {
+	parsed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad integer %q", s)
+	}
+
+	*value = int64Value(parsed)
+	return nil
+}
+
+// String returns field.
+func (value *int64Value) String() string {
+	return strconv.FormatInt(int64(*value), 10)
+}
+
+// durationValue is flag.Value of duration field.
+type durationValue time.Duration
+
+// Set parses field like "15m" or "720h".
+func (value *durationValue) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("bad duration %q", s)
+	}
+
+	*value = durationValue(parsed)
+	return nil
+}
+
+// String returns field.
+func (value *durationValue) String() string {
+	return time.Duration(*value).String()
+}
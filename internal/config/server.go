@@ -1,17 +1,241 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// minJWTSecretLength is minimal length of JWT secret. HS256 key shouldn't be shorter than hash.
+const minJWTSecretLength = 32
+
 // Server struct for server config.
 type Server struct {
-	RunAddress      string
+	RunAddress string
+	// DBConnectionURL is PostgreSQL connection URL or path to SQLite database file with scheme "sqlite://".
 	DBConnectionURL string
 	FilesDirectory  string
+	// EventsBackend is "memory" for single server or "postgres" to share record events between server instances.
+	EventsBackend string
+	// LoginLimitBackend is "memory" for single server or "postgres" to share failed login attempts between server instances.
+	LoginLimitBackend string
+	// TLSCertFile and TLSKeyFile are server certificate and key in PEM. Without them server runs without TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile is CA for client certificates. If set, users can authenticate by certificate with login in common name.
+	TLSClientCAFile string
+	// Reflection enables gRPC server reflection, so server can be explored by grpcurl.
+	Reflection bool
+	// MetricsAddress is address of HTTP server with Prometheus metrics on /metrics. Empty address disables it.
+	MetricsAddress string
+	// LogLevel is minimal level of server logs: "debug", "info", "warn" or "error".
+	LogLevel string
+	// JWTSecret is HMAC key, which signs access tokens. It should be same on all server instances.
+	JWTSecret string
+	// JWTKeyFile is Ed25519 or ECDSA P-256 private key in PEM, which signs access tokens instead of JWTSecret.
+	// Other services verify such tokens by public key from GetSigningKeys.
+	JWTKeyFile string
+	// JWTPreviousSecret and JWTPreviousKeyFiles are keys before rotation. They only verify tokens, which were signed by them.
+	// JWTPreviousKeyFiles is comma-separated list of PEM files with private or public keys.
+	JWTPreviousSecret   string
+	JWTPreviousKeyFiles string
+	// SRPSaltSecret is HMAC key of fake SRP salts of unknown logins. It should be same on all server instances
+	// and shouldn't change, otherwise fake salts change and show, that logins don't exist. JWTSecret is used without it.
+	SRPSaltSecret string
+	// AccessTokenTTL and RefreshTokenTTL are lifetimes of tokens of user session.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// QuotaBytes, QuotaRecords and QuotaRecordSize limit total size of records data, count of records and size
+	// of one record of each user. Zero doesn't limit.
+	QuotaBytes      int64
+	QuotaRecords    int64
+	QuotaRecordSize int64
+	// TombstoneRetention is how long tombstones of deleted records are kept for sync. Clients, which didn't sync
+	// for longer, list all records again.
+	TombstoneRetention time.Duration
+	// Dev runs server with in-memory storage without DB and files directory. Data is lost on exit.
+	// Without JWTSecret and JWTKeyFile random secret is generated.
+	Dev bool
 }
 
-// GetServerConfig gets server config.
+// GetServerConfig gets default server config.
 func GetServerConfig() Server {
 	return Server{
-		RunAddress:      ":3200",
-		DBConnectionURL: "",
-		FilesDirectory:  "files",
+		RunAddress:        ":3200",
+		DBConnectionURL:   "",
+		FilesDirectory:    "files",
+		EventsBackend:     "memory",
+		LoginLimitBackend: "memory",
+		MetricsAddress:    ":9090",
+		LogLevel:          "info",
+		AccessTokenTTL:    15 * time.Minute,
+		RefreshTokenTTL:   30 * 24 * time.Hour,
+		// Tombstones are kept as long as refresh tokens, so client, which keeps session, usually syncs only changes.
+		TombstoneRetention: 30 * 24 * time.Hour,
+	}
+}
+
+// SRPSaltKey returns key of fake SRP salts: SRPSaltSecret or JWTSecret without it. Empty key means, that key isn't configured.
+func (cfg Server) SRPSaltKey() []byte {
+	if cfg.SRPSaltSecret != "" {
+		return []byte(cfg.SRPSaltSecret)
+	}
+	return []byte(cfg.JWTSecret)
+}
+
+// PreviousKeyFiles returns list of JWTPreviousKeyFiles.
+func (cfg Server) PreviousKeyFiles() []string {
+	var files []string
+	for _, file := range strings.Split(cfg.JWTPreviousKeyFiles, ",") {
+		file = strings.TrimSpace(file)
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// sqliteScheme is scheme of db_url, which selects SQLite database.
+const sqliteScheme = "sqlite://"
+
+// SQLitePath returns path to SQLite database file, if DBConnectionURL has scheme "sqlite://".
+func (cfg Server) SQLitePath() (string, bool) {
+	if !strings.HasPrefix(cfg.DBConnectionURL, sqliteScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(cfg.DBConnectionURL, sqliteScheme), true
+}
+
+// LoadServerConfig loads server config from config file, environment variables and args. Config is validated.
+func LoadServerConfig(args []string) (Server, error) {
+	cfg := GetServerConfig()
+
+	err := load("server", args, cfg.options())
+	if err != nil {
+		return Server{}, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Server{}, err
+	}
+
+	return cfg, nil
+}
+
+// options returns options of server config.
+func (cfg *Server) options() []option {
+	return []option{
+		stringOption("run_address", &cfg.RunAddress, "address of gRPC server"),
+		stringOption("db_url", &cfg.DBConnectionURL, "PostgreSQL connection URL or sqlite://path to SQLite database file"),
+		stringOption("files_directory", &cfg.FilesDirectory, "directory of file records"),
+		stringOption("events_backend", &cfg.EventsBackend, `record events backend: "memory" or "postgres"`),
+		stringOption("login_limit_backend", &cfg.LoginLimitBackend, `failed logins backend: "memory" or "postgres"`),
+		stringOption("tls_cert_file", &cfg.TLSCertFile, "server certificate in PEM"),
+		stringOption("tls_key_file", &cfg.TLSKeyFile, "server key in PEM"),
+		stringOption("tls_client_ca_file", &cfg.TLSClientCAFile, "CA of client certificates in PEM"),
+		boolOption("reflection", &cfg.Reflection, "enable gRPC server reflection"),
+		stringOption("metrics_address", &cfg.MetricsAddress, "address of metrics HTTP server, empty disables it"),
+		stringOption("log_level", &cfg.LogLevel, `log level: "debug", "info", "warn" or "error"`),
+		stringOption("jwt_secret", &cfg.JWTSecret, fmt.Sprintf("key of access tokens, at least %d characters", minJWTSecretLength)),
+		stringOption("jwt_key_file", &cfg.JWTKeyFile, "Ed25519 or ECDSA P-256 private key of access tokens in PEM, used instead of jwt_secret"),
+		stringOption("jwt_previous_secret", &cfg.JWTPreviousSecret, "previous key of access tokens, which only verifies them"),
+		stringOption("jwt_previous_key_files", &cfg.JWTPreviousKeyFiles, "comma-separated previous keys of access tokens in PEM, which only verify them"),
+		stringOption("srp_salt_secret", &cfg.SRPSaltSecret, fmt.Sprintf("key of fake SRP salts of unknown logins, at least %d characters, jwt_secret by default", minJWTSecretLength)),
+		durationOption("access_token_ttl", &cfg.AccessTokenTTL, "lifetime of access token"),
+		durationOption("refresh_token_ttl", &cfg.RefreshTokenTTL, "lifetime of refresh token"),
+		int64Option("quota_bytes", &cfg.QuotaBytes, "total size of records of user in bytes, 0 doesn't limit"),
+		int64Option("quota_records", &cfg.QuotaRecords, "count of records of user, 0 doesn't limit"),
+		int64Option("quota_record_size", &cfg.QuotaRecordSize, "size of one record in bytes, 0 doesn't limit"),
+		durationOption("tombstone_retention", &cfg.TombstoneRetention, "how long deleted records are kept for sync of clients"),
+		boolOption("dev", &cfg.Dev, "development mode with in-memory storage, data is lost on exit"),
+	}
+}
+
+// Validate returns all errors of server config.
+func (cfg Server) Validate() error {
+	var errs []error
+
+	if cfg.RunAddress == "" {
+		errs = append(errs, errors.New("run_address is required"))
+	}
+
+	if cfg.DBConnectionURL == "" && !cfg.Dev {
+		errs = append(errs, errors.New("db_url is required"))
+	}
+
+	if path, ok := cfg.SQLitePath(); ok {
+		if path == "" {
+			errs = append(errs, errors.New("db_url should have path to SQLite database file after sqlite://"))
+		}
+
+		if cfg.EventsBackend == "postgres" || cfg.LoginLimitBackend == "postgres" {
+			errs = append(errs, errors.New(`events_backend and login_limit_backend can't be "postgres" with SQLite database`))
+		}
 	}
+
+	if cfg.Dev && (cfg.EventsBackend == "postgres" || cfg.LoginLimitBackend == "postgres") {
+		errs = append(errs, errors.New(`events_backend and login_limit_backend can't be "postgres" in dev mode`))
+	}
+
+	if cfg.FilesDirectory == "" {
+		errs = append(errs, errors.New("files_directory is required"))
+	}
+
+	if cfg.EventsBackend != "memory" && cfg.EventsBackend != "postgres" {
+		errs = append(errs, fmt.Errorf(`events_backend should be "memory" or "postgres", got %q`, cfg.EventsBackend))
+	}
+
+	if cfg.LoginLimitBackend != "memory" && cfg.LoginLimitBackend != "postgres" {
+		errs = append(errs, fmt.Errorf(`login_limit_backend should be "memory" or "postgres", got %q`, cfg.LoginLimitBackend))
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file should be set together"))
+	}
+
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		errs = append(errs, errors.New("tls_client_ca_file requires tls_cert_file"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level %q is unknown", cfg.LogLevel))
+	}
+
+	if cfg.JWTSecret == "" && cfg.JWTKeyFile == "" && !cfg.Dev {
+		errs = append(errs, errors.New("jwt_secret or jwt_key_file is required"))
+	}
+
+	if cfg.JWTSecret != "" && len(cfg.JWTSecret) < minJWTSecretLength {
+		errs = append(errs, fmt.Errorf("jwt_secret should have at least %d characters", minJWTSecretLength))
+	}
+
+	if cfg.JWTPreviousSecret != "" && len(cfg.JWTPreviousSecret) < minJWTSecretLength {
+		errs = append(errs, fmt.Errorf("jwt_previous_secret should have at least %d characters", minJWTSecretLength))
+	}
+
+	if cfg.SRPSaltSecret != "" && len(cfg.SRPSaltSecret) < minJWTSecretLength {
+		errs = append(errs, fmt.Errorf("srp_salt_secret should have at least %d characters", minJWTSecretLength))
+	}
+
+	if cfg.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("access_token_ttl should be positive"))
+	}
+
+	if cfg.RefreshTokenTTL < cfg.AccessTokenTTL {
+		errs = append(errs, errors.New("refresh_token_ttl shouldn't be shorter than access_token_ttl"))
+	}
+
+	if cfg.QuotaBytes < 0 || cfg.QuotaRecords < 0 || cfg.QuotaRecordSize < 0 {
+		errs = append(errs, errors.New("quota_bytes, quota_records and quota_record_size shouldn't be negative"))
+	}
+
+	if cfg.TombstoneRetention <= 0 {
+		errs = append(errs, errors.New("tombstone_retention should be positive"))
+	}
+
+	return errors.Join(errs...)
 }
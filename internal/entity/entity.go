@@ -1,8 +1,10 @@
 package entity
 
 import (
+	"context"
 	"io"
 	"os"
+	"time"
 )
 
 // UserCredentials struct for user authorization.
@@ -18,12 +20,273 @@ type UserID string
 // AuthToken is authorization token of user. Should store userID.
 type AuthToken string
 
+// Algorithms of stored password hashes.
+const (
+	// PasswordSHA256 is legacy hex SHA-256 of login and password. It's upgraded on login.
+	PasswordSHA256 = "sha256"
+	// PasswordArgon2id is Argon2id hash with salt and parameters in PHC string format.
+	PasswordArgon2id = "argon2id"
+	// PasswordSRP6a is SRP-6a salt and verifier. Password of such user is never sent to server.
+	PasswordSRP6a = "srp6a"
+)
+
+// SRPVerifier is SRP-6a salt and verifier of password, which client sends on registration.
+type SRPVerifier struct {
+	Salt     []byte
+	Verifier []byte
+}
+
+// SRPChallenge is answer of server to first step of SRP-6a login.
+type SRPChallenge struct {
+	LoginID         string
+	Salt            []byte
+	ServerPublicKey []byte
+}
+
+// SRPProof is proof of password of logged in user by SRP-6a handshake, which was started by StartLoginSRP.
+type SRPProof struct {
+	LoginID     string
+	ClientProof []byte
+}
+
+// StoredPassword is password hash of user, which is stored by server.
+type StoredPassword struct {
+	UserID    UserID
+	Hash      string
+	Algorithm string
+}
+
+// Session is issued to user after login. Access token is short-lived, refresh token gets new session.
+// If TOTPRequired is set, access token only allows to finish login by TOTP code and there is no refresh token.
+type Session struct {
+	AccessToken  AuthToken
+	RefreshToken string
+	ExpiresAt    time.Time
+	TOTPRequired bool
+}
+
+// TOTP is TOTP secret of user. Login requires code only after secret was confirmed.
+// LastStep is time step of the last accepted code, codes of it and earlier steps are rejected.
+type TOTP struct {
+	UserID    UserID
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+// TOTPEnrollment is new TOTP secret of user with one-time backup codes, which are shown to user only once.
+type TOTPEnrollment struct {
+	Secret      string
+	URI         string
+	BackupCodes []string
+}
+
+// RefreshToken is refresh token, which is stored by server. Only hash of token is stored.
+type RefreshToken struct {
+	Hash      string
+	UserID    UserID
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// Device describes client, which user logged in from.
+type Device struct {
+	Name      string
+	IP        string
+	UserAgent string
+}
+
+// SessionInfo is active session of user. Current is set for session of request.
+type SessionInfo struct {
+	ID         string
+	UserID     UserID
+	Device     Device
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Current    bool
+}
+
+// Scopes of principal.
+const (
+	// ScopeRecords allows to work with records of user.
+	ScopeRecords = "records"
+	// ScopeTOTP allows only to finish login by TOTP code.
+	ScopeTOTP = "totp"
+)
+
+// Principal is authenticated user of request.
+type Principal struct {
+	UserID    UserID
+	SessionID string
+	Scopes    []string
+	// ExpiresAt is expiration time of access token. It's zero, if principal was authenticated without token.
+	ExpiresAt time.Time
+}
+
+// HasScope checks if principal was granted scope.
+func (principal Principal) HasScope(scope string) bool {
+	for _, granted := range principal.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JWK is public key, which verifies access tokens, in JSON Web Key format (RFC 7517).
+// Coordinates X and Y are base64url without padding, Y is empty for Ed25519 key.
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+}
+
+// principalKey is context key of principal.
+type principalKey struct{}
+
+// WithPrincipal returns copy of context, which stores principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext gets principal from context.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// UserIDFromContext gets ID of authenticated user from context.
+func UserIDFromContext(ctx context.Context) (UserID, bool) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.UserID == "" {
+		return "", false
+	}
+	return principal.UserID, true
+}
+
 // Record is struct for decrypted or encrypted information.
+// Revision grows on every update and is used to detect concurrent changes.
 type Record struct {
 	ID       string
 	Metadata string
 	Type     RecordType
 	Data     []byte
+	Revision int64
+}
+
+// StagedFile is staged data of file record, which is moved in place of record file after record is updated.
+// Size is size of staged data, it's counted in usage of record.
+type StagedFile struct {
+	RecordID string
+	Name     string
+	Size     int64
+}
+
+// Changes is list of records, which were changed after some revision. Revision is the latest revision of user.
+type Changes struct {
+	Revision int64
+	Created  []Record
+	Updated  []Record
+	Deleted  []string
+}
+
+// RecordsQuery is parameters of records list request. Empty Types and Metadata don't filter records.
+type RecordsQuery struct {
+	PageSize  int32
+	PageToken string
+	Types     []RecordType
+	Metadata  string
+	Sort      RecordsSort
+}
+
+// RecordsPage is one page of records list. NextPageToken is empty on the last page.
+type RecordsPage struct {
+	Records       []Record
+	NextPageToken string
+}
+
+// RecordsSort is order of records list.
+type RecordsSort int32
+
+const (
+	SortByMetadata RecordsSort = iota
+	SortByMetadataDesc
+	SortByRevision
+	SortByRevisionDesc
+)
+
+// Quota is limits of records of each user. Zero limit means no limit.
+type Quota struct {
+	// MaxBytes is total size of data of all records.
+	MaxBytes int64
+	// MaxRecords is count of records.
+	MaxRecords int64
+	// MaxRecordSize is size of data of one record.
+	MaxRecordSize int64
+}
+
+// Usage is count of records of user and total size of their data with quota of user.
+type Usage struct {
+	Bytes   int64
+	Records int64
+	Quota   Quota
+}
+
+// RecordEvent is notification about changed record of user.
+type RecordEvent struct {
+	UserID   UserID
+	Type     EventType
+	RecordID string
+	// SessionID is revoked session of EventSessionRevoked. Empty ID means all sessions of user.
+	SessionID string `json:",omitempty"`
+}
+
+// EventType is kind of record change.
+type EventType int32
+
+const (
+	EventCreated EventType = iota
+	EventUpdated
+	EventDeleted
+	// EventResync is sent, when some events could be lost, so client should get changes since its last revision.
+	EventResync
+	// EventSessionRevoked isn't sent to clients, it stops watching of records by revoked session.
+	EventSessionRevoked
+)
+
+// AuditAction is kind of audited operation of user.
+type AuditAction string
+
+const (
+	AuditLogin        AuditAction = "login"
+	AuditGetRecord    AuditAction = "get_record"
+	AuditCreateRecord AuditAction = "create_record"
+	AuditUpdateRecord AuditAction = "update_record"
+	AuditDeleteRecord AuditAction = "delete_record"
+)
+
+// AuditResultSuccess is result of audit event of successful operation. Failed one has error text as result.
+const AuditResultSuccess = "success"
+
+// AuditEvent is record of audit log: who did what with which record, when and from where.
+type AuditEvent struct {
+	UserID   UserID
+	Action   AuditAction
+	RecordID string
+	IP       string
+	Time     time.Time
+	Result   string
+}
+
+// AuditQuery is parameters of audit log request. Zero From and To don't limit time range. Newest events go first.
+type AuditQuery struct {
+	From  time.Time
+	To    time.Time
+	Limit int32
 }
 
 type RecordType int32
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -107,3 +108,24 @@ func TestBinaryFile_Bytes(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, result)
 }
+
+func TestPrincipalFromContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = UserIDFromContext(context.Background())
+	assert.False(t, ok)
+
+	principal := Principal{UserID: "userID", SessionID: "sessionID", Scopes: []string{ScopeRecords}}
+	ctx := WithPrincipal(context.Background(), principal)
+
+	got, ok := PrincipalFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, principal, got)
+	assert.True(t, got.HasScope(ScopeRecords))
+	assert.False(t, got.HasScope("other"))
+
+	userID, ok := UserIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, UserID("userID"), userID)
+}
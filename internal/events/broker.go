@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// subscriberBuffer is count of events, which subscriber can miss reading before new events are dropped.
+const subscriberBuffer = 16
+
+// Broker delivers record events to subscribers of the same user.
+//
+//go:generate mockery --name Broker
+type Broker interface {
+	Publish(ctx context.Context, event entity.RecordEvent) error
+	Subscribe(userID entity.UserID) (<-chan entity.RecordEvent, func())
+}
+
+// MemoryBroker fans out record events to subscribers of this server instance.
+type MemoryBroker struct {
+	subscribers map[entity.UserID]map[chan entity.RecordEvent]struct{}
+	*sync.Mutex
+}
+
+// NewMemoryBroker returns new in-memory broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[entity.UserID]map[chan entity.RecordEvent]struct{}),
+		Mutex:       &sync.Mutex{},
+	}
+}
+
+// Publish sends event to all subscribers of user. If subscriber is too slow, event is dropped for it:
+// there are unread events anyway, and they make client sync changes.
+func (broker *MemoryBroker) Publish(_ context.Context, event entity.RecordEvent) error {
+	broker.Lock()
+	defer broker.Unlock()
+
+	for events := range broker.subscribers[event.UserID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// resync asks all subscribers to get changes, because their events could be lost. Subscriber with full buffer
+// is skipped, it has unread events anyway.
+func (broker *MemoryBroker) resync() {
+	broker.Lock()
+	defer broker.Unlock()
+
+	for userID, subscribers := range broker.subscribers {
+		for events := range subscribers {
+			select {
+			case events <- entity.RecordEvent{UserID: userID, Type: entity.EventResync}:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe returns channel of user events and function, which cancels subscription and closes channel.
+func (broker *MemoryBroker) Subscribe(userID entity.UserID) (<-chan entity.RecordEvent, func()) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	events := make(chan entity.RecordEvent, subscriberBuffer)
+
+	if broker.subscribers[userID] == nil {
+		broker.subscribers[userID] = make(map[chan entity.RecordEvent]struct{})
+	}
+	broker.subscribers[userID][events] = struct{}{}
+
+	once := &sync.Once{}
+	cancel := func() {
+		once.Do(func() {
+			broker.Lock()
+			defer broker.Unlock()
+
+			delete(broker.subscribers[userID], events)
+			if len(broker.subscribers[userID]) == 0 {
+				delete(broker.subscribers, userID)
+			}
+			close(events)
+		})
+	}
+
+	return events, cancel
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMemoryBroker(t *testing.T) {
+	broker := NewMemoryBroker()
+	assert.NotEmpty(t, broker)
+}
+
+func TestMemoryBroker(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	first, cancelFirst := broker.Subscribe("user")
+	second, cancelSecond := broker.Subscribe("user")
+	other, cancelOther := broker.Subscribe("other user")
+	defer cancelOther()
+
+	event := entity.RecordEvent{UserID: "user", Type: entity.EventCreated, RecordID: "1"}
+
+	tc := []struct {
+		name  string
+		valid func()
+	}{
+		{
+			"Every subscriber of user gets event",
+			func() {
+				assert.NoError(t, broker.Publish(context.Background(), event))
+				assert.Equal(t, event, <-first)
+				assert.Equal(t, event, <-second)
+				assert.Empty(t, other)
+			},
+		},
+		{
+			"Cancelled subscriber doesn't get event",
+			func() {
+				cancelFirst()
+				cancelFirst()
+
+				_, ok := <-first
+				assert.False(t, ok)
+
+				assert.NoError(t, broker.Publish(context.Background(), event))
+				assert.Equal(t, event, <-second)
+			},
+		},
+		{
+			"Every subscriber gets resync event",
+			func() {
+				broker.resync()
+				assert.Equal(t, entity.RecordEvent{UserID: "user", Type: entity.EventResync}, <-second)
+				assert.Equal(t, entity.RecordEvent{UserID: "other user", Type: entity.EventResync}, <-other)
+			},
+		},
+		{
+			"Slow subscriber doesn't block publishing",
+			func() {
+				for i := 0; i < subscriberBuffer+5; i++ {
+					assert.NoError(t, broker.Publish(context.Background(), event))
+				}
+				assert.Len(t, second, subscriberBuffer)
+
+				cancelSecond()
+				assert.Empty(t, broker.subscribers["user"])
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.valid()
+	}
+}
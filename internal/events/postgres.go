@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// notifyChannel is name of Postgres channel for record events.
+const notifyChannel = "gophkeeper_records"
+
+// listenRetryDelay is pause before listening again after lost connection.
+const listenRetryDelay = 3 * time.Second
+
+// unlistenTimeout limits stopping of listening, before connection is returned to pool.
+const unlistenTimeout = 5 * time.Second
+
+// PostgresBroker delivers record events between several server instances with Postgres LISTEN/NOTIFY.
+// Events are published to DB and fanned out to local subscribers, when they come back from DB.
+type PostgresBroker struct {
+	*MemoryBroker
+	DB *sql.DB
+}
+
+// NewPostgresBroker returns broker based on DB. Listen should be run to receive events.
+func NewPostgresBroker(db *sql.DB) *PostgresBroker {
+	return &PostgresBroker{
+		MemoryBroker: NewMemoryBroker(),
+		DB:           db,
+	}
+}
+
+// Publish sends event to all server instances.
+func (broker *PostgresBroker) Publish(ctx context.Context, event entity.RecordEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = broker.DB.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	return err
+}
+
+// Listen receives events from DB and sends them to local subscribers until context is done.
+func (broker *PostgresBroker) Listen(ctx context.Context) {
+	for {
+		err := broker.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.ErrorContext(ctx, "Failed listen record events, retrying", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// listen holds one DB connection and waits for notifications on it. Events could be published, while connection
+// wasn't listening, so after LISTEN subscribers are asked to resync. Connection stops listening before it's
+// returned to pool, otherwise it's closed.
+func (broker *PostgresBroker) listen(ctx context.Context) error {
+	conn, err := broker.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("DB driver isn't pgx")
+		}
+
+		pgxConn := stdlibConn.Conn()
+
+		err := broker.wait(ctx, pgxConn)
+
+		unlistenCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlistenTimeout)
+		defer cancel()
+
+		// Broken connection is closed instead of being returned to pool.
+		_, unlistenErr := pgxConn.Exec(unlistenCtx, "UNLISTEN *")
+		if unlistenErr != nil {
+			return errors.Join(err, driver.ErrBadConn)
+		}
+
+		return err
+	})
+}
+
+// wait listens channel on connection and sends received events to local subscribers.
+func (broker *PostgresBroker) wait(ctx context.Context, pgxConn *pgx.Conn) error {
+	_, err := pgxConn.Exec(ctx, "LISTEN "+notifyChannel)
+	if err != nil {
+		return err
+	}
+
+	broker.MemoryBroker.resync()
+
+	for {
+		notification, err := pgxConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event entity.RecordEvent
+		err = json.Unmarshal([]byte(notification.Payload), &event)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed decode record event", "error", err)
+			continue
+		}
+
+		broker.MemoryBroker.Publish(ctx, event)
+	}
+}
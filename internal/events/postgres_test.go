@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresBroker_Publish(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+
+	broker := NewPostgresBroker(db)
+	event := entity.RecordEvent{UserID: "user", Type: entity.EventDeleted, RecordID: "1"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Publish event",
+			func() {
+				mock.ExpectExec("SELECT pg_notify($1, $2)").
+					WithArgs(notifyChannel, `{"UserID":"user","Type":2,"RecordID":"1"}`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				err := broker.Publish(context.Background(), event)
+				assert.NoError(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Publish event, but DB will return error",
+			func() {
+				mock.ExpectExec("SELECT pg_notify($1, $2)").
+					WithArgs(notifyChannel, `{"UserID":"user","Type":2,"RecordID":"1"}`).
+					WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				err := broker.Publish(context.Background(), event)
+				assert.Error(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
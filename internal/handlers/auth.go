@@ -1,7 +1,10 @@
 package handlers
 
 import (
-	"log"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -9,60 +12,232 @@ import (
 	"github.com/size12/gophkeeper/internal/storage"
 )
 
-// Authenticator is interface for user authenticating. Should can creates tokens, and gets userIDs from them.
+// Authenticator is interface for user authenticating. Should can creates tokens, and gets principals from them.
 //
 //go:generate mockery --name Authenticator
 type Authenticator interface {
-	CreateToken(userID entity.UserID) (entity.AuthToken, error)
-	ValidateToken(token entity.AuthToken) (entity.UserID, error)
+	CreateToken(principal entity.Principal) (entity.AuthToken, error)
+	ValidateToken(token entity.AuthToken) (entity.Principal, error)
+	RevokeSession(sessionID string)
+	PublicKeys() []entity.JWK
 }
 
+// AccessTokenTTL is default lifetime of access token. Client should refresh session before it.
+const AccessTokenTTL = 15 * time.Minute
+
 // AuthenticatorJWT is authenticator which uses JWT.
+// Tokens are signed by current key, retired keys still verify tokens until they expire.
 type AuthenticatorJWT struct {
-	secretKey []byte
+	current SigningKey
+	keys    map[string]SigningKey
+	// TTL is lifetime of access tokens.
+	TTL time.Duration
+	// revoked keeps revoked sessions while their access tokens can be still valid.
+	revoked map[string]time.Time
+	*sync.Mutex
 }
 
-// NewAuthenticatorJWT gets new AuthenticatorJWT.
+// NewAuthenticatorJWT gets new AuthenticatorJWT, which signs tokens by HMAC secret.
 func NewAuthenticatorJWT(secretKey []byte) *AuthenticatorJWT {
-	return &AuthenticatorJWT{secretKey: secretKey}
+	auth, _ := NewAuthenticatorJWTWithKeys(NewHMACKey(secretKey))
+	return auth
+}
+
+// NewAuthenticatorJWTWithKeys gets new AuthenticatorJWT, which signs tokens by current key.
+// Previous keys are retired now, they only verify tokens, which were signed by them before restart, until they expire.
+func NewAuthenticatorJWTWithKeys(current SigningKey, previous ...SigningKey) (*AuthenticatorJWT, error) {
+	if current.Private == nil {
+		return nil, errors.New("current key can't sign tokens")
+	}
+
+	auth := &AuthenticatorJWT{
+		current: current,
+		keys:    map[string]SigningKey{current.ID: current},
+		TTL:     AccessTokenTTL,
+		revoked: make(map[string]time.Time),
+		Mutex:   &sync.Mutex{},
+	}
+
+	now := time.Now()
+	for _, key := range previous {
+		if _, ok := auth.keys[key.ID]; !ok {
+			key.retiredAt = now
+			auth.keys[key.ID] = key
+		}
+	}
+
+	return auth, nil
+}
+
+// RotateKey makes key current. Previous current key verifies its tokens until they expire and then is removed.
+func (auth *AuthenticatorJWT) RotateKey(key SigningKey) error {
+	if key.Private == nil {
+		return errors.New("current key can't sign tokens")
+	}
+
+	auth.Lock()
+	defer auth.Unlock()
+
+	now := time.Now()
+	auth.deleteExpiredKeys(now)
+
+	if key.ID == auth.current.ID {
+		return nil
+	}
+
+	retired := auth.current
+	retired.retiredAt = now
+	auth.keys[retired.ID] = retired
+
+	key.retiredAt = time.Time{}
+	auth.keys[key.ID] = key
+	auth.current = key
+
+	return nil
 }
 
-// CreateToken implementation of Authenticator interface. Creates token, which stores userID.
-func (auth *AuthenticatorJWT) CreateToken(userID entity.UserID) (entity.AuthToken, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// isExpired checks if key was retired earlier than lifetime of access token ago, so its tokens are expired.
+// Should be called under lock.
+func (auth *AuthenticatorJWT) isExpired(key SigningKey, now time.Time) bool {
+	return !key.retiredAt.IsZero() && now.After(key.retiredAt.Add(auth.TTL))
+}
+
+// deleteExpiredKeys deletes retired keys, which tokens are expired. Should be called under lock.
+func (auth *AuthenticatorJWT) deleteExpiredKeys(now time.Time) {
+	for id, key := range auth.keys {
+		if auth.isExpired(key, now) {
+			delete(auth.keys, id)
+		}
+	}
+}
+
+// PublicKeys implementation of Authenticator interface. Returns public keys, which verify tokens, sorted by key ID.
+// HMAC keys are secret, so they aren't returned. Expired retired keys are deleted.
+func (auth *AuthenticatorJWT) PublicKeys() []entity.JWK {
+	auth.Lock()
+	defer auth.Unlock()
+
+	auth.deleteExpiredKeys(time.Now())
+
+	keys := make([]entity.JWK, 0, len(auth.keys))
+	for _, key := range auth.keys {
+		jwk, err := publicJWK(key.Public)
+		if err != nil {
+			continue
+		}
+
+		jwk.KeyID = key.ID
+		keys = append(keys, jwk)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].KeyID < keys[j].KeyID
+	})
+
+	return keys
+}
+
+// verifyingKey gets key of token by its ID. Retired keys are valid only during rotation window.
+func (auth *AuthenticatorJWT) verifyingKey(id string) (SigningKey, bool) {
+	auth.Lock()
+	defer auth.Unlock()
+
+	key, ok := auth.keys[id]
+	if !ok || auth.isExpired(key, time.Now()) {
+		return SigningKey{}, false
+	}
+
+	return key, true
+}
+
+// RevokeSession implementation of Authenticator interface. Access tokens of session become invalid.
+func (auth *AuthenticatorJWT) RevokeSession(sessionID string) {
+	auth.Lock()
+	defer auth.Unlock()
+
+	now := time.Now()
+	for id, until := range auth.revoked {
+		if now.After(until) {
+			delete(auth.revoked, id)
+		}
+	}
+
+	auth.revoked[sessionID] = now.Add(auth.TTL)
+}
+
+// isRevoked checks if session was revoked.
+func (auth *AuthenticatorJWT) isRevoked(sessionID string) bool {
+	auth.Lock()
+	defer auth.Unlock()
+
+	until, ok := auth.revoked[sessionID]
+	return ok && time.Now().Before(until)
+}
+
+// CreateToken implementation of Authenticator interface. Creates token, which stores principal.
+func (auth *AuthenticatorJWT) CreateToken(principal entity.Principal) (entity.AuthToken, error) {
+	auth.Lock()
+	key := auth.current
+	auth.Unlock()
+
+	token := jwt.New(key.Method)
+	token.Header["kid"] = key.ID
 
 	claims := token.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(1 * time.Hour).Unix() // TODO: get this value from config.
-	claims["userID"] = userID
+	claims["exp"] = time.Now().Add(auth.TTL).Unix()
+	claims["userID"] = principal.UserID
+	claims["sid"] = principal.SessionID
+	claims["scopes"] = principal.Scopes
 
-	tokenString, err := token.SignedString(auth.secretKey)
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
-		log.Println("Failed generate token for authentication:", err)
+		slog.Error("Failed generate token for authentication", "error", err)
 		return "", storage.ErrUnknown
 	}
 
 	return entity.AuthToken(tokenString), nil
 }
 
-// ValidateToken implementation of Authenticator interface. Validates token, returns userID.
-func (auth *AuthenticatorJWT) ValidateToken(token entity.AuthToken) (entity.UserID, error) {
+// ValidateToken implementation of Authenticator interface. Validates token, returns principal.
+func (auth *AuthenticatorJWT) ValidateToken(token entity.AuthToken) (entity.Principal, error) {
 	claims := jwt.MapClaims{}
 
 	_, err := jwt.ParseWithClaims(string(token), claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		id, _ := token.Header["kid"].(string)
+		key, ok := auth.verifyingKey(id)
+		if !ok || token.Method.Alg() != key.Method.Alg() {
 			return nil, storage.ErrUnknown
 		}
-		return auth.secretKey, nil
+		return key.Public, nil
 	})
 	if err != nil {
-		return "", storage.ErrUserUnauthorized
+		return entity.Principal{}, storage.ErrUserUnauthorized
 	}
 
 	userID, ok := claims["userID"].(string)
 
-	if !ok {
-		return "", storage.ErrUserUnauthorized
+	if !ok || userID == "" {
+		return entity.Principal{}, storage.ErrUserUnauthorized
+	}
+
+	principal := entity.Principal{UserID: entity.UserID(userID)}
+	principal.SessionID, _ = claims["sid"].(string)
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err == nil && expiresAt != nil {
+		principal.ExpiresAt = expiresAt.Time
+	}
+
+	if principal.SessionID != "" && auth.isRevoked(principal.SessionID) {
+		return entity.Principal{}, storage.ErrUserUnauthorized
+	}
+
+	scopes, _ := claims["scopes"].([]interface{})
+	for _, scope := range scopes {
+		if scope, ok := scope.(string); ok {
+			principal.Scopes = append(principal.Scopes, scope)
+		}
 	}
 
-	return entity.UserID(userID), nil
+	return principal, nil
 }
@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/storage"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,12 +24,149 @@ func TestNewAuthenticatorJWT(t *testing.T) {
 func TestAuthenticatorJWT(t *testing.T) {
 	auth := NewAuthenticatorJWT([]byte("secret key"))
 
-	userID := entity.UserID("user_id_12")
+	principal := entity.Principal{
+		UserID:    "user_id_12",
+		SessionID: "session_id",
+		Scopes:    []string{entity.ScopeRecords},
+	}
 
-	token, err := auth.CreateToken(userID)
+	token, err := auth.CreateToken(principal)
 	assert.NoError(t, err)
 
-	id, err := auth.ValidateToken(token)
+	got, err := auth.ValidateToken(token)
 	assert.NoError(t, err)
-	assert.Equal(t, userID, id)
+	assert.WithinDuration(t, time.Now().Add(AccessTokenTTL), got.ExpiresAt, time.Minute)
+	got.ExpiresAt = time.Time{}
+	assert.Equal(t, principal, got)
+
+	_, err = NewAuthenticatorJWT([]byte("other key")).ValidateToken(token)
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+}
+
+func TestAuthenticatorJWT_RevokeSession(t *testing.T) {
+	auth := NewAuthenticatorJWT([]byte("secret key"))
+
+	token, err := auth.CreateToken(entity.Principal{UserID: "user_id", SessionID: "revoked"})
+	assert.NoError(t, err)
+	otherToken, err := auth.CreateToken(entity.Principal{UserID: "user_id", SessionID: "other"})
+	assert.NoError(t, err)
+
+	auth.RevokeSession("revoked")
+
+	_, err = auth.ValidateToken(token)
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+
+	_, err = auth.ValidateToken(otherToken)
+	assert.NoError(t, err)
+}
+
+func TestAuthenticatorJWT_RotateKey(t *testing.T) {
+	auth := NewAuthenticatorJWT([]byte("old key"))
+	oldToken, err := auth.CreateToken(entity.Principal{UserID: "user_id"})
+	assert.NoError(t, err)
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	key, err := NewSigningKey(private)
+	assert.NoError(t, err)
+
+	assert.NoError(t, auth.RotateKey(key))
+
+	newToken, err := auth.CreateToken(entity.Principal{UserID: "user_id"})
+	assert.NoError(t, err)
+
+	_, err = auth.ValidateToken(oldToken)
+	assert.NoError(t, err)
+	_, err = auth.ValidateToken(newToken)
+	assert.NoError(t, err)
+
+	// Retired key doesn't verify tokens after they expire, current key still does.
+	auth.TTL = -time.Second
+	_, err = auth.ValidateToken(oldToken)
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+	_, err = auth.ValidateToken(newToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, auth.RotateKey(NewHMACKey([]byte("new key"))))
+	_, err = auth.ValidateToken(newToken)
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+	assert.Empty(t, auth.PublicKeys(), "expired keys aren't published")
+
+	_, err = NewAuthenticatorJWTWithKeys(SigningKey{ID: "public only", Public: private.Public()})
+	assert.Error(t, err)
+}
+
+func TestAuthenticatorJWT_PreviousKeys(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	previous, err := NewSigningKey(private)
+	assert.NoError(t, err)
+
+	before, err := NewAuthenticatorJWTWithKeys(previous)
+	assert.NoError(t, err)
+	token, err := before.CreateToken(entity.Principal{UserID: "user_id"})
+	assert.NoError(t, err)
+
+	auth, err := NewAuthenticatorJWTWithKeys(NewHMACKey([]byte("current key")), previous)
+	assert.NoError(t, err)
+
+	_, err = auth.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Len(t, auth.PublicKeys(), 1)
+
+	// Previous key is retired at start, it doesn't verify tokens after they expire.
+	auth.TTL = -time.Second
+	_, err = auth.ValidateToken(token)
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+	assert.Empty(t, auth.PublicKeys())
+}
+
+func TestAuthenticatorJWT_PublicKey(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for _, private := range []crypto.Signer{ecdsaKey, ed25519Key} {
+		key, err := NewSigningKey(private)
+		assert.NoError(t, err)
+
+		auth, err := NewAuthenticatorJWTWithKeys(key, NewHMACKey([]byte("previous key")))
+		assert.NoError(t, err)
+
+		token, err := auth.CreateToken(entity.Principal{UserID: "user_id", Scopes: []string{entity.ScopeRecords}})
+		assert.NoError(t, err)
+
+		// Other service knows only public key.
+		public, err := NewVerifyingKey(private.Public())
+		assert.NoError(t, err)
+		assert.Equal(t, key.ID, public.ID)
+
+		verifier := &AuthenticatorJWT{keys: map[string]SigningKey{public.ID: public}, Mutex: &sync.Mutex{}, revoked: map[string]time.Time{}}
+		principal, err := verifier.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.UserID("user_id"), principal.UserID)
+
+		keys := auth.PublicKeys()
+		assert.Len(t, keys, 1)
+		assert.Equal(t, key.ID, keys[0].KeyID)
+		assert.Equal(t, key.Method.Alg(), keys[0].Algorithm)
+	}
+}
+
+func TestAuthenticatorJWT_ValidateTokenKeyID(t *testing.T) {
+	auth := NewAuthenticatorJWT([]byte("secret key"))
+
+	withoutKeyID, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "user_id"}).SignedString([]byte("secret key"))
+	assert.NoError(t, err)
+	_, err = auth.ValidateToken(entity.AuthToken(withoutKeyID))
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
+
+	// Token with kid of HMAC key, but signed by other algorithm, is rejected.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"userID": "user_id"})
+	token.Header["kid"] = auth.current.ID
+	otherAlgorithm, err := token.SignedString([]byte("secret key"))
+	assert.NoError(t, err)
+	_, err = auth.ValidateToken(entity.AuthToken(otherAlgorithm))
+	assert.Equal(t, storage.ErrUserUnauthorized, err)
 }
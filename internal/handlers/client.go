@@ -1,22 +1,47 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
+	"io"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/srp"
 	"github.com/size12/gophkeeper/internal/storage"
+	"github.com/size12/gophkeeper/internal/totp"
+)
+
+// AuthMethod is how client proves password to server.
+type AuthMethod int
+
+const (
+	// AuthPassword sends password to server, server checks its hash.
+	AuthPassword AuthMethod = iota
+	// AuthSRP proves password by SRP-6a handshake, password isn't sent to server.
+	AuthSRP
 )
 
 // Client struct for client handlers.
 type Client struct {
-	Conn      ClientConn
-	authToken entity.AuthToken
-	masterKey []byte
+	Conn       ClientConn
+	AuthMethod AuthMethod
+	authToken  entity.AuthToken
+	userLogin  string
+	masterKey  []byte
+	// totpToken and pending are kept between Login and LoginTOTP, if user enabled TOTP.
+	totpToken entity.AuthToken
+	pending   entity.UserCredentials
+	// records is cache of records info, which is synced with server by revision.
+	records  map[string]entity.Record
+	revision int64
 	*sync.Mutex
 }
 
@@ -29,11 +54,21 @@ func NewClientHandlers(conn ClientConn) *Client {
 }
 
 // Login logins user by login and password.
+// If user enabled TOTP, returns ErrTOTPRequired and login is finished by LoginTOTP.
 func (client *Client) Login(credentials entity.UserCredentials) error {
 	if credentials.Login == "" || credentials.Password == "" || len(credentials.MasterKey) == 0 {
 		return ErrFieldIsEmpty
 	}
-	authToken, err := client.Conn.Login(credentials)
+	authToken, err := client.login(credentials)
+	if errors.Is(err, ErrTOTPRequired) {
+		client.Lock()
+		defer client.Unlock()
+
+		client.totpToken = entity.AuthToken(authToken)
+		client.pending = entity.UserCredentials{Login: credentials.Login, MasterKey: credentials.MasterKey}
+		return err
+	}
+
 	if err != nil {
 		return err
 	}
@@ -41,18 +76,29 @@ func (client *Client) Login(credentials entity.UserCredentials) error {
 	client.Lock()
 	defer client.Unlock()
 
-	client.authToken = entity.AuthToken(authToken)
-	sha := sha256.New()
+	client.signIn(authToken, credentials)
+	return nil
+}
 
-	_, err = sha.Write(client.masterKey)
+// LoginTOTP finishes login by TOTP code or backup code, if Login returned ErrTOTPRequired.
+func (client *Client) LoginTOTP(code string) error {
+	if code == "" {
+		return ErrFieldIsEmpty
+	}
 
-	if err != nil {
-		return storage.ErrUnknown
+	client.Lock()
+	defer client.Unlock()
+
+	if client.totpToken == "" {
+		return storage.ErrUserUnauthorized
 	}
 
-	key := sha.Sum(nil)
+	authToken, err := client.Conn.VerifyTOTP(client.totpToken, code)
+	if err != nil {
+		return err
+	}
 
-	client.masterKey = key
+	client.signIn(authToken, client.pending)
 	return nil
 }
 
@@ -61,7 +107,7 @@ func (client *Client) Register(credentials entity.UserCredentials) error {
 	if credentials.Login == "" || credentials.Password == "" || len(credentials.MasterKey) == 0 {
 		return ErrFieldIsEmpty
 	}
-	authToken, err := client.Conn.Register(credentials)
+	authToken, err := client.register(credentials)
 	if err != nil {
 		return err
 	}
@@ -69,27 +115,325 @@ func (client *Client) Register(credentials entity.UserCredentials) error {
 	client.Lock()
 	defer client.Unlock()
 
+	client.signIn(authToken, credentials)
+	return nil
+}
+
+// signIn saves session token and master key of logged in user. Should be called under lock.
+func (client *Client) signIn(authToken string, credentials entity.UserCredentials) {
 	client.authToken = entity.AuthToken(authToken)
+	client.userLogin = credentials.Login
+	client.totpToken = ""
+	client.pending = entity.UserCredentials{}
+	client.records = nil
+	client.revision = 0
+	client.masterKey = deriveMasterKey(credentials.MasterKey)
+}
+
+// login gets session token by chosen auth method.
+func (client *Client) login(credentials entity.UserCredentials) (string, error) {
+	if client.AuthMethod != AuthSRP {
+		return client.Conn.Login(credentials)
+	}
 
-	sha := sha256.New()
+	handshake, err := srp.NewClient(credentials.Login, credentials.Password)
+	if err != nil {
+		return "", storage.ErrUnknown
+	}
 
-	_, err = sha.Write(client.masterKey)
+	challenge, err := client.Conn.StartLoginSRP(credentials.Login, handshake.PublicKey())
+	if err != nil {
+		return "", err
+	}
 
+	proof, err := handshake.Proof(challenge.Salt, challenge.ServerPublicKey)
+	if err != nil {
+		return "", storage.ErrWrongCredentials
+	}
+
+	authToken, serverProof, err := client.Conn.FinishLoginSRP(challenge.LoginID, proof)
+	if err != nil && !errors.Is(err, ErrTOTPRequired) {
+		return "", err
+	}
+
+	// Server, which doesn't know verifier, can't prove itself, so its session isn't trusted.
+	if handshake.VerifyServer(serverProof) != nil {
+		return "", storage.ErrWrongCredentials
+	}
+
+	return authToken, err
+}
+
+// register creates user by chosen auth method and gets session token.
+func (client *Client) register(credentials entity.UserCredentials) (string, error) {
+	if client.AuthMethod != AuthSRP {
+		return client.Conn.Register(credentials)
+	}
+
+	salt, verifier, err := srp.NewVerifier(credentials.Login, credentials.Password)
+	if err != nil {
+		return "", storage.ErrUnknown
+	}
+
+	return client.Conn.RegisterSRP(credentials.Login, entity.SRPVerifier{Salt: salt, Verifier: verifier})
+}
+
+// Logout ends session on server and forgets user data.
+func (client *Client) Logout() error {
+	client.Lock()
+	defer client.Unlock()
+
+	err := client.Conn.Logout(client.authToken)
+
+	client.authToken = ""
+	client.userLogin = ""
+	client.totpToken = ""
+	client.pending = entity.UserCredentials{}
+	client.masterKey = nil
+	client.records = nil
+	client.revision = 0
+
+	return err
+}
+
+// ChangePassword changes password of logged in user. Other sessions of user are ended.
+// SRP user proves old password by SRP handshake and sends new verifier, so passwords aren't sent to server.
+func (client *Client) ChangePassword(oldPassword, newPassword string) error {
+	if oldPassword == "" || newPassword == "" {
+		return ErrFieldIsEmpty
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	if client.AuthMethod != AuthSRP {
+		return client.Conn.ChangePassword(client.authToken, entity.UserCredentials{
+			Login:    client.userLogin,
+			Password: oldPassword,
+		}, newPassword)
+	}
+
+	proof, err := client.proveSRP(oldPassword)
+	if err != nil {
+		return err
+	}
+
+	salt, verifier, err := srp.NewVerifier(client.userLogin, newPassword)
 	if err != nil {
 		return storage.ErrUnknown
 	}
 
-	key := sha.Sum(nil)
+	return client.Conn.ChangePasswordSRP(client.authToken, proof, entity.SRPVerifier{Salt: salt, Verifier: verifier})
+}
+
+// proveSRP proves password of logged in user by new SRP-6a handshake, so password isn't sent to server.
+// Should be called under lock.
+func (client *Client) proveSRP(password string) (entity.SRPProof, error) {
+	handshake, err := srp.NewClient(client.userLogin, password)
+	if err != nil {
+		return entity.SRPProof{}, storage.ErrUnknown
+	}
+
+	challenge, err := client.Conn.StartLoginSRP(client.userLogin, handshake.PublicKey())
+	if err != nil {
+		return entity.SRPProof{}, err
+	}
+
+	proof, err := handshake.Proof(challenge.Salt, challenge.ServerPublicKey)
+	if err != nil {
+		return entity.SRPProof{}, storage.ErrWrongCredentials
+	}
+
+	return entity.SRPProof{LoginID: challenge.LoginID, ClientProof: proof}, nil
+}
+
+// DeleteAccount deletes logged in user with all his records and files on server and forgets user data.
+// SRP user proves password by SRP handshake, so password isn't sent to server.
+func (client *Client) DeleteAccount(password string) error {
+	if password == "" {
+		return ErrFieldIsEmpty
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	err := client.deleteAccount(password)
+	if err != nil {
+		return err
+	}
+
+	client.authToken = ""
+	client.userLogin = ""
+	client.masterKey = nil
+	client.records = nil
+	client.revision = 0
 
-	client.masterKey = key
 	return nil
 }
 
-// GetRecordsInfo gets all records.
-func (client *Client) GetRecordsInfo() ([]entity.Record, error) {
+// deleteAccount deletes logged in user on server by password or SRP proof of it. Should be called under lock.
+func (client *Client) deleteAccount(password string) error {
+	if client.AuthMethod != AuthSRP {
+		return client.Conn.DeleteAccount(client.authToken, entity.UserCredentials{
+			Login:    client.userLogin,
+			Password: password,
+		})
+	}
+
+	proof, err := client.proveSRP(password)
+	if err != nil {
+		return err
+	}
+
+	return client.Conn.DeleteAccountSRP(client.authToken, proof)
+}
+
+// ListSessions gets active sessions of user.
+func (client *Client) ListSessions() ([]entity.SessionInfo, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	return client.Conn.ListSessions(client.authToken)
+}
+
+// ListAuditEvents gets logins and record operations of user in time range, newest first.
+func (client *Client) ListAuditEvents(query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	return client.Conn.ListAuditEvents(client.authToken, query)
+}
+
+// GetUsage gets count of records of user and total size of their data with quota of user.
+func (client *Client) GetUsage() (entity.Usage, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	return client.Conn.GetUsage(client.authToken)
+}
+
+// RevokeSession ends session of user, for example on lost device.
+func (client *Client) RevokeSession(sessionID string) error {
+	client.Lock()
+	defer client.Unlock()
+
+	return client.Conn.RevokeSession(client.authToken, sessionID)
+}
+
+// EnableTOTP gets new TOTP secret and backup codes of user. TOTP is required on login after ConfirmTOTP.
+func (client *Client) EnableTOTP() (entity.TOTPEnrollment, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	enrollment, err := client.Conn.EnableTOTP(client.authToken)
+	if err != nil {
+		return entity.TOTPEnrollment{}, err
+	}
+
+	enrollment.URI = totp.URI(totpIssuer, client.userLogin, enrollment.Secret)
+	return enrollment, nil
+}
+
+// ConfirmTOTP confirms TOTP secret by code from authenticator app.
+func (client *Client) ConfirmTOTP(code string) error {
+	if code == "" {
+		return ErrFieldIsEmpty
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	return client.Conn.ConfirmTOTP(client.authToken, code)
+}
+
+// DisableTOTP disables TOTP of user. Code is TOTP code or backup code, password of user is required too.
+func (client *Client) DisableTOTP(code, password string) error {
+	if code == "" || password == "" {
+		return ErrFieldIsEmpty
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	if client.AuthMethod != AuthSRP {
+		return client.Conn.DisableTOTP(client.authToken, code, entity.UserCredentials{
+			Login:    client.userLogin,
+			Password: password,
+		}, entity.SRPProof{})
+	}
+
+	proof, err := client.proveSRP(password)
+	if err != nil {
+		return err
+	}
+
+	return client.Conn.DisableTOTP(client.authToken, code, entity.UserCredentials{}, proof)
+}
+
+// GetRecordsInfo gets page of records, which are matched by query.
+func (client *Client) GetRecordsInfo(query entity.RecordsQuery) (entity.RecordsPage, error) {
+	client.Lock()
+	defer client.Unlock()
+	return client.Conn.GetRecordsInfo(client.authToken, query)
+}
+
+// SyncRecords gets records changed since last sync and returns all records sorted by metadata.
+// If server pruned deleted records since last sync, all records are listed again.
+func (client *Client) SyncRecords() ([]entity.Record, error) {
 	client.Lock()
 	defer client.Unlock()
-	return client.Conn.GetRecordsInfo(client.authToken)
+
+	changes, err := client.Conn.GetChanges(client.authToken, client.revision)
+	if errors.Is(err, storage.ErrResyncRequired) {
+		client.records = nil
+		client.revision = 0
+		changes, err = client.Conn.GetChanges(client.authToken, 0)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if client.records == nil {
+		client.records = make(map[string]entity.Record)
+	}
+
+	for _, record := range changes.Created {
+		client.records[record.ID] = record
+	}
+
+	for _, record := range changes.Updated {
+		client.records[record.ID] = record
+	}
+
+	for _, recordID := range changes.Deleted {
+		delete(client.records, recordID)
+	}
+
+	client.revision = changes.Revision
+
+	records := make([]entity.Record, 0, len(client.records))
+	for _, record := range client.records {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Metadata != records[j].Metadata {
+			return records[i].Metadata < records[j].Metadata
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	return records, nil
+}
+
+// WatchRecords calls handle for every change of records made by any client. Blocks until context is done or connection breaks.
+func (client *Client) WatchRecords(ctx context.Context, handle func(event entity.RecordEvent)) error {
+	client.Lock()
+	token := client.authToken
+	client.Unlock()
+
+	return client.Conn.WatchRecords(ctx, token, handle)
 }
 
 // GetRecord gets record by recordID and decodes it.
@@ -101,39 +445,105 @@ func (client *Client) GetRecord(recordID string) (entity.Record, error) {
 		return record, err
 	}
 
-	aesblock, err := aes.NewCipher(client.masterKey)
+	if record.Type == entity.TypeFile {
+		err = client.downloadFile(record)
+		if err != nil {
+			return record, err
+		}
+
+		record.Data = []byte("Saved file successfully to " + record.Metadata + ".")
+		return record, nil
+	}
+
+	decoded, err := client.decrypt(record.Data)
 	if err != nil {
-		return record, ErrWrongMasterKey
+		return record, err
 	}
 
-	aesgcm, err := cipher.NewGCM(aesblock)
+	record.Data = decoded
+
+	return record, nil
+}
+
+// downloadFile downloads file record, decrypts it and saves to file named as record metadata.
+func (client *Client) downloadFile(record entity.Record) error {
+	aead, err := client.aead()
 	if err != nil {
-		return record, storage.ErrUnknown
+		return err
 	}
 
-	nonce := record.Data[:aesgcm.NonceSize()]
+	file, err := os.Create(record.Metadata)
+	if err != nil {
+		return storage.ErrUnknown
+	}
+	defer file.Close()
+
+	w := newDecryptWriter(aead, file, client.decrypt)
+
+	err = client.Conn.DownloadFile(client.authToken, record.ID, w)
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err != nil && !errors.Is(err, ErrLegacyRecords) && w.sealedBy(legacyAEAD) {
+		err = ErrLegacyRecords
+	}
 
-	decoded, err := aesgcm.Open(nil, nonce, record.Data[aesgcm.NonceSize():], nil)
 	if err != nil {
-		return record, storage.ErrUnknown
+		os.Remove(record.Metadata)
+		return err
 	}
 
-	record.Data = decoded
+	return nil
+}
 
-	if record.Type == entity.TypeFile {
-		file, err := os.Create(record.Metadata)
-		if err != nil {
-			return record, storage.ErrUnknown
+// HasLegacyRecords checks, that vault has records of old client versions, which are sealed with legacy master key.
+// They should be migrated by master key rotation. Only text records are checked, because files are checked
+// when they are downloaded.
+func (client *Client) HasLegacyRecords() (bool, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	infos, err := client.allRecordsInfo()
+	if err != nil {
+		return false, err
+	}
+
+	for _, info := range infos {
+		if info.Type == entity.TypeFile {
+			continue
 		}
 
-		_, err = file.Write(record.Data)
+		record, err := client.Conn.GetRecord(client.authToken, info.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
 		if err != nil {
-			return record, storage.ErrUnknown
+			return false, err
+		}
+
+		_, err = client.decrypt(record.Data)
+		if errors.Is(err, ErrLegacyRecords) {
+			return true, nil
 		}
-		record.Data = []byte("Saved file successfully to " + record.Metadata + ".")
 	}
 
-	return record, nil
+	return false, nil
+}
+
+// UploadFile encrypts file record data from reader and uploads it chunk by chunk.
+func (client *Client) UploadFile(record entity.Record, r io.Reader) error {
+	client.Lock()
+	defer client.Unlock()
+
+	aead, err := client.aead()
+	if err != nil {
+		return err
+	}
+
+	record.Type = entity.TypeFile
+	_, err = client.Conn.UploadFile(client.authToken, record, newEncryptReader(aead, r))
+	return err
 }
 
 // DeleteRecord deletes record by his ID.
@@ -147,26 +557,147 @@ func (client *Client) DeleteRecord(recordID string) error {
 func (client *Client) CreateRecord(record entity.Record) error {
 	client.Lock()
 	defer client.Unlock()
-	aesblock, err := aes.NewCipher(client.masterKey)
+	encoded, err := client.encrypt(record.Data)
 	if err != nil {
-		return ErrWrongMasterKey
+		return err
+	}
+
+	record.Data = encoded
+
+	return client.Conn.CreateRecord(client.authToken, record)
+}
+
+// UpdateRecord encrypts and replaces record. Record revision should be the one which was read, returns new revision.
+func (client *Client) UpdateRecord(record entity.Record) (int64, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	encoded, err := client.encrypt(record.Data)
+	if err != nil {
+		return 0, err
+	}
+
+	record.Data = encoded
+
+	return client.Conn.UpdateRecord(client.authToken, record)
+}
+
+// legacyMasterKey is key, which was used by clients before master key was derived from user input.
+// It's publicly known, so records sealed with it are opened only by master key rotation, which seals them with user key.
+var legacyMasterKey = deriveMasterKey(nil)
+
+// legacyAEAD is cipher of legacy master key, which detects records of old client versions.
+var legacyAEAD, _ = aeadOf(legacyMasterKey)
+
+// deriveMasterKey returns AES key of master key.
+func deriveMasterKey(masterKey []byte) []byte {
+	key := sha256.Sum256(masterKey)
+	return key[:]
+}
+
+// aead returns cipher based on master key.
+func (client *Client) aead() (cipher.AEAD, error) {
+	return aeadOf(client.masterKey)
+}
+
+// aeadOf returns cipher based on key.
+func aeadOf(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrWrongMasterKey
 	}
 
 	aesgcm, err := cipher.NewGCM(aesblock)
 	if err != nil {
-		return storage.ErrUnknown
+		return nil, storage.ErrUnknown
+	}
+
+	return aesgcm, nil
+}
+
+// aeadsOf returns ciphers based on keys.
+func aeadsOf(keys [][]byte) ([]cipher.AEAD, error) {
+	aeads := make([]cipher.AEAD, 0, len(keys))
+	for _, key := range keys {
+		aead, err := aeadOf(key)
+		if err != nil {
+			return nil, err
+		}
+		aeads = append(aeads, aead)
+	}
+	return aeads, nil
+}
+
+// encrypt seals data with master key. Result is nonce followed by encrypted data.
+func (client *Client) encrypt(data []byte) ([]byte, error) {
+	return encryptWith(client.masterKey, data)
+}
+
+// encryptWith seals data with key.
+func encryptWith(key []byte, data []byte) ([]byte, error) {
+	aesgcm, err := aeadOf(key)
+	if err != nil {
+		return nil, err
 	}
 
 	nonce, err := generateRandom(aesgcm.NonceSize())
 	if err != nil {
-		return storage.ErrUnknown
+		return nil, storage.ErrUnknown
 	}
 
-	out := aesgcm.Seal(nil, nonce, record.Data, nil) // зашифровываем
+	out := aesgcm.Seal(nil, nonce, data, nil) // зашифровываем
 
-	record.Data = append(nonce, out...)
+	return append(nonce, out...), nil
+}
 
-	return client.Conn.CreateRecord(client.authToken, record)
+// decrypt opens data sealed by encrypt. Returns ErrLegacyRecords, if data is sealed with legacy master key.
+func (client *Client) decrypt(data []byte) ([]byte, error) {
+	decoded, err := decryptWith([][]byte{client.masterKey}, data)
+	if err == nil || bytes.Equal(client.masterKey, legacyMasterKey) {
+		return decoded, err
+	}
+
+	if _, legacyErr := decryptWith([][]byte{legacyMasterKey}, data); legacyErr == nil {
+		return nil, ErrLegacyRecords
+	}
+
+	return nil, err
+}
+
+// rotationKeys returns keys, which records can be sealed with before rotation of master key: the key itself
+// and legacy key.
+func rotationKeys(key []byte) [][]byte {
+	if bytes.Equal(key, legacyMasterKey) {
+		return [][]byte{key}
+	}
+	return [][]byte{key, legacyMasterKey}
+}
+
+// decryptWith opens data sealed by one of keys.
+func decryptWith(keys [][]byte, data []byte) ([]byte, error) {
+	err := storage.ErrUnknown
+
+	for _, key := range keys {
+		var aesgcm cipher.AEAD
+		aesgcm, err = aeadOf(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) < aesgcm.NonceSize() {
+			return nil, storage.ErrUnknown
+		}
+
+		nonce := data[:aesgcm.NonceSize()]
+
+		decoded, openErr := aesgcm.Open(nil, nonce, data[aesgcm.NonceSize():], nil)
+		if openErr == nil {
+			return decoded, nil
+		}
+		err = storage.ErrUnknown
+	}
+
+	return nil, err
 }
 
 // generateRandom generates random bytes for encrypting.
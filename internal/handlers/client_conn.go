@@ -2,13 +2,21 @@ package handlers
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
 	"log"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
 	"github.com/size12/gophkeeper/internal/storage"
 	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -21,33 +29,191 @@ import (
 type ClientConn interface {
 	Login(credentials entity.UserCredentials) (string, error)
 	Register(credentials entity.UserCredentials) (string, error)
-	GetRecordsInfo(token entity.AuthToken) ([]entity.Record, error)
+	RegisterSRP(login string, verifier entity.SRPVerifier) (string, error)
+	StartLoginSRP(login string, clientPublicKey []byte) (entity.SRPChallenge, error)
+	FinishLoginSRP(loginID string, clientProof []byte) (string, []byte, error)
+	GetRecordsInfo(token entity.AuthToken, query entity.RecordsQuery) (entity.RecordsPage, error)
+	GetChanges(token entity.AuthToken, sinceRevision int64) (entity.Changes, error)
 	GetRecord(token entity.AuthToken, recordID string) (entity.Record, error)
 	DeleteRecord(token entity.AuthToken, recordID string) error
+	GetUsage(token entity.AuthToken) (entity.Usage, error)
 	CreateRecord(token entity.AuthToken, record entity.Record) error
+	UpdateRecord(token entity.AuthToken, record entity.Record) (int64, error)
+	UploadFile(token entity.AuthToken, record entity.Record, r io.Reader) (string, error)
+	DownloadFile(token entity.AuthToken, recordID string, w io.Writer) error
+	ReplaceRecords(token entity.AuthToken, records []entity.Record, files map[string]io.Reader) (int64, error)
+	WatchRecords(ctx context.Context, token entity.AuthToken, handle func(event entity.RecordEvent)) error
+	ChangePassword(token entity.AuthToken, credentials entity.UserCredentials, newPassword string) error
+	ChangePasswordSRP(token entity.AuthToken, proof entity.SRPProof, verifier entity.SRPVerifier) error
+	DeleteAccount(token entity.AuthToken, credentials entity.UserCredentials) error
+	DeleteAccountSRP(token entity.AuthToken, proof entity.SRPProof) error
+	Logout(token entity.AuthToken) error
+	ListSessions(token entity.AuthToken) ([]entity.SessionInfo, error)
+	RevokeSession(token entity.AuthToken, sessionID string) error
+	ListAuditEvents(token entity.AuthToken, query entity.AuditQuery) ([]entity.AuditEvent, error)
+	EnableTOTP(token entity.AuthToken) (entity.TOTPEnrollment, error)
+	ConfirmTOTP(token entity.AuthToken, code string) error
+	DisableTOTP(token entity.AuthToken, code string, credentials entity.UserCredentials, proof entity.SRPProof) error
+	VerifyTOTP(token entity.AuthToken, code string) (string, error)
 }
 
+// refreshBeforeExpiry is how long before access token expiry client refreshes session.
+const refreshBeforeExpiry = time.Minute
+
+// refreshTimeout limits time of session refresh, other requests wait for it.
+const refreshTimeout = 10 * time.Second
+
 // ClientConnGPRC keeps connection with server. Uses gRPC.
+// After login it keeps session and refreshes it before access token expires,
+// so requests are sent with fresh access token instead of given one.
 type ClientConnGPRC struct {
 	pb.GophkeeperClient
+	session entity.Session
+	*sync.Mutex
 }
 
-// NewClientConn connects to server and returning connection.
-func NewClientConn(serverAddress string) *ClientConnGPRC {
-	conn, err := grpc.Dial(serverAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// ClientOption configures client connection.
+type ClientOption func(creds *credentials.TransportCredentials)
+
+// WithClientTLS makes client connect to server with TLS.
+func WithClientTLS(config *tls.Config) ClientOption {
+	return func(creds *credentials.TransportCredentials) {
+		*creds = credentials.NewTLS(config)
+	}
+}
+
+// NewClientConn connects to server and returning connection. Without TLS option connection is insecure.
+func NewClientConn(serverAddress string, opts ...ClientOption) *ClientConnGPRC {
+	creds := insecure.NewCredentials()
+	for _, opt := range opts {
+		opt(&creds)
+	}
+
+	client := &ClientConnGPRC{Mutex: &sync.Mutex{}}
+
+	conn, err := grpc.Dial(serverAddress,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent("gophkeeper-client"),
+		grpc.WithUnaryInterceptor(client.unaryRefreshInterceptor),
+		grpc.WithStreamInterceptor(client.streamRefreshInterceptor),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	c := pb.NewGophkeeperClient(conn)
-	return &ClientConnGPRC{GophkeeperClient: c}
+	client.GophkeeperClient = pb.NewGophkeeperClient(conn)
+	return client
+}
+
+// unaryRefreshInterceptor sends unary request with fresh access token.
+func (conn *ClientConnGPRC) unaryRefreshInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, err := conn.withFreshToken(ctx, method)
+	if err != nil {
+		return err
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// streamRefreshInterceptor opens stream with fresh access token.
+func (conn *ClientConnGPRC) streamRefreshInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := conn.withFreshToken(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+// withFreshToken refreshes session, if access token expires soon, and puts access token of session to request metadata.
+// Error of refresh is returned, so request fails with it and next request refreshes session again.
+func (conn *ClientConnGPRC) withFreshToken(ctx context.Context, method string) (context.Context, error) {
+	if publicMethods[method] {
+		return ctx, nil
+	}
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	if conn.session.AccessToken == "" {
+		return ctx, nil
+	}
+
+	if conn.session.RefreshToken != "" && time.Until(conn.session.ExpiresAt) < refreshBeforeExpiry {
+		err := conn.refreshSession(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set("authToken", string(conn.session.AccessToken))
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// refreshSession gets new session by refresh token. Should be called under lock, so refresh is limited by timeout,
+// and other requests don't wait for it longer.
+func (conn *ClientConnGPRC) refreshSession(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	session, err := conn.GophkeeperClient.RefreshSession(ctx, &pb.RefreshRequest{
+		RefreshToken: conn.session.RefreshToken,
+	})
+
+	code := status.Code(err)
+
+	// Refresh token isn't valid anymore, user should login again. Request is sent with old token and fails itself.
+	if code == codes.Unauthenticated || code == codes.InvalidArgument {
+		conn.session.RefreshToken = ""
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	conn.session = sessionFromProto(session)
+	return nil
+}
+
+// setSession saves session, which was got after login.
+func (conn *ClientConnGPRC) setSession(session entity.Session) {
+	conn.Lock()
+	defer conn.Unlock()
+
+	conn.session = session
+}
+
+// deviceName returns name of this device, which is shown in list of sessions.
+func deviceName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "unknown device"
+	}
+	return name
+}
+
+// sessionFromProto converts protobuf session.
+func sessionFromProto(session *pb.Session) entity.Session {
+	return entity.Session{
+		AccessToken:  entity.AuthToken(session.SessionToken),
+		RefreshToken: session.RefreshToken,
+		ExpiresAt:    time.Unix(session.ExpiresAt, 0),
+		TOTPRequired: session.TotpRequired,
+	}
 }
 
 // Login logins user by login and password.
+// If user enabled TOTP, returns token for VerifyTOTP with ErrTOTPRequired.
 func (conn *ClientConnGPRC) Login(credentials entity.UserCredentials) (string, error) {
 	session, err := conn.GophkeeperClient.Login(context.Background(), &pb.UserCredentials{
-		Login:    credentials.Login,
-		Password: credentials.Password,
+		Login:      credentials.Login,
+		Password:   credentials.Password,
+		DeviceName: deviceName(),
 	})
 
 	code := status.Code(err)
@@ -56,6 +222,10 @@ func (conn *ClientConnGPRC) Login(credentials entity.UserCredentials) (string, e
 		return "", storage.ErrWrongCredentials
 	}
 
+	if code == codes.ResourceExhausted {
+		return "", lockoutFromStatus(err)
+	}
+
 	if code == codes.Internal {
 		return "", storage.ErrUnknown
 	}
@@ -68,14 +238,21 @@ func (conn *ClientConnGPRC) Login(credentials entity.UserCredentials) (string, e
 		return "", err
 	}
 
+	conn.setSession(sessionFromProto(session))
+
+	if session.TotpRequired {
+		return session.SessionToken, ErrTOTPRequired
+	}
+
 	return session.SessionToken, nil
 }
 
 // Register creates new user by login and password.
 func (conn *ClientConnGPRC) Register(credentials entity.UserCredentials) (string, error) {
 	session, err := conn.GophkeeperClient.Register(context.Background(), &pb.UserCredentials{
-		Login:    credentials.Login,
-		Password: credentials.Password,
+		Login:      credentials.Login,
+		Password:   credentials.Password,
+		DeviceName: deviceName(),
 	})
 
 	code := status.Code(err)
@@ -89,35 +266,181 @@ func (conn *ClientConnGPRC) Register(credentials entity.UserCredentials) (string
 		return "", ErrFieldIsEmpty
 	}
 
+	if err != nil {
+		return "", err
+	}
+
+	conn.setSession(sessionFromProto(session))
+	return session.SessionToken, nil
+}
+
+// RegisterSRP creates new user by login and SRP-6a verifier.
+func (conn *ClientConnGPRC) RegisterSRP(login string, verifier entity.SRPVerifier) (string, error) {
+	session, err := conn.GophkeeperClient.RegisterSRP(context.Background(), &pb.SRPRegistration{
+		Login:      login,
+		Salt:       verifier.Salt,
+		Verifier:   verifier.Verifier,
+		DeviceName: deviceName(),
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.AlreadyExists:
+		return "", storage.ErrLoginExists
+	case codes.Internal:
+		return "", storage.ErrUnknown
+	case codes.InvalidArgument:
+		return "", ErrFieldIsEmpty
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	conn.setSession(sessionFromProto(session))
 	return session.SessionToken, nil
 }
 
-// GetRecordsInfo gets all record.
-func (conn *ClientConnGPRC) GetRecordsInfo(token entity.AuthToken) ([]entity.Record, error) {
+// StartLoginSRP sends public key of client and gets challenge of server.
+func (conn *ClientConnGPRC) StartLoginSRP(login string, clientPublicKey []byte) (entity.SRPChallenge, error) {
+	challenge, err := conn.GophkeeperClient.StartLoginSRP(context.Background(), &pb.SRPStart{
+		Login:           login,
+		ClientPublicKey: clientPublicKey,
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return entity.SRPChallenge{}, storage.ErrUnknown
+	case codes.InvalidArgument:
+		return entity.SRPChallenge{}, ErrFieldIsEmpty
+	case codes.Unavailable:
+		return entity.SRPChallenge{}, ErrTooManyLogins
+	case codes.ResourceExhausted:
+		return entity.SRPChallenge{}, lockoutFromStatus(err)
+	}
+
+	if err != nil {
+		return entity.SRPChallenge{}, err
+	}
+
+	return entity.SRPChallenge{
+		LoginID:         challenge.LoginId,
+		Salt:            challenge.Salt,
+		ServerPublicKey: challenge.ServerPublicKey,
+	}, nil
+}
+
+// FinishLoginSRP sends proof of client. Returns session token and proof of server.
+// If user enabled TOTP, returns token for VerifyTOTP and proof of server with ErrTOTPRequired.
+func (conn *ClientConnGPRC) FinishLoginSRP(loginID string, clientProof []byte) (string, []byte, error) {
+	session, err := conn.GophkeeperClient.FinishLoginSRP(context.Background(), &pb.SRPFinish{
+		LoginId:     loginID,
+		ClientProof: clientProof,
+		DeviceName:  deviceName(),
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Unauthenticated:
+		return "", nil, storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return "", nil, lockoutFromStatus(err)
+	case codes.Internal:
+		return "", nil, storage.ErrUnknown
+	case codes.InvalidArgument:
+		return "", nil, ErrFieldIsEmpty
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	conn.setSession(sessionFromProto(session.Session))
+
+	if session.Session.GetTotpRequired() {
+		return session.Session.GetSessionToken(), session.ServerProof, ErrTOTPRequired
+	}
+
+	return session.Session.GetSessionToken(), session.ServerProof, nil
+}
+
+// GetRecordsInfo gets page of records, which are matched by query.
+func (conn *ClientConnGPRC) GetRecordsInfo(token entity.AuthToken, query entity.RecordsQuery) (entity.RecordsPage, error) {
 	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
 
-	gotRecords, err := conn.GophkeeperClient.GetRecordsInfo(ctx, &emptypb.Empty{})
+	types := make([]pb.MessageType, 0, len(query.Types))
+	for _, recordType := range query.Types {
+		types = append(types, pb.MessageType(recordType))
+	}
+
+	gotRecords, err := conn.GophkeeperClient.GetRecordsInfo(ctx, &pb.RecordsQuery{
+		PageSize:  query.PageSize,
+		PageToken: query.PageToken,
+		Types:     types,
+		Metadata:  query.Metadata,
+		Sort:      pb.RecordsSort(query.Sort),
+	})
 
 	code := status.Code(err)
 
 	switch code {
 	case codes.Internal:
-		return nil, storage.ErrUnknown
+		return entity.RecordsPage{}, storage.ErrUnknown
 	case codes.Unauthenticated:
-		return nil, storage.ErrUserUnauthorized
+		return entity.RecordsPage{}, storage.ErrUserUnauthorized
+	case codes.InvalidArgument:
+		return entity.RecordsPage{}, storage.ErrBadQuery
 	}
 
-	records := make([]entity.Record, 0, len(gotRecords.Records))
+	return entity.RecordsPage{
+		Records:       recordsInfoFromProto(gotRecords.Records),
+		NextPageToken: gotRecords.NextPageToken,
+	}, nil
+}
+
+// GetChanges gets records changed after revision.
+func (conn *ClientConnGPRC) GetChanges(token entity.AuthToken, sinceRevision int64) (entity.Changes, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	gotChanges, err := conn.GophkeeperClient.GetChanges(ctx, &pb.ChangesRequest{SinceRevision: sinceRevision})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return entity.Changes{}, storage.ErrUnknown
+	case codes.Unauthenticated:
+		return entity.Changes{}, storage.ErrUserUnauthorized
+	case codes.FailedPrecondition:
+		return entity.Changes{}, storage.ErrResyncRequired
+	}
+
+	return entity.Changes{
+		Revision: gotChanges.Revision,
+		Created:  recordsInfoFromProto(gotChanges.Created),
+		Updated:  recordsInfoFromProto(gotChanges.Updated),
+		Deleted:  gotChanges.Deleted,
+	}, nil
+}
+
+// recordsInfoFromProto converts protobuf records to records info without data.
+func recordsInfoFromProto(gotRecords []*pb.Record) []entity.Record {
+	records := make([]entity.Record, 0, len(gotRecords))
 
-	for _, record := range gotRecords.Records {
+	for _, record := range gotRecords {
 		records = append(records, entity.Record{
 			ID:       record.Id,
 			Metadata: record.Metadata,
 			Type:     entity.RecordType(record.Type),
+			Revision: record.Revision,
 		})
 	}
 
-	return records, nil
+	return records
 }
 
 // GetRecord gets record from server by ID.
@@ -144,6 +467,7 @@ func (conn *ClientConnGPRC) GetRecord(token entity.AuthToken, recordID string) (
 		Metadata: gotRecord.Metadata,
 		Type:     entity.RecordType(gotRecord.Type),
 		Data:     gotRecord.StoredData,
+		Revision: gotRecord.Revision,
 	}
 	return record, nil
 }
@@ -168,6 +492,33 @@ func (conn *ClientConnGPRC) DeleteRecord(token entity.AuthToken, recordID string
 	return nil
 }
 
+// GetUsage gets count of records of user and total size of their data with quota of user.
+func (conn *ClientConnGPRC) GetUsage(token entity.AuthToken) (entity.Usage, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	usage, err := conn.GophkeeperClient.GetUsage(ctx, &emptypb.Empty{})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+	case codes.Unauthenticated:
+		return entity.Usage{}, storage.ErrUserUnauthorized
+	default:
+		return entity.Usage{}, storage.ErrUnknown
+	}
+
+	return entity.Usage{
+		Bytes:   usage.Bytes,
+		Records: usage.Records,
+		Quota: entity.Quota{
+			MaxBytes:      usage.MaxBytes,
+			MaxRecords:    usage.MaxRecords,
+			MaxRecordSize: usage.MaxRecordSize,
+		},
+	}, nil
+}
+
 // CreateRecord creates record and saves to server.
 func (conn *ClientConnGPRC) CreateRecord(token entity.AuthToken, record entity.Record) error {
 	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
@@ -185,7 +536,579 @@ func (conn *ClientConnGPRC) CreateRecord(token entity.AuthToken, record entity.R
 		return storage.ErrUnknown
 	case codes.Unauthenticated:
 		return storage.ErrUserUnauthorized
+	case codes.ResourceExhausted:
+		return storage.ErrQuotaExceeded
 	}
 
 	return nil
 }
+
+// UpdateRecord replaces record on server. Returns new record revision.
+func (conn *ClientConnGPRC) UpdateRecord(token entity.AuthToken, record entity.Record) (int64, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	updated, err := conn.GophkeeperClient.UpdateRecord(ctx, &pb.Record{
+		Id:         record.ID,
+		Type:       pb.MessageType(record.Type),
+		Metadata:   record.Metadata,
+		StoredData: record.Data,
+		Revision:   record.Revision,
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return 0, storage.ErrUnknown
+	case codes.Unauthenticated:
+		return 0, storage.ErrUserUnauthorized
+	case codes.NotFound:
+		return 0, storage.ErrNotFound
+	case codes.Aborted:
+		return 0, storage.ErrRevisionConflict
+	case codes.ResourceExhausted:
+		return 0, storage.ErrQuotaExceeded
+	case codes.InvalidArgument:
+		if status.Convert(err).Message() == recordTypeMessage {
+			return 0, storage.ErrRecordType
+		}
+		return 0, ErrFieldIsEmpty
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return updated.Revision, nil
+}
+
+// UploadFile streams file record to server. First chunk carries record info, others carry data from reader.
+func (conn *ClientConnGPRC) UploadFile(token entity.AuthToken, record entity.Record, r io.Reader) (string, error) {
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token)))
+	defer cancel()
+
+	stream, err := conn.GophkeeperClient.UploadFile(ctx)
+	if err != nil {
+		return "", storage.ErrUnknown
+	}
+
+	err = stream.Send(&pb.FileChunk{Payload: &pb.FileChunk_Info{Info: &pb.Record{
+		Type:     pb.MessageType(record.Type),
+		Metadata: record.Metadata,
+	}}})
+
+	buf := make([]byte, fileChunkSize)
+	for err == nil {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			err = stream.Send(&pb.FileChunk{Payload: &pb.FileChunk_Data{Data: buf[:n]}})
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+
+	// Send returns io.EOF when server has already finished stream, real status comes from CloseAndRecv.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", storage.ErrUnknown
+	}
+
+	recordID, err := stream.CloseAndRecv()
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return "", storage.ErrUnknown
+	case codes.Unauthenticated:
+		return "", storage.ErrUserUnauthorized
+	case codes.InvalidArgument:
+		return "", ErrFieldIsEmpty
+	case codes.ResourceExhausted:
+		return "", storage.ErrQuotaExceeded
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return recordID.Id, nil
+}
+
+// ReplaceRecords replaces data of all user records at once. Data of file records is read from files by record ID.
+// Returns new revision.
+func (conn *ClientConnGPRC) ReplaceRecords(token entity.AuthToken, records []entity.Record, files map[string]io.Reader) (int64, error) {
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token)))
+	defer cancel()
+
+	stream, err := conn.GophkeeperClient.ReplaceRecords(ctx)
+	if err != nil {
+		return 0, storage.ErrUnknown
+	}
+
+	w := &chunkWriter{send: func(data []byte) error {
+		return stream.Send(&pb.FileChunk{Payload: &pb.FileChunk_Data{Data: data}})
+	}}
+
+	for _, record := range records {
+		err = stream.Send(&pb.FileChunk{Payload: &pb.FileChunk_Info{Info: &pb.Record{
+			Id:         record.ID,
+			Type:       pb.MessageType(record.Type),
+			Metadata:   record.Metadata,
+			StoredData: record.Data,
+			Revision:   record.Revision,
+		}}})
+		if err != nil {
+			break
+		}
+
+		if record.Type == entity.TypeFile && files[record.ID] != nil {
+			_, err = io.Copy(w, files[record.ID])
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	// Send returns io.EOF when server has already finished stream, real status comes from CloseAndRecv.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, storage.ErrUnknown
+	}
+
+	result, err := stream.CloseAndRecv()
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return 0, storage.ErrUnknown
+	case codes.Unauthenticated:
+		return 0, storage.ErrUserUnauthorized
+	case codes.InvalidArgument:
+		if status.Convert(err).Message() == recordTypeMessage {
+			return 0, storage.ErrRecordType
+		}
+		return 0, ErrFieldIsEmpty
+	case codes.NotFound:
+		return 0, storage.ErrNotFound
+	case codes.Aborted:
+		return 0, storage.ErrRevisionConflict
+	case codes.ResourceExhausted:
+		return 0, storage.ErrQuotaExceeded
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Revision, nil
+}
+
+// DownloadFile streams file record data from server to writer.
+func (conn *ClientConnGPRC) DownloadFile(token entity.AuthToken, recordID string, w io.Writer) error {
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token)))
+	defer cancel()
+
+	stream, err := conn.GophkeeperClient.DownloadFile(ctx, &pb.RecordID{Id: recordID})
+
+	for err == nil {
+		var chunk *pb.FileChunk
+		chunk, err = stream.Recv()
+		if err != nil {
+			break
+		}
+
+		_, writeErr := w.Write(chunk.GetData())
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.Internal:
+		return storage.ErrUnknown
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.NotFound:
+		return storage.ErrNotFound
+	case codes.FailedPrecondition:
+		return storage.ErrNotFile
+	}
+
+	return err
+}
+
+// WatchRecords calls handle for every record event from server until context is done or stream breaks.
+func (conn *ClientConnGPRC) WatchRecords(ctx context.Context, token entity.AuthToken, handle func(event entity.RecordEvent)) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authToken", string(token))
+
+	stream, err := conn.GophkeeperClient.WatchRecords(ctx, &emptypb.Empty{})
+	if err != nil {
+		return storage.ErrUnknown
+	}
+
+	for {
+		event, err := stream.Recv()
+
+		if errors.Is(err, io.EOF) || ctx.Err() != nil {
+			return nil
+		}
+
+		switch status.Code(err) {
+		case codes.OK:
+		case codes.Unauthenticated:
+			return storage.ErrUserUnauthorized
+		default:
+			return storage.ErrUnknown
+		}
+
+		handle(entity.RecordEvent{
+			Type:     entity.EventType(event.Type),
+			RecordID: event.RecordId,
+		})
+	}
+}
+
+// Logout ends session on server. Session is forgotten by client even if server returned error.
+func (conn *ClientConnGPRC) Logout(token entity.AuthToken) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.Logout(ctx, &emptypb.Empty{})
+
+	conn.setSession(entity.Session{})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	}
+
+	return storage.ErrUnknown
+}
+
+// ChangePassword changes password of user. Current password is given in credentials.
+func (conn *ClientConnGPRC) ChangePassword(token entity.AuthToken, credentials entity.UserCredentials, newPassword string) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.ChangePassword(ctx, &pb.ChangePasswordRequest{
+		Login:       credentials.Login,
+		OldPassword: credentials.Password,
+		NewPassword: newPassword,
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.PermissionDenied:
+		return storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return lockoutFromStatus(err)
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// ChangePasswordSRP changes password of SRP user. Current password is proved by proof, new one is given as verifier.
+func (conn *ClientConnGPRC) ChangePasswordSRP(token entity.AuthToken, proof entity.SRPProof, verifier entity.SRPVerifier) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.ChangePasswordSRP(ctx, &pb.SRPPasswordChange{
+		Proof:    srpProofToProto(proof),
+		Salt:     verifier.Salt,
+		Verifier: verifier.Verifier,
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.PermissionDenied:
+		return storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return lockoutFromStatus(err)
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// srpProofToProto converts SRP proof to protobuf.
+func srpProofToProto(proof entity.SRPProof) *pb.SRPProof {
+	return &pb.SRPProof{
+		LoginId:     proof.LoginID,
+		ClientProof: proof.ClientProof,
+	}
+}
+
+// DeleteAccount deletes user with all his data. Password is given in credentials. Session is forgotten after deletion.
+func (conn *ClientConnGPRC) DeleteAccount(token entity.AuthToken, credentials entity.UserCredentials) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.DeleteAccount(ctx, &pb.UserCredentials{
+		Login:    credentials.Login,
+		Password: credentials.Password,
+	})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		conn.setSession(entity.Session{})
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.PermissionDenied:
+		return storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return lockoutFromStatus(err)
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// DeleteAccountSRP deletes SRP user with all his data. Password is proved by proof. Session is forgotten after deletion.
+func (conn *ClientConnGPRC) DeleteAccountSRP(token entity.AuthToken, proof entity.SRPProof) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.DeleteAccountSRP(ctx, srpProofToProto(proof))
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		conn.setSession(entity.Session{})
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.PermissionDenied:
+		return storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return lockoutFromStatus(err)
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// ListSessions gets active sessions of user.
+func (conn *ClientConnGPRC) ListSessions(token entity.AuthToken) ([]entity.SessionInfo, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	list, err := conn.GophkeeperClient.ListSessions(ctx, &emptypb.Empty{})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+	case codes.Unauthenticated:
+		return nil, storage.ErrUserUnauthorized
+	default:
+		return nil, storage.ErrUnknown
+	}
+
+	sessions := make([]entity.SessionInfo, 0, len(list.Sessions))
+	for _, session := range list.Sessions {
+		sessions = append(sessions, entity.SessionInfo{
+			ID: session.Id,
+			Device: entity.Device{
+				Name:      session.DeviceName,
+				IP:        session.Ip,
+				UserAgent: session.UserAgent,
+			},
+			CreatedAt:  time.Unix(session.CreatedAt, 0),
+			LastSeenAt: time.Unix(session.LastSeenAt, 0),
+			Current:    session.Current,
+		})
+	}
+
+	return sessions, nil
+}
+
+// ListAuditEvents gets audit log of user.
+func (conn *ClientConnGPRC) ListAuditEvents(token entity.AuthToken, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	request := &pb.AuditQuery{Limit: query.Limit}
+	if !query.From.IsZero() {
+		request.From = query.From.Unix()
+	}
+	if !query.To.IsZero() {
+		request.To = query.To.Unix()
+	}
+
+	list, err := conn.GophkeeperClient.ListAuditEvents(ctx, request)
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+	case codes.Unauthenticated:
+		return nil, storage.ErrUserUnauthorized
+	case codes.InvalidArgument:
+		return nil, storage.ErrBadQuery
+	default:
+		return nil, storage.ErrUnknown
+	}
+
+	events := make([]entity.AuditEvent, 0, len(list.Events))
+	for _, event := range list.Events {
+		events = append(events, entity.AuditEvent{
+			Action:   entity.AuditAction(event.Action),
+			RecordID: event.RecordId,
+			IP:       event.Ip,
+			Time:     time.Unix(event.Time, 0),
+			Result:   event.Result,
+		})
+	}
+
+	return events, nil
+}
+
+// RevokeSession ends session of user by ID.
+func (conn *ClientConnGPRC) RevokeSession(token entity.AuthToken, sessionID string) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.RevokeSession(ctx, &pb.SessionID{Id: sessionID})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.NotFound:
+		return storage.ErrNotFound
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// EnableTOTP gets new TOTP secret and backup codes of user.
+func (conn *ClientConnGPRC) EnableTOTP(token entity.AuthToken) (entity.TOTPEnrollment, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	enrollment, err := conn.GophkeeperClient.EnableTOTP(ctx, &emptypb.Empty{})
+
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+	case codes.Unauthenticated:
+		return entity.TOTPEnrollment{}, storage.ErrUserUnauthorized
+	case codes.AlreadyExists:
+		return entity.TOTPEnrollment{}, ErrTOTPEnabled
+	default:
+		return entity.TOTPEnrollment{}, storage.ErrUnknown
+	}
+
+	return entity.TOTPEnrollment{
+		Secret:      enrollment.Secret,
+		BackupCodes: enrollment.BackupCodes,
+	}, nil
+}
+
+// ConfirmTOTP confirms TOTP secret of user by code from authenticator app.
+func (conn *ClientConnGPRC) ConfirmTOTP(token entity.AuthToken, code string) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.ConfirmTOTP(ctx, &pb.TOTPCode{Code: code})
+
+	return totpError(err)
+}
+
+// DisableTOTP disables TOTP of user. Code is TOTP code or backup code. Password is given in credentials
+// or proved by SRP proof.
+func (conn *ClientConnGPRC) DisableTOTP(token entity.AuthToken, code string, credentials entity.UserCredentials, proof entity.SRPProof) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	_, err := conn.GophkeeperClient.DisableTOTP(ctx, &pb.DisableTOTPRequest{
+		Code:     code,
+		Login:    credentials.Login,
+		Password: credentials.Password,
+		Proof:    srpProofToProto(proof),
+	})
+
+	return totpError(err)
+}
+
+// VerifyTOTP finishes login by TOTP code or backup code. Token is the one, which was returned by login.
+func (conn *ClientConnGPRC) VerifyTOTP(token entity.AuthToken, code string) (string, error) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", string(token))
+
+	session, err := conn.GophkeeperClient.VerifyTOTP(ctx, &pb.TOTPCode{Code: code, DeviceName: deviceName()})
+
+	err = totpError(err)
+	if err != nil {
+		return "", err
+	}
+
+	conn.setSession(sessionFromProto(session))
+	return session.SessionToken, nil
+}
+
+// totpError converts error of TOTP endpoints.
+func totpError(err error) error {
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated:
+		return storage.ErrUserUnauthorized
+	case codes.PermissionDenied:
+		return storage.ErrWrongCredentials
+	case codes.ResourceExhausted:
+		return lockoutFromStatus(err)
+	case codes.FailedPrecondition:
+		return storage.ErrNotFound
+	case codes.AlreadyExists:
+		return ErrTOTPEnabled
+	case codes.InvalidArgument:
+		return ErrFieldIsEmpty
+	}
+
+	return storage.ErrUnknown
+}
+
+// lockoutFromStatus gets lockout of login from status error with retry info.
+func lockoutFromStatus(err error) error {
+	lockout := &LockoutError{}
+
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			lockout.RetryAfter = info.RetryDelay.AsDuration()
+		}
+	}
+
+	return lockout
+}
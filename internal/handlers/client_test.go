@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"io"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/size12/gophkeeper/internal/entity"
 	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	"github.com/size12/gophkeeper/internal/srp"
 	"github.com/size12/gophkeeper/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -42,7 +47,7 @@ func TestClient_Register(t *testing.T) {
 				})
 				assert.NoError(t, err)
 				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
-				assert.Equal(t, []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24, 0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}, handlers.masterKey)
+				assert.Equal(t, []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}, handlers.masterKey)
 			},
 		},
 		{
@@ -95,7 +100,7 @@ func TestClient_Login(t *testing.T) {
 				})
 				assert.NoError(t, err)
 				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
-				assert.Equal(t, []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24, 0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}, handlers.masterKey)
+				assert.Equal(t, []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}, handlers.masterKey)
 			},
 		},
 		{
@@ -122,6 +127,459 @@ func TestClient_Login(t *testing.T) {
 	}
 }
 
+func TestClient_TOTP(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+
+	credentials := entity.UserCredentials{
+		Login:     "Login",
+		Password:  "Password",
+		MasterKey: []byte("hello"),
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Login user with TOTP",
+			func() {
+				conn.On("Login", credentials).Return("totpToken", ErrTOTPRequired).Once()
+			},
+			func() {
+				err := handlers.Login(credentials)
+				assert.Equal(t, ErrTOTPRequired, err)
+				assert.Empty(t, handlers.authToken)
+				assert.Nil(t, handlers.masterKey)
+			},
+		},
+		{
+			"Finish login with wrong code",
+			func() {
+				conn.On("VerifyTOTP", entity.AuthToken("totpToken"), "000000").Return("", storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				err := handlers.LoginTOTP("000000")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+				assert.Empty(t, handlers.authToken)
+			},
+		},
+		{
+			"Finish login",
+			func() {
+				conn.On("VerifyTOTP", entity.AuthToken("totpToken"), "123456").Return("token", nil).Once()
+			},
+			func() {
+				err := handlers.LoginTOTP("123456")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
+				assert.Equal(t, "Login", handlers.userLogin)
+				assert.Equal(t, deriveMasterKey([]byte("hello")), handlers.masterKey)
+			},
+		},
+		{
+			"Finish login, which wasn't started",
+			func() {},
+			func() {
+				assert.Equal(t, storage.ErrUserUnauthorized, handlers.LoginTOTP("123456"))
+			},
+		},
+		{
+			"Enable TOTP",
+			func() {
+				conn.On("EnableTOTP", entity.AuthToken("token")).
+					Return(entity.TOTPEnrollment{Secret: "SECRET", BackupCodes: []string{"abcd-efgh"}}, nil).Once()
+			},
+			func() {
+				enrollment, err := handlers.EnableTOTP()
+				assert.NoError(t, err)
+				assert.Equal(t, "SECRET", enrollment.Secret)
+				assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/Gophkeeper:Login?"))
+			},
+		},
+		{
+			"Confirm TOTP",
+			func() {
+				conn.On("ConfirmTOTP", entity.AuthToken("token"), "123456").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.ConfirmTOTP("123456"))
+			},
+		},
+		{
+			"Disable TOTP with password",
+			func() {
+				conn.On("DisableTOTP", entity.AuthToken("token"), "123456", entity.UserCredentials{
+					Login:    "Login",
+					Password: "Password",
+				}, entity.SRPProof{}).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.DisableTOTP("123456", "Password"))
+			},
+		},
+		{
+			"Disable TOTP with empty code",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DisableTOTP("", "Password"))
+			},
+		},
+		{
+			"Disable TOTP without password",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DisableTOTP("123456", ""))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_SRP(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.AuthMethod = AuthSRP
+
+	credentials := entity.UserCredentials{
+		Login:     "Login",
+		Password:  "Password",
+		MasterKey: []byte("hello"),
+	}
+
+	var registered entity.SRPVerifier
+
+	// startServer answers to login as server, which knows registered verifier.
+	startServer := func(serverProof func([]byte) []byte) {
+		server, err := srp.NewServer("Login", registered.Salt, registered.Verifier)
+		assert.NoError(t, err)
+
+		var clientPublicKey []byte
+		conn.On("StartLoginSRP", "Login", mock.Anything).Return(func(_ string, publicKey []byte) entity.SRPChallenge {
+			clientPublicKey = publicKey
+			return entity.SRPChallenge{LoginID: "loginID", Salt: registered.Salt, ServerPublicKey: server.PublicKey()}
+		}, nil).Once()
+		conn.On("FinishLoginSRP", "loginID", mock.Anything).Return("token", func(_ string, clientProof []byte) []byte {
+			proof, err := server.Verify(clientPublicKey, clientProof)
+			assert.NoError(t, err)
+			return serverProof(proof)
+		}, nil).Once()
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Register with verifier",
+			func() {
+				conn.On("RegisterSRP", "Login", mock.Anything).Return(func(_ string, verifier entity.SRPVerifier) string {
+					registered = verifier
+					return "token"
+				}, nil).Once()
+			},
+			func() {
+				err := handlers.Register(credentials)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
+				assert.Len(t, registered.Salt, srp.SaltSize)
+			},
+		},
+		{
+			"Login by SRP handshake",
+			func() {
+				startServer(func(proof []byte) []byte { return proof })
+			},
+			func() {
+				handlers.authToken = ""
+				err := handlers.Login(credentials)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
+			},
+		},
+		{
+			"Login to server, which can't prove it knows verifier",
+			func() {
+				startServer(func(proof []byte) []byte { return []byte("fake proof") })
+			},
+			func() {
+				handlers.authToken = ""
+				err := handlers.Login(credentials)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+				assert.Empty(t, handlers.authToken)
+			},
+		},
+		{
+			"Change password by SRP proof, passwords aren't sent",
+			func() {
+				server, err := srp.NewServer("Login", registered.Salt, registered.Verifier)
+				assert.NoError(t, err)
+
+				var clientPublicKey []byte
+				conn.On("StartLoginSRP", "Login", mock.Anything).Return(func(_ string, publicKey []byte) entity.SRPChallenge {
+					clientPublicKey = publicKey
+					return entity.SRPChallenge{LoginID: "loginID", Salt: registered.Salt, ServerPublicKey: server.PublicKey()}
+				}, nil).Once()
+				conn.On("ChangePasswordSRP", entity.AuthToken("token"), mock.Anything, mock.Anything).Return(func(_ entity.AuthToken, proof entity.SRPProof, verifier entity.SRPVerifier) error {
+					assert.Equal(t, "loginID", proof.LoginID)
+					_, err := server.Verify(clientPublicKey, proof.ClientProof)
+					assert.NoError(t, err)
+					assert.Len(t, verifier.Salt, srp.SaltSize)
+					assert.NotEqual(t, registered.Verifier, verifier.Verifier)
+					return nil
+				}).Once()
+			},
+			func() {
+				handlers.authToken = "token"
+				assert.NoError(t, handlers.ChangePassword("Password", "NewPassword"))
+			},
+		},
+		{
+			"Delete account by SRP proof, password isn't sent",
+			func() {
+				server, err := srp.NewServer("Login", registered.Salt, registered.Verifier)
+				assert.NoError(t, err)
+
+				var clientPublicKey []byte
+				conn.On("StartLoginSRP", "Login", mock.Anything).Return(func(_ string, publicKey []byte) entity.SRPChallenge {
+					clientPublicKey = publicKey
+					return entity.SRPChallenge{LoginID: "loginID", Salt: registered.Salt, ServerPublicKey: server.PublicKey()}
+				}, nil).Once()
+				conn.On("DeleteAccountSRP", entity.AuthToken("token"), mock.Anything).Return(func(_ entity.AuthToken, proof entity.SRPProof) error {
+					assert.Equal(t, "loginID", proof.LoginID)
+					_, err := server.Verify(clientPublicKey, proof.ClientProof)
+					assert.NoError(t, err)
+					return nil
+				}).Once()
+			},
+			func() {
+				handlers.authToken = "token"
+				assert.NoError(t, handlers.DeleteAccount("Password"))
+				assert.Empty(t, handlers.authToken)
+				assert.Nil(t, handlers.masterKey)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_Logout(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Logout",
+			func() {
+				conn.On("Logout", entity.AuthToken("token")).Return(nil).Once()
+			},
+			func() {
+				err := handlers.Logout()
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Logout, but server will return error",
+			func() {
+				conn.On("Logout", entity.AuthToken("token")).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				err := handlers.Logout()
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		handlers.authToken = "token"
+		handlers.masterKey = []byte("key")
+		handlers.records = map[string]entity.Record{"1": {ID: "1"}}
+		test.mock()
+		test.valid()
+		assert.Empty(t, handlers.authToken)
+		assert.Empty(t, handlers.masterKey)
+		assert.Empty(t, handlers.records)
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_Sessions(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"List sessions",
+			func() {
+				conn.On("ListSessions", entity.AuthToken("token")).Return([]entity.SessionInfo{{ID: "sessionID"}}, nil).Once()
+			},
+			func() {
+				sessions, err := handlers.ListSessions()
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.SessionInfo{{ID: "sessionID"}}, sessions)
+			},
+		},
+		{
+			"Revoke session",
+			func() {
+				conn.On("RevokeSession", entity.AuthToken("token"), "sessionID").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.RevokeSession("sessionID"))
+			},
+		},
+		{
+			"Revoke session, but server will return error",
+			func() {
+				conn.On("RevokeSession", entity.AuthToken("token"), "sessionID").Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrNotFound, handlers.RevokeSession("sessionID"))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_ChangePassword(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.userLogin = "Login"
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Change password",
+			func() {
+				conn.On("ChangePassword", entity.AuthToken("token"), entity.UserCredentials{
+					Login:    "Login",
+					Password: "Password",
+				}, "NewPassword").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.ChangePassword("Password", "NewPassword"))
+			},
+		},
+		{
+			"Change password with wrong current password",
+			func() {
+				conn.On("ChangePassword", entity.AuthToken("token"), entity.UserCredentials{
+					Login:    "Login",
+					Password: "Wrong",
+				}, "NewPassword").Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, handlers.ChangePassword("Wrong", "NewPassword"))
+			},
+		},
+		{
+			"Change password to empty one",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.ChangePassword("Password", ""))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_DeleteAccount(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.userLogin = "Login"
+	handlers.masterKey = deriveMasterKey([]byte("master"))
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete account with wrong password",
+			func() {
+				conn.On("DeleteAccount", entity.AuthToken("token"), entity.UserCredentials{
+					Login:    "Login",
+					Password: "Wrong",
+				}).Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, handlers.DeleteAccount("Wrong"))
+				assert.Equal(t, entity.AuthToken("token"), handlers.authToken)
+			},
+		},
+		{
+			"Delete account with empty password",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DeleteAccount(""))
+			},
+		},
+		{
+			"Delete account, user data is forgotten",
+			func() {
+				conn.On("DeleteAccount", entity.AuthToken("token"), entity.UserCredentials{
+					Login:    "Login",
+					Password: "Password",
+				}).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.DeleteAccount("Password"))
+				assert.Empty(t, handlers.authToken)
+				assert.Empty(t, handlers.userLogin)
+				assert.Nil(t, handlers.masterKey)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
 func TestClient_GetRecordsInfo(t *testing.T) {
 	conn := mocks.NewClientConn(t)
 	handlers := NewClientHandlers(conn)
@@ -135,23 +593,151 @@ func TestClient_GetRecordsInfo(t *testing.T) {
 		{
 			"Get records info",
 			func() {
-				conn.On("GetRecordsInfo", entity.AuthToken("token")).Return([]entity.Record{}, nil).Once()
+				conn.On("GetRecordsInfo", entity.AuthToken("token"), entity.RecordsQuery{Metadata: "text"}).
+					Return(entity.RecordsPage{Records: []entity.Record{}, NextPageToken: "next"}, nil).Once()
 			},
 			func() {
-				records, err := handlers.GetRecordsInfo()
+				page, err := handlers.GetRecordsInfo(entity.RecordsQuery{Metadata: "text"})
 				assert.NoError(t, err)
-				assert.Equal(t, []entity.Record{}, records)
+				assert.Equal(t, entity.RecordsPage{Records: []entity.Record{}, NextPageToken: "next"}, page)
 			},
 		},
 		{
 			"Get records info, but return error",
 			func() {
-				conn.On("GetRecordsInfo", entity.AuthToken("token")).Return([]entity.Record{}, storage.ErrUserUnauthorized).Once()
+				conn.On("GetRecordsInfo", entity.AuthToken("token"), entity.RecordsQuery{}).Return(entity.RecordsPage{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				page, err := handlers.GetRecordsInfo(entity.RecordsQuery{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Empty(t, page)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_SyncRecords(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Sync records first time",
+			func() {
+				conn.On("GetChanges", entity.AuthToken("token"), int64(0)).Return(entity.Changes{
+					Revision: 3,
+					Created: []entity.Record{
+						{ID: "1", Metadata: "b", Revision: 1},
+						{ID: "2", Metadata: "a", Revision: 2},
+						{ID: "3", Metadata: "c", Revision: 3},
+					},
+				}, nil).Once()
+			},
+			func() {
+				records, err := handlers.SyncRecords()
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.Record{
+					{ID: "2", Metadata: "a", Revision: 2},
+					{ID: "1", Metadata: "b", Revision: 1},
+					{ID: "3", Metadata: "c", Revision: 3},
+				}, records)
+			},
+		},
+		{
+			"Sync only changed records",
+			func() {
+				conn.On("GetChanges", entity.AuthToken("token"), int64(3)).Return(entity.Changes{
+					Revision: 5,
+					Updated:  []entity.Record{{ID: "1", Metadata: "d", Revision: 4}},
+					Deleted:  []string{"3"},
+				}, nil).Once()
 			},
 			func() {
-				records, err := handlers.GetRecordsInfo()
+				records, err := handlers.SyncRecords()
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.Record{
+					{ID: "2", Metadata: "a", Revision: 2},
+					{ID: "1", Metadata: "d", Revision: 4},
+				}, records)
+			},
+		},
+		{
+			"Sync records, but return error",
+			func() {
+				conn.On("GetChanges", entity.AuthToken("token"), int64(5)).Return(entity.Changes{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				records, err := handlers.SyncRecords()
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Empty(t, records)
+			},
+		},
+		{
+			"Sync records, which deleted records are pruned on server, all records are listed again",
+			func() {
+				conn.On("GetChanges", entity.AuthToken("token"), int64(5)).Return(entity.Changes{}, storage.ErrResyncRequired).Once()
+				conn.On("GetChanges", entity.AuthToken("token"), int64(0)).Return(entity.Changes{
+					Revision: 9,
+					Created:  []entity.Record{{ID: "1", Metadata: "d", Revision: 4}},
+				}, nil).Once()
+			},
+			func() {
+				records, err := handlers.SyncRecords()
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.Record{{ID: "1", Metadata: "d", Revision: 4}}, records, "record, which tombstone was pruned, should be dropped")
+				assert.Equal(t, int64(9), handlers.revision)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_WatchRecords(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Watch records",
+			func() {
+				conn.On("WatchRecords", context.Background(), entity.AuthToken("token"), mock.Anything).Return(nil).Once()
+			},
+			func() {
+				err := handlers.WatchRecords(context.Background(), func(event entity.RecordEvent) {})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Watch records, but return error",
+			func() {
+				conn.On("WatchRecords", context.Background(), entity.AuthToken("token"), mock.Anything).Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				err := handlers.WatchRecords(context.Background(), func(event entity.RecordEvent) {})
 				assert.Equal(t, storage.ErrUserUnauthorized, err)
-				assert.Equal(t, []entity.Record{}, records)
 			},
 		},
 	}
@@ -168,7 +754,10 @@ func TestClient_GetRecord(t *testing.T) {
 	conn := mocks.NewClientConn(t)
 	handlers := NewClientHandlers(conn)
 	handlers.authToken = "token"
-	handlers.masterKey = []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24, 0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
+
+	sealed, err := encryptWith(handlers.masterKey, []byte("hello!"))
+	assert.NoError(t, err)
 
 	tc := []struct {
 		name  string
@@ -179,7 +768,7 @@ func TestClient_GetRecord(t *testing.T) {
 			"Get record",
 			func() {
 				conn.On("GetRecord", entity.AuthToken("token"), "1").Return(entity.Record{
-					Data: []byte{0xcb, 0x1a, 0x6d, 0xb2, 0x12, 0xe2, 0x34, 0x9d, 0xf7, 0xe4, 0x2b, 0x9f, 0xa2, 0x9e, 0xd2, 0x12, 0x7, 0x2d, 0xa9, 0xff, 0xa, 0xd5, 0x88, 0x2b, 0x88, 0x6d, 0x61, 0x7, 0xf8, 0xd1, 0xc4, 0xf9, 0x17, 0xbc},
+					Data: sealed,
 				}, nil).Once()
 			},
 			func() {
@@ -190,6 +779,18 @@ func TestClient_GetRecord(t *testing.T) {
 				}, record)
 			},
 		},
+		{
+			"Get record sealed with legacy key, it's opened only by master key rotation",
+			func() {
+				conn.On("GetRecord", entity.AuthToken("token"), "1").Return(entity.Record{
+					Data: []byte{0xcb, 0x1a, 0x6d, 0xb2, 0x12, 0xe2, 0x34, 0x9d, 0xf7, 0xe4, 0x2b, 0x9f, 0xa2, 0x9e, 0xd2, 0x12, 0x7, 0x2d, 0xa9, 0xff, 0xa, 0xd5, 0x88, 0x2b, 0x88, 0x6d, 0x61, 0x7, 0xf8, 0xd1, 0xc4, 0xf9, 0x17, 0xbc},
+				}, nil).Once()
+			},
+			func() {
+				_, err := handlers.GetRecord("1")
+				assert.Equal(t, ErrLegacyRecords, err)
+			},
+		},
 		{
 			"Get record, but not found",
 			func() {
@@ -228,7 +829,7 @@ func TestClient_DeleteRecord(t *testing.T) {
 	conn := mocks.NewClientConn(t)
 	handlers := NewClientHandlers(conn)
 	handlers.authToken = "token"
-	handlers.masterKey = []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24, 0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
 
 	tc := []struct {
 		name  string
@@ -269,7 +870,7 @@ func TestClient_CreateRecord(t *testing.T) {
 	conn := mocks.NewClientConn(t)
 	handlers := NewClientHandlers(conn)
 	handlers.authToken = "token"
-	handlers.masterKey = []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24, 0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
 
 	tc := []struct {
 		name  string
@@ -322,6 +923,170 @@ func TestClient_CreateRecord(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateRecord(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Update record",
+			func() {
+				conn.On("UpdateRecord", entity.AuthToken("token"), mock.MatchedBy(func(record entity.Record) bool {
+					decoded, err := handlers.decrypt(record.Data)
+					return err == nil && string(decoded) == "hello!" && record.ID == "1" && record.Revision == 1
+				})).Return(int64(2), nil).Once()
+			},
+			func() {
+				revision, err := handlers.UpdateRecord(entity.Record{
+					ID:       "1",
+					Data:     []byte("hello!"),
+					Revision: 1,
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+			},
+		},
+		{
+			"Update record, but it was changed by another client",
+			func() {
+				conn.On("UpdateRecord", entity.AuthToken("token"), mock.AnythingOfType("entity.Record")).Return(int64(0), storage.ErrRevisionConflict).Once()
+			},
+			func() {
+				_, err := handlers.UpdateRecord(entity.Record{
+					ID:       "1",
+					Data:     []byte("hello!"),
+					Revision: 1,
+				})
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
+
+func TestClient_UploadFile(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
+
+	conn.On("UploadFile", entity.AuthToken("token"), entity.Record{Metadata: "file.txt", Type: entity.TypeFile}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			encrypted, err := io.ReadAll(args.Get(2).(io.Reader))
+			assert.NoError(t, err)
+			assert.NotEqual(t, []byte("file content"), encrypted)
+		}).Return("1", nil).Once()
+
+	err := handlers.UploadFile(entity.Record{Metadata: "file.txt"}, strings.NewReader("file content"))
+	assert.NoError(t, err)
+	conn.AssertExpectations(t)
+}
+
+func TestClient_GetFileRecord(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = []byte{0x2c, 0xf2, 0x4d, 0xba, 0x5f, 0xb0, 0xa3, 0x0e, 0x26, 0xe8, 0x3b, 0x2a, 0xc5, 0xb9, 0xe2, 0x9e, 0x1b, 0x16, 0x1e, 0x5c, 0x1f, 0xa7, 0x42, 0x5e, 0x73, 0x04, 0x33, 0x62, 0x93, 0x8b, 0x98, 0x24}
+
+	filename := t.TempDir() + "/file.txt"
+
+	aead, err := handlers.aead()
+	assert.NoError(t, err)
+	encrypted, err := io.ReadAll(newEncryptReader(aead, strings.NewReader("file content")))
+	assert.NoError(t, err)
+
+	conn.On("GetRecord", entity.AuthToken("token"), "1").Return(entity.Record{ID: "1", Metadata: filename, Type: entity.TypeFile}, nil).Once()
+	conn.On("DownloadFile", entity.AuthToken("token"), "1", mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, err := args.Get(2).(io.Writer).Write(encrypted)
+			assert.NoError(t, err)
+		}).Return(nil).Once()
+
+	record, err := handlers.GetRecord("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Saved file successfully to "+filename+".", string(record.Data))
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "file content", string(data))
+	conn.AssertExpectations(t)
+}
+
+func TestClient_GetLegacyFileRecord(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = deriveMasterKey([]byte("master key"))
+
+	filename := t.TempDir() + "/file.txt"
+
+	chunked, err := io.ReadAll(newEncryptReader(legacyAEAD, strings.NewReader("file content")))
+	assert.NoError(t, err)
+	blob, err := encryptWith(legacyMasterKey, []byte("file content"))
+	assert.NoError(t, err)
+
+	for _, encrypted := range [][]byte{chunked, blob} {
+		conn.On("GetRecord", entity.AuthToken("token"), "1").Return(entity.Record{ID: "1", Metadata: filename, Type: entity.TypeFile}, nil).Once()
+		conn.On("DownloadFile", entity.AuthToken("token"), "1", mock.Anything).
+			Run(func(args mock.Arguments) {
+				_, err := args.Get(2).(io.Writer).Write(encrypted)
+				assert.NoError(t, err)
+			}).Return(nil).Once()
+
+		_, err = handlers.GetRecord("1")
+		assert.Equal(t, ErrLegacyRecords, err)
+		assert.NoFileExists(t, filename)
+	}
+
+	conn.AssertExpectations(t)
+}
+
+func TestClient_HasLegacyRecords(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = deriveMasterKey([]byte("master key"))
+
+	sealed, err := encryptWith(handlers.masterKey, []byte("new"))
+	assert.NoError(t, err)
+	legacy, err := encryptWith(legacyMasterKey, []byte("old"))
+	assert.NoError(t, err)
+
+	infos := entity.RecordsPage{Records: []entity.Record{
+		{ID: "file", Type: entity.TypeFile},
+		{ID: "new", Type: entity.TypeText},
+		{ID: "old", Type: entity.TypeText},
+	}}
+
+	conn.On("GetRecordsInfo", entity.AuthToken("token"), mock.Anything).Return(infos, nil).Twice()
+	conn.On("GetRecord", entity.AuthToken("token"), "new").Return(entity.Record{ID: "new", Data: sealed}, nil).Twice()
+	conn.On("GetRecord", entity.AuthToken("token"), "old").Return(entity.Record{ID: "old", Data: legacy}, nil).Once()
+
+	found, err := handlers.HasLegacyRecords()
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	conn.On("GetRecord", entity.AuthToken("token"), "old").Return(entity.Record{ID: "old", Data: sealed}, nil).Once()
+
+	found, err = handlers.HasLegacyRecords()
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	conn.AssertExpectations(t)
+}
+
 func Test_GenerateRandom(t *testing.T) {
 	bytes, err := generateRandom(12)
 	assert.NoError(t, err)
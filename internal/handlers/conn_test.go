@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/config"
 	"github.com/size12/gophkeeper/internal/entity"
@@ -10,12 +14,21 @@ import (
 	"github.com/size12/gophkeeper/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// testAuthenticator returns authenticator, which accepts "token" as token of user "userID".
+func testAuthenticator(t *testing.T) *mocks.Authenticator {
+	auth := mocks.NewAuthenticator(t)
+	auth.On("ValidateToken", entity.AuthToken("token")).
+		Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeRecords}}, nil).Maybe()
+	return auth
+}
+
 func TestCreateUser(t *testing.T) {
 	serverCfg := config.GetServerConfig()
 	handlers := mocks.NewServerHandlers(t)
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, testAuthenticator(t))
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
@@ -29,10 +42,10 @@ func TestCreateUser(t *testing.T) {
 		{
 			"Create user",
 			func() {
-				handlers.On("CreateUser", entity.UserCredentials{
+				handlers.On("CreateUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken("token"), nil).Once()
+				}, mock.Anything).Return(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
 			},
 			func() {
 				token, err := client.Register(entity.UserCredentials{
@@ -46,10 +59,10 @@ func TestCreateUser(t *testing.T) {
 		{
 			"Create user, but server will return error",
 			func() {
-				handlers.On("CreateUser", entity.UserCredentials{
+				handlers.On("CreateUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken(""), storage.ErrLoginExists).Once()
+				}, mock.Anything).Return(entity.Session{}, storage.ErrLoginExists).Once()
 			},
 			func() {
 				token, err := client.Register(entity.UserCredentials{
@@ -63,10 +76,10 @@ func TestCreateUser(t *testing.T) {
 		{
 			"Create user, but server will return unknown error",
 			func() {
-				handlers.On("CreateUser", entity.UserCredentials{
+				handlers.On("CreateUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken(""), storage.ErrUnknown).Once()
+				}, mock.Anything).Return(entity.Session{}, storage.ErrUnknown).Once()
 			},
 			func() {
 				token, err := client.Register(entity.UserCredentials{
@@ -89,14 +102,14 @@ func TestCreateUser(t *testing.T) {
 
 func TestLoginUser(t *testing.T) {
 	serverCfg := config.GetServerConfig()
-	client := NewClientConn(serverCfg.RunAddress)
-
 	handlers := mocks.NewServerHandlers(t)
 
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, testAuthenticator(t))
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
+	client := NewClientConn(serverCfg.RunAddress)
+
 	tc := []struct {
 		name  string
 		mock  func()
@@ -105,10 +118,12 @@ func TestLoginUser(t *testing.T) {
 		{
 			"Login user",
 			func() {
-				handlers.On("LoginUser", entity.UserCredentials{
+				handlers.On("LoginUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken("token"), nil).Once()
+				}, mock.MatchedBy(func(device entity.Device) bool {
+					return device.Name != "" && device.IP != "" && strings.HasPrefix(device.UserAgent, "gophkeeper-client")
+				})).Return(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
 			},
 			func() {
 				token, err := client.Login(entity.UserCredentials{
@@ -122,10 +137,10 @@ func TestLoginUser(t *testing.T) {
 		{
 			"Login user, but server will return error",
 			func() {
-				handlers.On("LoginUser", entity.UserCredentials{
+				handlers.On("LoginUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken(""), storage.ErrWrongCredentials).Once()
+				}, mock.Anything).Return(entity.Session{}, storage.ErrWrongCredentials).Once()
 			},
 			func() {
 				token, err := client.Login(entity.UserCredentials{
@@ -136,13 +151,30 @@ func TestLoginUser(t *testing.T) {
 				assert.Empty(t, token)
 			},
 		},
+		{
+			"Login user, which is locked out",
+			func() {
+				handlers.On("LoginUser", mock.Anything, entity.UserCredentials{
+					Login:    "Login",
+					Password: "Password",
+				}, mock.Anything).Return(entity.Session{}, &LockoutError{RetryAfter: time.Minute}).Once()
+			},
+			func() {
+				_, err := client.Login(entity.UserCredentials{
+					Login:    "Login",
+					Password: "Password",
+				})
+				assert.Equal(t, &LockoutError{RetryAfter: time.Minute}, err)
+				assert.ErrorIs(t, err, ErrTooManyAttempts)
+			},
+		},
 		{
 			"Create user, but server will return unknown error",
 			func() {
-				handlers.On("LoginUser", entity.UserCredentials{
+				handlers.On("LoginUser", mock.Anything, entity.UserCredentials{
 					Login:    "Login",
 					Password: "Password",
-				}).Return(entity.AuthToken(""), storage.ErrUnknown).Once()
+				}, mock.Anything).Return(entity.Session{}, storage.ErrUnknown).Once()
 			},
 			func() {
 				token, err := client.Login(entity.UserCredentials{
@@ -163,52 +195,155 @@ func TestLoginUser(t *testing.T) {
 	}
 }
 
-func TestGetRecordsInfo(t *testing.T) {
+func TestLoginSRP(t *testing.T) {
 	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
 	client := NewClientConn(serverCfg.RunAddress)
 
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Register user with verifier",
+			func() {
+				handlers.On("RegisterSRP", mock.Anything, "Login", entity.SRPVerifier{Salt: []byte("salt"), Verifier: []byte("verifier")}, mock.Anything).
+					Return(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+			},
+			func() {
+				token, err := client.RegisterSRP("Login", entity.SRPVerifier{Salt: []byte("salt"), Verifier: []byte("verifier")})
+				assert.NoError(t, err)
+				assert.Equal(t, "token", token)
+			},
+		},
+		{
+			"Start login",
+			func() {
+				handlers.On("StartLoginSRP", mock.Anything, "Login", []byte("A"), mock.Anything).
+					Return(entity.SRPChallenge{LoginID: "loginID", Salt: []byte("salt"), ServerPublicKey: []byte("B")}, nil).Once()
+			},
+			func() {
+				challenge, err := client.StartLoginSRP("Login", []byte("A"))
+				assert.NoError(t, err)
+				assert.Equal(t, entity.SRPChallenge{LoginID: "loginID", Salt: []byte("salt"), ServerPublicKey: []byte("B")}, challenge)
+			},
+		},
+		{
+			"Start login, which is locked out",
+			func() {
+				handlers.On("StartLoginSRP", mock.Anything, "Login", []byte("A"), mock.Anything).
+					Return(entity.SRPChallenge{}, &LockoutError{RetryAfter: time.Minute}).Once()
+			},
+			func() {
+				_, err := client.StartLoginSRP("Login", []byte("A"))
+				assert.Equal(t, &LockoutError{RetryAfter: time.Minute}, err)
+			},
+		},
+		{
+			"Finish login",
+			func() {
+				handlers.On("FinishLoginSRP", mock.Anything, "loginID", []byte("M1"), mock.Anything).
+					Return(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}, []byte("M2"), nil).Once()
+			},
+			func() {
+				token, serverProof, err := client.FinishLoginSRP("loginID", []byte("M1"))
+				assert.NoError(t, err)
+				assert.Equal(t, "token", token)
+				assert.Equal(t, []byte("M2"), serverProof)
+			},
+		},
+		{
+			"Finish login with wrong proof",
+			func() {
+				handlers.On("FinishLoginSRP", mock.Anything, "loginID", []byte("M1"), mock.Anything).
+					Return(entity.Session{}, nil, storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				token, _, err := client.FinishLoginSRP("loginID", []byte("M1"))
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+				assert.Empty(t, token)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	serverCfg := config.GetServerConfig()
 	handlers := mocks.NewServerHandlers(t)
+	auth := testAuthenticator(t)
+	auth.On("ValidateToken", entity.AuthToken("old")).Return(entity.Principal{}, storage.ErrUserUnauthorized).Maybe()
 
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, auth)
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
+	client := NewClientConn(serverCfg.RunAddress)
+
 	tc := []struct {
 		name  string
 		mock  func()
 		valid func()
 	}{
 		{
-			"Get all records",
+			"Request with expiring session refreshes it",
 			func() {
-				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx")).
-					Return([]entity.Record{}, nil).Once()
+				client.setSession(entity.Session{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Second)})
+				handlers.On("RefreshSession", mock.Anything, "refresh").
+					Return(entity.Session{AccessToken: "token", RefreshToken: "new refresh", ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+				handlers.On("GetChanges", mock.Anything, int64(0)).Return(entity.Changes{Revision: 1}, nil).Once()
 			},
 			func() {
-				_, err := client.GetRecordsInfo("token")
+				changes, err := client.GetChanges("old", 0)
 				assert.NoError(t, err)
+				assert.Equal(t, int64(1), changes.Revision)
+				assert.Equal(t, "new refresh", client.session.RefreshToken)
 			},
 		},
 		{
-			"Get all records, but server will return error",
+			"Request with fresh session doesn't refresh it",
 			func() {
-				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx")).
-					Return([]entity.Record{}, storage.ErrUserUnauthorized).Once()
+				handlers.On("GetChanges", mock.Anything, int64(0)).Return(entity.Changes{Revision: 1}, nil).Once()
 			},
 			func() {
-				_, err := client.GetRecordsInfo("token")
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				_, err := client.GetChanges("old", 0)
+				assert.NoError(t, err)
 			},
 		},
 		{
-			"Get all records, but server will return unknown error",
+			"Request fails, when session can't be refreshed, refresh token is kept",
 			func() {
-				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx")).
-					Return([]entity.Record{}, storage.ErrUnknown).Once()
+				client.setSession(entity.Session{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: time.Now()})
+				handlers.On("RefreshSession", mock.Anything, "refresh").Return(entity.Session{}, storage.ErrUnknown).Once()
 			},
 			func() {
-				_, err := client.GetRecordsInfo("token")
+				_, err := client.GetChanges("old", 0)
 				assert.Equal(t, storage.ErrUnknown, err)
+				assert.Equal(t, "refresh", client.session.RefreshToken)
+			},
+		},
+		{
+			"Request with revoked session",
+			func() {
+				client.setSession(entity.Session{AccessToken: "old", RefreshToken: "revoked", ExpiresAt: time.Now()})
+				handlers.On("RefreshSession", mock.Anything, "revoked").Return(entity.Session{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.GetChanges("old", 0)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Empty(t, client.session.RefreshToken)
 			},
 		},
 	}
@@ -221,62 +356,123 @@ func TestGetRecordsInfo(t *testing.T) {
 	}
 }
 
-func TestGetRecord(t *testing.T) {
+func TestGetSigningKeys(t *testing.T) {
 	serverCfg := config.GetServerConfig()
+	auth := testAuthenticator(t)
+	auth.On("PublicKeys").Return([]entity.JWK{
+		{KeyID: "key", KeyType: "OKP", Algorithm: "EdDSA", Use: "sig", Curve: "Ed25519", X: "public"},
+	}).Once()
+
+	server := NewServerConn(mocks.NewServerHandlers(t), auth)
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
 	client := NewClientConn(serverCfg.RunAddress)
 
+	keys, err := client.GophkeeperClient.GetSigningKeys(context.Background(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, keys.Keys, 1)
+	assert.Equal(t, "key", keys.Keys[0].Kid)
+	assert.Equal(t, "Ed25519", keys.Keys[0].Crv)
+	assert.Equal(t, "public", keys.Keys[0].X)
+}
+
+func TestLogout(t *testing.T) {
+	serverCfg := config.GetServerConfig()
 	handlers := mocks.NewServerHandlers(t)
 
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, testAuthenticator(t))
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
+	client := NewClientConn(serverCfg.RunAddress)
+
 	tc := []struct {
 		name  string
 		mock  func()
 		valid func()
 	}{
 		{
-			"Get record",
+			"Logout",
 			func() {
-				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
-					Return(entity.Record{}, nil).Once()
+				handlers.On("Logout", mock.Anything).Return(nil).Once()
 			},
 			func() {
-				_, err := client.GetRecord("token", "recordID")
+				err := client.Logout("token")
 				assert.NoError(t, err)
+				assert.Empty(t, client.session)
 			},
 		},
 		{
-			"Get record, but not authenticated.",
+			"Logout, but server will return error",
 			func() {
-				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
-					Return(entity.Record{}, storage.ErrUserUnauthorized).Once()
+				handlers.On("Logout", mock.Anything).Return(storage.ErrUnknown).Once()
 			},
 			func() {
-				_, err := client.GetRecord("token", "recordID")
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				err := client.Logout("token")
+				assert.Equal(t, storage.ErrUnknown, err)
+				assert.Empty(t, client.session)
 			},
 		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		client.setSession(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)})
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	lastSeen := time.Unix(1683000000, 0)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
 		{
-			"Get record, but wrong ID.",
+			"List sessions",
 			func() {
-				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
-					Return(entity.Record{}, storage.ErrNotFound).Once()
+				handlers.On("ListSessions", mock.Anything).Return([]entity.SessionInfo{{
+					ID:         "sessionID",
+					UserID:     "userID",
+					Device:     entity.Device{Name: "laptop", IP: "127.0.0.1", UserAgent: "gophkeeper-client"},
+					CreatedAt:  lastSeen,
+					LastSeenAt: lastSeen,
+					Current:    true,
+				}}, nil).Once()
 			},
 			func() {
-				_, err := client.GetRecord("token", "recordID")
-				assert.Equal(t, storage.ErrNotFound, err)
+				sessions, err := client.ListSessions("token")
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.SessionInfo{{
+					ID:         "sessionID",
+					Device:     entity.Device{Name: "laptop", IP: "127.0.0.1", UserAgent: "gophkeeper-client"},
+					CreatedAt:  lastSeen,
+					LastSeenAt: lastSeen,
+					Current:    true,
+				}}, sessions)
 			},
 		},
 		{
-			"Get record, but unknown error.",
+			"List sessions, but server will return error",
 			func() {
-				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
-					Return(entity.Record{}, storage.ErrUnknown).Once()
+				handlers.On("ListSessions", mock.Anything).Return(nil, storage.ErrUnknown).Once()
 			},
 			func() {
-				_, err := client.GetRecord("token", "recordID")
+				_, err := client.ListSessions("token")
 				assert.Equal(t, storage.ErrUnknown, err)
 			},
 		},
@@ -290,48 +486,112 @@ func TestGetRecord(t *testing.T) {
 	}
 }
 
-func TestCreateRecord(t *testing.T) {
+func TestRevokeSession(t *testing.T) {
 	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
 	client := NewClientConn(serverCfg.RunAddress)
 
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Revoke session",
+			func() {
+				handlers.On("RevokeSession", mock.Anything, "lost").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, client.RevokeSession("token", "lost"))
+			},
+		},
+		{
+			"Revoke not existing session",
+			func() {
+				handlers.On("RevokeSession", mock.Anything, "unknown").Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrNotFound, client.RevokeSession("token", "unknown"))
+			},
+		},
+		{
+			"Revoke session, but server will return error",
+			func() {
+				handlers.On("RevokeSession", mock.Anything, "lost").Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUnknown, client.RevokeSession("token", "lost"))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	serverCfg := config.GetServerConfig()
 	handlers := mocks.NewServerHandlers(t)
 
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, testAuthenticator(t))
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
+	client := NewClientConn(serverCfg.RunAddress)
+
+	from := time.Unix(1683000000, 0)
+	event := entity.AuditEvent{
+		Action:   entity.AuditGetRecord,
+		RecordID: "recordID",
+		IP:       "127.0.0.1",
+		Time:     from.Add(time.Hour),
+		Result:   entity.AuditResultSuccess,
+	}
+
 	tc := []struct {
 		name  string
 		mock  func()
 		valid func()
 	}{
 		{
-			"Create record.",
+			"List audit events from time",
 			func() {
-				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(nil).Once()
+				handlers.On("ListAuditEvents", mock.Anything, entity.AuditQuery{From: from, Limit: 10}).
+					Return([]entity.AuditEvent{event}, nil).Once()
 			},
 			func() {
-				err := client.CreateRecord("token", entity.Record{})
+				events, err := client.ListAuditEvents("token", entity.AuditQuery{From: from, Limit: 10})
 				assert.NoError(t, err)
+				assert.Equal(t, []entity.AuditEvent{event}, events)
 			},
 		},
 		{
-			"Create record, but not authenticated.",
+			"List audit events with bad time range",
 			func() {
-				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(storage.ErrUserUnauthorized).Once()
+				handlers.On("ListAuditEvents", mock.Anything, entity.AuditQuery{From: from, To: from.Add(-time.Hour)}).
+					Return(nil, storage.ErrBadQuery).Once()
 			},
 			func() {
-				err := client.CreateRecord("token", entity.Record{})
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				_, err := client.ListAuditEvents("token", entity.AuditQuery{From: from, To: from.Add(-time.Hour)})
+				assert.Equal(t, storage.ErrBadQuery, err)
 			},
 		},
 		{
-			"Create record, but unknown error.",
+			"List audit events, but server will return error",
 			func() {
-				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(storage.ErrUnknown).Once()
+				handlers.On("ListAuditEvents", mock.Anything, entity.AuditQuery{}).Return(nil, storage.ErrUnknown).Once()
 			},
 			func() {
-				err := client.CreateRecord("token", entity.Record{})
+				_, err := client.ListAuditEvents("token", entity.AuditQuery{})
 				assert.Equal(t, storage.ErrUnknown, err)
 			},
 		},
@@ -345,55 +605,867 @@ func TestCreateRecord(t *testing.T) {
 	}
 }
 
-func TestDeleteRecord(t *testing.T) {
+func TestChangePassword(t *testing.T) {
 	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
 	client := NewClientConn(serverCfg.RunAddress)
 
+	credentials := entity.UserCredentials{Login: "Login", Password: "Password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Change password",
+			func() {
+				handlers.On("ChangePassword", mock.Anything, credentials, "NewPassword").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, client.ChangePassword("token", credentials, "NewPassword"))
+			},
+		},
+		{
+			"Change password with wrong current password",
+			func() {
+				handlers.On("ChangePassword", mock.Anything, credentials, "NewPassword").Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, client.ChangePassword("token", credentials, "NewPassword"))
+			},
+		},
+		{
+			"Change password, but server will return error",
+			func() {
+				handlers.On("ChangePassword", mock.Anything, credentials, "NewPassword").Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUnknown, client.ChangePassword("token", credentials, "NewPassword"))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestChangePasswordSRP(t *testing.T) {
+	serverCfg := config.GetServerConfig()
 	handlers := mocks.NewServerHandlers(t)
 
-	server := NewServerConn(handlers)
+	server := NewServerConn(handlers, testAuthenticator(t))
 	server.Run(context.Background(), serverCfg.RunAddress)
 	defer server.Stop()
 
+	client := NewClientConn(serverCfg.RunAddress)
+
+	proof := entity.SRPProof{LoginID: "loginID", ClientProof: []byte("proof")}
+	verifier := entity.SRPVerifier{Salt: []byte("salt"), Verifier: []byte("verifier")}
+
 	tc := []struct {
 		name  string
 		mock  func()
 		valid func()
 	}{
 		{
-			"Delete record.",
+			"Change password",
 			func() {
-				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(nil).Once()
+				handlers.On("ChangePasswordSRP", mock.Anything, proof, verifier).Return(nil).Once()
 			},
 			func() {
-				err := client.DeleteRecord("token", "recordID")
-				assert.NoError(t, err)
+				assert.NoError(t, client.ChangePasswordSRP("token", proof, verifier))
 			},
 		},
 		{
-			"Delete record, but not authenticated.",
+			"Change password with wrong proof",
 			func() {
-				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrUserUnauthorized).Once()
+				handlers.On("ChangePasswordSRP", mock.Anything, proof, verifier).Return(storage.ErrWrongCredentials).Once()
 			},
 			func() {
-				err := client.DeleteRecord("token", "recordID")
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Equal(t, storage.ErrWrongCredentials, client.ChangePasswordSRP("token", proof, verifier))
 			},
 		},
 		{
-			"Delete record, but not found.",
+			"Change password, but login is locked out",
 			func() {
-				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrNotFound).Once()
+				handlers.On("ChangePasswordSRP", mock.Anything, proof, verifier).Return(&LockoutError{RetryAfter: time.Minute}).Once()
 			},
 			func() {
-				err := client.DeleteRecord("token", "recordID")
-				assert.Equal(t, storage.ErrNotFound, err)
+				var lockout *LockoutError
+				assert.ErrorAs(t, client.ChangePasswordSRP("token", proof, verifier), &lockout)
 			},
 		},
 		{
-			"Delete record, but unknown error.",
+			"Change password without verifier",
 			func() {
-				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrUnknown).Once()
+				handlers.On("ChangePasswordSRP", mock.Anything, proof, entity.SRPVerifier{}).Return(ErrFieldIsEmpty).Once()
+			},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, client.ChangePasswordSRP("token", proof, entity.SRPVerifier{}))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	credentials := entity.UserCredentials{Login: "Login", Password: "Password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete account",
+			func() {
+				handlers.On("DeleteAccount", mock.Anything, credentials).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, client.DeleteAccount("token", credentials))
+			},
+		},
+		{
+			"Delete account with wrong password",
+			func() {
+				handlers.On("DeleteAccount", mock.Anything, credentials).Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, client.DeleteAccount("token", credentials))
+			},
+		},
+		{
+			"Delete account, but server will return error",
+			func() {
+				handlers.On("DeleteAccount", mock.Anything, credentials).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUnknown, client.DeleteAccount("token", credentials))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestDeleteAccountSRP(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	proof := entity.SRPProof{LoginID: "loginID", ClientProof: []byte("proof")}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete account",
+			func() {
+				handlers.On("DeleteAccountSRP", mock.Anything, proof).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, client.DeleteAccountSRP("token", proof))
+			},
+		},
+		{
+			"Delete account with wrong password",
+			func() {
+				handlers.On("DeleteAccountSRP", mock.Anything, proof).Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, client.DeleteAccountSRP("token", proof))
+			},
+		},
+		{
+			"Delete account, while user is locked out",
+			func() {
+				handlers.On("DeleteAccountSRP", mock.Anything, proof).Return(&LockoutError{RetryAfter: time.Minute}).Once()
+			},
+			func() {
+				var lockout *LockoutError
+				assert.ErrorAs(t, client.DeleteAccountSRP("token", proof), &lockout)
+			},
+		},
+		{
+			"Delete account without proof",
+			func() {
+				handlers.On("DeleteAccountSRP", mock.Anything, entity.SRPProof{}).Return(ErrFieldIsEmpty).Once()
+			},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, client.DeleteAccountSRP("token", entity.SRPProof{}))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	auth := testAuthenticator(t)
+	auth.On("ValidateToken", entity.AuthToken("totpToken")).
+		Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}}, nil).Maybe()
+
+	server := NewServerConn(handlers, auth)
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	credentials := entity.UserCredentials{Login: "Login", Password: "Password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Enable TOTP",
+			func() {
+				handlers.On("EnableTOTP", mock.Anything).
+					Return(entity.TOTPEnrollment{Secret: "SECRET", BackupCodes: []string{"abcd-efgh"}}, nil).Once()
+			},
+			func() {
+				enrollment, err := client.EnableTOTP("token")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.TOTPEnrollment{Secret: "SECRET", BackupCodes: []string{"abcd-efgh"}}, enrollment)
+			},
+		},
+		{
+			"Enable TOTP, which is already enabled",
+			func() {
+				handlers.On("EnableTOTP", mock.Anything).Return(entity.TOTPEnrollment{}, ErrTOTPEnabled).Once()
+			},
+			func() {
+				_, err := client.EnableTOTP("token")
+				assert.Equal(t, ErrTOTPEnabled, err)
+			},
+		},
+		{
+			"Confirm TOTP with wrong code",
+			func() {
+				handlers.On("ConfirmTOTP", mock.Anything, "123456").Return(storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, client.ConfirmTOTP("token", "123456"))
+			},
+		},
+		{
+			"Disable TOTP, which wasn't enabled",
+			func() {
+				handlers.On("DisableTOTP", mock.Anything, "123456", entity.UserCredentials{Login: "Login", Password: "Password"}, entity.SRPProof{}).
+					Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				err := client.DisableTOTP("token", "123456", entity.UserCredentials{Login: "Login", Password: "Password"}, entity.SRPProof{})
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+		{
+			"Disable TOTP by SRP proof",
+			func() {
+				proof := entity.SRPProof{LoginID: "loginID", ClientProof: []byte("proof")}
+				handlers.On("DisableTOTP", mock.Anything, "123456", entity.UserCredentials{}, proof).Return(nil).Once()
+			},
+			func() {
+				err := client.DisableTOTP("token", "123456", entity.UserCredentials{}, entity.SRPProof{LoginID: "loginID", ClientProof: []byte("proof")})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Disable TOTP, but user is locked out",
+			func() {
+				handlers.On("DisableTOTP", mock.Anything, "123456", mock.Anything, mock.Anything).Return(&LockoutError{RetryAfter: time.Minute}).Once()
+			},
+			func() {
+				var lockout *LockoutError
+				err := client.DisableTOTP("token", "123456", entity.UserCredentials{Login: "Login", Password: "Password"}, entity.SRPProof{})
+				assert.ErrorAs(t, err, &lockout)
+			},
+		},
+		{
+			"Login user with TOTP",
+			func() {
+				handlers.On("LoginUser", mock.Anything, credentials, mock.Anything).
+					Return(entity.Session{AccessToken: "totpToken", ExpiresAt: time.Now().Add(time.Hour), TOTPRequired: true}, nil).Once()
+			},
+			func() {
+				token, err := client.Login(credentials)
+				assert.Equal(t, ErrTOTPRequired, err)
+				assert.Equal(t, "totpToken", token)
+			},
+		},
+		{
+			"Finish login with wrong code",
+			func() {
+				handlers.On("VerifyTOTP", mock.Anything, "000000", mock.Anything).Return(entity.Session{}, storage.ErrWrongCredentials).Once()
+			},
+			func() {
+				_, err := client.VerifyTOTP("totpToken", "000000")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Finish login",
+			func() {
+				handlers.On("VerifyTOTP", mock.Anything, "123456", mock.MatchedBy(func(device entity.Device) bool {
+					return device.Name != ""
+				})).Return(entity.Session{AccessToken: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+			},
+			func() {
+				token, err := client.VerifyTOTP("totpToken", "123456")
+				assert.NoError(t, err)
+				assert.Equal(t, "token", token)
+			},
+		},
+		{
+			"Finish login with token of full session",
+			func() {},
+			func() {
+				_, err := client.VerifyTOTP("token", "123456")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestGetRecordsInfo(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get all records",
+			func() {
+				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx"), entity.RecordsQuery{
+					PageSize:  2,
+					PageToken: "token",
+					Types:     []entity.RecordType{entity.TypeText, entity.TypeFile},
+					Metadata:  "my",
+					Sort:      entity.SortByRevisionDesc,
+				}).Return(entity.RecordsPage{
+					Records:       []entity.Record{{ID: "1", Type: entity.TypeText, Metadata: "my text", Revision: 3}},
+					NextPageToken: "next",
+				}, nil).Once()
+			},
+			func() {
+				page, err := client.GetRecordsInfo("token", entity.RecordsQuery{
+					PageSize:  2,
+					PageToken: "token",
+					Types:     []entity.RecordType{entity.TypeText, entity.TypeFile},
+					Metadata:  "my",
+					Sort:      entity.SortByRevisionDesc,
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, entity.RecordsPage{
+					Records:       []entity.Record{{ID: "1", Type: entity.TypeText, Metadata: "my text", Revision: 3}},
+					NextPageToken: "next",
+				}, page)
+			},
+		},
+		{
+			"Get all records, but server will return error",
+			func() {
+				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx"), entity.RecordsQuery{Types: []entity.RecordType{}}).
+					Return(entity.RecordsPage{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.GetRecordsInfo("token", entity.RecordsQuery{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Get all records with bad query",
+			func() {
+				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx"), entity.RecordsQuery{Types: []entity.RecordType{}, PageToken: "bad"}).
+					Return(entity.RecordsPage{}, storage.ErrBadQuery).Once()
+			},
+			func() {
+				_, err := client.GetRecordsInfo("token", entity.RecordsQuery{PageToken: "bad"})
+				assert.Equal(t, storage.ErrBadQuery, err)
+			},
+		},
+		{
+			"Get all records, but server will return unknown error",
+			func() {
+				handlers.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx"), entity.RecordsQuery{Types: []entity.RecordType{}}).
+					Return(entity.RecordsPage{}, storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := client.GetRecordsInfo("token", entity.RecordsQuery{})
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestGetChanges(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get changes",
+			func() {
+				handlers.On("GetChanges", mock.AnythingOfType("*context.valueCtx"), int64(3)).
+					Return(entity.Changes{
+						Revision: 5,
+						Created:  []entity.Record{{ID: "1", Type: entity.TypeText, Metadata: "my text", Revision: 4}},
+						Updated:  []entity.Record{{ID: "2", Type: entity.TypeText, Metadata: "other text", Revision: 5}},
+						Deleted:  []string{"3"},
+					}, nil).Once()
+			},
+			func() {
+				changes, err := client.GetChanges("token", 3)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Changes{
+					Revision: 5,
+					Created:  []entity.Record{{ID: "1", Type: entity.TypeText, Metadata: "my text", Revision: 4}},
+					Updated:  []entity.Record{{ID: "2", Type: entity.TypeText, Metadata: "other text", Revision: 5}},
+					Deleted:  []string{"3"},
+				}, changes)
+			},
+		},
+		{
+			"Get changes, but server will return error",
+			func() {
+				handlers.On("GetChanges", mock.AnythingOfType("*context.valueCtx"), int64(3)).
+					Return(entity.Changes{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.GetChanges("token", 3)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Get changes since revision, which deleted records are pruned",
+			func() {
+				handlers.On("GetChanges", mock.AnythingOfType("*context.valueCtx"), int64(3)).
+					Return(entity.Changes{}, storage.ErrResyncRequired).Once()
+			},
+			func() {
+				_, err := client.GetChanges("token", 3)
+				assert.Equal(t, storage.ErrResyncRequired, err)
+			},
+		},
+		{
+			"Get changes, but server will return unknown error",
+			func() {
+				handlers.On("GetChanges", mock.AnythingOfType("*context.valueCtx"), int64(3)).
+					Return(entity.Changes{}, storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := client.GetChanges("token", 3)
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestGetRecord(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get record",
+			func() {
+				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
+					Return(entity.Record{}, nil).Once()
+			},
+			func() {
+				_, err := client.GetRecord("token", "recordID")
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Get record, but not authenticated.",
+			func() {
+				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
+					Return(entity.Record{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.GetRecord("token", "recordID")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Get record, but wrong ID.",
+			func() {
+				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
+					Return(entity.Record{}, storage.ErrNotFound).Once()
+			},
+			func() {
+				_, err := client.GetRecord("token", "recordID")
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+		{
+			"Get record, but unknown error.",
+			func() {
+				handlers.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").
+					Return(entity.Record{}, storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := client.GetRecord("token", "recordID")
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestCreateRecord(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Create record.",
+			func() {
+				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(nil).Once()
+			},
+			func() {
+				err := client.CreateRecord("token", entity.Record{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Create record, but not authenticated.",
+			func() {
+				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				err := client.CreateRecord("token", entity.Record{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Create record, but storage quota is exceeded.",
+			func() {
+				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(storage.ErrQuotaExceeded).Once()
+			},
+			func() {
+				err := client.CreateRecord("token", entity.Record{})
+				assert.Equal(t, storage.ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Create record, but unknown error.",
+			func() {
+				handlers.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{}).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				err := client.CreateRecord("token", entity.Record{})
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	usage := entity.Usage{Bytes: 2048, Records: 3, Quota: entity.Quota{MaxBytes: 4096, MaxRecords: 10, MaxRecordSize: 1024}}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get usage.",
+			func() {
+				handlers.On("GetUsage", mock.Anything).Return(usage, nil).Once()
+			},
+			func() {
+				got, err := client.GetUsage("token")
+				assert.NoError(t, err)
+				assert.Equal(t, usage, got)
+			},
+		},
+		{
+			"Get usage, but not authenticated.",
+			func() {
+				handlers.On("GetUsage", mock.Anything).Return(entity.Usage{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.GetUsage("token")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestUpdateRecord(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	record := entity.Record{ID: "recordID", Data: []byte("data"), Revision: 1}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Update record.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(2), nil).Once()
+			},
+			func() {
+				revision, err := client.UpdateRecord("token", record)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+			},
+		},
+		{
+			"Update record, but it was changed by another client.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(0), storage.ErrRevisionConflict).Once()
+			},
+			func() {
+				_, err := client.UpdateRecord("token", record)
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+			},
+		},
+		{
+			"Update record, but type of record was changed.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(0), storage.ErrRecordType).Once()
+			},
+			func() {
+				_, err := client.UpdateRecord("token", record)
+				assert.Equal(t, storage.ErrRecordType, err)
+			},
+		},
+		{
+			"Update record, but not found.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(0), storage.ErrNotFound).Once()
+			},
+			func() {
+				_, err := client.UpdateRecord("token", record)
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+		{
+			"Update record, but not authenticated.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(0), storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.UpdateRecord("token", record)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Update record, but unknown error.",
+			func() {
+				handlers.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), record).Return(int64(0), storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := client.UpdateRecord("token", record)
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestDeleteRecord(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete record.",
+			func() {
+				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(nil).Once()
+			},
+			func() {
+				err := client.DeleteRecord("token", "recordID")
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Delete record, but not authenticated.",
+			func() {
+				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				err := client.DeleteRecord("token", "recordID")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Delete record, but not found.",
+			func() {
+				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				err := client.DeleteRecord("token", "recordID")
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+		{
+			"Delete record, but unknown error.",
+			func() {
+				handlers.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(storage.ErrUnknown).Once()
 			},
 			func() {
 				err := client.DeleteRecord("token", "recordID")
@@ -409,3 +1481,272 @@ func TestDeleteRecord(t *testing.T) {
 		handlers.AssertExpectations(t)
 	}
 }
+
+func TestUploadFile(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	data := bytes.Repeat([]byte("d"), 3*fileChunkSize+7)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Upload file.",
+			func() {
+				handlers.On("UploadFile", mock.AnythingOfType("*context.valueCtx"), entity.Record{Metadata: "file.txt", Type: entity.TypeFile}, mock.Anything).
+					Run(func(args mock.Arguments) {
+						uploaded, err := io.ReadAll(args.Get(2).(io.Reader))
+						assert.NoError(t, err)
+						assert.Equal(t, data, uploaded)
+					}).Return("recordID", nil).Once()
+			},
+			func() {
+				recordID, err := client.UploadFile("token", entity.Record{Metadata: "file.txt", Type: entity.TypeFile}, bytes.NewReader(data))
+				assert.NoError(t, err)
+				assert.Equal(t, "recordID", recordID)
+			},
+		},
+		{
+			"Upload file, but not authenticated.",
+			func() {
+				handlers.On("UploadFile", mock.AnythingOfType("*context.valueCtx"), entity.Record{Metadata: "file.txt", Type: entity.TypeFile}, mock.Anything).
+					Return("", storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := client.UploadFile("token", entity.Record{Metadata: "file.txt", Type: entity.TypeFile}, bytes.NewReader(data))
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestReplaceRecords(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	data := bytes.Repeat([]byte("d"), 2*fileChunkSize+7)
+
+	records := []entity.Record{
+		{ID: "1", Type: entity.TypeFile, Metadata: "file.txt", Revision: 2},
+		{ID: "2", Type: entity.TypeText, Data: []byte("sealed"), Revision: 3},
+		{ID: "3", Type: entity.TypeFile, Metadata: "empty.txt", Revision: 4},
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Replace records",
+			func() {
+				handlers.On("ReplaceRecords", mock.AnythingOfType("*context.valueCtx"), mock.Anything).
+					Run(func(args mock.Arguments) {
+						next := args.Get(1).(func() (entity.Record, io.Reader, error))
+
+						record, r, err := next()
+						assert.NoError(t, err)
+						assert.Equal(t, records[0], record)
+						got, err := io.ReadAll(r)
+						assert.NoError(t, err)
+						assert.Equal(t, data, got)
+
+						record, _, err = next()
+						assert.NoError(t, err)
+						assert.Equal(t, records[1], record)
+
+						record, r, err = next()
+						assert.NoError(t, err)
+						assert.Equal(t, records[2], record)
+						got, err = io.ReadAll(r)
+						assert.NoError(t, err)
+						assert.Empty(t, got)
+
+						_, _, err = next()
+						assert.Equal(t, io.EOF, err)
+					}).Return(int64(7), nil).Once()
+			},
+			func() {
+				revision, err := client.ReplaceRecords("token", records, map[string]io.Reader{
+					"1": bytes.NewReader(data),
+					"3": bytes.NewReader(nil),
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(7), revision)
+			},
+		},
+		{
+			"Replace records, but records were changed",
+			func() {
+				handlers.On("ReplaceRecords", mock.AnythingOfType("*context.valueCtx"), mock.Anything).
+					Return(int64(0), storage.ErrRevisionConflict).Once()
+			},
+			func() {
+				_, err := client.ReplaceRecords("token", records[1:2], nil)
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	data := bytes.Repeat([]byte("e"), 2*fileChunkSize+3)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Download file.",
+			func() {
+				handlers.On("DownloadFile", mock.AnythingOfType("*context.valueCtx"), "recordID", mock.Anything).
+					Run(func(args mock.Arguments) {
+						_, err := args.Get(2).(io.Writer).Write(data)
+						assert.NoError(t, err)
+					}).Return(nil).Once()
+			},
+			func() {
+				buf := &bytes.Buffer{}
+				err := client.DownloadFile("token", "recordID", buf)
+				assert.NoError(t, err)
+				assert.Equal(t, data, buf.Bytes())
+			},
+		},
+		{
+			"Download file, but it is not a file.",
+			func() {
+				handlers.On("DownloadFile", mock.AnythingOfType("*context.valueCtx"), "recordID", mock.Anything).Return(storage.ErrNotFile).Once()
+			},
+			func() {
+				err := client.DownloadFile("token", "recordID", &bytes.Buffer{})
+				assert.Equal(t, storage.ErrNotFile, err)
+			},
+		},
+		{
+			"Download file, but not found.",
+			func() {
+				handlers.On("DownloadFile", mock.AnythingOfType("*context.valueCtx"), "recordID", mock.Anything).Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				err := client.DownloadFile("token", "recordID", &bytes.Buffer{})
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestWatchRecords(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	client := NewClientConn(serverCfg.RunAddress)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Watch records",
+			func() {
+				handlers.On("WatchRecords", mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) {
+						handle := args.Get(1).(func(event entity.RecordEvent) error)
+						handle(entity.RecordEvent{UserID: "userID", Type: entity.EventCreated, RecordID: "1"})
+						handle(entity.RecordEvent{UserID: "userID", Type: entity.EventDeleted, RecordID: "2"})
+					}).
+					Return(nil).Once()
+			},
+			func() {
+				got := make([]entity.RecordEvent, 0)
+				err := client.WatchRecords(context.Background(), "token", func(event entity.RecordEvent) {
+					got = append(got, event)
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.RecordEvent{
+					{Type: entity.EventCreated, RecordID: "1"},
+					{Type: entity.EventDeleted, RecordID: "2"},
+				}, got)
+			},
+		},
+		{
+			"Watch records, but server will return error",
+			func() {
+				handlers.On("WatchRecords", mock.Anything, mock.Anything).
+					Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				err := client.WatchRecords(context.Background(), "token", func(event entity.RecordEvent) {})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Watch records, but server will return unknown error",
+			func() {
+				handlers.On("WatchRecords", mock.Anything, mock.Anything).
+					Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				err := client.WatchRecords(context.Background(), "token", func(event entity.RecordEvent) {})
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/config"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/events"
+	"github.com/size12/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientServer_MemoryStorage runs client against server with in-memory storage like in dev mode.
+func TestClientServer_MemoryStorage(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+
+	serverStorage := storage.NewStorage(storage.NewMemoryStorage(), storage.NewMemoryFileStorage())
+	auth := NewAuthenticatorJWT([]byte("secret of dev server, which is long enough"))
+	handlers := NewServerHandlers(serverStorage, serverStorage, auth, events.NewMemoryBroker())
+
+	server := NewServerConn(handlers, auth)
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	credentials := entity.UserCredentials{Login: "login", Password: "password", MasterKey: []byte("master key")}
+
+	client := NewClientHandlers(NewClientConn(serverCfg.RunAddress))
+	require.NoError(t, client.Register(credentials))
+	assert.Equal(t, storage.ErrLoginExists, client.Register(credentials))
+
+	require.NoError(t, client.CreateRecord(entity.Record{Metadata: "note", Type: entity.TypeText, Data: []byte("secret text")}))
+
+	page, err := client.GetRecordsInfo(entity.RecordsQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+
+	record, err := client.GetRecord(page.Records[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret text"), record.Data)
+
+	other := NewClientHandlers(NewClientConn(serverCfg.RunAddress))
+	require.NoError(t, other.Login(credentials))
+
+	records, err := other.SyncRecords()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	assert.NoError(t, other.DeleteRecord(page.Records[0].ID))
+
+	usage, err := client.GetUsage()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Records)
+
+	assert.NoError(t, client.DeleteAccount(credentials.Password))
+	assert.Equal(t, storage.ErrWrongCredentials, other.Login(credentials))
+}
+
+// TestClientServer_SRP runs client of SRP user against server with in-memory storage, password is never sent.
+func TestClientServer_SRP(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+
+	serverStorage := storage.NewStorage(storage.NewMemoryStorage(), storage.NewMemoryFileStorage())
+	auth := NewAuthenticatorJWT([]byte("secret of dev server, which is long enough"))
+	handlers := NewServerHandlers(serverStorage, serverStorage, auth, events.NewMemoryBroker())
+
+	server := NewServerConn(handlers, auth)
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	credentials := entity.UserCredentials{Login: "login", Password: "password", MasterKey: []byte("master key")}
+
+	client := NewClientHandlers(NewClientConn(serverCfg.RunAddress))
+	client.AuthMethod = AuthSRP
+	require.NoError(t, client.Register(credentials))
+
+	other := NewClientHandlers(NewClientConn(serverCfg.RunAddress))
+	other.AuthMethod = AuthSRP
+	require.NoError(t, other.Login(credentials))
+
+	assert.Equal(t, storage.ErrWrongCredentials, client.ChangePassword("wrong", "new password"))
+	require.NoError(t, client.ChangePassword(credentials.Password, "new password"))
+
+	_, err := other.ListSessions()
+	assert.Equal(t, storage.ErrUserUnauthorized, err, "other sessions are revoked")
+	assert.Equal(t, storage.ErrWrongCredentials, other.Login(credentials))
+
+	credentials.Password = "new password"
+	assert.NoError(t, other.Login(credentials))
+
+	assert.Equal(t, storage.ErrWrongCredentials, other.DeleteAccount("wrong"))
+	require.NoError(t, other.DeleteAccount(credentials.Password))
+	assert.Equal(t, storage.ErrWrongCredentials, client.Login(credentials), "account is deleted")
+}
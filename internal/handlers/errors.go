@@ -1,9 +1,36 @@
 package handlers
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Errors for handlers.
 var (
 	ErrFieldIsEmpty   = errors.New("field is empty")
 	ErrWrongMasterKey = errors.New("wrong master key")
+	ErrTooManyLogins  = errors.New("too many unfinished logins")
+	ErrTOTPRequired   = errors.New("TOTP code is required")
+	ErrTOTPEnabled    = errors.New("TOTP is already enabled")
+	// ErrLegacyRecords is returned for records of old client versions, which are sealed with legacy master key.
+	// They are opened only by master key rotation.
+	ErrLegacyRecords = errors.New("records are sealed with legacy master key")
+	// ErrTooManyAttempts is matched by LockoutError.
+	ErrTooManyAttempts = errors.New("too many failed attempts")
 )
+
+// LockoutError is returned, while login is locked out after too many failed attempts.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+// Error implementation of error interface.
+func (err *LockoutError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ErrTooManyAttempts, err.RetryAfter)
+}
+
+// Unwrap makes LockoutError match ErrTooManyAttempts.
+func (err *LockoutError) Unwrap() error {
+	return ErrTooManyAttempts
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// healthCheckInterval is how often dependencies of server are checked.
+	healthCheckInterval = 5 * time.Second
+	// healthCheckTimeout limits one check of all dependencies.
+	healthCheckTimeout = 2 * time.Second
+)
+
+// HealthChecker is dependency of server, for example DB or file storage. Server isn't ready, while Ping fails.
+//
+//go:generate mockery --name HealthChecker
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// WithHealthChecks makes server report NOT_SERVING by gRPC health service, while any of checkers fails.
+func WithHealthChecks(checkers ...HealthChecker) ServerOption {
+	return func(server *ServerConn) {
+		server.checkers = append(server.checkers, checkers...)
+	}
+}
+
+// WithReflection enables gRPC server reflection, so server can be explored by tools like grpcurl.
+func WithReflection() ServerOption {
+	return func(server *ServerConn) {
+		server.reflection = true
+	}
+}
+
+// checkHealth pings all dependencies and updates serving status of server.
+func (server *ServerConn) checkHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	status := healthpb.HealthCheckResponse_SERVING
+	for _, checker := range server.checkers {
+		if err := checker.Ping(ctx); err != nil {
+			slog.WarnContext(ctx, "Health check failed", "error", err)
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			break
+		}
+	}
+
+	setServingStatus(server.health, status)
+}
+
+// watchHealth checks dependencies of server until context is done or server is stopped.
+func (server *ServerConn) watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-server.done:
+			return
+		case <-ticker.C:
+			server.checkHealth(ctx)
+		}
+	}
+}
+
+// setServingStatus sets status of whole server and of Gophkeeper service.
+func setServingStatus(healthServer *health.Server, status healthpb.HealthCheckResponse_ServingStatus) {
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(pb.Gophkeeper_ServiceDesc.ServiceName, status)
+}
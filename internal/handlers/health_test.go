@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/config"
+	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+func TestHealth(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+	checker := mocks.NewHealthChecker(t)
+
+	checker.On("Ping", mock.Anything).Return(nil).Once()
+
+	server := NewServerConn(handlers, testAuthenticator(t), WithHealthChecks(checker), WithReflection())
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(serverCfg.RunAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		response, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		return response.GetStatus()
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Check health of ready server without token",
+			func() {},
+			func() {
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check("gophkeeper.Gophkeeper"))
+			},
+		},
+		{
+			"Check health, when dependency fails",
+			func() {
+				checker.On("Ping", mock.Anything).Return(errors.New("connection refused")).Once()
+			},
+			func() {
+				server.checkHealth(context.Background())
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check("gophkeeper.Gophkeeper"))
+			},
+		},
+		{
+			"Check health, when dependency recovers",
+			func() {
+				checker.On("Ping", mock.Anything).Return(nil).Once()
+			},
+			func() {
+				server.checkHealth(context.Background())
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+			},
+		},
+		{
+			"List services by reflection without token",
+			func() {},
+			func() {
+				stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+				assert.NoError(t, err)
+
+				err = stream.Send(&reflectionpb.ServerReflectionRequest{
+					MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+				})
+				assert.NoError(t, err)
+
+				response, err := stream.Recv()
+				assert.NoError(t, err)
+
+				var services []string
+				for _, service := range response.GetListServicesResponse().GetService() {
+					services = append(services, service.GetName())
+				}
+				assert.Contains(t, services, "gophkeeper.Gophkeeper")
+				assert.Contains(t, services, "grpc.health.v1.Health")
+				assert.NoError(t, stream.CloseSend())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		checker.AssertExpectations(t)
+	}
+}
+
+func TestServerConn_StopTwice(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	server := NewServerConn(mocks.NewServerHandlers(t), testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+
+	conn, err := grpc.Dial(serverCfg.RunAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// Server is stopped only after it serves requests.
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	assert.NoError(t, err)
+
+	server.Stop()
+	assert.NotPanics(t, server.Stop, "second stop should do nothing")
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/logging"
+	"github.com/size12/gophkeeper/internal/storage"
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// publicMethods are methods, which can be called without authentication.
+var publicMethods = map[string]bool{
+	pb.Gophkeeper_Register_FullMethodName:       true,
+	pb.Gophkeeper_Login_FullMethodName:          true,
+	pb.Gophkeeper_RegisterSRP_FullMethodName:    true,
+	pb.Gophkeeper_StartLoginSRP_FullMethodName:  true,
+	pb.Gophkeeper_FinishLoginSRP_FullMethodName: true,
+	pb.Gophkeeper_RefreshSession_FullMethodName: true,
+	pb.Gophkeeper_GetSigningKeys_FullMethodName: true,
+	// Health and reflection are used by orchestrators and tools, which don't have user token.
+	healthpb.Health_Check_FullMethodName:                              true,
+	healthpb.Health_Watch_FullMethodName:                              true,
+	reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName: true,
+}
+
+// methodScopes are scopes, which are required by methods. Other methods require ScopeRecords.
+var methodScopes = map[string]string{
+	pb.Gophkeeper_VerifyTOTP_FullMethodName: entity.ScopeTOTP,
+}
+
+// CertificateUsers finds users by subject of client certificate. Certificate common name is user login.
+//
+//go:generate mockery --name CertificateUsers
+type CertificateUsers interface {
+	GetUserID(ctx context.Context, login string) (entity.UserID, error)
+}
+
+// SessionChecker checks session of principal wasn't revoked.
+type SessionChecker interface {
+	CheckSession(ctx context.Context) error
+}
+
+// authenticate validates token from request metadata and returns context with principal.
+// Request without token is authenticated by verified client certificate, if users is set.
+// Session of token is checked on every request, if sessions is set.
+// Public methods are passed without principal.
+func authenticate(ctx context.Context, auth Authenticator, users CertificateUsers, sessions SessionChecker, method string) (context.Context, error) {
+	if publicMethods[method] {
+		return ctx, nil
+	}
+
+	certificateLogin, hasCertificate := verifiedCertificateLogin(ctx)
+	if users == nil {
+		hasCertificate = false
+	}
+
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authToken"); len(values) != 0 {
+		token = values[0]
+	}
+
+	if token == "" && !hasCertificate {
+		return nil, status.Errorf(codes.Unauthenticated, "Didn't send metadata for authentication.")
+	}
+
+	var principal entity.Principal
+	var err error
+
+	if token != "" {
+		principal, err = auth.ValidateToken(entity.AuthToken(token))
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+		}
+	}
+
+	if hasCertificate {
+		userID, err := users.GetUserID(ctx, certificateLogin)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "Unknown client certificate.")
+		}
+
+		if principal.UserID == "" {
+			principal = entity.Principal{UserID: userID, Scopes: []string{entity.ScopeRecords}}
+		}
+
+		// Token of one user can't be used with certificate of another one.
+		if principal.UserID != userID {
+			return nil, status.Errorf(codes.PermissionDenied, "Token and client certificate belong to different users.")
+		}
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = entity.ScopeRecords
+	}
+
+	if !principal.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "Token doesn't allow this method.")
+	}
+
+	ctx = entity.WithPrincipal(ctx, principal)
+
+	if sessions != nil && principal.SessionID != "" {
+		err = sessions.CheckSession(ctx)
+		if errors.Is(err, storage.ErrUserUnauthorized) {
+			return nil, status.Errorf(codes.Unauthenticated, "Session was revoked.")
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Internal server error.")
+		}
+	}
+
+	return ctx, nil
+}
+
+// verifiedCertificateLogin gets common name of client certificate, which was verified by TLS handshake.
+func verifiedCertificateLogin(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	login := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	return login, login != ""
+}
+
+// UnaryAuthInterceptor authenticates unary requests. Users can be nil, then client certificates aren't used.
+// Sessions can be nil, then sessions are checked only by authenticator.
+func UnaryAuthInterceptor(auth Authenticator, users CertificateUsers, sessions SessionChecker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, auth, users, sessions, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor authenticates stream requests. Users can be nil, then client certificates aren't used.
+// Sessions can be nil, then sessions are checked only by authenticator.
+func StreamAuthInterceptor(auth Authenticator, users CertificateUsers, sessions SessionChecker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), auth, users, sessions, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// contextStream is server stream with context, which stores principal or request.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns context of stream.
+func (stream *contextStream) Context() context.Context {
+	return stream.ctx
+}
+
+// newRequest returns request with new random ID.
+func newRequest(method string) (logging.Request, error) {
+	id, err := generateRandom(8)
+	if err != nil {
+		return logging.Request{}, err
+	}
+
+	return logging.Request{ID: hex.EncodeToString(id), Method: method}, nil
+}
+
+// UnaryRequestIDInterceptor gives ID to unary request. ID is logged with request and returned in trailer for support.
+func UnaryRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		request, err := newRequest(info.FullMethod)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed generate request ID", "error", err)
+			return nil, status.Errorf(codes.Internal, "Internal server error.")
+		}
+
+		ctx = logging.WithRequest(ctx, request)
+		err = grpc.SetTrailer(ctx, metadata.Pairs(logging.RequestIDKey, request.ID))
+		if err != nil {
+			slog.WarnContext(ctx, "Failed set request ID trailer", "error", err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRequestIDInterceptor gives ID to stream request. ID is logged with request and returned in trailer for support.
+func StreamRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		request, err := newRequest(info.FullMethod)
+		if err != nil {
+			slog.ErrorContext(stream.Context(), "Failed generate request ID", "error", err)
+			return status.Errorf(codes.Internal, "Internal server error.")
+		}
+
+		stream.SetTrailer(metadata.Pairs(logging.RequestIDKey, request.ID))
+		return handler(srv, &contextStream{ServerStream: stream, ctx: logging.WithRequest(stream.Context(), request)})
+	}
+}
+
+// UnaryRecoveryInterceptor turns panic of unary handler into internal error, so one bad request can't stop server.
+func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(ctx, "Handler panicked", "panic", r, "stack", string(debug.Stack()))
+				err = status.Errorf(codes.Internal, "Internal server error.")
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor turns panic of stream handler into internal error, so one bad request can't stop server.
+func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(stream.Context(), "Handler panicked", "panic", r, "stack", string(debug.Stack()))
+				err = status.Errorf(codes.Internal, "Internal server error.")
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
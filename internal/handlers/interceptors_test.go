@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/config"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	"github.com/size12/gophkeeper/internal/logging"
+	"github.com/size12/gophkeeper/internal/storage"
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryAuthInterceptor(t *testing.T) {
+	auth := mocks.NewAuthenticator(t)
+	interceptor := UnaryAuthInterceptor(auth, nil, nil)
+
+	var gotCtx context.Context
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		gotCtx = ctx
+		return nil, nil
+	}
+
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authToken", token))
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Call public method without token",
+			func() {},
+			func() {
+				_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_Login_FullMethodName}, handler)
+				assert.NoError(t, err)
+				_, ok := entity.PrincipalFromContext(gotCtx)
+				assert.False(t, ok)
+			},
+		},
+		{
+			"Call method without token",
+			func() {},
+			func() {
+				_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			"Call method with bad token",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("bad")).Return(entity.Principal{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("bad"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			"Call method with token without scope",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).Return(entity.Principal{UserID: "userID"}, nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("token"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			"Call method with valid token",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).
+					Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeRecords}}, nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("token"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}, handler)
+				assert.NoError(t, err)
+				userID, ok := entity.UserIDFromContext(gotCtx)
+				assert.True(t, ok)
+				assert.Equal(t, entity.UserID("userID"), userID)
+			},
+		},
+		{
+			"Call method with token for second step of login",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("totpToken")).
+					Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}}, nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("totpToken"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			"Finish login with token for second step of login",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("totpToken")).
+					Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}}, nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("totpToken"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_VerifyTOTP_FullMethodName}, handler)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Finish login with token of full session",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).
+					Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeRecords}}, nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken("token"), nil, &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_VerifyTOTP_FullMethodName}, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		gotCtx = nil
+		test.mock()
+		test.valid()
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestStreamAuthInterceptor(t *testing.T) {
+	auth := mocks.NewAuthenticator(t)
+	interceptor := StreamAuthInterceptor(auth, nil, nil)
+
+	auth.On("ValidateToken", entity.AuthToken("token")).
+		Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeRecords}}, nil).Once()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authToken", "token"))
+
+	err := interceptor(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: pb.Gophkeeper_WatchRecords_FullMethodName},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			userID, ok := entity.UserIDFromContext(stream.Context())
+			assert.True(t, ok)
+			assert.Equal(t, entity.UserID("userID"), userID)
+			return nil
+		})
+	assert.NoError(t, err)
+
+	err = interceptor(nil, &testServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: pb.Gophkeeper_WatchRecords_FullMethodName},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryAuthInterceptor_Certificate(t *testing.T) {
+	auth := mocks.NewAuthenticator(t)
+	users := mocks.NewCertificateUsers(t)
+	interceptor := UnaryAuthInterceptor(auth, users, nil)
+
+	var gotCtx context.Context
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		gotCtx = ctx
+		return nil, nil
+	}
+
+	withCertificate := func(ctx context.Context, login string) context.Context {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: login}}
+		return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		}})
+	}
+
+	withToken := func(ctx context.Context, token string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("authToken", token))
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Call method with certificate of user",
+			func() {
+				users.On("GetUserID", mock.Anything, "login").Return(entity.UserID("userID"), nil).Once()
+			},
+			func() {
+				_, err := interceptor(withCertificate(context.Background(), "login"), nil, info, handler)
+				assert.NoError(t, err)
+				principal, ok := entity.PrincipalFromContext(gotCtx)
+				assert.True(t, ok)
+				assert.Equal(t, entity.UserID("userID"), principal.UserID)
+				assert.True(t, principal.HasScope(entity.ScopeRecords))
+			},
+		},
+		{
+			"Call method with certificate of unknown user",
+			func() {
+				users.On("GetUserID", mock.Anything, "unknown").Return(entity.UserID(""), storage.ErrNotFound).Once()
+			},
+			func() {
+				_, err := interceptor(withCertificate(context.Background(), "unknown"), nil, info, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			"Call method with token and certificate of other user",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).
+					Return(entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeRecords}}, nil).Once()
+				users.On("GetUserID", mock.Anything, "other").Return(entity.UserID("otherID"), nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken(withCertificate(context.Background(), "other"), "token"), nil, info, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			"Call method with token and certificate of same user",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).
+					Return(entity.Principal{UserID: "userID", SessionID: "sid", Scopes: []string{entity.ScopeRecords}}, nil).Once()
+				users.On("GetUserID", mock.Anything, "login").Return(entity.UserID("userID"), nil).Once()
+			},
+			func() {
+				_, err := interceptor(withToken(withCertificate(context.Background(), "login"), "token"), nil, info, handler)
+				assert.NoError(t, err)
+				principal, ok := entity.PrincipalFromContext(gotCtx)
+				assert.True(t, ok)
+				assert.Equal(t, "sid", principal.SessionID)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		gotCtx = nil
+		test.mock()
+		test.valid()
+		auth.AssertExpectations(t)
+		users.AssertExpectations(t)
+	}
+}
+
+func TestUnaryAuthInterceptor_Session(t *testing.T) {
+	auth := mocks.NewAuthenticator(t)
+	sessions := mocks.NewServerHandlers(t)
+	interceptor := UnaryAuthInterceptor(auth, nil, sessions)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authToken", "token"))
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Gophkeeper_GetRecord_FullMethodName}
+	principal := entity.Principal{UserID: "userID", SessionID: "sessionID", Scopes: []string{entity.ScopeRecords}}
+	withPrincipal := mock.MatchedBy(func(ctx context.Context) bool {
+		got, ok := entity.PrincipalFromContext(ctx)
+		return ok && got.SessionID == "sessionID"
+	})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Call method with active session",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).Return(principal, nil).Once()
+				sessions.On("CheckSession", withPrincipal).Return(nil).Once()
+			},
+			func() {
+				_, err := interceptor(ctx, nil, info, handler)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Call method with revoked session",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).Return(principal, nil).Once()
+				sessions.On("CheckSession", withPrincipal).Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := interceptor(ctx, nil, info, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			"Call method, but session check will return error",
+			func() {
+				auth.On("ValidateToken", entity.AuthToken("token")).Return(principal, nil).Once()
+				sessions.On("CheckSession", withPrincipal).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := interceptor(ctx, nil, info, handler)
+				assert.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		auth.AssertExpectations(t)
+		sessions.AssertExpectations(t)
+	}
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(serverCfg.RunAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := pb.NewGophkeeperClient(conn)
+
+	var requestID string
+	withRequest := mock.MatchedBy(func(ctx context.Context) bool {
+		request, ok := logging.RequestFromContext(ctx)
+		requestID = request.ID
+		return ok && request.ID != "" && request.Method == pb.Gophkeeper_Login_FullMethodName
+	})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Return request ID in trailer of failed request",
+			func() {
+				handlers.On("LoginUser", withRequest, mock.Anything, mock.Anything).
+					Return(entity.Session{}, storage.ErrUnknown).Once()
+			},
+			func() {
+				var trailer metadata.MD
+				_, err := client.Login(context.Background(), &pb.UserCredentials{Login: "login", Password: "password"}, grpc.Trailer(&trailer))
+				assert.Equal(t, codes.Internal, status.Code(err))
+				assert.Equal(t, []string{requestID}, trailer.Get(logging.RequestIDKey))
+			},
+		},
+		{
+			"Give different IDs to requests",
+			func() {
+				handlers.On("LoginUser", withRequest, mock.Anything, mock.Anything).
+					Return(entity.Session{}, storage.ErrWrongCredentials).Twice()
+			},
+			func() {
+				var first, second metadata.MD
+				_, err := client.Login(context.Background(), &pb.UserCredentials{Login: "login", Password: "wrong"}, grpc.Trailer(&first))
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				_, err = client.Login(context.Background(), &pb.UserCredentials{Login: "login", Password: "wrong"}, grpc.Trailer(&second))
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				assert.NotEqual(t, first.Get(logging.RequestIDKey), second.Get(logging.RequestIDKey))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		handlers.AssertExpectations(t)
+	}
+}
+
+func TestStreamRequestIDInterceptor(t *testing.T) {
+	interceptor := StreamRequestIDInterceptor()
+	stream := &testServerStream{ctx: context.Background()}
+
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: pb.Gophkeeper_WatchRecords_FullMethodName},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			request, ok := logging.RequestFromContext(stream.Context())
+			assert.True(t, ok)
+			assert.Equal(t, pb.Gophkeeper_WatchRecords_FullMethodName, request.Method)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Len(t, stream.trailer.Get(logging.RequestIDKey), 1)
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	handlers := mocks.NewServerHandlers(t)
+
+	server := NewServerConn(handlers, testAuthenticator(t))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(serverCfg.RunAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := pb.NewGophkeeperClient(conn)
+
+	handlers.On("StartLoginSRP", mock.Anything, "Login", []byte("A"), mock.Anything).Run(func(mock.Arguments) {
+		panic("broken handler")
+	}).Once()
+	_, err = client.StartLoginSRP(context.Background(), &pb.SRPStart{Login: "Login", ClientPublicKey: []byte("A")})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// Server keeps serving after panic.
+	handlers.On("StartLoginSRP", mock.Anything, "Login", []byte("A"), mock.Anything).Return(entity.SRPChallenge{LoginID: "loginID"}, nil).Once()
+	challenge, err := client.StartLoginSRP(context.Background(), &pb.SRPStart{Login: "Login", ClientPublicKey: []byte("A")})
+	assert.NoError(t, err)
+	assert.Equal(t, "loginID", challenge.LoginId)
+}
+
+func TestStreamRecoveryInterceptor(t *testing.T) {
+	interceptor := StreamRecoveryInterceptor()
+	stream := &testServerStream{ctx: context.Background()}
+
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: pb.Gophkeeper_WatchRecords_FullMethodName},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			panic("broken handler")
+		})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+// testServerStream is server stream with given context.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+// Context returns stream context.
+func (stream *testServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+// SetTrailer keeps trailer of stream.
+func (stream *testServerStream) SetTrailer(trailer metadata.MD) {
+	stream.trailer = metadata.Join(stream.trailer, trailer)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// ErrUnsupportedKey is returned for key, which isn't HMAC secret, Ed25519 or ECDSA P-256 key.
+var ErrUnsupportedKey = errors.New("key should be Ed25519 or ECDSA P-256")
+
+// SigningKey is key of access tokens. Its ID is put in "kid" header of tokens, which it signs.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private signs tokens, it's nil for key, which only verifies them. Public verifies tokens.
+	// For HMAC both are secret.
+	Private interface{}
+	Public  interface{}
+	// retiredAt is time, when key was retired. Retired key verifies tokens during lifetime of access token after it.
+	// Zero time means key isn't retired.
+	retiredAt time.Time
+}
+
+// NewHMACKey returns HS256 key of secret. Tokens signed by it are verified only by services, which know secret.
+func NewHMACKey(secret []byte) SigningKey {
+	sum := sha256.Sum256(secret)
+	return SigningKey{
+		ID:      "hs-" + hex.EncodeToString(sum[:8]),
+		Method:  jwt.SigningMethodHS256,
+		Private: secret,
+		Public:  secret,
+	}
+}
+
+// NewSigningKey returns EdDSA or ES256 key of Ed25519 or ECDSA P-256 private key.
+func NewSigningKey(private crypto.Signer) (SigningKey, error) {
+	key, err := NewVerifyingKey(private.Public())
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key.Private = private
+	return key, nil
+}
+
+// NewVerifyingKey returns key of Ed25519 or ECDSA P-256 public key. It only verifies tokens.
+// Key ID is JWK thumbprint (RFC 7638), so it's same on all server instances.
+func NewVerifyingKey(public crypto.PublicKey) (SigningKey, error) {
+	key := SigningKey{Public: public}
+
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	switch public.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		key.Method = jwt.SigningMethodES256
+	}
+
+	key.ID = jwkThumbprint(jwk)
+	return key, nil
+}
+
+// LoadSigningKey loads key from PEM file. Private key (PKCS #8 or SEC 1) signs and verifies tokens,
+// public key (PKIX) only verifies them.
+func LoadSigningKey(path string) (SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("%s: no PEM key", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("%s: unknown PEM block %q", path, block.Type)
+	}
+
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var signingKey SigningKey
+	if signer, ok := key.(crypto.Signer); ok {
+		signingKey, err = NewSigningKey(signer)
+	} else {
+		signingKey, err = NewVerifyingKey(key)
+	}
+
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return signingKey, nil
+}
+
+// publicJWK returns JWK of public key without key ID.
+func publicJWK(public crypto.PublicKey) (entity.JWK, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return entity.JWK{KeyType: "OKP", Algorithm: "EdDSA", Use: "sig", Curve: "Ed25519", X: encode(public)}, nil
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return entity.JWK{}, ErrUnsupportedKey
+		}
+
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return entity.JWK{
+			KeyType:   "EC",
+			Algorithm: "ES256",
+			Use:       "sig",
+			Curve:     "P-256",
+			X:         encode(public.X.FillBytes(make([]byte, size))),
+			Y:         encode(public.Y.FillBytes(make([]byte, size))),
+		}, nil
+	default:
+		return entity.JWK{}, ErrUnsupportedKey
+	}
+}
+
+// jwkThumbprint returns base64url SHA-256 of required members of JWK in lexicographic order (RFC 7638).
+func jwkThumbprint(jwk entity.JWK) string {
+	var canonical string
+	if jwk.KeyType == "OKP" {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Curve, jwk.KeyType, jwk.X)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Curve, jwk.KeyType, jwk.X, jwk.Y)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
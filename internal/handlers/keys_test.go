@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+
+	writeKey := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+		return path
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(public)
+	assert.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	sec1, err := x509.MarshalECPrivateKey(ecdsaKey)
+	assert.NoError(t, err)
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	p384, err := x509.MarshalECPrivateKey(p384Key)
+	assert.NoError(t, err)
+
+	tc := []struct {
+		name  string
+		path  string
+		valid func(key SigningKey, err error)
+	}{
+		{
+			"Load Ed25519 private key",
+			writeKey("ed25519.pem", "PRIVATE KEY", pkcs8),
+			func(key SigningKey, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, jwt.SigningMethodEdDSA, key.Method)
+				assert.NotNil(t, key.Private)
+			},
+		},
+		{
+			"Load Ed25519 public key",
+			writeKey("ed25519.pub", "PUBLIC KEY", pkix),
+			func(key SigningKey, err error) {
+				assert.NoError(t, err)
+				assert.Nil(t, key.Private)
+				signing, _ := NewSigningKey(private)
+				assert.Equal(t, signing.ID, key.ID)
+			},
+		},
+		{
+			"Load ECDSA P-256 private key",
+			writeKey("p256.pem", "EC PRIVATE KEY", sec1),
+			func(key SigningKey, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, jwt.SigningMethodES256, key.Method)
+			},
+		},
+		{
+			"Load ECDSA P-384 private key",
+			writeKey("p384.pem", "EC PRIVATE KEY", p384),
+			func(key SigningKey, err error) {
+				assert.ErrorIs(t, err, ErrUnsupportedKey)
+			},
+		},
+		{
+			"Load not PEM file",
+			writeKey("bad.pem", "CERTIFICATE", []byte("certificate")),
+			func(key SigningKey, err error) {
+				assert.Error(t, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.valid(LoadSigningKey(test.path))
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example of RFC 8037, appendix A.3.
+	jwk, err := publicJWK(ed25519.PublicKey{
+		0xd7, 0x5a, 0x98, 0x01, 0x82, 0xb1, 0x0a, 0xb7, 0xd5, 0x4b, 0xfe, 0xd3, 0xc9, 0x64, 0x07, 0x3a,
+		0x0e, 0xe1, 0x72, 0xf3, 0xda, 0xa6, 0x23, 0x25, 0xaf, 0x02, 0x1a, 0x68, 0xf7, 0x07, 0x51, 0x1a,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", jwk.X)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", jwkThumbprint(jwk))
+}
@@ -13,23 +13,23 @@ type Authenticator struct {
 	mock.Mock
 }
 
-// CreateToken provides a mock function with given fields: userID
-func (_m *Authenticator) CreateToken(userID entity.UserID) (entity.AuthToken, error) {
-	ret := _m.Called(userID)
+// CreateToken provides a mock function with given fields: principal
+func (_m *Authenticator) CreateToken(principal entity.Principal) (entity.AuthToken, error) {
+	ret := _m.Called(principal)
 
 	var r0 entity.AuthToken
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.UserID) (entity.AuthToken, error)); ok {
-		return rf(userID)
+	if rf, ok := ret.Get(0).(func(entity.Principal) (entity.AuthToken, error)); ok {
+		return rf(principal)
 	}
-	if rf, ok := ret.Get(0).(func(entity.UserID) entity.AuthToken); ok {
-		r0 = rf(userID)
+	if rf, ok := ret.Get(0).(func(entity.Principal) entity.AuthToken); ok {
+		r0 = rf(principal)
 	} else {
 		r0 = ret.Get(0).(entity.AuthToken)
 	}
 
-	if rf, ok := ret.Get(1).(func(entity.UserID) error); ok {
-		r1 = rf(userID)
+	if rf, ok := ret.Get(1).(func(entity.Principal) error); ok {
+		r1 = rf(principal)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -37,19 +37,40 @@ func (_m *Authenticator) CreateToken(userID entity.UserID) (entity.AuthToken, er
 	return r0, r1
 }
 
+// PublicKeys provides a mock function with given fields:
+func (_m *Authenticator) PublicKeys() []entity.JWK {
+	ret := _m.Called()
+
+	var r0 []entity.JWK
+	if rf, ok := ret.Get(0).(func() []entity.JWK); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.JWK)
+		}
+	}
+
+	return r0
+}
+
+// RevokeSession provides a mock function with given fields: sessionID
+func (_m *Authenticator) RevokeSession(sessionID string) {
+	_m.Called(sessionID)
+}
+
 // ValidateToken provides a mock function with given fields: token
-func (_m *Authenticator) ValidateToken(token entity.AuthToken) (entity.UserID, error) {
+func (_m *Authenticator) ValidateToken(token entity.AuthToken) (entity.Principal, error) {
 	ret := _m.Called(token)
 
-	var r0 entity.UserID
+	var r0 entity.Principal
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.AuthToken) (entity.UserID, error)); ok {
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) (entity.Principal, error)); ok {
 		return rf(token)
 	}
-	if rf, ok := ret.Get(0).(func(entity.AuthToken) entity.UserID); ok {
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) entity.Principal); ok {
 		r0 = rf(token)
 	} else {
-		r0 = ret.Get(0).(entity.UserID)
+		r0 = ret.Get(0).(entity.Principal)
 	}
 
 	if rf, ok := ret.Get(1).(func(entity.AuthToken) error); ok {
@@ -3,8 +3,12 @@
 package mocks
 
 import (
+	context "context"
+
 	entity "github.com/size12/gophkeeper/internal/entity"
 
+	io "io"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,6 +17,48 @@ type ClientConn struct {
 	mock.Mock
 }
 
+// ChangePassword provides a mock function with given fields: token, credentials, newPassword
+func (_m *ClientConn) ChangePassword(token entity.AuthToken, credentials entity.UserCredentials, newPassword string) error {
+	ret := _m.Called(token, credentials, newPassword)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.UserCredentials, string) error); ok {
+		r0 = rf(token, credentials, newPassword)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ChangePasswordSRP provides a mock function with given fields: token, proof, verifier
+func (_m *ClientConn) ChangePasswordSRP(token entity.AuthToken, proof entity.SRPProof, verifier entity.SRPVerifier) error {
+	ret := _m.Called(token, proof, verifier)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.SRPProof, entity.SRPVerifier) error); ok {
+		r0 = rf(token, proof, verifier)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ConfirmTOTP provides a mock function with given fields: token, code
+func (_m *ClientConn) ConfirmTOTP(token entity.AuthToken, code string) error {
+	ret := _m.Called(token, code)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string) error); ok {
+		r0 = rf(token, code)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateRecord provides a mock function with given fields: token, record
 func (_m *ClientConn) CreateRecord(token entity.AuthToken, record entity.Record) error {
 	ret := _m.Called(token, record)
@@ -27,6 +73,34 @@ func (_m *ClientConn) CreateRecord(token entity.AuthToken, record entity.Record)
 	return r0
 }
 
+// DeleteAccount provides a mock function with given fields: token, credentials
+func (_m *ClientConn) DeleteAccount(token entity.AuthToken, credentials entity.UserCredentials) error {
+	ret := _m.Called(token, credentials)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.UserCredentials) error); ok {
+		r0 = rf(token, credentials)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteAccountSRP provides a mock function with given fields: token, proof
+func (_m *ClientConn) DeleteAccountSRP(token entity.AuthToken, proof entity.SRPProof) error {
+	ret := _m.Called(token, proof)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.SRPProof) error); ok {
+		r0 = rf(token, proof)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteRecord provides a mock function with given fields: token, recordID
 func (_m *ClientConn) DeleteRecord(token entity.AuthToken, recordID string) error {
 	ret := _m.Called(token, recordID)
@@ -41,6 +115,115 @@ func (_m *ClientConn) DeleteRecord(token entity.AuthToken, recordID string) erro
 	return r0
 }
 
+// DisableTOTP provides a mock function with given fields: token, code, credentials, proof
+func (_m *ClientConn) DisableTOTP(token entity.AuthToken, code string, credentials entity.UserCredentials, proof entity.SRPProof) error {
+	ret := _m.Called(token, code, credentials, proof)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string, entity.UserCredentials, entity.SRPProof) error); ok {
+		r0 = rf(token, code, credentials, proof)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DownloadFile provides a mock function with given fields: token, recordID, w
+func (_m *ClientConn) DownloadFile(token entity.AuthToken, recordID string, w io.Writer) error {
+	ret := _m.Called(token, recordID, w)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string, io.Writer) error); ok {
+		r0 = rf(token, recordID, w)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnableTOTP provides a mock function with given fields: token
+func (_m *ClientConn) EnableTOTP(token entity.AuthToken) (entity.TOTPEnrollment, error) {
+	ret := _m.Called(token)
+
+	var r0 entity.TOTPEnrollment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) (entity.TOTPEnrollment, error)); ok {
+		return rf(token)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) entity.TOTPEnrollment); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Get(0).(entity.TOTPEnrollment)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishLoginSRP provides a mock function with given fields: loginID, clientProof
+func (_m *ClientConn) FinishLoginSRP(loginID string, clientProof []byte) (string, []byte, error) {
+	ret := _m.Called(loginID, clientProof)
+
+	var r0 string
+	var r1 []byte
+	var r2 error
+	if rf, ok := ret.Get(0).(func(string, []byte) (string, []byte, error)); ok {
+		return rf(loginID, clientProof)
+	}
+	if rf, ok := ret.Get(0).(func(string, []byte) string); ok {
+		r0 = rf(loginID, clientProof)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, []byte) []byte); ok {
+		r1 = rf(loginID, clientProof)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(string, []byte) error); ok {
+		r2 = rf(loginID, clientProof)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetChanges provides a mock function with given fields: token, sinceRevision
+func (_m *ClientConn) GetChanges(token entity.AuthToken, sinceRevision int64) (entity.Changes, error) {
+	ret := _m.Called(token, sinceRevision)
+
+	var r0 entity.Changes
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, int64) (entity.Changes, error)); ok {
+		return rf(token, sinceRevision)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, int64) entity.Changes); ok {
+		r0 = rf(token, sinceRevision)
+	} else {
+		r0 = ret.Get(0).(entity.Changes)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, int64) error); ok {
+		r1 = rf(token, sinceRevision)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRecord provides a mock function with given fields: token, recordID
 func (_m *ClientConn) GetRecord(token entity.AuthToken, recordID string) (entity.Record, error) {
 	ret := _m.Called(token, recordID)
@@ -65,20 +248,94 @@ func (_m *ClientConn) GetRecord(token entity.AuthToken, recordID string) (entity
 	return r0, r1
 }
 
-// GetRecordsInfo provides a mock function with given fields: token
-func (_m *ClientConn) GetRecordsInfo(token entity.AuthToken) ([]entity.Record, error) {
+// GetRecordsInfo provides a mock function with given fields: token, query
+func (_m *ClientConn) GetRecordsInfo(token entity.AuthToken, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	ret := _m.Called(token, query)
+
+	var r0 entity.RecordsPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.RecordsQuery) (entity.RecordsPage, error)); ok {
+		return rf(token, query)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.RecordsQuery) entity.RecordsPage); ok {
+		r0 = rf(token, query)
+	} else {
+		r0 = ret.Get(0).(entity.RecordsPage)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, entity.RecordsQuery) error); ok {
+		r1 = rf(token, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsage provides a mock function with given fields: token
+func (_m *ClientConn) GetUsage(token entity.AuthToken) (entity.Usage, error) {
+	ret := _m.Called(token)
+
+	var r0 entity.Usage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) (entity.Usage, error)); ok {
+		return rf(token)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) entity.Usage); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Get(0).(entity.Usage)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditEvents provides a mock function with given fields: token, query
+func (_m *ClientConn) ListAuditEvents(token entity.AuthToken, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	ret := _m.Called(token, query)
+
+	var r0 []entity.AuditEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.AuditQuery) ([]entity.AuditEvent, error)); ok {
+		return rf(token, query)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.AuditQuery) []entity.AuditEvent); ok {
+		r0 = rf(token, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.AuditEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, entity.AuditQuery) error); ok {
+		r1 = rf(token, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: token
+func (_m *ClientConn) ListSessions(token entity.AuthToken) ([]entity.SessionInfo, error) {
 	ret := _m.Called(token)
 
-	var r0 []entity.Record
+	var r0 []entity.SessionInfo
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.AuthToken) ([]entity.Record, error)); ok {
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) ([]entity.SessionInfo, error)); ok {
 		return rf(token)
 	}
-	if rf, ok := ret.Get(0).(func(entity.AuthToken) []entity.Record); ok {
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) []entity.SessionInfo); ok {
 		r0 = rf(token)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]entity.Record)
+			r0 = ret.Get(0).([]entity.SessionInfo)
 		}
 	}
 
@@ -115,6 +372,20 @@ func (_m *ClientConn) Login(credentials entity.UserCredentials) (string, error)
 	return r0, r1
 }
 
+// Logout provides a mock function with given fields: token
+func (_m *ClientConn) Logout(token entity.AuthToken) error {
+	ret := _m.Called(token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken) error); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Register provides a mock function with given fields: credentials
 func (_m *ClientConn) Register(credentials entity.UserCredentials) (string, error) {
 	ret := _m.Called(credentials)
@@ -139,6 +410,178 @@ func (_m *ClientConn) Register(credentials entity.UserCredentials) (string, erro
 	return r0, r1
 }
 
+// RegisterSRP provides a mock function with given fields: login, verifier
+func (_m *ClientConn) RegisterSRP(login string, verifier entity.SRPVerifier) (string, error) {
+	ret := _m.Called(login, verifier)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, entity.SRPVerifier) (string, error)); ok {
+		return rf(login, verifier)
+	}
+	if rf, ok := ret.Get(0).(func(string, entity.SRPVerifier) string); ok {
+		r0 = rf(login, verifier)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, entity.SRPVerifier) error); ok {
+		r1 = rf(login, verifier)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceRecords provides a mock function with given fields: token, records, files
+func (_m *ClientConn) ReplaceRecords(token entity.AuthToken, records []entity.Record, files map[string]io.Reader) (int64, error) {
+	ret := _m.Called(token, records, files)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, []entity.Record, map[string]io.Reader) (int64, error)); ok {
+		return rf(token, records, files)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, []entity.Record, map[string]io.Reader) int64); ok {
+		r0 = rf(token, records, files)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, []entity.Record, map[string]io.Reader) error); ok {
+		r1 = rf(token, records, files)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeSession provides a mock function with given fields: token, sessionID
+func (_m *ClientConn) RevokeSession(token entity.AuthToken, sessionID string) error {
+	ret := _m.Called(token, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string) error); ok {
+		r0 = rf(token, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StartLoginSRP provides a mock function with given fields: login, clientPublicKey
+func (_m *ClientConn) StartLoginSRP(login string, clientPublicKey []byte) (entity.SRPChallenge, error) {
+	ret := _m.Called(login, clientPublicKey)
+
+	var r0 entity.SRPChallenge
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, []byte) (entity.SRPChallenge, error)); ok {
+		return rf(login, clientPublicKey)
+	}
+	if rf, ok := ret.Get(0).(func(string, []byte) entity.SRPChallenge); ok {
+		r0 = rf(login, clientPublicKey)
+	} else {
+		r0 = ret.Get(0).(entity.SRPChallenge)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, []byte) error); ok {
+		r1 = rf(login, clientPublicKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateRecord provides a mock function with given fields: token, record
+func (_m *ClientConn) UpdateRecord(token entity.AuthToken, record entity.Record) (int64, error) {
+	ret := _m.Called(token, record)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.Record) (int64, error)); ok {
+		return rf(token, record)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.Record) int64); ok {
+		r0 = rf(token, record)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, entity.Record) error); ok {
+		r1 = rf(token, record)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UploadFile provides a mock function with given fields: token, record, r
+func (_m *ClientConn) UploadFile(token entity.AuthToken, record entity.Record, r io.Reader) (string, error) {
+	ret := _m.Called(token, record, r)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.Record, io.Reader) (string, error)); ok {
+		return rf(token, record, r)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, entity.Record, io.Reader) string); ok {
+		r0 = rf(token, record, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, entity.Record, io.Reader) error); ok {
+		r1 = rf(token, record, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyTOTP provides a mock function with given fields: token, code
+func (_m *ClientConn) VerifyTOTP(token entity.AuthToken, code string) (string, error) {
+	ret := _m.Called(token, code)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string) (string, error)); ok {
+		return rf(token, code)
+	}
+	if rf, ok := ret.Get(0).(func(entity.AuthToken, string) string); ok {
+		r0 = rf(token, code)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(entity.AuthToken, string) error); ok {
+		r1 = rf(token, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WatchRecords provides a mock function with given fields: ctx, token, handle
+func (_m *ClientConn) WatchRecords(ctx context.Context, token entity.AuthToken, handle func(entity.RecordEvent)) error {
+	ret := _m.Called(ctx, token, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuthToken, func(entity.RecordEvent)) error); ok {
+		r0 = rf(ctx, token, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewClientConn interface {
 	mock.TestingT
 	Cleanup(func())
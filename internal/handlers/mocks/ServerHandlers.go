@@ -7,6 +7,8 @@ import (
 
 	entity "github.com/size12/gophkeeper/internal/entity"
 
+	io "io"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -15,6 +17,62 @@ type ServerHandlers struct {
 	mock.Mock
 }
 
+// ChangePassword provides a mock function with given fields: ctx, credentials, newPassword
+func (_m *ServerHandlers) ChangePassword(ctx context.Context, credentials entity.UserCredentials, newPassword string) error {
+	ret := _m.Called(ctx, credentials, newPassword)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials, string) error); ok {
+		r0 = rf(ctx, credentials, newPassword)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ChangePasswordSRP provides a mock function with given fields: ctx, proof, verifier
+func (_m *ServerHandlers) ChangePasswordSRP(ctx context.Context, proof entity.SRPProof, verifier entity.SRPVerifier) error {
+	ret := _m.Called(ctx, proof, verifier)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.SRPProof, entity.SRPVerifier) error); ok {
+		r0 = rf(ctx, proof, verifier)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CheckSession provides a mock function with given fields: ctx
+func (_m *ServerHandlers) CheckSession(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ConfirmTOTP provides a mock function with given fields: ctx, code
+func (_m *ServerHandlers) ConfirmTOTP(ctx context.Context, code string) error {
+	ret := _m.Called(ctx, code)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, code)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateRecord provides a mock function with given fields: ctx, record
 func (_m *ServerHandlers) CreateRecord(ctx context.Context, record entity.Record) error {
 	ret := _m.Called(ctx, record)
@@ -29,23 +87,23 @@ func (_m *ServerHandlers) CreateRecord(ctx context.Context, record entity.Record
 	return r0
 }
 
-// CreateUser provides a mock function with given fields: credentials
-func (_m *ServerHandlers) CreateUser(credentials entity.UserCredentials) (entity.AuthToken, error) {
-	ret := _m.Called(credentials)
+// CreateUser provides a mock function with given fields: ctx, credentials, device
+func (_m *ServerHandlers) CreateUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error) {
+	ret := _m.Called(ctx, credentials, device)
 
-	var r0 entity.AuthToken
+	var r0 entity.Session
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) (entity.AuthToken, error)); ok {
-		return rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials, entity.Device) (entity.Session, error)); ok {
+		return rf(ctx, credentials, device)
 	}
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) entity.AuthToken); ok {
-		r0 = rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials, entity.Device) entity.Session); ok {
+		r0 = rf(ctx, credentials, device)
 	} else {
-		r0 = ret.Get(0).(entity.AuthToken)
+		r0 = ret.Get(0).(entity.Session)
 	}
 
-	if rf, ok := ret.Get(1).(func(entity.UserCredentials) error); ok {
-		r1 = rf(credentials)
+	if rf, ok := ret.Get(1).(func(context.Context, entity.UserCredentials, entity.Device) error); ok {
+		r1 = rf(ctx, credentials, device)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -53,6 +111,34 @@ func (_m *ServerHandlers) CreateUser(credentials entity.UserCredentials) (entity
 	return r0, r1
 }
 
+// DeleteAccount provides a mock function with given fields: ctx, credentials
+func (_m *ServerHandlers) DeleteAccount(ctx context.Context, credentials entity.UserCredentials) error {
+	ret := _m.Called(ctx, credentials)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials) error); ok {
+		r0 = rf(ctx, credentials)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteAccountSRP provides a mock function with given fields: ctx, proof
+func (_m *ServerHandlers) DeleteAccountSRP(ctx context.Context, proof entity.SRPProof) error {
+	ret := _m.Called(ctx, proof)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.SRPProof) error); ok {
+		r0 = rf(ctx, proof)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteRecord provides a mock function with given fields: ctx, recordID
 func (_m *ServerHandlers) DeleteRecord(ctx context.Context, recordID string) error {
 	ret := _m.Called(ctx, recordID)
@@ -67,6 +153,115 @@ func (_m *ServerHandlers) DeleteRecord(ctx context.Context, recordID string) err
 	return r0
 }
 
+// DisableTOTP provides a mock function with given fields: ctx, code, credentials, proof
+func (_m *ServerHandlers) DisableTOTP(ctx context.Context, code string, credentials entity.UserCredentials, proof entity.SRPProof) error {
+	ret := _m.Called(ctx, code, credentials, proof)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.UserCredentials, entity.SRPProof) error); ok {
+		r0 = rf(ctx, code, credentials, proof)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DownloadFile provides a mock function with given fields: ctx, recordID, w
+func (_m *ServerHandlers) DownloadFile(ctx context.Context, recordID string, w io.Writer) error {
+	ret := _m.Called(ctx, recordID, w)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Writer) error); ok {
+		r0 = rf(ctx, recordID, w)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnableTOTP provides a mock function with given fields: ctx
+func (_m *ServerHandlers) EnableTOTP(ctx context.Context) (entity.TOTPEnrollment, error) {
+	ret := _m.Called(ctx)
+
+	var r0 entity.TOTPEnrollment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (entity.TOTPEnrollment, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) entity.TOTPEnrollment); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(entity.TOTPEnrollment)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishLoginSRP provides a mock function with given fields: ctx, loginID, clientProof, device
+func (_m *ServerHandlers) FinishLoginSRP(ctx context.Context, loginID string, clientProof []byte, device entity.Device) (entity.Session, []byte, error) {
+	ret := _m.Called(ctx, loginID, clientProof, device)
+
+	var r0 entity.Session
+	var r1 []byte
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, entity.Device) (entity.Session, []byte, error)); ok {
+		return rf(ctx, loginID, clientProof, device)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, entity.Device) entity.Session); ok {
+		r0 = rf(ctx, loginID, clientProof, device)
+	} else {
+		r0 = ret.Get(0).(entity.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte, entity.Device) []byte); ok {
+		r1 = rf(ctx, loginID, clientProof, device)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, []byte, entity.Device) error); ok {
+		r2 = rf(ctx, loginID, clientProof, device)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetChanges provides a mock function with given fields: ctx, sinceRevision
+func (_m *ServerHandlers) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	ret := _m.Called(ctx, sinceRevision)
+
+	var r0 entity.Changes
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (entity.Changes, error)); ok {
+		return rf(ctx, sinceRevision)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) entity.Changes); ok {
+		r0 = rf(ctx, sinceRevision)
+	} else {
+		r0 = ret.Get(0).(entity.Changes)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, sinceRevision)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRecord provides a mock function with given fields: ctx, recordID
 func (_m *ServerHandlers) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
 	ret := _m.Called(ctx, recordID)
@@ -91,20 +286,94 @@ func (_m *ServerHandlers) GetRecord(ctx context.Context, recordID string) (entit
 	return r0, r1
 }
 
-// GetRecordsInfo provides a mock function with given fields: ctx
-func (_m *ServerHandlers) GetRecordsInfo(ctx context.Context) ([]entity.Record, error) {
+// GetRecordsInfo provides a mock function with given fields: ctx, query
+func (_m *ServerHandlers) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 entity.RecordsPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.RecordsQuery) (entity.RecordsPage, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.RecordsQuery) entity.RecordsPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		r0 = ret.Get(0).(entity.RecordsPage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.RecordsQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsage provides a mock function with given fields: ctx
+func (_m *ServerHandlers) GetUsage(ctx context.Context) (entity.Usage, error) {
 	ret := _m.Called(ctx)
 
-	var r0 []entity.Record
+	var r0 entity.Usage
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) ([]entity.Record, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context) (entity.Usage, error)); ok {
 		return rf(ctx)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) []entity.Record); ok {
+	if rf, ok := ret.Get(0).(func(context.Context) entity.Usage); ok {
 		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(entity.Usage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditEvents provides a mock function with given fields: ctx, query
+func (_m *ServerHandlers) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 []entity.AuditEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuditQuery) ([]entity.AuditEvent, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuditQuery) []entity.AuditEvent); ok {
+		r0 = rf(ctx, query)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]entity.Record)
+			r0 = ret.Get(0).([]entity.AuditEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.AuditQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: ctx
+func (_m *ServerHandlers) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []entity.SessionInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]entity.SessionInfo, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []entity.SessionInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.SessionInfo)
 		}
 	}
 
@@ -117,23 +386,23 @@ func (_m *ServerHandlers) GetRecordsInfo(ctx context.Context) ([]entity.Record,
 	return r0, r1
 }
 
-// LoginUser provides a mock function with given fields: credentials
-func (_m *ServerHandlers) LoginUser(credentials entity.UserCredentials) (entity.AuthToken, error) {
-	ret := _m.Called(credentials)
+// LoginUser provides a mock function with given fields: ctx, credentials, device
+func (_m *ServerHandlers) LoginUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error) {
+	ret := _m.Called(ctx, credentials, device)
 
-	var r0 entity.AuthToken
+	var r0 entity.Session
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) (entity.AuthToken, error)); ok {
-		return rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials, entity.Device) (entity.Session, error)); ok {
+		return rf(ctx, credentials, device)
 	}
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) entity.AuthToken); ok {
-		r0 = rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserCredentials, entity.Device) entity.Session); ok {
+		r0 = rf(ctx, credentials, device)
 	} else {
-		r0 = ret.Get(0).(entity.AuthToken)
+		r0 = ret.Get(0).(entity.Session)
 	}
 
-	if rf, ok := ret.Get(1).(func(entity.UserCredentials) error); ok {
-		r1 = rf(credentials)
+	if rf, ok := ret.Get(1).(func(context.Context, entity.UserCredentials, entity.Device) error); ok {
+		r1 = rf(ctx, credentials, device)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -141,6 +410,216 @@ func (_m *ServerHandlers) LoginUser(credentials entity.UserCredentials) (entity.
 	return r0, r1
 }
 
+// Logout provides a mock function with given fields: ctx
+func (_m *ServerHandlers) Logout(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RefreshSession provides a mock function with given fields: ctx, refreshToken
+func (_m *ServerHandlers) RefreshSession(ctx context.Context, refreshToken string) (entity.Session, error) {
+	ret := _m.Called(ctx, refreshToken)
+
+	var r0 entity.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entity.Session, error)); ok {
+		return rf(ctx, refreshToken)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) entity.Session); ok {
+		r0 = rf(ctx, refreshToken)
+	} else {
+		r0 = ret.Get(0).(entity.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, refreshToken)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RegisterSRP provides a mock function with given fields: ctx, login, verifier, device
+func (_m *ServerHandlers) RegisterSRP(ctx context.Context, login string, verifier entity.SRPVerifier, device entity.Device) (entity.Session, error) {
+	ret := _m.Called(ctx, login, verifier, device)
+
+	var r0 entity.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.SRPVerifier, entity.Device) (entity.Session, error)); ok {
+		return rf(ctx, login, verifier, device)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.SRPVerifier, entity.Device) entity.Session); ok {
+		r0 = rf(ctx, login, verifier, device)
+	} else {
+		r0 = ret.Get(0).(entity.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, entity.SRPVerifier, entity.Device) error); ok {
+		r1 = rf(ctx, login, verifier, device)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceRecords provides a mock function with given fields: ctx, next
+func (_m *ServerHandlers) ReplaceRecords(ctx context.Context, next func() (entity.Record, io.Reader, error)) (int64, error) {
+	ret := _m.Called(ctx, next)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, func() (entity.Record, io.Reader, error)) (int64, error)); ok {
+		return rf(ctx, next)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, func() (entity.Record, io.Reader, error)) int64); ok {
+		r0 = rf(ctx, next)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, func() (entity.Record, io.Reader, error)) error); ok {
+		r1 = rf(ctx, next)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeSession provides a mock function with given fields: ctx, sessionID
+func (_m *ServerHandlers) RevokeSession(ctx context.Context, sessionID string) error {
+	ret := _m.Called(ctx, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StartLoginSRP provides a mock function with given fields: ctx, login, clientPublicKey, device
+func (_m *ServerHandlers) StartLoginSRP(ctx context.Context, login string, clientPublicKey []byte, device entity.Device) (entity.SRPChallenge, error) {
+	ret := _m.Called(ctx, login, clientPublicKey, device)
+
+	var r0 entity.SRPChallenge
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, entity.Device) (entity.SRPChallenge, error)); ok {
+		return rf(ctx, login, clientPublicKey, device)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, entity.Device) entity.SRPChallenge); ok {
+		r0 = rf(ctx, login, clientPublicKey, device)
+	} else {
+		r0 = ret.Get(0).(entity.SRPChallenge)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte, entity.Device) error); ok {
+		r1 = rf(ctx, login, clientPublicKey, device)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateRecord provides a mock function with given fields: ctx, record
+func (_m *ServerHandlers) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	ret := _m.Called(ctx, record)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) (int64, error)); ok {
+		return rf(ctx, record)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) int64); ok {
+		r0 = rf(ctx, record)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.Record) error); ok {
+		r1 = rf(ctx, record)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UploadFile provides a mock function with given fields: ctx, record, r
+func (_m *ServerHandlers) UploadFile(ctx context.Context, record entity.Record, r io.Reader) (string, error) {
+	ret := _m.Called(ctx, record, r)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record, io.Reader) (string, error)); ok {
+		return rf(ctx, record, r)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record, io.Reader) string); ok {
+		r0 = rf(ctx, record, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.Record, io.Reader) error); ok {
+		r1 = rf(ctx, record, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyTOTP provides a mock function with given fields: ctx, code, device
+func (_m *ServerHandlers) VerifyTOTP(ctx context.Context, code string, device entity.Device) (entity.Session, error) {
+	ret := _m.Called(ctx, code, device)
+
+	var r0 entity.Session
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.Device) (entity.Session, error)); ok {
+		return rf(ctx, code, device)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.Device) entity.Session); ok {
+		r0 = rf(ctx, code, device)
+	} else {
+		r0 = ret.Get(0).(entity.Session)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, entity.Device) error); ok {
+		r1 = rf(ctx, code, device)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WatchRecords provides a mock function with given fields: ctx, handle
+func (_m *ServerHandlers) WatchRecords(ctx context.Context, handle func(entity.RecordEvent) error) error {
+	ret := _m.Called(ctx, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(entity.RecordEvent) error) error); ok {
+		r0 = rf(ctx, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewServerHandlers interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"golang.org/x/crypto/argon2"
+)
+
+// errBadPasswordHash is returned, when stored password hash can't be parsed.
+var errBadPasswordHash = errors.New("bad password hash")
+
+// argon2Params are parameters of Argon2id password hashing.
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+// passwordParams are parameters of new password hashes. Hashes with other parameters are upgraded on login.
+var passwordParams = argon2Params{time: 3, memory: 64 * 1024, threads: 2, keyLen: 32, saltLen: 16}
+
+// maxPasswordHashes limits number of Argon2id hashes computed at once. Each one takes memory of its parameters,
+// so burst of logins or registrations can't exhaust memory of server.
+const maxPasswordHashes = 4
+
+// passwordHashes is semaphore of Argon2id hashes, which are computed now.
+var passwordHashes = make(chan struct{}, maxPasswordHashes)
+
+// dummyPassword is password hash with parameters of new hashes, which never matches. It's checked for unknown
+// logins, so they take as long as known ones and response time doesn't show, if user exists.
+var dummyPassword = entity.StoredPassword{
+	Hash:      formatArgon2Hash(passwordParams, make([]byte, passwordParams.saltLen), make([]byte, passwordParams.keyLen)),
+	Algorithm: entity.PasswordArgon2id,
+}
+
+// argon2Key computes Argon2id key of password. It waits, while too many hashes are computed,
+// and returns error of context, if request is done before hash is started.
+func argon2Key(ctx context.Context, password string, salt []byte, params argon2Params) ([]byte, error) {
+	select {
+	case passwordHashes <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-passwordHashes }()
+
+	return argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, params.keyLen), nil
+}
+
+// formatArgon2Hash returns Argon2id hash in PHC string format.
+func formatArgon2Hash(params argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.memory, params.time, params.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// hashPassword returns Argon2id hash of password with random salt.
+func hashPassword(ctx context.Context, password string) (entity.StoredPassword, error) {
+	salt, err := generateRandom(int(passwordParams.saltLen))
+	if err != nil {
+		return entity.StoredPassword{}, err
+	}
+
+	key, err := argon2Key(ctx, password, salt, passwordParams)
+	if err != nil {
+		return entity.StoredPassword{}, err
+	}
+
+	return entity.StoredPassword{Hash: formatArgon2Hash(passwordParams, salt, key), Algorithm: entity.PasswordArgon2id}, nil
+}
+
+// verifyPassword checks password of user. Rehash is true, if password is right, but its hash is legacy or
+// was made with old parameters. Error is returned only, if request is done before password is checked.
+func verifyPassword(ctx context.Context, stored entity.StoredPassword, credentials entity.UserCredentials) (ok bool, rehash bool, err error) {
+	switch stored.Algorithm {
+	case entity.PasswordSHA256:
+		sum := sha256.Sum256([]byte(credentials.Login + credentials.Password))
+		ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(stored.Hash)) == 1
+		return ok, ok, nil
+	case entity.PasswordArgon2id:
+		params, salt, key, err := parseArgon2Hash(stored.Hash)
+		if err != nil {
+			return false, false, nil
+		}
+
+		got, err := argon2Key(ctx, credentials.Password, salt, params)
+		if err != nil {
+			return false, false, err
+		}
+
+		ok = subtle.ConstantTimeCompare(got, key) == 1
+		return ok, ok && params != passwordParams, nil
+	}
+
+	return false, false, nil
+}
+
+// encodeSRPVerifier returns SRP-6a salt and verifier as stored password.
+func encodeSRPVerifier(verifier entity.SRPVerifier) entity.StoredPassword {
+	return entity.StoredPassword{
+		Hash: fmt.Sprintf("$srp6a$%s$%s", base64.RawStdEncoding.EncodeToString(verifier.Salt),
+			base64.RawStdEncoding.EncodeToString(verifier.Verifier)),
+		Algorithm: entity.PasswordSRP6a,
+	}
+}
+
+// decodeSRPVerifier gets SRP-6a salt and verifier from stored password.
+func decodeSRPVerifier(stored entity.StoredPassword) (entity.SRPVerifier, error) {
+	parts := strings.Split(stored.Hash, "$")
+	if stored.Algorithm != entity.PasswordSRP6a || len(parts) != 4 || parts[1] != "srp6a" {
+		return entity.SRPVerifier{}, errBadPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return entity.SRPVerifier{}, errBadPasswordHash
+	}
+
+	verifier, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(verifier) == 0 {
+		return entity.SRPVerifier{}, errBadPasswordHash
+	}
+
+	return entity.SRPVerifier{Salt: salt, Verifier: verifier}, nil
+}
+
+// parseArgon2Hash parses Argon2id hash in PHC string format.
+func parseArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	var params argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	// Argon2 requires at least one pass and one lane and at least 8 KiB of memory per lane.
+	if params.time == 0 || params.threads == 0 || uint64(params.memory) < 8*uint64(params.threads) {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, errBadPasswordHash
+	}
+
+	params.saltLen = uint32(len(salt))
+	params.keyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	first, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.PasswordArgon2id, first.Algorithm)
+	assert.True(t, strings.HasPrefix(first.Hash, "$argon2id$v=19$m=65536,t=3,p=2$"))
+
+	second, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Hash, second.Hash, "salt should be random")
+}
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+
+	credentials := entity.UserCredentials{Login: "admin", Password: "password"}
+
+	tc := []struct {
+		name   string
+		stored entity.StoredPassword
+		creds  entity.UserCredentials
+		ok     bool
+		rehash bool
+	}{
+		{"Right password with current hash", current, credentials, true, false},
+		{"Wrong password with current hash", current, entity.UserCredentials{Login: "admin", Password: "wrong"}, false, false},
+		{
+			"Right password with legacy hash",
+			entity.StoredPassword{Hash: "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70", Algorithm: entity.PasswordSHA256},
+			credentials, true, true,
+		},
+		{
+			"Wrong password with legacy hash",
+			entity.StoredPassword{Hash: "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70", Algorithm: entity.PasswordSHA256},
+			entity.UserCredentials{Login: "admin", Password: "wrong"}, false, false,
+		},
+		{
+			"Right password with hash of old parameters",
+			entity.StoredPassword{
+				Hash:      "$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY",
+				Algorithm: entity.PasswordArgon2id,
+			},
+			credentials, true, true,
+		},
+		{"Broken hash", entity.StoredPassword{Hash: "$argon2id$broken", Algorithm: entity.PasswordArgon2id}, credentials, false, false},
+		{"Unknown algorithm", entity.StoredPassword{Hash: current.Hash, Algorithm: "md5"}, credentials, false, false},
+		{"Dummy hash of unknown login", dummyPassword, credentials, false, false},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		ok, rehash, err := verifyPassword(context.Background(), test.stored, test.creds)
+		assert.NoError(t, err)
+		assert.Equal(t, test.ok, ok)
+		assert.Equal(t, test.rehash, rehash)
+	}
+}
+
+func TestDummyPassword(t *testing.T) {
+	params, _, _, err := parseArgon2Hash(dummyPassword.Hash)
+	assert.NoError(t, err)
+	assert.Equal(t, passwordParams, params, "dummy hash should take as long as hash of known user")
+}
+
+func TestHashPassword_LimitsConcurrentHashes(t *testing.T) {
+	for i := 0; i < maxPasswordHashes; i++ {
+		passwordHashes <- struct{}{}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, err := hashPassword(context.Background(), "password")
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("password is hashed, while too many hashes are computed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-passwordHashes
+	<-done
+
+	for i := 1; i < maxPasswordHashes; i++ {
+		<-passwordHashes
+	}
+}
+
+func TestHashPassword_StopsWaitingOnDoneContext(t *testing.T) {
+	for i := 0; i < maxPasswordHashes; i++ {
+		passwordHashes <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxPasswordHashes; i++ {
+			<-passwordHashes
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := hashPassword(ctx, "password")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ok, _, err := verifyPassword(ctx, dummyPassword, entity.UserCredentials{Login: "admin", Password: "password"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, ok)
+}
+
+func TestEncodeSRPVerifier(t *testing.T) {
+	verifier := entity.SRPVerifier{Salt: []byte("saltsaltsaltsalt"), Verifier: []byte("verifier")}
+
+	stored := encodeSRPVerifier(verifier)
+	assert.Equal(t, entity.PasswordSRP6a, stored.Algorithm)
+	assert.Equal(t, "$srp6a$c2FsdHNhbHRzYWx0c2FsdA$dmVyaWZpZXI", stored.Hash)
+
+	got, err := decodeSRPVerifier(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, verifier, got)
+
+	_, err = decodeSRPVerifier(entity.StoredPassword{Hash: stored.Hash, Algorithm: entity.PasswordArgon2id})
+	assert.Equal(t, errBadPasswordHash, err)
+
+	_, err = decodeSRPVerifier(entity.StoredPassword{Hash: "$srp6a$c2FsdA$", Algorithm: entity.PasswordSRP6a})
+	assert.Equal(t, errBadPasswordHash, err)
+}
+
+func TestParseArgon2Hash(t *testing.T) {
+	tc := []struct {
+		name string
+		hash string
+	}{
+		{"Zero time", "$argon2id$v=19$m=16,t=0,p=1$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+		{"Zero threads", "$argon2id$v=19$m=16,t=1,p=0$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+		{"Too little memory for threads", "$argon2id$v=19$m=15,t=1,p=2$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+		{"Empty salt", "$argon2id$v=19$m=16,t=1,p=1$$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+		{"Empty key", "$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$"},
+		{"Wrong version", "$argon2id$v=16$m=16,t=1,p=1$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+		{"Broken salt", "$argon2id$v=19$m=16,t=1,p=1$c2F!$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY"},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		_, _, _, err := parseArgon2Hash(test.hash)
+		assert.Equal(t, errBadPasswordHash, err)
+
+		ok, rehash, _ := verifyPassword(context.Background(), entity.StoredPassword{Hash: test.hash, Algorithm: entity.PasswordArgon2id}, entity.UserCredentials{Password: "password"})
+		assert.False(t, ok)
+		assert.False(t, rehash)
+	}
+
+	params, salt, key, err := parseArgon2Hash("$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$UmYMPLGNtNOREKjq2uk7Zhy7gGVFOGpO0OBEnDYhZWY")
+	assert.NoError(t, err)
+	assert.Equal(t, argon2Params{time: 1, memory: 16, threads: 1, keyLen: 32, saltLen: 8}, params)
+	assert.Equal(t, []byte("saltsalt"), salt)
+	assert.Len(t, key, 32)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"io"
+	"os"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/storage"
+)
+
+// rotationPageSize is size of records page, which is read while master key is rotated.
+const rotationPageSize = 1000
+
+// RotateMasterKey seals all records of user with new master key. Old master key should be the one user logged in with.
+// Records are replaced on server at once, so vault is never left sealed by both keys.
+// Progress is called after every record is sealed, it may be nil. Records sealed with legacy key are sealed
+// with new master key too, rotation to the same master key only migrates them.
+func (client *Client) RotateMasterKey(oldMasterKey, newMasterKey []byte, progress func(done, total int)) error {
+	if len(oldMasterKey) == 0 || len(newMasterKey) == 0 {
+		return ErrFieldIsEmpty
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	oldKey := deriveMasterKey(oldMasterKey)
+	if subtle.ConstantTimeCompare(oldKey, client.masterKey) != 1 {
+		return ErrWrongMasterKey
+	}
+
+	newKey := deriveMasterKey(newMasterKey)
+
+	infos, err := client.allRecordsInfo()
+	if err != nil {
+		return err
+	}
+
+	records := make([]entity.Record, 0, len(infos))
+	files := make(map[string]io.Reader)
+
+	var temporary []*os.File
+	defer func() {
+		for _, file := range temporary {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	for i, info := range infos {
+		record, err := client.Conn.GetRecord(client.authToken, info.ID)
+		if err != nil {
+			return err
+		}
+
+		if record.Type == entity.TypeFile {
+			file, err := client.resealFile(record.ID, rotationKeys(oldKey), newKey)
+			if err != nil {
+				return err
+			}
+
+			temporary = append(temporary, file)
+			files[record.ID] = file
+			record.Data = nil
+		} else {
+			plain, err := decryptWith(rotationKeys(oldKey), record.Data)
+			if err != nil {
+				return ErrWrongMasterKey
+			}
+
+			record.Data, err = encryptWith(newKey, plain)
+			if err != nil {
+				return err
+			}
+		}
+
+		records = append(records, record)
+
+		if progress != nil {
+			progress(i+1, len(infos))
+		}
+	}
+
+	_, err = client.Conn.ReplaceRecords(client.authToken, records, files)
+	if err != nil {
+		return err
+	}
+
+	client.masterKey = newKey
+	client.records = nil
+	client.revision = 0
+	return nil
+}
+
+// allRecordsInfo gets info of all records of user page by page.
+func (client *Client) allRecordsInfo() ([]entity.Record, error) {
+	var records []entity.Record
+
+	query := entity.RecordsQuery{PageSize: rotationPageSize}
+	for {
+		page, err := client.Conn.GetRecordsInfo(client.authToken, query)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, page.Records...)
+
+		if page.NextPageToken == "" {
+			return records, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// resealFile downloads file record sealed by one of old keys and seals it with new key to temporary file.
+// Plain data isn't written to disk. Returned file is read from start.
+func (client *Client) resealFile(recordID string, oldKeys [][]byte, newKey []byte) (*os.File, error) {
+	oldAEADs, err := aeadsOf(oldKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	newAEAD, err := aeadOf(newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "gophkeeper-*")
+	if err != nil {
+		return nil, storage.ErrUnknown
+	}
+
+	pr, pw := io.Pipe()
+	sealed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(file, newEncryptReader(newAEAD, pr))
+		pr.CloseWithError(err)
+		sealed <- err
+	}()
+
+	w := newDecryptWriter(oldAEADs[0], pw, func(data []byte) ([]byte, error) {
+		return decryptWith(oldKeys, data)
+	}, oldAEADs[1:]...)
+
+	err = client.Conn.DownloadFile(client.authToken, recordID, w)
+	if err == nil {
+		err = w.Close()
+	}
+	pw.CloseWithError(err)
+
+	sealErr := <-sealed
+	if err == nil && sealErr != nil {
+		err = storage.ErrUnknown
+	}
+
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return file, nil
+}
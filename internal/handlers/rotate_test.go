@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	"github.com/size12/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClient_RotateMasterKey(t *testing.T) {
+	conn := mocks.NewClientConn(t)
+	handlers := NewClientHandlers(conn)
+	handlers.authToken = "token"
+	handlers.masterKey = deriveMasterKey([]byte("old"))
+
+	plainFile := bytes.Repeat([]byte("f"), fileChunkSize+10)
+
+	oldAEAD, err := aeadOf(deriveMasterKey([]byte("old")))
+	assert.NoError(t, err)
+	sealedFile, err := io.ReadAll(newEncryptReader(oldAEAD, bytes.NewReader(plainFile)))
+	assert.NoError(t, err)
+
+	sealedText, err := encryptWith(deriveMasterKey([]byte("old")), []byte("text"))
+	assert.NoError(t, err)
+	// Record sealed before master key was derived from user input.
+	sealedLegacy, err := encryptWith(legacyMasterKey, []byte("legacy"))
+	assert.NoError(t, err)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Rotate master key with wrong old master key",
+			func() {},
+			func() {
+				err := handlers.RotateMasterKey([]byte("wrong"), []byte("new"), nil)
+				assert.Equal(t, ErrWrongMasterKey, err)
+			},
+		},
+		{
+			"Rotate master key, but records were changed meanwhile",
+			func() {
+				conn.On("GetRecordsInfo", entity.AuthToken("token"), entity.RecordsQuery{PageSize: rotationPageSize}).
+					Return(entity.RecordsPage{Records: []entity.Record{{ID: "1"}}}, nil).Once()
+				conn.On("GetRecord", entity.AuthToken("token"), "1").
+					Return(entity.Record{ID: "1", Type: entity.TypeText, Data: sealedText, Revision: 2}, nil).Once()
+				conn.On("ReplaceRecords", entity.AuthToken("token"), mock.Anything, mock.Anything).
+					Return(int64(0), storage.ErrRevisionConflict).Once()
+			},
+			func() {
+				err := handlers.RotateMasterKey([]byte("old"), []byte("new"), nil)
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+				assert.Equal(t, deriveMasterKey([]byte("old")), handlers.masterKey)
+			},
+		},
+		{
+			"Rotate master key",
+			func() {
+				conn.On("GetRecordsInfo", entity.AuthToken("token"), entity.RecordsQuery{PageSize: rotationPageSize}).
+					Return(entity.RecordsPage{Records: []entity.Record{{ID: "1"}, {ID: "2"}}, NextPageToken: "next"}, nil).Once()
+				conn.On("GetRecordsInfo", entity.AuthToken("token"), entity.RecordsQuery{PageSize: rotationPageSize, PageToken: "next"}).
+					Return(entity.RecordsPage{Records: []entity.Record{{ID: "3"}}}, nil).Once()
+
+				conn.On("GetRecord", entity.AuthToken("token"), "1").
+					Return(entity.Record{ID: "1", Type: entity.TypeText, Data: sealedText, Revision: 2}, nil).Once()
+				conn.On("GetRecord", entity.AuthToken("token"), "2").
+					Return(entity.Record{ID: "2", Type: entity.TypeCreditCard, Data: sealedLegacy, Revision: 3}, nil).Once()
+				conn.On("GetRecord", entity.AuthToken("token"), "3").
+					Return(entity.Record{ID: "3", Type: entity.TypeFile, Metadata: "file.txt", Revision: 4}, nil).Once()
+				conn.On("DownloadFile", entity.AuthToken("token"), "3", mock.Anything).Run(func(args mock.Arguments) {
+					_, err := args.Get(2).(io.Writer).Write(sealedFile)
+					assert.NoError(t, err)
+				}).Return(nil).Once()
+
+				newKey := deriveMasterKey([]byte("new"))
+				conn.On("ReplaceRecords", entity.AuthToken("token"), mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+					records := args.Get(1).([]entity.Record)
+					files := args.Get(2).(map[string]io.Reader)
+					assert.Len(t, records, 3)
+
+					text, err := decryptWith([][]byte{newKey}, records[0].Data)
+					assert.NoError(t, err)
+					assert.Equal(t, "text", string(text))
+					assert.Equal(t, int64(2), records[0].Revision)
+
+					legacy, err := decryptWith([][]byte{newKey}, records[1].Data)
+					assert.NoError(t, err)
+					assert.Equal(t, "legacy", string(legacy))
+
+					newAEAD, err := aeadOf(newKey)
+					assert.NoError(t, err)
+					plain := &bytes.Buffer{}
+					w := newDecryptWriter(newAEAD, plain, nil)
+					_, err = io.Copy(w, files["3"])
+					assert.NoError(t, err)
+					assert.NoError(t, w.Close())
+					assert.Equal(t, plainFile, plain.Bytes())
+				}).Return(int64(8), nil).Once()
+			},
+			func() {
+				var progress []int
+				err := handlers.RotateMasterKey([]byte("old"), []byte("new"), func(done, total int) {
+					assert.Equal(t, 3, total)
+					progress = append(progress, done)
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, []int{1, 2, 3}, progress)
+				assert.Equal(t, deriveMasterKey([]byte("new")), handlers.masterKey)
+			},
+		},
+		{
+			"Rotate master key to empty one",
+			func() {},
+			func() {
+				err := handlers.RotateMasterKey([]byte("new"), nil, nil)
+				assert.Equal(t, ErrFieldIsEmpty, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		conn.AssertExpectations(t)
+	}
+}
@@ -2,151 +2,1404 @@ package handlers
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/events"
+	"github.com/size12/gophkeeper/internal/logging"
+	"github.com/size12/gophkeeper/internal/metrics"
+	"github.com/size12/gophkeeper/internal/ratelimit"
+	"github.com/size12/gophkeeper/internal/srp"
 	"github.com/size12/gophkeeper/internal/storage"
+	"github.com/size12/gophkeeper/internal/totp"
 )
 
 // ServerHandlers interface for server handlers
 //
 //go:generate mockery --name ServerHandlers
 type ServerHandlers interface {
-	LoginUser(credentials entity.UserCredentials) (entity.AuthToken, error)
-	CreateUser(credentials entity.UserCredentials) (entity.AuthToken, error)
-	GetRecordsInfo(ctx context.Context) ([]entity.Record, error)
+	LoginUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error)
+	CreateUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error)
+	RegisterSRP(ctx context.Context, login string, verifier entity.SRPVerifier, device entity.Device) (entity.Session, error)
+	StartLoginSRP(ctx context.Context, login string, clientPublicKey []byte, device entity.Device) (entity.SRPChallenge, error)
+	FinishLoginSRP(ctx context.Context, loginID string, clientProof []byte, device entity.Device) (entity.Session, []byte, error)
+	RefreshSession(ctx context.Context, refreshToken string) (entity.Session, error)
+	ChangePassword(ctx context.Context, credentials entity.UserCredentials, newPassword string) error
+	ChangePasswordSRP(ctx context.Context, proof entity.SRPProof, verifier entity.SRPVerifier) error
+	DeleteAccount(ctx context.Context, credentials entity.UserCredentials) error
+	DeleteAccountSRP(ctx context.Context, proof entity.SRPProof) error
+	Logout(ctx context.Context) error
+	CheckSession(ctx context.Context) error
+	ListSessions(ctx context.Context) ([]entity.SessionInfo, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	EnableTOTP(ctx context.Context) (entity.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, code string) error
+	DisableTOTP(ctx context.Context, code string, credentials entity.UserCredentials, proof entity.SRPProof) error
+	VerifyTOTP(ctx context.Context, code string, device entity.Device) (entity.Session, error)
+	ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error)
+	GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error)
+	GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error)
 	GetRecord(ctx context.Context, recordID string) (entity.Record, error)
 	CreateRecord(ctx context.Context, record entity.Record) error
+	UpdateRecord(ctx context.Context, record entity.Record) (int64, error)
 	DeleteRecord(ctx context.Context, recordID string) error
+	GetUsage(ctx context.Context) (entity.Usage, error)
+	UploadFile(ctx context.Context, record entity.Record, r io.Reader) (string, error)
+	DownloadFile(ctx context.Context, recordID string, w io.Writer) error
+	ReplaceRecords(ctx context.Context, next func() (entity.Record, io.Reader, error)) (int64, error)
+	WatchRecords(ctx context.Context, handle func(event entity.RecordEvent) error) error
 }
 
 // Server struct for server handlers.
 type Server struct {
 	Storage       storage.Storager
+	Files         storage.FileStreamer
 	Authenticator Authenticator
+	Events        events.Broker
+	// Limiter locks out logins and IP addresses after failed attempts.
+	Limiter ratelimit.Limiter
+	// AccessTokenTTL and RefreshTokenTTL are lifetimes of session tokens. AccessTokenTTL should match authenticator one.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SRPSaltKey is HMAC key of fake SRP salts of unknown logins. It should be secret and same on all server instances,
+	// otherwise fake salt differs from one instance to another and shows, that login doesn't exist.
+	SRPSaltKey []byte
+	// srpLogins are unfinished SRP login handshakes by login ID.
+	srpLogins map[string]srpLogin
+	// srpExpiry is queue of started handshakes in order of expiration, so expired ones are removed without scan of all.
+	srpExpiry []srpExpiry
+	srpMutex  *sync.Mutex
 }
 
-// NewServerHandlers returns server handlers based on storage and authenticator.
-func NewServerHandlers(s storage.Storager, a Authenticator) *Server {
-	return &Server{Storage: s, Authenticator: a}
+// NewServerHandlers returns server handlers based on storage, file streamer, authenticator and events broker.
+// Failed logins are limited in memory of this server instance, Limiter can be replaced to share them.
+// SRPSaltKey is random, it should be replaced by configured secret to keep fake salts after restart.
+func NewServerHandlers(s storage.Storager, f storage.FileStreamer, a Authenticator, e events.Broker) *Server {
+	// Without random key fake salts can't be generated and StartLoginSRP fails for unknown logins.
+	saltKey, _ := generateRandom(srpSaltKeySize)
+
+	return &Server{
+		Storage:         s,
+		Files:           f,
+		Authenticator:   a,
+		Events:          e,
+		Limiter:         ratelimit.NewMemoryLimiter(ratelimit.DefaultPolicy),
+		AccessTokenTTL:  AccessTokenTTL,
+		RefreshTokenTTL: RefreshTokenTTL,
+		SRPSaltKey:      saltKey,
+		srpLogins:       make(map[string]srpLogin),
+		srpMutex:        &sync.Mutex{},
+	}
+}
+
+// RefreshTokenTTL is default lifetime of refresh token. Session ends, if it wasn't refreshed during this time.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// LoginUser logins user by login and password. New session is started on device.
+// Login and IP address of device are locked out after too many failed attempts.
+func (handlers *Server) LoginUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error) {
+	if credentials.Login == "" || credentials.Password == "" {
+		return entity.Session{}, ErrFieldIsEmpty
+	}
+
+	keys := loginKeys(credentials.Login, device)
+
+	err := handlers.acquireAttempts(ctx, keys...)
+	if err != nil {
+		countLogin(entity.Session{}, err)
+		return entity.Session{}, err
+	}
+
+	session, err := handlers.loginUser(ctx, credentials, device)
+	handlers.finishAttempts(ctx, err, keys...)
+
+	countLogin(session, err)
+	return session, err
+}
+
+// loginUser checks password of user and starts session. Legacy password hash is upgraded after successful login.
+func (handlers *Server) loginUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error) {
+	stored, err := handlers.Storage.GetPassword(ctx, credentials.Login)
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		// Password is checked for unknown login too, so it isn't answered faster than known one.
+		verifyPassword(ctx, dummyPassword, credentials)
+		return entity.Session{}, err
+	}
+
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	ctx = logging.WithUserID(ctx, stored.UserID)
+
+	ok, rehash, err := verifyPassword(ctx, stored, credentials)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	if !ok {
+		handlers.audit(ctx, stored.UserID, entity.AuditLogin, "", device.IP, storage.ErrWrongCredentials)
+		return entity.Session{}, storage.ErrWrongCredentials
+	}
+
+	if rehash {
+		handlers.rehashPassword(ctx, stored.UserID, credentials.Password)
+	}
+
+	session, err := handlers.finishLogin(ctx, stored.UserID, device)
+	handlers.auditLogin(ctx, stored.UserID, device, session, err)
+	return session, err
+}
+
+// finishLogin starts session of user, who proved password. If user enabled TOTP,
+// only token for VerifyTOTP is issued and session is started after TOTP code is checked.
+func (handlers *Server) finishLogin(ctx context.Context, userID entity.UserID, device entity.Device) (entity.Session, error) {
+	secret, err := handlers.Storage.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return entity.Session{}, err
+	}
+
+	if err != nil || !secret.Confirmed {
+		return handlers.startSession(ctx, userID, device)
+	}
+
+	token, err := handlers.Authenticator.CreateToken(entity.Principal{
+		UserID: userID,
+		Scopes: []string{entity.ScopeTOTP},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed create authToken for TOTP", "error", err)
+		return entity.Session{}, storage.ErrUnknown
+	}
+
+	return entity.Session{
+		AccessToken:  token,
+		ExpiresAt:    time.Now().Add(handlers.AccessTokenTTL),
+		TOTPRequired: true,
+	}, nil
+}
+
+// limiterTimeout limits time of limiter requests.
+const limiterTimeout = 5 * time.Second
+
+// loginKeys returns limiter keys of login attempt. The first key is of login, the second one is of IP address.
+// Only key of login is reset after successful attempt, so own account doesn't reset failures of IP address.
+func loginKeys(login string, device entity.Device) []string {
+	keys := []string{"login:" + login}
+	if device.IP != "" {
+		keys = append(keys, "ip:"+device.IP)
+	}
+	return keys
+}
+
+// acquireAttempts reserves attempt of keys before credentials are checked, so concurrent attempts can't pass
+// lockout check together. It returns LockoutError with the longest lockout of keys, if any of them is locked out.
+// Reserved attempt counts as failure until finishAttempts.
+func (handlers *Server) acquireAttempts(ctx context.Context, keys ...string) error {
+	limiterCtx, cancel := context.WithTimeout(ctx, limiterTimeout)
+	defer cancel()
+
+	var retryAfter time.Duration
+	acquired := make([]string, 0, len(keys))
+	for _, key := range keys {
+		wait, err := handlers.Limiter.Acquire(limiterCtx, key)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed acquire login attempt", "error", err)
+			handlers.releaseAttempts(ctx, acquired...)
+			return storage.ErrUnknown
+		}
+
+		if wait > retryAfter {
+			retryAfter = wait
+		}
+
+		if wait == 0 {
+			acquired = append(acquired, key)
+		}
+	}
+
+	if retryAfter > 0 {
+		handlers.releaseAttempts(ctx, acquired...)
+		return &LockoutError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// finishAttempts finishes attempt of keys, which was reserved by acquireAttempts, with its result.
+// Failed attempt stays counted. After successful one failed attempts of the first key are forgotten.
+// Attempt, which failed not because of credentials, is released.
+func (handlers *Server) finishAttempts(ctx context.Context, err error, keys ...string) {
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return
+	}
+
+	if err == nil {
+		handlers.resetAttempts(ctx, keys[0])
+		keys = keys[1:]
+	}
+
+	handlers.releaseAttempts(ctx, keys...)
+}
+
+// releaseAttempts releases reserved attempt of keys. It's released even if request was canceled.
+func (handlers *Server) releaseAttempts(ctx context.Context, keys ...string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), limiterTimeout)
+	defer cancel()
+
+	for _, key := range keys {
+		err := handlers.Limiter.Release(ctx, key)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed release login attempt", "error", err)
+		}
+	}
+}
+
+// resetAttempts forgets failed attempts of key after successful one.
+func (handlers *Server) resetAttempts(ctx context.Context, key string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), limiterTimeout)
+	defer cancel()
+
+	err := handlers.Limiter.Reset(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed reset login attempts", "error", err)
+	}
+}
+
+// startSession starts new session of user on device.
+func (handlers *Server) startSession(ctx context.Context, userID entity.UserID, device entity.Device) (entity.Session, error) {
+	sessionID, err := generateRandom(16)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed generate session ID", "error", err)
+		return entity.Session{}, storage.ErrUnknown
+	}
+
+	now := time.Now()
+	err = handlers.Storage.CreateSession(ctx, entity.SessionInfo{
+		ID:         hex.EncodeToString(sessionID),
+		UserID:     userID,
+		Device:     device,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	})
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	return handlers.newSession(ctx, userID, hex.EncodeToString(sessionID))
+}
+
+// rehashPassword upgrades password hash of user. Login isn't failed, if upgrade failed.
+func (handlers *Server) rehashPassword(ctx context.Context, userID entity.UserID, password string) {
+	upgraded, err := hashPassword(ctx, password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed hash password for upgrade", "error", err)
+		return
+	}
+
+	upgraded.UserID = userID
+	err = handlers.Storage.UpdatePassword(ctx, upgraded)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed upgrade password hash", "error", err)
+	}
+}
+
+// CreateUser creates new user by login and password. New session is started on device.
+func (handlers *Server) CreateUser(ctx context.Context, credentials entity.UserCredentials, device entity.Device) (entity.Session, error) {
+	if credentials.Login == "" || credentials.Password == "" {
+		return entity.Session{}, ErrFieldIsEmpty
+	}
+
+	password, err := hashPassword(ctx, credentials.Password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed hash password", "error", err)
+		return entity.Session{}, storage.ErrUnknown
+	}
+
+	err = handlers.Storage.CreateUser(ctx, credentials.Login, password)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	// Password was just hashed, so it isn't checked again, only ID of new user is read.
+	userID, err := handlers.Storage.GetUserID(ctx, credentials.Login)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	ctx = logging.WithUserID(ctx, userID)
+
+	session, err := handlers.finishLogin(ctx, userID, device)
+	handlers.auditLogin(ctx, userID, device, session, err)
+	return session, err
+}
+
+// ChangePassword changes password of user, current password is checked by credentials.
+// All other sessions of user are revoked.
+func (handlers *Server) ChangePassword(ctx context.Context, credentials entity.UserCredentials, newPassword string) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if credentials.Login == "" || credentials.Password == "" || newPassword == "" {
+		return ErrFieldIsEmpty
+	}
+
+	err := handlers.checkPassword(ctx, principal, credentials)
+	if err != nil {
+		return err
+	}
+
+	password, err := hashPassword(ctx, newPassword)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed hash password", "error", err)
+		return storage.ErrUnknown
+	}
+
+	password.UserID = principal.UserID
+	err = handlers.Storage.UpdatePassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	return handlers.revokeOtherSessions(ctx, principal)
+}
+
+// ChangePasswordSRP changes SRP-6a verifier of user, current password is checked by proof of SRP handshake.
+// All other sessions of user are revoked.
+func (handlers *Server) ChangePasswordSRP(ctx context.Context, proof entity.SRPProof, verifier entity.SRPVerifier) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if len(verifier.Salt) == 0 || len(verifier.Verifier) == 0 {
+		return ErrFieldIsEmpty
+	}
+
+	err := handlers.checkSRPProof(ctx, principal, proof)
+	if err != nil {
+		return err
+	}
+
+	password := encodeSRPVerifier(verifier)
+	password.UserID = principal.UserID
+	err = handlers.Storage.UpdatePassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	return handlers.revokeOtherSessions(ctx, principal)
+}
+
+// checkPassword checks password of logged in user, who isn't SRP user. Login is locked out after too many failed attempts.
+func (handlers *Server) checkPassword(ctx context.Context, principal entity.Principal, credentials entity.UserCredentials) error {
+	key := loginKeys(credentials.Login, entity.Device{})[0]
+
+	err := handlers.acquireAttempts(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	err = handlers.verifyPrincipalPassword(ctx, principal, credentials)
+	handlers.finishAttempts(ctx, err, key)
+	return err
+}
+
+// verifyPrincipalPassword checks, that credentials are password of logged in user.
+func (handlers *Server) verifyPrincipalPassword(ctx context.Context, principal entity.Principal, credentials entity.UserCredentials) error {
+	stored, err := handlers.Storage.GetPassword(ctx, credentials.Login)
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		verifyPassword(ctx, dummyPassword, credentials)
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := verifyPassword(ctx, stored, credentials)
+	if err != nil {
+		return err
+	}
+
+	if !ok || stored.UserID != principal.UserID {
+		return storage.ErrWrongCredentials
+	}
+
+	return nil
+}
+
+// checkSRPProof checks password of logged in SRP user by proof of handshake, which was started by StartLoginSRP.
+// Attempt of login was reserved by StartLoginSRP, so login is locked out after too many failed attempts.
+func (handlers *Server) checkSRPProof(ctx context.Context, principal entity.Principal, proof entity.SRPProof) error {
+	if proof.LoginID == "" || len(proof.ClientProof) == 0 {
+		return ErrFieldIsEmpty
+	}
+
+	state, ok := handlers.popSRPLogin(proof.LoginID)
+	if !ok {
+		return storage.ErrWrongCredentials
+	}
+
+	_, err := state.server.Verify(state.clientPublicKey, proof.ClientProof)
+	if err != nil || state.userID == "" || state.userID != principal.UserID {
+		err = storage.ErrWrongCredentials
+	}
+
+	handlers.finishAttempts(ctx, err, state.keys...)
+	return err
+}
+
+// revokeOtherSessions revokes all sessions of user except session of request.
+func (handlers *Server) revokeOtherSessions(ctx context.Context, principal entity.Principal) error {
+	sessions, err := handlers.Storage.ListSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == principal.SessionID {
+			continue
+		}
+
+		err = handlers.RevokeSession(ctx, session.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAccount deletes user with all his records and files, password is checked by credentials.
+// All sessions of user are ended. Files, which can't be deleted now,
+// are deleted later by server.
+func (handlers *Server) DeleteAccount(ctx context.Context, credentials entity.UserCredentials) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if credentials.Login == "" || credentials.Password == "" {
+		return ErrFieldIsEmpty
+	}
+
+	err := handlers.checkPassword(ctx, principal, credentials)
+	if err != nil {
+		return err
+	}
+
+	return handlers.deleteAccount(ctx)
+}
+
+// DeleteAccountSRP deletes SRP user with all his records and files, password is checked by proof of SRP handshake.
+// All sessions of user are ended. Files, which can't be deleted now,
+// are deleted later by server.
+func (handlers *Server) DeleteAccountSRP(ctx context.Context, proof entity.SRPProof) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	err := handlers.checkSRPProof(ctx, principal, proof)
+	if err != nil {
+		return err
+	}
+
+	return handlers.deleteAccount(ctx)
+}
+
+// deleteAccount deletes user of request with all his records and files and ends all his sessions.
+func (handlers *Server) deleteAccount(ctx context.Context) error {
+	sessions, err := handlers.Storage.ListSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = handlers.Storage.DeleteUser(ctx, func(recordIDs []string) error {
+		return handlers.Files.DeleteFiles(ctx, recordIDs)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		handlers.Authenticator.RevokeSession(session.ID)
+	}
+
+	userID, _ := entity.UserIDFromContext(ctx)
+	handlers.publishSessionRevoked(ctx, userID, "")
+
+	return nil
+}
+
+// srpLoginTTL is time, during which SRP login handshake should be finished.
+const srpLoginTTL = time.Minute
+
+// maxSRPLogins limits number of unfinished SRP login handshakes.
+const maxSRPLogins = 10000
+
+// srpLogin is state of unfinished SRP login handshake.
+type srpLogin struct {
+	login  string
+	userID entity.UserID
+	// keys are limiter keys, which attempts were reserved by start of handshake.
+	keys            []string
+	server          *srp.Server
+	clientPublicKey []byte
+	expiresAt       time.Time
+}
+
+// srpExpiry is expiration time of SRP login handshake.
+type srpExpiry struct {
+	loginID   string
+	expiresAt time.Time
+}
+
+// RegisterSRP creates new user with SRP-6a verifier instead of password. New session is started on device.
+func (handlers *Server) RegisterSRP(ctx context.Context, login string, verifier entity.SRPVerifier, device entity.Device) (entity.Session, error) {
+	if login == "" || len(verifier.Salt) == 0 || len(verifier.Verifier) == 0 {
+		return entity.Session{}, ErrFieldIsEmpty
+	}
+
+	err := handlers.Storage.CreateUser(ctx, login, encodeSRPVerifier(verifier))
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	userID, err := handlers.Storage.GetUserID(ctx, login)
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	return handlers.startSession(logging.WithUserID(ctx, userID), userID, device)
+}
+
+// StartLoginSRP starts SRP-6a login of user. For unknown user or user without verifier fake challenge is
+// returned, so handshake fails only on last step and doesn't show if user exists.
+// Start of handshake reserves attempt of login and IP address of device, which counts as failure until handshake
+// is finished successfully, so they are locked out after too many unfinished or failed handshakes.
+func (handlers *Server) StartLoginSRP(ctx context.Context, login string, clientPublicKey []byte, device entity.Device) (entity.SRPChallenge, error) {
+	if login == "" || len(clientPublicKey) == 0 {
+		return entity.SRPChallenge{}, ErrFieldIsEmpty
+	}
+
+	err := srp.CheckPublicKey(clientPublicKey)
+	if err != nil {
+		return entity.SRPChallenge{}, err
+	}
+
+	keys := loginKeys(login, device)
+
+	err = handlers.acquireAttempts(ctx, keys...)
+	if err != nil {
+		return entity.SRPChallenge{}, err
+	}
+
+	challenge, err := handlers.startLoginSRP(ctx, login, clientPublicKey, keys)
+	if err != nil {
+		handlers.releaseAttempts(ctx, keys...)
+		return entity.SRPChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// startLoginSRP creates server side of handshake and keeps it until FinishLoginSRP.
+func (handlers *Server) startLoginSRP(ctx context.Context, login string, clientPublicKey []byte, keys []string) (entity.SRPChallenge, error) {
+	stored, err := handlers.Storage.GetPassword(ctx, login)
+	if err != nil && !errors.Is(err, storage.ErrWrongCredentials) {
+		return entity.SRPChallenge{}, err
+	}
+
+	verifier, err := decodeSRPVerifier(stored)
+	if err != nil {
+		stored.UserID = ""
+		verifier, err = handlers.fakeSRPVerifier(login)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed generate fake SRP verifier", "error", err)
+			return entity.SRPChallenge{}, storage.ErrUnknown
+		}
+	}
+
+	server, err := srp.NewServer(login, verifier.Salt, verifier.Verifier)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed start SRP handshake", "error", err)
+		return entity.SRPChallenge{}, storage.ErrUnknown
+	}
+
+	loginID, err := generateRandom(16)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed generate SRP login ID", "error", err)
+		return entity.SRPChallenge{}, storage.ErrUnknown
+	}
+
+	handlers.srpMutex.Lock()
+	defer handlers.srpMutex.Unlock()
+
+	now := time.Now()
+	handlers.expireSRPLogins(now)
+
+	if len(handlers.srpLogins) >= maxSRPLogins {
+		return entity.SRPChallenge{}, ErrTooManyLogins
+	}
+
+	id := hex.EncodeToString(loginID)
+	expiresAt := now.Add(srpLoginTTL)
+
+	handlers.srpLogins[id] = srpLogin{
+		login:           login,
+		userID:          stored.UserID,
+		keys:            keys,
+		server:          server,
+		clientPublicKey: clientPublicKey,
+		expiresAt:       expiresAt,
+	}
+	handlers.srpExpiry = append(handlers.srpExpiry, srpExpiry{loginID: id, expiresAt: expiresAt})
+
+	return entity.SRPChallenge{
+		LoginID:         id,
+		Salt:            verifier.Salt,
+		ServerPublicKey: server.PublicKey(),
+	}, nil
+}
+
+// expireSRPLogins removes expired handshakes. Handshakes have same TTL, so queue is ordered by expiration
+// and only expired ones are looked through. Should be called under srpMutex.
+func (handlers *Server) expireSRPLogins(now time.Time) {
+	expired := 0
+	for _, expiry := range handlers.srpExpiry {
+		if !now.After(expiry.expiresAt) {
+			break
+		}
+
+		// Handshake can be already finished, then its ID isn't in map.
+		delete(handlers.srpLogins, expiry.loginID)
+		expired++
+	}
+
+	handlers.srpExpiry = handlers.srpExpiry[expired:]
+}
+
+// FinishLoginSRP checks proof of client. Returns new session and proof of server.
+// Attempt of login and IP address was reserved by StartLoginSRP, it's counted as failure, if proof is wrong.
+func (handlers *Server) FinishLoginSRP(ctx context.Context, loginID string, clientProof []byte, device entity.Device) (entity.Session, []byte, error) {
+	if loginID == "" || len(clientProof) == 0 {
+		return entity.Session{}, nil, ErrFieldIsEmpty
+	}
+
+	state, ok := handlers.popSRPLogin(loginID)
+	if !ok {
+		countLogin(entity.Session{}, storage.ErrWrongCredentials)
+		return entity.Session{}, nil, storage.ErrWrongCredentials
+	}
+
+	ctx = logging.WithUserID(ctx, state.userID)
+
+	serverProof, err := state.server.Verify(state.clientPublicKey, clientProof)
+	if err != nil || state.userID == "" {
+		handlers.finishAttempts(ctx, storage.ErrWrongCredentials, state.keys...)
+		if state.userID != "" {
+			handlers.audit(ctx, state.userID, entity.AuditLogin, "", device.IP, storage.ErrWrongCredentials)
+		}
+		countLogin(entity.Session{}, storage.ErrWrongCredentials)
+		return entity.Session{}, nil, storage.ErrWrongCredentials
+	}
+
+	handlers.finishAttempts(ctx, nil, state.keys...)
+
+	session, err := handlers.finishLogin(ctx, state.userID, device)
+	handlers.auditLogin(ctx, state.userID, device, session, err)
+	countLogin(session, err)
+	if err != nil {
+		return entity.Session{}, nil, err
+	}
+
+	return session, serverProof, nil
+}
+
+// popSRPLogin takes state of unfinished SRP login handshake, so it can be finished only once.
+// Expired handshake isn't returned.
+func (handlers *Server) popSRPLogin(loginID string) (srpLogin, bool) {
+	handlers.srpMutex.Lock()
+	defer handlers.srpMutex.Unlock()
+
+	state, ok := handlers.srpLogins[loginID]
+	delete(handlers.srpLogins, loginID)
+
+	if !ok || time.Now().After(state.expiresAt) {
+		return srpLogin{}, false
+	}
+
+	return state, true
+}
+
+// srpSaltKeySize is size of random SRPSaltKey.
+const srpSaltKeySize = 32
+
+// errNoSRPSaltKey is returned, when fake SRP salt can't be generated without key.
+var errNoSRPSaltKey = errors.New("SRP salt key is empty")
+
+// fakeSRPVerifier returns verifier for unknown user. Salt is same for login, as it's for real user.
+// Salt is keyed by SRPSaltKey, so it can't be computed by anyone else and told apart from real one.
+func (handlers *Server) fakeSRPVerifier(login string) (entity.SRPVerifier, error) {
+	if len(handlers.SRPSaltKey) == 0 {
+		return entity.SRPVerifier{}, errNoSRPSaltKey
+	}
+
+	verifier, err := generateRandom(256)
+	if err != nil {
+		return entity.SRPVerifier{}, err
+	}
+
+	mac := hmac.New(sha256.New, handlers.SRPSaltKey)
+	mac.Write([]byte(login))
+	return entity.SRPVerifier{Salt: mac.Sum(nil)[:srp.SaltSize], Verifier: verifier}, nil
 }
 
-// LoginUser logins user by login and password.
-func (handlers *Server) LoginUser(credentials entity.UserCredentials) (entity.AuthToken, error) {
-	if credentials.Login == "" || credentials.Password == "" {
-		return "", ErrFieldIsEmpty
+// RefreshSession exchanges refresh token to new session. Refresh token can be used only once.
+func (handlers *Server) RefreshSession(ctx context.Context, refreshToken string) (entity.Session, error) {
+	if refreshToken == "" {
+		return entity.Session{}, ErrFieldIsEmpty
+	}
+
+	token, err := handlers.Storage.UseRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	ctx = logging.WithUserID(ctx, token.UserID)
+
+	if time.Now().After(token.ExpiresAt) {
+		return entity.Session{}, storage.ErrUserUnauthorized
+	}
+
+	return handlers.newSession(ctx, token.UserID, token.SessionID)
+}
+
+// Logout ends session of request.
+func (handlers *Server) Logout(ctx context.Context) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if principal.SessionID == "" {
+		return nil
+	}
+
+	return handlers.RevokeSession(ctx, principal.SessionID)
+}
+
+// CheckSession checks session of request wasn't revoked and updates its last seen time.
+func (handlers *Server) CheckSession(ctx context.Context) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if principal.SessionID == "" {
+		return nil
 	}
 
-	credentials.Password = credentials.Login + credentials.Password
+	return handlers.Storage.TouchSession(ctx, principal.SessionID)
+}
 
-	sha := sha256.New()
-	sha.Write([]byte(credentials.Password))
-	credentials.Password = hex.EncodeToString(sha.Sum(nil))
+// ListSessions gets active sessions of user. Session of request is marked as current.
+func (handlers *Server) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, storage.ErrUserUnauthorized
+	}
 
-	userID, err := handlers.Storage.LoginUser(credentials)
+	sessions, err := handlers.Storage.ListSessions(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal.SessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends session of user. Its refresh tokens are deleted, access tokens are revoked
+// and its watching of records is stopped.
+func (handlers *Server) RevokeSession(ctx context.Context, sessionID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if sessionID == "" {
+		return ErrFieldIsEmpty
 	}
 
-	authToken, err := handlers.Authenticator.CreateToken(userID)
+	err := handlers.Storage.RevokeSession(ctx, sessionID)
 	if err != nil {
-		log.Println("Failed create authToken:", err)
-		return "", storage.ErrUnknown
+		return err
 	}
 
-	return authToken, nil
+	handlers.Authenticator.RevokeSession(sessionID)
+	handlers.publishSessionRevoked(ctx, userID, sessionID)
+
+	return handlers.Storage.DeleteSessionTokens(ctx, sessionID)
 }
 
-// CreateUser creates new user by login and password.
-func (handlers *Server) CreateUser(credentials entity.UserCredentials) (entity.AuthToken, error) {
-	if credentials.Login == "" || credentials.Password == "" {
-		return "", ErrFieldIsEmpty
+// EnableTOTP generates new TOTP secret and backup codes of user.
+// TOTP code is required on login only after secret is confirmed by ConfirmTOTP.
+func (handlers *Server) EnableTOTP(ctx context.Context) (entity.TOTPEnrollment, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.TOTPEnrollment{}, storage.ErrUserUnauthorized
 	}
 
-	passwordHash := credentials.Login + credentials.Password
+	current, err := handlers.Storage.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return entity.TOTPEnrollment{}, err
+	}
 
-	sha := sha256.New()
-	sha.Write([]byte(passwordHash))
-	passwordHash = hex.EncodeToString(sha.Sum(nil))
+	if err == nil && current.Confirmed {
+		return entity.TOTPEnrollment{}, ErrTOTPEnabled
+	}
 
-	err := handlers.Storage.CreateUser(entity.UserCredentials{
-		Login:    credentials.Login,
-		Password: passwordHash,
-	})
+	secret, err := totp.GenerateSecret()
 	if err != nil {
-		return "", err
+		slog.ErrorContext(ctx, "Failed generate TOTP secret", "error", err)
+		return entity.TOTPEnrollment{}, storage.ErrUnknown
+	}
+
+	codes, err := generateBackupCodes()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed generate backup codes", "error", err)
+		return entity.TOTPEnrollment{}, storage.ErrUnknown
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, hashBackupCode(code))
+	}
+
+	err = handlers.Storage.SaveTOTP(ctx, entity.TOTP{UserID: userID, Secret: secret}, hashes)
+	if err != nil {
+		return entity.TOTPEnrollment{}, err
+	}
+
+	return entity.TOTPEnrollment{Secret: secret, BackupCodes: codes}, nil
+}
+
+// ConfirmTOTP confirms TOTP secret of user by code from authenticator app.
+// User is locked out after too many wrong codes.
+func (handlers *Server) ConfirmTOTP(ctx context.Context, code string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	if code == "" {
+		return ErrFieldIsEmpty
+	}
+
+	key := totpKey(userID)
+
+	err := handlers.acquireAttempts(ctx, key)
+	if err != nil {
+		return err
 	}
 
-	return handlers.LoginUser(credentials)
+	err = handlers.confirmTOTP(ctx, userID, code)
+	handlers.finishAttempts(ctx, err, key)
+	return err
 }
 
-// GetRecordsInfo gets all records from storage.
-func (handlers *Server) GetRecordsInfo(ctx context.Context) ([]entity.Record, error) {
-	token, ok := ctx.Value("authToken").(entity.AuthToken)
+// confirmTOTP checks code by unconfirmed TOTP secret of user. Accepted code can't be used again.
+func (handlers *Server) confirmTOTP(ctx context.Context, userID entity.UserID, code string) error {
+	secret, err := handlers.Storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if secret.Confirmed {
+		return ErrTOTPEnabled
+	}
 
+	step, ok := totp.Validate(secret.Secret, normalizeCode(code), time.Now())
 	if !ok {
-		return nil, storage.ErrUserUnauthorized
+		return storage.ErrWrongCredentials
+	}
+
+	return handlers.Storage.UseTOTPStep(ctx, userID, step)
+}
+
+// DisableTOTP deletes TOTP secret and backup codes of user. TOTP code or backup code is required with password,
+// which is checked by credentials, or by SRP proof for SRP user. User is locked out after too many wrong codes.
+func (handlers *Server) DisableTOTP(ctx context.Context, code string, credentials entity.UserCredentials, proof entity.SRPProof) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok || principal.UserID == "" {
+		return storage.ErrUserUnauthorized
+	}
+
+	if code == "" {
+		return ErrFieldIsEmpty
+	}
+
+	var err error
+	if proof.LoginID != "" {
+		err = handlers.checkSRPProof(ctx, principal, proof)
+	} else if credentials.Login == "" || credentials.Password == "" {
+		err = ErrFieldIsEmpty
+	} else {
+		err = handlers.checkPassword(ctx, principal, credentials)
 	}
 
-	userID, err := handlers.Authenticator.ValidateToken(token)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	key := totpKey(principal.UserID)
+
+	err = handlers.acquireAttempts(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	secret, err := handlers.Storage.GetTOTP(ctx, principal.UserID)
+	if err == nil {
+		err = handlers.checkTOTP(ctx, secret, code)
+	}
+
+	handlers.finishAttempts(ctx, err, key)
+	if err != nil {
+		return err
+	}
+
+	return handlers.Storage.DeleteTOTP(ctx, principal.UserID)
+}
+
+// totpKey returns limiter key of TOTP codes of user. Confirm, disable and login share it,
+// so codes can't be guessed by switching between them.
+func totpKey(userID entity.UserID) string {
+	return "totp:" + string(userID)
+}
+
+// VerifyTOTP finishes login of user by TOTP code or backup code. New session is started on device.
+// User and IP address of device are locked out after too many wrong codes.
+func (handlers *Server) VerifyTOTP(ctx context.Context, code string, device entity.Device) (entity.Session, error) {
+	principal, ok := entity.PrincipalFromContext(ctx)
+	if !ok || principal.UserID == "" || !principal.HasScope(entity.ScopeTOTP) {
+		return entity.Session{}, storage.ErrUserUnauthorized
+	}
+
+	if code == "" {
+		return entity.Session{}, ErrFieldIsEmpty
+	}
+
+	keys := []string{totpKey(principal.UserID)}
+	if device.IP != "" {
+		keys = append(keys, "ip:"+device.IP)
+	}
+
+	err := handlers.acquireAttempts(ctx, keys...)
+	if err != nil {
+		countLogin(entity.Session{}, err)
+		return entity.Session{}, err
+	}
+
+	secret, err := handlers.Storage.GetTOTP(ctx, principal.UserID)
+	if errors.Is(err, storage.ErrNotFound) || err == nil && !secret.Confirmed {
+		handlers.finishAttempts(ctx, storage.ErrWrongCredentials, keys...)
+		countLogin(entity.Session{}, storage.ErrWrongCredentials)
+		return entity.Session{}, storage.ErrWrongCredentials
+	}
+
+	if err == nil {
+		err = handlers.checkTOTP(ctx, secret, code)
+	}
+
+	handlers.finishAttempts(ctx, err, keys...)
+	if err != nil {
+		handlers.audit(ctx, principal.UserID, entity.AuditLogin, "", device.IP, err)
+		countLogin(entity.Session{}, err)
+		return entity.Session{}, err
+	}
+
+	session, err := handlers.startSession(ctx, principal.UserID, device)
+	handlers.audit(ctx, principal.UserID, entity.AuditLogin, "", device.IP, err)
+	countLogin(session, err)
+	return session, err
+}
+
+// checkTOTP checks TOTP code or backup code of user. Accepted code can't be used again.
+func (handlers *Server) checkTOTP(ctx context.Context, secret entity.TOTP, code string) error {
+	code = normalizeCode(code)
+
+	step, ok := totp.Validate(secret.Secret, code, time.Now())
+	if ok {
+		return handlers.Storage.UseTOTPStep(ctx, secret.UserID, step)
+	}
+
+	if len(code) != backupCodeLength {
+		return storage.ErrWrongCredentials
+	}
+
+	return handlers.Storage.UseBackupCode(ctx, secret.UserID, hashBackupCode(code))
+}
+
+// newSession issues access token and saves new refresh token of session.
+func (handlers *Server) newSession(ctx context.Context, userID entity.UserID, sessionID string) (entity.Session, error) {
+	authToken, err := handlers.Authenticator.CreateToken(entity.Principal{
+		UserID:    userID,
+		SessionID: sessionID,
+		Scopes:    []string{entity.ScopeRecords},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed create authToken", "error", err)
+		return entity.Session{}, storage.ErrUnknown
+	}
+
+	refreshToken, err := generateRandom(32)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed generate refresh token", "error", err)
+		return entity.Session{}, storage.ErrUnknown
+	}
+
+	session := entity.Session{
+		AccessToken:  authToken,
+		RefreshToken: base64.RawURLEncoding.EncodeToString(refreshToken),
+		ExpiresAt:    time.Now().Add(handlers.AccessTokenTTL),
+	}
+
+	err = handlers.Storage.SaveRefreshToken(ctx, entity.RefreshToken{
+		Hash:      hashRefreshToken(session.RefreshToken),
+		UserID:    userID,
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(handlers.RefreshTokenTTL),
+	})
+	if err != nil {
+		return entity.Session{}, err
 	}
 
-	ctx = context.WithValue(ctx, "userID", userID)
-	return handlers.Storage.GetRecordsInfo(ctx)
+	return session, nil
+}
+
+// hashRefreshToken returns hash of refresh token, which is stored instead of token.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetRecordsInfo gets page of records from storage.
+func (handlers *Server) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	_, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.RecordsPage{}, storage.ErrUserUnauthorized
+	}
+
+	return handlers.Storage.GetRecordsInfo(ctx, query)
+}
+
+// GetChanges gets records changed after revision from storage.
+func (handlers *Server) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	_, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.Changes{}, storage.ErrUserUnauthorized
+	}
+
+	return handlers.Storage.GetChanges(ctx, sinceRevision)
 }
 
 // GetRecord get record from storage by ID.
 func (handlers *Server) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
-	token, ok := ctx.Value("authToken").(entity.AuthToken)
-
+	userID, ok := entity.UserIDFromContext(ctx)
 	if !ok {
 		return entity.Record{}, storage.ErrUserUnauthorized
 	}
 
-	userID, err := handlers.Authenticator.ValidateToken(token)
+	record, err := handlers.Storage.GetRecord(ctx, recordID)
+	handlers.audit(ctx, userID, entity.AuditGetRecord, recordID, peerIP(ctx), err)
+	return record, err
+}
+
+// CreateRecord added record to storage.
+func (handlers *Server) CreateRecord(ctx context.Context, record entity.Record) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	recordID, err := handlers.Storage.CreateRecord(ctx, record)
+	handlers.audit(ctx, userID, entity.AuditCreateRecord, recordID, peerIP(ctx), err)
 	if err != nil {
-		return entity.Record{}, err
+		return err
 	}
 
-	ctx = context.WithValue(ctx, "userID", userID)
-	return handlers.Storage.GetRecord(ctx, recordID)
+	handlers.publish(ctx, userID, entity.EventCreated, recordID)
+	return nil
 }
 
-// CreateRecord added record to storage.
-func (handlers *Server) CreateRecord(ctx context.Context, record entity.Record) error {
-	token, ok := ctx.Value("authToken").(entity.AuthToken)
+// UpdateRecord replaces record in storage, returns new record revision.
+func (handlers *Server) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return 0, storage.ErrUserUnauthorized
+	}
+
+	if record.ID == "" {
+		return 0, ErrFieldIsEmpty
+	}
+
+	revision, err := handlers.Storage.UpdateRecord(ctx, record)
+	handlers.audit(ctx, userID, entity.AuditUpdateRecord, record.ID, peerIP(ctx), err)
+	if err != nil {
+		return 0, err
+	}
+
+	handlers.publish(ctx, userID, entity.EventUpdated, record.ID)
+	return revision, nil
+}
 
+// DeleteRecord deletes record from storage.
+func (handlers *Server) DeleteRecord(ctx context.Context, recordID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
 	if !ok {
 		return storage.ErrUserUnauthorized
 	}
 
-	userID, err := handlers.Authenticator.ValidateToken(token)
+	err := handlers.Storage.DeleteRecord(ctx, recordID)
+	handlers.audit(ctx, userID, entity.AuditDeleteRecord, recordID, peerIP(ctx), err)
 	if err != nil {
 		return err
 	}
 
-	ctx = context.WithValue(ctx, "userID", userID)
-	_, err = handlers.Storage.CreateRecord(ctx, record)
+	handlers.publish(ctx, userID, entity.EventDeleted, recordID)
+	return nil
+}
+
+// GetUsage gets count of records of user and total size of their data with quota of user.
+func (handlers *Server) GetUsage(ctx context.Context) (entity.Usage, error) {
+	_, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.Usage{}, storage.ErrUserUnauthorized
+	}
+
+	return handlers.Storage.GetUsage(ctx)
+}
+
+// UploadFile saves file record, which data is read from reader.
+func (handlers *Server) UploadFile(ctx context.Context, record entity.Record, r io.Reader) (string, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return "", storage.ErrUserUnauthorized
+	}
+
+	recordID, err := handlers.Files.UploadFile(ctx, record, r)
+	handlers.audit(ctx, userID, entity.AuditCreateRecord, recordID, peerIP(ctx), err)
+	if err != nil {
+		return "", err
+	}
+
+	handlers.publish(ctx, userID, entity.EventCreated, recordID)
+	return recordID, nil
+}
+
+// DownloadFile writes file record data to writer.
+func (handlers *Server) DownloadFile(ctx context.Context, recordID string, w io.Writer) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return storage.ErrUserUnauthorized
+	}
+
+	_, err := handlers.Files.DownloadFile(ctx, recordID, w)
+	handlers.audit(ctx, userID, entity.AuditGetRecord, recordID, peerIP(ctx), err)
 	return err
 }
 
-// DeleteRecord deletes record from storage.
-func (handlers *Server) DeleteRecord(ctx context.Context, recordID string) error {
-	token, ok := ctx.Value("authToken").(entity.AuthToken)
+// ReplaceRecords replaces data of all user records at once, for example after master key change.
+// Records are returned by next one by one, io.EOF is returned after the last one. Returns new revision.
+// Every read record is audited as updated with result of the whole replacement.
+func (handlers *Server) ReplaceRecords(ctx context.Context, next func() (entity.Record, io.Reader, error)) (int64, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return 0, storage.ErrUserUnauthorized
+	}
+
+	var recordIDs []string
+
+	revision, err := handlers.Files.ReplaceAllRecords(ctx, func() (entity.Record, io.Reader, error) {
+		record, r, err := next()
+		if err != nil {
+			return record, r, err
+		}
+
+		if record.ID == "" {
+			return record, r, ErrFieldIsEmpty
+		}
+
+		recordIDs = append(recordIDs, record.ID)
+		return record, r, nil
+	})
 
+	for _, recordID := range recordIDs {
+		handlers.audit(ctx, userID, entity.AuditUpdateRecord, recordID, peerIP(ctx), err)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, recordID := range recordIDs {
+		handlers.publish(ctx, userID, entity.EventUpdated, recordID)
+	}
+
+	return revision, nil
+}
+
+// watchSessionCheckInterval is how often session of WatchRecords is checked, in case event of its revocation was missed.
+const watchSessionCheckInterval = time.Minute
+
+// WatchRecords calls handle for every change of user records until context is done.
+// Watching stops with ErrUserUnauthorized, when session is revoked, and without error, when access token expires,
+// so client watches again with fresh token.
+func (handlers *Server) WatchRecords(ctx context.Context, handle func(event entity.RecordEvent) error) error {
+	principal, ok := entity.PrincipalFromContext(ctx)
 	if !ok {
 		return storage.ErrUserUnauthorized
 	}
 
-	userID, err := handlers.Authenticator.ValidateToken(token)
+	recordEvents, cancel := handlers.Events.Subscribe(principal.UserID)
+	defer cancel()
+
+	var expired <-chan time.Time
+	if !principal.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(principal.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ticker := time.NewTicker(watchSessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-expired:
+			return nil
+		case <-ticker.C:
+			err := handlers.CheckSession(ctx)
+			if err != nil {
+				return err
+			}
+		case event, ok := <-recordEvents:
+			if !ok {
+				return nil
+			}
+
+			if event.Type == entity.EventSessionRevoked {
+				if event.SessionID == "" || event.SessionID == principal.SessionID {
+					return storage.ErrUserUnauthorized
+				}
+				continue
+			}
+
+			err := handle(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListAuditEvents gets audit log of user.
+func (handlers *Server) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	_, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return nil, storage.ErrUserUnauthorized
+	}
+
+	return handlers.Storage.ListAuditEvents(ctx, query)
+}
+
+// audit writes operation of user to audit log. Result is error text or success.
+// Operation is already done, so it's written even if request was canceled and error of audit log is only logged.
+func (handlers *Server) audit(ctx context.Context, userID entity.UserID, action entity.AuditAction, recordID, ip string, err error) {
+	result := entity.AuditResultSuccess
+	if err != nil {
+		result = err.Error()
+	}
+
+	err = handlers.Storage.SaveAuditEvent(context.WithoutCancel(ctx), entity.AuditEvent{
+		UserID:   userID,
+		Action:   action,
+		RecordID: recordID,
+		IP:       ip,
+		Time:     time.Now(),
+		Result:   result,
+	})
 	if err != nil {
-		return err
+		slog.ErrorContext(ctx, "Failed save audit event", "error", err)
+	}
+}
+
+// auditLogin writes login of user to audit log. Login, which waits for TOTP code, has ErrTOTPRequired result.
+func (handlers *Server) auditLogin(ctx context.Context, userID entity.UserID, device entity.Device, session entity.Session, err error) {
+	if err == nil && session.TOTPRequired {
+		err = ErrTOTPRequired
+	}
+
+	handlers.audit(ctx, userID, entity.AuditLogin, "", device.IP, err)
+}
+
+// countLogin counts login attempt in metrics by its result.
+func countLogin(session entity.Session, err error) {
+	var lockout *LockoutError
+
+	result := metrics.LoginSuccess
+	switch {
+	case errors.As(err, &lockout):
+		result = metrics.LoginLockedOut
+	case errors.Is(err, storage.ErrWrongCredentials):
+		result = metrics.LoginFailure
+	case err != nil:
+		result = metrics.LoginError
+	case session.TOTPRequired:
+		result = metrics.LoginTOTPRequired
+	}
+
+	metrics.Logins.WithLabelValues(result).Inc()
+}
+
+// publishSessionRevoked stops watching of records by revoked session of user. Empty session ID means all sessions.
+func (handlers *Server) publishSessionRevoked(ctx context.Context, userID entity.UserID, sessionID string) {
+	err := handlers.Events.Publish(ctx, entity.RecordEvent{
+		UserID:    userID,
+		Type:      entity.EventSessionRevoked,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed publish session revocation", "error", err)
 	}
+}
 
-	ctx = context.WithValue(ctx, "userID", userID)
-	return handlers.Storage.DeleteRecord(ctx, recordID)
+// publish notifies watchers about changed record. Record is already saved, so error is only logged.
+func (handlers *Server) publish(ctx context.Context, userID entity.UserID, eventType entity.EventType, recordID string) {
+	err := handlers.Events.Publish(ctx, entity.RecordEvent{
+		UserID:   userID,
+		Type:     eventType,
+		RecordID: recordID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed publish record event", "error", err)
+	}
 }
@@ -2,66 +2,156 @@ package handlers
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/metrics"
+	"github.com/size12/gophkeeper/internal/srp"
 	"github.com/size12/gophkeeper/internal/storage"
 	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// recordTypeMessage is status message of changing record type, client tells it from other invalid arguments by it.
+const recordTypeMessage = "Type of record can't be changed."
+
 // ServerConn keeps server endpoints alive.
 type ServerConn struct {
 	pb.UnimplementedGophkeeperServer
-	Handlers ServerHandlers
-	server   *grpc.Server
+	Handlers      ServerHandlers
+	Authenticator Authenticator
+	server        *grpc.Server
+	tlsConfig     *tls.Config
+	users         CertificateUsers
+	// checkers are dependencies of server, which are reported by gRPC health service.
+	checkers   []HealthChecker
+	health     *health.Server
+	reflection bool
+	// done is closed on stop, so long-lived streams don't block graceful shutdown.
+	done chan struct{}
+	// stop makes repeated Stop calls no-op, so done isn't closed twice.
+	stop *sync.Once
+}
+
+// ServerOption configures server connection.
+type ServerOption func(server *ServerConn)
+
+// WithServerTLS makes server accept only TLS connections.
+func WithServerTLS(config *tls.Config) ServerOption {
+	return func(server *ServerConn) {
+		server.tlsConfig = config
+	}
 }
 
-// NewServerConn returns new server connection.
-func NewServerConn(h ServerHandlers) *ServerConn {
-	return &ServerConn{
-		Handlers: h,
+// WithCertificateUsers authenticates requests without token by verified client certificate.
+func WithCertificateUsers(users CertificateUsers) ServerOption {
+	return func(server *ServerConn) {
+		server.users = users
 	}
 }
 
+// NewServerConn returns new server connection. Requests are authenticated by authenticator.
+func NewServerConn(h ServerHandlers, a Authenticator, opts ...ServerOption) *ServerConn {
+	server := &ServerConn{
+		Handlers:      h,
+		Authenticator: a,
+		health:        health.NewServer(),
+		done:          make(chan struct{}),
+		stop:          &sync.Once{},
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	return server
+}
+
 // Run runs server listener.
 func (server *ServerConn) Run(ctx context.Context, runAddress string) {
 	listen, err := net.Listen("tcp", runAddress)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Failed listen address of server", "address", runAddress, "error", err)
+		os.Exit(1)
+	}
+
+	serverOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			UnaryRequestIDInterceptor(),
+			UnaryRecoveryInterceptor(),
+			UnaryAuthInterceptor(server.Authenticator, server.users, server.Handlers),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			StreamRequestIDInterceptor(),
+			StreamRecoveryInterceptor(),
+			StreamAuthInterceptor(server.Authenticator, server.users, server.Handlers),
+		),
+	}
+
+	if server.tlsConfig != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(server.tlsConfig)))
+	} else {
+		slog.Warn("Server runs without TLS, data is sent in clear text")
 	}
 
-	sgrpc := grpc.NewServer()
+	sgrpc := grpc.NewServer(serverOptions...)
 	pb.RegisterGophkeeperServer(sgrpc, server)
+	healthpb.RegisterHealthServer(sgrpc, server.health)
+
+	if server.reflection {
+		reflection.Register(sgrpc)
+	}
+
+	server.checkHealth(ctx)
+	go server.watchHealth(ctx)
 
 	go func() {
-		fmt.Println("Сервер gRPC начал работу")
+		slog.Info("gRPC server started", "address", runAddress)
 		if err := sgrpc.Serve(listen); err != nil {
-			log.Fatal(err)
+			slog.Error("Failed serve gRPC", "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	server.server = sgrpc
 }
 
+// Stop stops server gracefully. Health service reports NOT_SERVING while requests are finished.
+// Server is stopped once, repeated calls do nothing.
 func (server *ServerConn) Stop() {
-	server.server.GracefulStop()
-	fmt.Println("Shutdown server gracefully.")
+	server.stop.Do(func() {
+		server.health.Shutdown()
+		close(server.done)
+		server.server.GracefulStop()
+		slog.Info("Shutdown server gracefully")
+	})
 }
 
 // Register process register endpoint.
-func (server *ServerConn) Register(_ context.Context, credentials *pb.UserCredentials) (*pb.Session, error) {
-	token, err := server.Handlers.CreateUser(entity.UserCredentials{
+func (server *ServerConn) Register(ctx context.Context, credentials *pb.UserCredentials) (*pb.Session, error) {
+	session, err := server.Handlers.CreateUser(ctx, entity.UserCredentials{
 		Login:    credentials.Login,
 		Password: credentials.Password,
-	})
+	}, deviceFromContext(ctx, credentials.DeviceName))
 
 	if errors.Is(err, ErrFieldIsEmpty) {
 		return nil, status.Errorf(codes.InvalidArgument, "Login or password is empty.")
@@ -75,20 +165,104 @@ func (server *ServerConn) Register(_ context.Context, credentials *pb.UserCreden
 		return nil, status.Errorf(codes.Internal, "Internal server error.")
 	}
 
-	return &pb.Session{SessionToken: string(token)}, nil
+	return sessionToProto(session), nil
 }
 
 // Login process login endpoint.
-func (server *ServerConn) Login(_ context.Context, credentials *pb.UserCredentials) (*pb.Session, error) {
-	token, err := server.Handlers.LoginUser(entity.UserCredentials{
+func (server *ServerConn) Login(ctx context.Context, credentials *pb.UserCredentials) (*pb.Session, error) {
+	session, err := server.Handlers.LoginUser(ctx, entity.UserCredentials{
 		Login:    credentials.Login,
 		Password: credentials.Password,
-	})
+	}, deviceFromContext(ctx, credentials.DeviceName))
 
 	if errors.Is(err, ErrFieldIsEmpty) {
 		return nil, status.Errorf(codes.InvalidArgument, "Login or password is empty.")
 	}
 
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.Unauthenticated, "Wrong login or password.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return sessionToProto(session), nil
+}
+
+// RegisterSRP process SRP register endpoint.
+func (server *ServerConn) RegisterSRP(ctx context.Context, registration *pb.SRPRegistration) (*pb.Session, error) {
+	session, err := server.Handlers.RegisterSRP(ctx, registration.Login, entity.SRPVerifier{
+		Salt:     registration.Salt,
+		Verifier: registration.Verifier,
+	}, deviceFromContext(ctx, registration.DeviceName))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Login or verifier is empty.")
+	}
+
+	if errors.Is(err, storage.ErrLoginExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Login already exists.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return sessionToProto(session), nil
+}
+
+// StartLoginSRP process first step of SRP login.
+func (server *ServerConn) StartLoginSRP(ctx context.Context, start *pb.SRPStart) (*pb.SRPChallenge, error) {
+	challenge, err := server.Handlers.StartLoginSRP(ctx, start.Login, start.ClientPublicKey, deviceFromContext(ctx, ""))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Login or public key is empty.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, srp.ErrBadPublicKey) {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad public key.")
+	}
+
+	if errors.Is(err, ErrTooManyLogins) {
+		return nil, status.Errorf(codes.Unavailable, "Too many logins, try again later.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &pb.SRPChallenge{
+		LoginId:         challenge.LoginID,
+		Salt:            challenge.Salt,
+		ServerPublicKey: challenge.ServerPublicKey,
+	}, nil
+}
+
+// FinishLoginSRP process last step of SRP login.
+func (server *ServerConn) FinishLoginSRP(ctx context.Context, finish *pb.SRPFinish) (*pb.SRPSession, error) {
+	session, serverProof, err := server.Handlers.FinishLoginSRP(ctx, finish.LoginId, finish.ClientProof,
+		deviceFromContext(ctx, finish.DeviceName))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Login ID or proof is empty.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
 	if errors.Is(err, storage.ErrWrongCredentials) {
 		return nil, status.Errorf(codes.Unauthenticated, "Wrong login or password.")
 	}
@@ -97,29 +271,504 @@ func (server *ServerConn) Login(_ context.Context, credentials *pb.UserCredentia
 		return nil, status.Errorf(codes.Internal, "Internal server error.")
 	}
 
-	return &pb.Session{SessionToken: string(token)}, nil
+	return &pb.SRPSession{Session: sessionToProto(session), ServerProof: serverProof}, nil
+}
+
+// RefreshSession process refresh session endpoint.
+func (server *ServerConn) RefreshSession(ctx context.Context, request *pb.RefreshRequest) (*pb.Session, error) {
+	session, err := server.Handlers.RefreshSession(ctx, request.RefreshToken)
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Refresh token is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad refresh token.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return sessionToProto(session), nil
 }
 
-// GetRecordsInfo process get all records endpoint.
-func (server *ServerConn) GetRecordsInfo(ctx context.Context, _ *emptypb.Empty) (*pb.RecordsList, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("authToken")) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "Didn't send metadata for authentication.")
+// GetSigningKeys process signing keys endpoint. Other services verify access tokens by these public keys.
+func (server *ServerConn) GetSigningKeys(_ context.Context, _ *emptypb.Empty) (*pb.JWKS, error) {
+	keys := server.Authenticator.PublicKeys()
+
+	response := &pb.JWKS{Keys: make([]*pb.JWK, 0, len(keys))}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, &pb.JWK{
+			Kid: key.KeyID,
+			Kty: key.KeyType,
+			Alg: key.Algorithm,
+			Use: key.Use,
+			Crv: key.Curve,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+
+	return response, nil
+}
+
+// Logout process logout endpoint.
+func (server *ServerConn) Logout(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	err := server.Handlers.Logout(ctx)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
 	}
 
-	token := entity.AuthToken(md.Get("authToken")[0])
-	ctx = context.WithValue(ctx, "authToken", token)
+	return &emptypb.Empty{}, nil
+}
 
-	records, err := server.Handlers.GetRecordsInfo(ctx)
+// ChangePassword process change password endpoint.
+func (server *ServerConn) ChangePassword(ctx context.Context, request *pb.ChangePasswordRequest) (*emptypb.Empty, error) {
+	err := server.Handlers.ChangePassword(ctx, entity.UserCredentials{
+		Login:    request.Login,
+		Password: request.OldPassword,
+	}, request.NewPassword)
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Login or password is empty.")
+	}
 
 	if errors.Is(err, storage.ErrUserUnauthorized) {
 		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
 	}
 
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong current password.")
+	}
+
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Internal server error.")
 	}
 
+	return &emptypb.Empty{}, nil
+}
+
+// ChangePasswordSRP process change password endpoint of SRP user.
+func (server *ServerConn) ChangePasswordSRP(ctx context.Context, request *pb.SRPPasswordChange) (*emptypb.Empty, error) {
+	err := server.Handlers.ChangePasswordSRP(ctx, srpProofFromProto(request.Proof), entity.SRPVerifier{
+		Salt:     request.Salt,
+		Verifier: request.Verifier,
+	})
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Proof or verifier is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong current password.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// srpProofFromProto converts SRP proof from protobuf. Missing proof is empty.
+func srpProofFromProto(proof *pb.SRPProof) entity.SRPProof {
+	return entity.SRPProof{
+		LoginID:     proof.GetLoginId(),
+		ClientProof: proof.GetClientProof(),
+	}
+}
+
+// DeleteAccount process delete account endpoint.
+func (server *ServerConn) DeleteAccount(ctx context.Context, credentials *pb.UserCredentials) (*emptypb.Empty, error) {
+	err := server.Handlers.DeleteAccount(ctx, entity.UserCredentials{
+		Login:    credentials.Login,
+		Password: credentials.Password,
+	})
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Login or password is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong password.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// DeleteAccountSRP process delete account endpoint of SRP user.
+func (server *ServerConn) DeleteAccountSRP(ctx context.Context, proof *pb.SRPProof) (*emptypb.Empty, error) {
+	err := server.Handlers.DeleteAccountSRP(ctx, srpProofFromProto(proof))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Proof is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong password.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// ListSessions process list sessions endpoint.
+func (server *ServerConn) ListSessions(ctx context.Context, _ *emptypb.Empty) (*pb.SessionsList, error) {
+	sessions, err := server.Handlers.ListSessions(ctx)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	list := &pb.SessionsList{Sessions: make([]*pb.SessionInfo, 0, len(sessions))}
+	for _, session := range sessions {
+		list.Sessions = append(list.Sessions, &pb.SessionInfo{
+			Id:         session.ID,
+			DeviceName: session.Device.Name,
+			Ip:         session.Device.IP,
+			UserAgent:  session.Device.UserAgent,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeenAt.Unix(),
+			Current:    session.Current,
+		})
+	}
+
+	return list, nil
+}
+
+// ListAuditEvents process list audit events endpoint.
+func (server *ServerConn) ListAuditEvents(ctx context.Context, query *pb.AuditQuery) (*pb.AuditEvents, error) {
+	auditQuery := entity.AuditQuery{Limit: query.Limit}
+	if query.From != 0 {
+		auditQuery.From = time.Unix(query.From, 0)
+	}
+	if query.To != 0 {
+		auditQuery.To = time.Unix(query.To, 0)
+	}
+
+	events, err := server.Handlers.ListAuditEvents(ctx, auditQuery)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrBadQuery) {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad audit query.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	list := &pb.AuditEvents{Events: make([]*pb.AuditEvent, 0, len(events))}
+	for _, event := range events {
+		list.Events = append(list.Events, &pb.AuditEvent{
+			Action:   string(event.Action),
+			RecordId: event.RecordID,
+			Ip:       event.IP,
+			Time:     event.Time.Unix(),
+			Result:   event.Result,
+		})
+	}
+
+	return list, nil
+}
+
+// RevokeSession process revoke session endpoint.
+func (server *ServerConn) RevokeSession(ctx context.Context, sessionID *pb.SessionID) (*emptypb.Empty, error) {
+	err := server.Handlers.RevokeSession(ctx, sessionID.Id)
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Session ID is empty.")
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Session not found.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// EnableTOTP process enable TOTP endpoint.
+func (server *ServerConn) EnableTOTP(ctx context.Context, _ *emptypb.Empty) (*pb.TOTPEnrollment, error) {
+	enrollment, err := server.Handlers.EnableTOTP(ctx)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, ErrTOTPEnabled) {
+		return nil, status.Errorf(codes.AlreadyExists, "TOTP is already enabled.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &pb.TOTPEnrollment{Secret: enrollment.Secret, BackupCodes: enrollment.BackupCodes}, nil
+}
+
+// ConfirmTOTP process confirm TOTP endpoint.
+func (server *ServerConn) ConfirmTOTP(ctx context.Context, code *pb.TOTPCode) (*emptypb.Empty, error) {
+	err := server.Handlers.ConfirmTOTP(ctx, code.Code)
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Code is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.FailedPrecondition, "TOTP wasn't enabled.")
+	}
+
+	if errors.Is(err, ErrTOTPEnabled) {
+		return nil, status.Errorf(codes.AlreadyExists, "TOTP is already enabled.")
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong code.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// DisableTOTP process disable TOTP endpoint.
+func (server *ServerConn) DisableTOTP(ctx context.Context, request *pb.DisableTOTPRequest) (*emptypb.Empty, error) {
+	err := server.Handlers.DisableTOTP(ctx, request.Code, entity.UserCredentials{
+		Login:    request.Login,
+		Password: request.Password,
+	}, srpProofFromProto(request.Proof))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Code or password is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.FailedPrecondition, "TOTP wasn't enabled.")
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong code or password.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// VerifyTOTP process second step of login, when user enabled TOTP.
+func (server *ServerConn) VerifyTOTP(ctx context.Context, code *pb.TOTPCode) (*pb.Session, error) {
+	session, err := server.Handlers.VerifyTOTP(ctx, code.Code, deviceFromContext(ctx, code.DeviceName))
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Code is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		return nil, lockoutStatus(lockout)
+	}
+
+	if errors.Is(err, storage.ErrWrongCredentials) {
+		return nil, status.Errorf(codes.PermissionDenied, "Wrong code.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return sessionToProto(session), nil
+}
+
+// lockoutStatus returns status of locked out login. Client can retry after delay from retry info.
+func lockoutStatus(lockout *LockoutError) error {
+	st := status.New(codes.ResourceExhausted, "Too many failed attempts, try again later.")
+
+	withRetry, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(lockout.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withRetry.Err()
+}
+
+// peerIP gets IP address of request peer.
+func peerIP(ctx context.Context) string {
+	return deviceFromContext(ctx, "").IP
+}
+
+// deviceFromContext gets device of request: address of peer and user agent from metadata.
+func deviceFromContext(ctx context.Context, name string) entity.Device {
+	device := entity.Device{Name: name}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		device.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(device.IP); err == nil {
+			device.IP = host
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if userAgent := md.Get("user-agent"); len(userAgent) != 0 {
+		device.UserAgent = userAgent[0]
+	}
+
+	return device
+}
+
+// sessionToProto converts session to protobuf.
+func sessionToProto(session entity.Session) *pb.Session {
+	return &pb.Session{
+		SessionToken: string(session.AccessToken),
+		RefreshToken: session.RefreshToken,
+		ExpiresAt:    session.ExpiresAt.Unix(),
+		TotpRequired: session.TOTPRequired,
+	}
+}
+
+// GetRecordsInfo process get records endpoint.
+func (server *ServerConn) GetRecordsInfo(ctx context.Context, query *pb.RecordsQuery) (*pb.RecordsList, error) {
+	types := make([]entity.RecordType, 0, len(query.Types))
+	for _, recordType := range query.Types {
+		types = append(types, entity.RecordType(recordType))
+	}
+
+	page, err := server.Handlers.GetRecordsInfo(ctx, entity.RecordsQuery{
+		PageSize:  query.PageSize,
+		PageToken: query.PageToken,
+		Types:     types,
+		Metadata:  query.Metadata,
+		Sort:      entity.RecordsSort(query.Sort),
+	})
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrBadQuery) {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad records query.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &pb.RecordsList{
+		Records:       recordsInfoToProto(page.Records),
+		NextPageToken: page.NextPageToken,
+	}, nil
+}
+
+// GetChanges process get changes endpoint.
+func (server *ServerConn) GetChanges(ctx context.Context, request *pb.ChangesRequest) (*pb.Changes, error) {
+	changes, err := server.Handlers.GetChanges(ctx, request.SinceRevision)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrResyncRequired) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Deleted records are pruned, list all records again.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &pb.Changes{
+		Revision: changes.Revision,
+		Created:  recordsInfoToProto(changes.Created),
+		Updated:  recordsInfoToProto(changes.Updated),
+		Deleted:  changes.Deleted,
+	}, nil
+}
+
+// recordsInfoToProto converts records info without data to protobuf records.
+func recordsInfoToProto(records []entity.Record) []*pb.Record {
 	recordsList := make([]*pb.Record, 0, len(records))
 
 	for _, record := range records {
@@ -127,22 +776,15 @@ func (server *ServerConn) GetRecordsInfo(ctx context.Context, _ *emptypb.Empty)
 			Id:       record.ID,
 			Metadata: record.Metadata,
 			Type:     pb.MessageType(record.Type),
+			Revision: record.Revision,
 		})
 	}
 
-	return &pb.RecordsList{Records: recordsList}, nil
+	return recordsList
 }
 
 // GetRecord process get record endpoint.
 func (server *ServerConn) GetRecord(ctx context.Context, recordID *pb.RecordID) (*pb.Record, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("authToken")) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "Didn't send metadata for authentication.")
-	}
-
-	token := entity.AuthToken(md.Get("authToken")[0])
-	ctx = context.WithValue(ctx, "authToken", token)
-
 	record, err := server.Handlers.GetRecord(ctx, recordID.Id)
 
 	if errors.Is(err, storage.ErrUserUnauthorized) {
@@ -162,19 +804,12 @@ func (server *ServerConn) GetRecord(ctx context.Context, recordID *pb.RecordID)
 		Type:       pb.MessageType(record.Type),
 		Metadata:   record.Metadata,
 		StoredData: record.Data,
+		Revision:   record.Revision,
 	}, nil
 }
 
 // CreateRecord process create record endpoint.
 func (server *ServerConn) CreateRecord(ctx context.Context, record *pb.Record) (*emptypb.Empty, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("authToken")) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "Didn't send metadata for authentication.")
-	}
-
-	token := entity.AuthToken(md.Get("authToken")[0])
-	ctx = context.WithValue(ctx, "authToken", token)
-
 	err := server.Handlers.CreateRecord(ctx, entity.Record{
 		Metadata: record.Metadata,
 		Type:     entity.RecordType(record.Type),
@@ -185,6 +820,10 @@ func (server *ServerConn) CreateRecord(ctx context.Context, record *pb.Record) (
 		return &emptypb.Empty{}, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
 	}
 
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return &emptypb.Empty{}, status.Errorf(codes.ResourceExhausted, "Storage quota exceeded.")
+	}
+
 	if err != nil {
 		return &emptypb.Empty{}, status.Errorf(codes.Internal, "Internal server error.")
 	}
@@ -192,16 +831,49 @@ func (server *ServerConn) CreateRecord(ctx context.Context, record *pb.Record) (
 	return &emptypb.Empty{}, nil
 }
 
-// DeleteRecord process delete record endpoint.
-func (server *ServerConn) DeleteRecord(ctx context.Context, recordID *pb.RecordID) (*emptypb.Empty, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("authToken")) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "Didn't send metadata for authentication.")
+// UpdateRecord process update record endpoint.
+func (server *ServerConn) UpdateRecord(ctx context.Context, record *pb.Record) (*pb.Record, error) {
+	revision, err := server.Handlers.UpdateRecord(ctx, entity.Record{
+		ID:       record.Id,
+		Metadata: record.Metadata,
+		Type:     entity.RecordType(record.Type),
+		Data:     record.StoredData,
+		Revision: record.Revision,
+	})
+
+	if errors.Is(err, ErrFieldIsEmpty) {
+		return nil, status.Errorf(codes.InvalidArgument, "Record id is empty.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Not found record with such id.")
+	}
+
+	if errors.Is(err, storage.ErrRecordType) {
+		return nil, status.Errorf(codes.InvalidArgument, recordTypeMessage)
+	}
+
+	if errors.Is(err, storage.ErrRevisionConflict) {
+		return nil, status.Errorf(codes.Aborted, "Record was changed by another client.")
+	}
+
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, status.Errorf(codes.ResourceExhausted, "Storage quota exceeded.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
 	}
 
-	token := entity.AuthToken(md.Get("authToken")[0])
-	ctx = context.WithValue(ctx, "authToken", token)
+	return &pb.Record{Id: record.Id, Revision: revision}, nil
+}
 
+// DeleteRecord process delete record endpoint.
+func (server *ServerConn) DeleteRecord(ctx context.Context, recordID *pb.RecordID) (*emptypb.Empty, error) {
 	err := server.Handlers.DeleteRecord(ctx, recordID.Id)
 
 	if errors.Is(err, storage.ErrUserUnauthorized) {
@@ -218,3 +890,159 @@ func (server *ServerConn) DeleteRecord(ctx context.Context, recordID *pb.RecordI
 
 	return &emptypb.Empty{}, nil
 }
+
+// GetUsage process usage endpoint.
+func (server *ServerConn) GetUsage(ctx context.Context, _ *emptypb.Empty) (*pb.Usage, error) {
+	usage, err := server.Handlers.GetUsage(ctx)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return nil, status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return &pb.Usage{
+		Bytes:         usage.Bytes,
+		Records:       usage.Records,
+		MaxBytes:      usage.Quota.MaxBytes,
+		MaxRecords:    usage.Quota.MaxRecords,
+		MaxRecordSize: usage.Quota.MaxRecordSize,
+	}, nil
+}
+
+// UploadFile process upload file endpoint. First chunk should carry record info, others carry file data.
+func (server *ServerConn) UploadFile(stream pb.Gophkeeper_UploadFileServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil || first.GetInfo() == nil {
+		return status.Errorf(codes.InvalidArgument, "First chunk should contain record info.")
+	}
+
+	r := &chunkReader{recv: func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	}}
+
+	recordID, err := server.Handlers.UploadFile(ctx, entity.Record{
+		Metadata: first.GetInfo().Metadata,
+		Type:     entity.TypeFile,
+	}, r)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return status.Errorf(codes.ResourceExhausted, "Storage quota exceeded.")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return stream.SendAndClose(&pb.RecordID{Id: recordID})
+}
+
+// ReplaceRecords process replace records endpoint. Records are read from stream one by one.
+func (server *ServerConn) ReplaceRecords(stream pb.Gophkeeper_ReplaceRecordsServer) error {
+	batch := &recordsBatch{recv: stream.Recv}
+
+	revision, err := server.Handlers.ReplaceRecords(stream.Context(), batch.Next)
+
+	if errors.Is(err, ErrFieldIsEmpty) || errors.Is(err, errNoRecordInfo) {
+		return status.Errorf(codes.InvalidArgument, "Every record should be sent as info with record id.")
+	}
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "Not found record with such id.")
+	}
+
+	if errors.Is(err, storage.ErrRecordType) {
+		return status.Errorf(codes.InvalidArgument, recordTypeMessage)
+	}
+
+	if errors.Is(err, storage.ErrRevisionConflict) {
+		return status.Errorf(codes.Aborted, "Records were changed by another client.")
+	}
+
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return status.Errorf(codes.ResourceExhausted, "Storage quota exceeded.")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return stream.SendAndClose(&pb.Record{Revision: revision})
+}
+
+// DownloadFile process download file endpoint. Streams file data chunk by chunk.
+func (server *ServerConn) DownloadFile(recordID *pb.RecordID, stream pb.Gophkeeper_DownloadFileServer) error {
+	ctx := stream.Context()
+
+	w := &chunkWriter{send: func(data []byte) error {
+		return stream.Send(&pb.FileChunk{Payload: &pb.FileChunk_Data{Data: data}})
+	}}
+
+	err := server.Handlers.DownloadFile(ctx, recordID.Id, w)
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return status.Errorf(codes.Unauthenticated, "Bad authentication token.")
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "Not found record with such id.")
+	}
+
+	if errors.Is(err, storage.ErrNotFile) {
+		return status.Errorf(codes.FailedPrecondition, "Record is not a file.")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return nil
+}
+
+// WatchRecords process watch records endpoint. Streams record events until client or server stops,
+// access token expires or session is revoked.
+func (server *ServerConn) WatchRecords(_ *emptypb.Empty, stream pb.Gophkeeper_WatchRecordsServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-server.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := server.Handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+		return stream.Send(&pb.RecordEvent{
+			Type:     pb.EventType(event.Type),
+			RecordId: event.RecordID,
+		})
+	})
+
+	if errors.Is(err, storage.ErrUserUnauthorized) {
+		return status.Errorf(codes.Unauthenticated, "Session was revoked.")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Internal server error.")
+	}
+
+	return nil
+}
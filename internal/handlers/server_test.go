@@ -1,28 +1,50 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
+	eventsmocks "github.com/size12/gophkeeper/internal/events/mocks"
 	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	"github.com/size12/gophkeeper/internal/ratelimit"
+	ratelimitmocks "github.com/size12/gophkeeper/internal/ratelimit/mocks"
+	"github.com/size12/gophkeeper/internal/srp"
 	"github.com/size12/gophkeeper/internal/storage"
 	storagemocks "github.com/size12/gophkeeper/internal/storage/mocks"
+	"github.com/size12/gophkeeper/internal/totp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestNewServerHandlers(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
 	assert.NotEmpty(t, handlers)
 }
 
 func TestServer_CreateUser(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	device := entity.Device{Name: "laptop", IP: "127.0.0.1", UserAgent: "gophkeeper-client"}
+
+	argon2Password, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	argon2Password.UserID = "userID"
 
 	tc := []struct {
 		name string
@@ -33,15 +55,17 @@ func TestServer_CreateUser(t *testing.T) {
 		{
 			"Create user with good credentials",
 			func() {
-				store.On("CreateUser", entity.UserCredentials{
-					Login:    "admin",
-					Password: "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70",
-				}).Return(nil).Once()
-				store.On("LoginUser", entity.UserCredentials{
-					Login:    "admin",
-					Password: "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70",
-				}).Return(entity.UserID("userID"), nil).Once()
-				auth.On("CreateToken", entity.UserID("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("CreateUser", mock.Anything, "admin", mock.MatchedBy(func(password entity.StoredPassword) bool {
+					return password.Algorithm == entity.PasswordArgon2id && strings.HasPrefix(password.Hash, "$argon2id$")
+				})).Return(nil).Once()
+				store.On("GetUserID", mock.Anything, "admin").Return(entity.UserID("userID"), nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+				store.On("CreateSession", mock.Anything, mock.MatchedBy(func(session entity.SessionInfo) bool {
+					return session.UserID == "userID" && len(session.ID) == 32 && session.Device == device
+				})).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
 			},
 			entity.UserCredentials{
 				Login:    "admin",
@@ -63,7 +87,7 @@ func TestServer_CreateUser(t *testing.T) {
 	for _, test := range tc {
 		t.Log(test.name)
 		test.mock()
-		_, err := handlers.CreateUser(test.arg)
+		_, err := handlers.CreateUser(context.Background(), test.arg, device)
 		assert.Equal(t, test.want, err)
 
 		store.AssertExpectations(t)
@@ -73,8 +97,26 @@ func TestServer_CreateUser(t *testing.T) {
 
 func TestServer_LoginUser(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	device := entity.Device{Name: "laptop", IP: "127.0.0.1", UserAgent: "gophkeeper-client"}
+
+	argon2Password, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	argon2Password.UserID = "userID"
+
+	startSession := func() {
+		store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+		store.On("CreateSession", mock.Anything, mock.MatchedBy(func(session entity.SessionInfo) bool {
+			return session.UserID == "userID" && len(session.ID) == 32 && session.Device == device
+		})).Return(nil).Once()
+		auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+		store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+		store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
+	}
 
 	tc := []struct {
 		name string
@@ -83,13 +125,30 @@ func TestServer_LoginUser(t *testing.T) {
 		want error
 	}{
 		{
-			"Login user with good credentials",
+			"Login user with Argon2id password hash",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(argon2Password, nil).Once()
+				startSession()
+			},
+			entity.UserCredentials{
+				Login:    "admin",
+				Password: "password",
+			},
+			nil,
+		},
+		{
+			"Login user with legacy password hash, which is upgraded",
 			func() {
-				store.On("LoginUser", entity.UserCredentials{
-					Login:    "admin",
-					Password: "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70",
-				}).Return(entity.UserID("userID"), nil).Once()
-				auth.On("CreateToken", entity.UserID("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("GetPassword", mock.Anything, "admin").Return(entity.StoredPassword{
+					UserID:    "userID",
+					Hash:      "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70",
+					Algorithm: entity.PasswordSHA256,
+				}, nil).Once()
+				store.On("UpdatePassword", mock.Anything, mock.MatchedBy(func(password entity.StoredPassword) bool {
+					ok, rehash, _ := verifyPassword(context.Background(), password, entity.UserCredentials{Login: "admin", Password: "password"})
+					return password.UserID == "userID" && password.Algorithm == entity.PasswordArgon2id && ok && !rehash
+				})).Return(nil).Once()
+				startSession()
 			},
 			entity.UserCredentials{
 				Login:    "admin",
@@ -97,6 +156,44 @@ func TestServer_LoginUser(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"Login user with TOTP, only token for second step is issued",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(argon2Password, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{UserID: "userID", Secret: "SECRET", Confirmed: true}, nil).Once()
+				auth.On("CreateToken", entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}}).
+					Return(entity.AuthToken("totpToken"), nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", ErrTOTPRequired.Error())).Return(nil).Once()
+			},
+			entity.UserCredentials{
+				Login:    "admin",
+				Password: "password",
+			},
+			nil,
+		},
+		{
+			"Login user with wrong password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(argon2Password, nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", storage.ErrWrongCredentials.Error())).Return(nil).Once()
+			},
+			entity.UserCredentials{
+				Login:    "admin",
+				Password: "wrong",
+			},
+			storage.ErrWrongCredentials,
+		},
+		{
+			"Login not existing user",
+			func() {
+				store.On("GetPassword", mock.Anything, "nobody").Return(entity.StoredPassword{}, storage.ErrWrongCredentials).Once()
+			},
+			entity.UserCredentials{
+				Login:    "nobody",
+				Password: "password",
+			},
+			storage.ErrWrongCredentials,
+		},
 		{
 			"Login user with bad credentials",
 			func() {},
@@ -111,7 +208,7 @@ func TestServer_LoginUser(t *testing.T) {
 	for _, test := range tc {
 		t.Log(test.name)
 		test.mock()
-		_, err := handlers.LoginUser(test.arg)
+		_, err := handlers.LoginUser(context.Background(), test.arg, device)
 		assert.Equal(t, test.want, err)
 
 		store.AssertExpectations(t)
@@ -119,10 +216,20 @@ func TestServer_LoginUser(t *testing.T) {
 	}
 }
 
-func TestServer_GetRecordsInfo(t *testing.T) {
+func TestServer_LoginLockout(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	limiter := ratelimitmocks.NewLimiter(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+	handlers.Limiter = limiter
+
+	device := entity.Device{Name: "laptop", IP: "127.0.0.1"}
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
 
 	tc := []struct {
 		name  string
@@ -130,24 +237,70 @@ func TestServer_GetRecordsInfo(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Get all records with valid context",
+			"Login from locked out IP address",
+			func() {
+				limiter.On("Acquire", mock.Anything, "login:admin").Return(time.Duration(0), nil).Once()
+				limiter.On("Acquire", mock.Anything, "ip:127.0.0.1").Return(30*time.Second, nil).Once()
+				limiter.On("Release", mock.Anything, "login:admin").Return(nil).Once()
+			},
+			func() {
+				_, err := handlers.LoginUser(context.Background(), entity.UserCredentials{Login: "admin", Password: "password"}, device)
+				assert.Equal(t, &LockoutError{RetryAfter: 30 * time.Second}, err)
+				assert.ErrorIs(t, err, ErrTooManyAttempts)
+			},
+		},
+		{
+			"Login with wrong password, reserved attempt of login and IP address stays failed",
+			func() {
+				limiter.On("Acquire", mock.Anything, "login:admin").Return(time.Duration(0), nil).Once()
+				limiter.On("Acquire", mock.Anything, "ip:127.0.0.1").Return(time.Duration(0), nil).Once()
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", storage.ErrWrongCredentials.Error())).Return(nil).Once()
+			},
+			func() {
+				_, err := handlers.LoginUser(context.Background(), entity.UserCredentials{Login: "admin", Password: "wrong"}, device)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Login with right password, failures of login are forgotten, attempt of IP address is released",
 			func() {
-				store.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx")).Return([]entity.Record{}, nil).Once()
-				auth.On("ValidateToken", entity.AuthToken("token")).Return(entity.UserID("userID"), nil).Once()
+				limiter.On("Acquire", mock.Anything, mock.Anything).Return(time.Duration(0), nil).Twice()
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+				store.On("CreateSession", mock.Anything, mock.Anything).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
+				limiter.On("Reset", mock.Anything, "login:admin").Return(nil).Once()
+				limiter.On("Release", mock.Anything, "ip:127.0.0.1").Return(nil).Once()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "authToken", entity.AuthToken("token"))
-				_, err := handlers.GetRecordsInfo(ctx)
+				_, err := handlers.LoginUser(context.Background(), entity.UserCredentials{Login: "admin", Password: "password"}, device)
 				assert.NoError(t, err)
 			},
 		},
 		{
-			"Get all records with not valid context",
-			func() {},
+			"Login, but limiter will return error",
 			func() {
-				ctx := context.Background()
-				_, err := handlers.GetRecordsInfo(ctx)
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				limiter.On("Acquire", mock.Anything, "login:admin").Return(time.Duration(0), errors.New("some DB error")).Once()
+			},
+			func() {
+				_, err := handlers.LoginUser(context.Background(), entity.UserCredentials{Login: "admin", Password: "password"}, device)
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+		{
+			"Finish login with TOTP code, while user is locked out",
+			func() {
+				limiter.On("Acquire", mock.Anything, "totp:userID").Return(time.Minute, nil).Once()
+				limiter.On("Acquire", mock.Anything, "ip:127.0.0.1").Return(time.Duration(0), nil).Once()
+				limiter.On("Release", mock.Anything, "ip:127.0.0.1").Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}})
+				_, err := handlers.VerifyTOTP(ctx, "123456", device)
+				assert.Equal(t, &LockoutError{RetryAfter: time.Minute}, err)
 			},
 		},
 	}
@@ -159,13 +312,173 @@ func TestServer_GetRecordsInfo(t *testing.T) {
 
 		store.AssertExpectations(t)
 		auth.AssertExpectations(t)
+		limiter.AssertExpectations(t)
 	}
 }
 
-func TestServer_GetRecord(t *testing.T) {
+func TestServer_ConcurrentLoginGuesses(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+	handlers.Limiter = ratelimit.NewMemoryLimiter(ratelimit.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, Window: time.Hour})
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
+
+	store.On("GetPassword", mock.Anything, "admin").Return(stored, nil)
+	store.On("SaveAuditEvent", mock.Anything, mock.Anything).Return(nil)
+
+	results := make(chan error, 20)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := handlers.LoginUser(context.Background(), entity.UserCredentials{Login: "admin", Password: "wrong"}, entity.Device{})
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	checked := 0
+	for err := range results {
+		if errors.Is(err, storage.ErrWrongCredentials) {
+			checked++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+	}
+
+	// Free attempts and the one, which locks login out, are checked, others see lockout.
+	assert.Equal(t, 3, checked)
+}
+
+// newSessionPrincipal matches principal of new session of user.
+func newSessionPrincipal(userID entity.UserID) interface{} {
+	return mock.MatchedBy(func(principal entity.Principal) bool {
+		return principal.UserID == userID && len(principal.SessionID) == 32 && principal.HasScope(entity.ScopeRecords)
+	})
+}
+
+// auditEventOf matches audit event of user, which is saved to storage.
+func auditEventOf(userID entity.UserID, action entity.AuditAction, recordID, result string) interface{} {
+	return mock.MatchedBy(func(event entity.AuditEvent) bool {
+		return event.UserID == userID && event.Action == action && event.RecordID == recordID &&
+			event.Result == result && !event.Time.IsZero()
+	})
+}
+
+// sessionRevokedEvent is event, which stops watching of records by revoked session of user.
+func sessionRevokedEvent(userID entity.UserID, sessionID string) entity.RecordEvent {
+	return entity.RecordEvent{UserID: userID, Type: entity.EventSessionRevoked, SessionID: sessionID}
+}
+
+// refreshTokenOf matches refresh token of user, which is saved to storage.
+func refreshTokenOf(userID entity.UserID) interface{} {
+	return mock.MatchedBy(func(token entity.RefreshToken) bool {
+		return token.UserID == userID && len(token.Hash) == 64 && token.ExpiresAt.After(time.Now())
+	})
+}
+
+func TestServer_RegisterSRP(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	device := entity.Device{Name: "laptop"}
+	verifier := entity.SRPVerifier{Salt: []byte("salt"), Verifier: []byte("verifier")}
+
+	tc := []struct {
+		name     string
+		mock     func()
+		login    string
+		verifier entity.SRPVerifier
+		want     error
+	}{
+		{
+			"Register user with verifier",
+			func() {
+				store.On("CreateUser", mock.Anything, "admin", encodeSRPVerifier(verifier)).Return(nil).Once()
+				store.On("GetUserID", mock.Anything, "admin").Return(entity.UserID("userID"), nil).Once()
+				store.On("CreateSession", mock.Anything, mock.Anything).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+			},
+			"admin",
+			verifier,
+			nil,
+		},
+		{
+			"Register user, but login exists",
+			func() {
+				store.On("CreateUser", mock.Anything, "admin", encodeSRPVerifier(verifier)).Return(storage.ErrLoginExists).Once()
+			},
+			"admin",
+			verifier,
+			storage.ErrLoginExists,
+		},
+		{
+			"Register user without verifier",
+			func() {},
+			"admin",
+			entity.SRPVerifier{},
+			ErrFieldIsEmpty,
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		_, err := handlers.RegisterSRP(context.Background(), test.login, test.verifier, device)
+		assert.Equal(t, test.want, err)
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_LoginSRP(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	device := entity.Device{Name: "laptop"}
+
+	salt, verifier, err := srp.NewVerifier("admin", "password")
+	assert.NoError(t, err)
+	stored := encodeSRPVerifier(entity.SRPVerifier{Salt: salt, Verifier: verifier})
+	stored.UserID = "userID"
+
+	// login makes SRP handshake with password and returns result of last step.
+	login := func(login, password string) (entity.Session, error) {
+		client, err := srp.NewClient(login, password)
+		assert.NoError(t, err)
+
+		challenge, err := handlers.StartLoginSRP(context.Background(), login, client.PublicKey(), entity.Device{})
+		if err != nil {
+			return entity.Session{}, err
+		}
+
+		proof, err := client.Proof(challenge.Salt, challenge.ServerPublicKey)
+		assert.NoError(t, err)
+
+		session, serverProof, err := handlers.FinishLoginSRP(context.Background(), challenge.LoginID, proof, device)
+		if err != nil {
+			return entity.Session{}, err
+		}
+
+		assert.NoError(t, client.VerifyServer(serverProof))
+		return session, nil
+	}
 
 	tc := []struct {
 		name  string
@@ -173,24 +486,108 @@ func TestServer_GetRecord(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Get record with valid context",
+			"Login user with right password",
 			func() {
-				store.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(entity.Record{}, nil).Once()
-				auth.On("ValidateToken", entity.AuthToken("token")).Return(entity.UserID("userID"), nil).Once()
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+				store.On("CreateSession", mock.Anything, mock.Anything).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "authToken", entity.AuthToken("token"))
-				_, err := handlers.GetRecord(ctx, "recordID")
+				session, err := login("admin", "password")
 				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), session.AccessToken)
 			},
 		},
 		{
-			"Get record with not valid context",
+			"Login user with wrong password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", storage.ErrWrongCredentials.Error())).Return(nil).Once()
+			},
+			func() {
+				_, err := login("admin", "wrong")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Login not existing user gets same salt every time",
+			func() {
+				store.On("GetPassword", mock.Anything, "nobody").Return(entity.StoredPassword{}, storage.ErrWrongCredentials).Times(3)
+			},
+			func() {
+				first, err := handlers.StartLoginSRP(context.Background(), "nobody", []byte{1}, entity.Device{})
+				assert.NoError(t, err)
+				second, err := handlers.StartLoginSRP(context.Background(), "nobody", []byte{1}, entity.Device{})
+				assert.NoError(t, err)
+				assert.Equal(t, first.Salt, second.Salt)
+				assert.Len(t, first.Salt, srp.SaltSize)
+
+				_, err = login("nobody", "password")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Fake salt of not existing user depends on salt key",
+			func() {
+				store.On("GetPassword", mock.Anything, "nobody").Return(entity.StoredPassword{}, storage.ErrWrongCredentials).Twice()
+			},
+			func() {
+				key := handlers.SRPSaltKey
+				defer func() { handlers.SRPSaltKey = key }()
+
+				handlers.SRPSaltKey = []byte("first key")
+				first, err := handlers.StartLoginSRP(context.Background(), "nobody", []byte{1}, entity.Device{})
+				assert.NoError(t, err)
+
+				handlers.SRPSaltKey = []byte("second key")
+				second, err := handlers.StartLoginSRP(context.Background(), "nobody", []byte{1}, entity.Device{})
+				assert.NoError(t, err)
+
+				assert.NotEqual(t, first.Salt, second.Salt)
+			},
+		},
+		{
+			"Login user, which has password hash instead of verifier",
+			func() {
+				store.On("GetPassword", mock.Anything, "legacy").Return(entity.StoredPassword{
+					UserID:    "userID",
+					Hash:      "749f09bade8aca755660eeb17792da880218d4fbdc4e25fbec279d7fe9f65d70",
+					Algorithm: entity.PasswordSHA256,
+				}, nil).Once()
+			},
+			func() {
+				_, err := login("legacy", "password")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Finish unknown login",
 			func() {},
 			func() {
-				ctx := context.Background()
-				_, err := handlers.GetRecord(ctx, "recordID")
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				_, _, err := handlers.FinishLoginSRP(context.Background(), "unknown", []byte("proof"), device)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Start login without public key",
+			func() {},
+			func() {
+				_, err := handlers.StartLoginSRP(context.Background(), "admin", nil, entity.Device{})
+				assert.Equal(t, ErrFieldIsEmpty, err)
+			},
+		},
+		{
+			"Start login with public key longer than N",
+			func() {},
+			func() {
+				started := len(handlers.srpLogins)
+				tooLong := append([]byte{1}, make([]byte, 256)...)
+				_, err := handlers.StartLoginSRP(context.Background(), "admin", tooLong, entity.Device{})
+				assert.Equal(t, srp.ErrBadPublicKey, err)
+				assert.Len(t, handlers.srpLogins, started)
 			},
 		},
 	}
@@ -205,10 +602,58 @@ func TestServer_GetRecord(t *testing.T) {
 	}
 }
 
-func TestServer_CreateRecord(t *testing.T) {
+func TestServer_StartLoginSRPLockout(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+	handlers.Limiter = ratelimit.NewMemoryLimiter(ratelimit.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, Window: time.Hour})
+
+	store.On("GetPassword", mock.Anything, mock.Anything).Return(entity.StoredPassword{}, storage.ErrWrongCredentials)
+
+	device := entity.Device{IP: "10.0.0.1"}
+
+	// Unfinished handshakes count as failures, so one IP address can't keep many of them.
+	for i := 0; i < 3; i++ {
+		_, err := handlers.StartLoginSRP(context.Background(), fmt.Sprintf("user%d", i), []byte{1}, device)
+		assert.NoError(t, err)
+	}
+
+	_, err := handlers.StartLoginSRP(context.Background(), "other", []byte{1}, device)
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Len(t, handlers.srpLogins, 3)
+
+	// Other IP address isn't locked out.
+	_, err = handlers.StartLoginSRP(context.Background(), "other", []byte{1}, entity.Device{IP: "10.0.0.2"})
+	assert.NoError(t, err)
+}
+
+func TestServer_ExpireSRPLogins(t *testing.T) {
+	handlers := NewServerHandlers(nil, nil, nil, nil)
+
+	now := time.Now()
+	for i, expiresAt := range []time.Time{now.Add(-time.Second), now.Add(-time.Millisecond), now.Add(time.Minute)} {
+		id := fmt.Sprint(i)
+		handlers.srpLogins[id] = srpLogin{expiresAt: expiresAt}
+		handlers.srpExpiry = append(handlers.srpExpiry, srpExpiry{loginID: id, expiresAt: expiresAt})
+	}
+
+	// Finished handshake is still in queue.
+	delete(handlers.srpLogins, "1")
+
+	handlers.expireSRPLogins(now)
+	assert.Len(t, handlers.srpLogins, 1)
+	assert.Contains(t, handlers.srpLogins, "2")
+	assert.Equal(t, []srpExpiry{{loginID: "2", expiresAt: now.Add(time.Minute)}}, handlers.srpExpiry)
+}
+
+func TestServer_RefreshSession(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
 
 	tc := []struct {
 		name  string
@@ -216,26 +661,62 @@ func TestServer_CreateRecord(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Create record with valid context",
+			"Refresh session with valid token",
 			func() {
-				store.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), mock.AnythingOfType("entity.Record")).Return("", nil).Once()
-				auth.On("ValidateToken", entity.AuthToken("token")).Return(entity.UserID("userID"), nil).Once()
+				store.On("UseRefreshToken", mock.Anything, hashRefreshToken("refresh")).Return(entity.RefreshToken{
+					Hash:      hashRefreshToken("refresh"),
+					UserID:    "userID",
+					SessionID: "sessionID",
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil).Once()
+				auth.On("CreateToken", entity.Principal{UserID: "userID", SessionID: "sessionID", Scopes: []string{entity.ScopeRecords}}).
+					Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(token entity.RefreshToken) bool {
+					return token.SessionID == "sessionID" && token.Hash != hashRefreshToken("refresh")
+				})).Return(nil).Once()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "authToken", entity.AuthToken("token"))
-				err := handlers.CreateRecord(ctx, entity.Record{})
+				session, err := handlers.RefreshSession(context.Background(), "refresh")
 				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), session.AccessToken)
+				assert.NotEmpty(t, session.RefreshToken)
+				assert.NotEqual(t, "refresh", session.RefreshToken)
+				assert.True(t, session.ExpiresAt.After(time.Now()))
 			},
 		},
 		{
-			"Create record with not valid context",
-			func() {},
+			"Refresh session with expired token",
 			func() {
-				ctx := context.Background()
-				_, err := handlers.GetRecord(ctx, "recordID")
+				store.On("UseRefreshToken", mock.Anything, hashRefreshToken("expired")).Return(entity.RefreshToken{
+					Hash:      hashRefreshToken("expired"),
+					UserID:    "userID",
+					SessionID: "sessionID",
+					ExpiresAt: time.Now().Add(-time.Hour),
+				}, nil).Once()
+			},
+			func() {
+				_, err := handlers.RefreshSession(context.Background(), "expired")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Refresh session with unknown token",
+			func() {
+				store.On("UseRefreshToken", mock.Anything, hashRefreshToken("unknown")).Return(entity.RefreshToken{}, storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				_, err := handlers.RefreshSession(context.Background(), "unknown")
 				assert.Equal(t, storage.ErrUserUnauthorized, err)
 			},
 		},
+		{
+			"Refresh session with empty token",
+			func() {},
+			func() {
+				_, err := handlers.RefreshSession(context.Background(), "")
+				assert.Equal(t, ErrFieldIsEmpty, err)
+			},
+		},
 	}
 
 	for _, test := range tc {
@@ -248,10 +729,14 @@ func TestServer_CreateRecord(t *testing.T) {
 	}
 }
 
-func TestServer_DeleteRecord(t *testing.T) {
+func TestServer_Logout(t *testing.T) {
 	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
 	auth := mocks.NewAuthenticator(t)
-	handlers := NewServerHandlers(store, auth)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "sessionID"})
 
 	tc := []struct {
 		name  string
@@ -259,24 +744,31 @@ func TestServer_DeleteRecord(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Delete record with valid context",
+			"Logout user",
 			func() {
-				store.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(nil).Once()
-				auth.On("ValidateToken", entity.AuthToken("token")).Return(entity.UserID("userID"), nil).Once()
+				store.On("RevokeSession", ctx, "sessionID").Return(nil).Once()
+				store.On("DeleteSessionTokens", ctx, "sessionID").Return(nil).Once()
+				auth.On("RevokeSession", "sessionID").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "sessionID")).Return(nil).Once()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "authToken", entity.AuthToken("token"))
-				err := handlers.DeleteRecord(ctx, "recordID")
-				assert.NoError(t, err)
+				assert.NoError(t, handlers.Logout(ctx))
 			},
 		},
 		{
-			"Create record with not valid context",
+			"Logout user, but storage will return error",
+			func() {
+				store.On("RevokeSession", ctx, "sessionID").Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUnknown, handlers.Logout(ctx))
+			},
+		},
+		{
+			"Logout without user",
 			func() {},
 			func() {
-				ctx := context.Background()
-				err := handlers.DeleteRecord(ctx, "recordID")
-				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Equal(t, storage.ErrUserUnauthorized, handlers.Logout(context.Background()))
 			},
 		},
 	}
@@ -290,3 +782,1456 @@ func TestServer_DeleteRecord(t *testing.T) {
 		auth.AssertExpectations(t)
 	}
 }
+
+func TestServer_CheckSession(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "sessionID"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Check active session",
+			func() {
+				store.On("TouchSession", ctx, "sessionID").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.CheckSession(ctx))
+			},
+		},
+		{
+			"Check revoked session",
+			func() {
+				store.On("TouchSession", ctx, "sessionID").Return(storage.ErrUserUnauthorized).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUserUnauthorized, handlers.CheckSession(ctx))
+			},
+		},
+		{
+			"Check principal without session",
+			func() {},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				assert.NoError(t, handlers.CheckSession(ctx))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+	}
+}
+
+func TestServer_ListSessions(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"List sessions",
+			func() {
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}, {ID: "other"}}, nil).Once()
+			},
+			func() {
+				sessions, err := handlers.ListSessions(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.SessionInfo{{ID: "current", Current: true}, {ID: "other"}}, sessions)
+			},
+		},
+		{
+			"List sessions, but storage will return error",
+			func() {
+				store.On("ListSessions", ctx).Return(nil, storage.ErrUnknown).Once()
+			},
+			func() {
+				_, err := handlers.ListSessions(ctx)
+				assert.Equal(t, storage.ErrUnknown, err)
+			},
+		},
+		{
+			"List sessions without user",
+			func() {},
+			func() {
+				_, err := handlers.ListSessions(context.Background())
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+	}
+}
+
+func TestServer_RevokeSession(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Revoke other session",
+			func() {
+				store.On("RevokeSession", ctx, "lost").Return(nil).Once()
+				auth.On("RevokeSession", "lost").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "lost")).Return(nil).Once()
+				store.On("DeleteSessionTokens", ctx, "lost").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.RevokeSession(ctx, "lost"))
+			},
+		},
+		{
+			"Revoke not existing session",
+			func() {
+				store.On("RevokeSession", ctx, "unknown").Return(storage.ErrNotFound).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrNotFound, handlers.RevokeSession(ctx, "unknown"))
+			},
+		},
+		{
+			"Revoke session with empty ID",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.RevokeSession(ctx, ""))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_ChangePassword(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
+
+	credentials := entity.UserCredentials{Login: "admin", Password: "password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Change password, other sessions are revoked",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("UpdatePassword", mock.Anything, mock.MatchedBy(func(password entity.StoredPassword) bool {
+					ok, _, _ := verifyPassword(context.Background(), password, entity.UserCredentials{Login: "admin", Password: "new password"})
+					return password.UserID == "userID" && ok
+				})).Return(nil).Once()
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}, {ID: "other"}}, nil).Once()
+				store.On("RevokeSession", ctx, "other").Return(nil).Once()
+				auth.On("RevokeSession", "other").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "other")).Return(nil).Once()
+				store.On("DeleteSessionTokens", ctx, "other").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.ChangePassword(ctx, credentials, "new password"))
+			},
+		},
+		{
+			"Change password with wrong current password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+			},
+			func() {
+				err := handlers.ChangePassword(ctx, entity.UserCredentials{Login: "admin", Password: "wrong"}, "new password")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Change password of other user",
+			func() {
+				other := stored
+				other.UserID = "otherUserID"
+				store.On("GetPassword", mock.Anything, "other").Return(other, nil).Once()
+			},
+			func() {
+				err := handlers.ChangePassword(ctx, entity.UserCredentials{Login: "other", Password: "password"}, "new password")
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Change password to empty one",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.ChangePassword(ctx, credentials, ""))
+			},
+		},
+		{
+			"Change password without authentication",
+			func() {},
+			func() {
+				err := handlers.ChangePassword(context.Background(), credentials, "new password")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+// proveSRP makes SRP handshake with password and returns proof for operation, which requires password.
+func proveSRP(t *testing.T, handlers *Server, login, password string) entity.SRPProof {
+	client, err := srp.NewClient(login, password)
+	assert.NoError(t, err)
+
+	challenge, err := handlers.StartLoginSRP(context.Background(), login, client.PublicKey(), entity.Device{})
+	assert.NoError(t, err)
+
+	proof, err := client.Proof(challenge.Salt, challenge.ServerPublicKey)
+	assert.NoError(t, err)
+
+	return entity.SRPProof{LoginID: challenge.LoginID, ClientProof: proof}
+}
+
+func TestServer_ChangePasswordSRP(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	salt, verifier, err := srp.NewVerifier("admin", "password")
+	assert.NoError(t, err)
+	stored := encodeSRPVerifier(entity.SRPVerifier{Salt: salt, Verifier: verifier})
+	stored.UserID = "userID"
+
+	newVerifier := entity.SRPVerifier{Salt: []byte("new salt"), Verifier: []byte("new verifier")}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Change password, other sessions are revoked",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("UpdatePassword", mock.Anything, entity.StoredPassword{
+					UserID:    "userID",
+					Hash:      encodeSRPVerifier(newVerifier).Hash,
+					Algorithm: entity.PasswordSRP6a,
+				}).Return(nil).Once()
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}, {ID: "other"}}, nil).Once()
+				store.On("RevokeSession", ctx, "other").Return(nil).Once()
+				auth.On("RevokeSession", "other").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "other")).Return(nil).Once()
+				store.On("DeleteSessionTokens", ctx, "other").Return(nil).Once()
+			},
+			func() {
+				proof := proveSRP(t, handlers, "admin", "password")
+				assert.NoError(t, handlers.ChangePasswordSRP(ctx, proof, newVerifier))
+
+				err := handlers.ChangePasswordSRP(ctx, proof, newVerifier)
+				assert.Equal(t, storage.ErrWrongCredentials, err, "proof can be used only once")
+			},
+		},
+		{
+			"Change password with wrong current password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+			},
+			func() {
+				err := handlers.ChangePasswordSRP(ctx, proveSRP(t, handlers, "admin", "wrong"), newVerifier)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Change password of other user",
+			func() {
+				other := stored
+				other.UserID = "otherUserID"
+				store.On("GetPassword", mock.Anything, "admin").Return(other, nil).Once()
+			},
+			func() {
+				err := handlers.ChangePasswordSRP(ctx, proveSRP(t, handlers, "admin", "password"), newVerifier)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Change password of user, which has password hash instead of verifier",
+			func() {
+				legacy, err := hashPassword(context.Background(), "password")
+				assert.NoError(t, err)
+				legacy.UserID = "userID"
+				store.On("GetPassword", mock.Anything, "admin").Return(legacy, nil).Once()
+			},
+			func() {
+				err := handlers.ChangePasswordSRP(ctx, proveSRP(t, handlers, "admin", "password"), newVerifier)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Change password without new verifier",
+			func() {},
+			func() {
+				err := handlers.ChangePasswordSRP(ctx, entity.SRPProof{LoginID: "id", ClientProof: []byte("proof")}, entity.SRPVerifier{})
+				assert.Equal(t, ErrFieldIsEmpty, err)
+			},
+		},
+		{
+			"Change password without proof",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.ChangePasswordSRP(ctx, entity.SRPProof{}, newVerifier))
+			},
+		},
+		{
+			"Change password without authentication",
+			func() {},
+			func() {
+				err := handlers.ChangePasswordSRP(context.Background(), entity.SRPProof{}, newVerifier)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_DeleteAccount(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
+
+	credentials := entity.UserCredentials{Login: "admin", Password: "password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete account, files are deleted and sessions are revoked",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}, {ID: "other"}}, nil).Once()
+				store.On("DeleteUser", ctx, mock.Anything).Run(func(args mock.Arguments) {
+					deleteFiles := args.Get(1).(func([]string) error)
+					assert.NoError(t, deleteFiles([]string{"file"}))
+				}).Return(nil).Once()
+				files.On("DeleteFiles", ctx, []string{"file"}).Return(nil).Once()
+				auth.On("RevokeSession", "current").Once()
+				auth.On("RevokeSession", "other").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "")).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.DeleteAccount(ctx, credentials))
+			},
+		},
+		{
+			"Delete account, but user wasn't deleted",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}}, nil).Once()
+				store.On("DeleteUser", ctx, mock.Anything).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrUnknown, handlers.DeleteAccount(ctx, credentials))
+			},
+		},
+		{
+			"Delete account with wrong password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+			},
+			func() {
+				err := handlers.DeleteAccount(ctx, entity.UserCredentials{Login: "admin", Password: "wrong"})
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Delete account of other user",
+			func() {
+				other := stored
+				other.UserID = "otherUserID"
+				store.On("GetPassword", mock.Anything, "other").Return(other, nil).Once()
+			},
+			func() {
+				err := handlers.DeleteAccount(ctx, entity.UserCredentials{Login: "other", Password: "password"})
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Delete account with empty password",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DeleteAccount(ctx, entity.UserCredentials{Login: "admin"}))
+			},
+		},
+		{
+			"Delete account without authentication",
+			func() {},
+			func() {
+				err := handlers.DeleteAccount(context.Background(), credentials)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		files.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_DeleteAccountSRP(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current"})
+
+	salt, verifier, err := srp.NewVerifier("admin", "password")
+	assert.NoError(t, err)
+	stored := encodeSRPVerifier(entity.SRPVerifier{Salt: salt, Verifier: verifier})
+	stored.UserID = "userID"
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete account, files are deleted and sessions are revoked",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("ListSessions", ctx).Return([]entity.SessionInfo{{ID: "current"}, {ID: "other"}}, nil).Once()
+				store.On("DeleteUser", ctx, mock.Anything).Run(func(args mock.Arguments) {
+					deleteFiles := args.Get(1).(func([]string) error)
+					assert.NoError(t, deleteFiles([]string{"file"}))
+				}).Return(nil).Once()
+				files.On("DeleteFiles", ctx, []string{"file"}).Return(nil).Once()
+				auth.On("RevokeSession", "current").Once()
+				auth.On("RevokeSession", "other").Once()
+				broker.On("Publish", mock.Anything, sessionRevokedEvent("userID", "")).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.DeleteAccountSRP(ctx, proveSRP(t, handlers, "admin", "password")))
+			},
+		},
+		{
+			"Delete account with wrong password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+			},
+			func() {
+				err := handlers.DeleteAccountSRP(ctx, proveSRP(t, handlers, "admin", "wrong"))
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Delete account of other user",
+			func() {
+				other := stored
+				other.UserID = "otherUserID"
+				store.On("GetPassword", mock.Anything, "admin").Return(other, nil).Once()
+			},
+			func() {
+				err := handlers.DeleteAccountSRP(ctx, proveSRP(t, handlers, "admin", "password"))
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Delete account without proof",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DeleteAccountSRP(ctx, entity.SRPProof{}))
+			},
+		},
+		{
+			"Delete account without authentication",
+			func() {},
+			func() {
+				err := handlers.DeleteAccountSRP(context.Background(), entity.SRPProof{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		files.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_TOTP(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current", Scopes: []string{entity.ScopeRecords}})
+	totpCtx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", Scopes: []string{entity.ScopeTOTP}})
+	device := entity.Device{Name: "laptop"}
+
+	secret, err := totp.GenerateSecret()
+	assert.NoError(t, err)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	assert.NoError(t, err)
+
+	confirmed := entity.TOTP{UserID: "userID", Secret: secret, Confirmed: true}
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
+
+	credentials := entity.UserCredentials{Login: "admin", Password: "password"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Enable TOTP",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+				store.On("SaveTOTP", mock.Anything, mock.MatchedBy(func(secret entity.TOTP) bool {
+					return secret.UserID == "userID" && len(secret.Secret) == 32 && !secret.Confirmed
+				}), mock.MatchedBy(func(hashes []string) bool {
+					return len(hashes) == backupCodesCount
+				})).Return(nil).Once()
+			},
+			func() {
+				enrollment, err := handlers.EnableTOTP(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, enrollment.Secret, 32)
+				assert.Len(t, enrollment.BackupCodes, backupCodesCount)
+			},
+		},
+		{
+			"Enable TOTP, which is already enabled",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+			},
+			func() {
+				_, err := handlers.EnableTOTP(ctx)
+				assert.Equal(t, ErrTOTPEnabled, err)
+			},
+		},
+		{
+			"Confirm TOTP",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{UserID: "userID", Secret: secret}, nil).Once()
+				store.On("UseTOTPStep", mock.Anything, entity.UserID("userID"), step).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.ConfirmTOTP(ctx, code))
+			},
+		},
+		{
+			"Confirm TOTP with wrong code",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{UserID: "userID", Secret: secret}, nil).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, handlers.ConfirmTOTP(ctx, "000000x"))
+			},
+		},
+		{
+			"Confirm TOTP, which wasn't enabled",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{}, storage.ErrNotFound).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrNotFound, handlers.ConfirmTOTP(ctx, code))
+			},
+		},
+		{
+			"Finish login by TOTP code",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+				store.On("UseTOTPStep", mock.Anything, entity.UserID("userID"), step).Return(nil).Once()
+				store.On("CreateSession", mock.Anything, mock.Anything).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
+			},
+			func() {
+				session, err := handlers.VerifyTOTP(totpCtx, code, device)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.AuthToken("token"), session.AccessToken)
+				assert.False(t, session.TOTPRequired)
+			},
+		},
+		{
+			"Finish login by replayed TOTP code",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+				store.On("UseTOTPStep", mock.Anything, entity.UserID("userID"), step).Return(storage.ErrWrongCredentials).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", storage.ErrWrongCredentials.Error())).Return(nil).Once()
+			},
+			func() {
+				_, err := handlers.VerifyTOTP(totpCtx, code, device)
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Finish login by backup code",
+			func() {
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+				store.On("UseBackupCode", mock.Anything, entity.UserID("userID"), hashBackupCode("abcdefgh")).Return(nil).Once()
+				store.On("CreateSession", mock.Anything, mock.Anything).Return(nil).Once()
+				auth.On("CreateToken", newSessionPrincipal("userID")).Return(entity.AuthToken("token"), nil).Once()
+				store.On("SaveRefreshToken", mock.Anything, refreshTokenOf("userID")).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditLogin, "", entity.AuditResultSuccess)).Return(nil).Once()
+			},
+			func() {
+				_, err := handlers.VerifyTOTP(totpCtx, "ABCD-EFGH", device)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Finish login with token of full session",
+			func() {},
+			func() {
+				_, err := handlers.VerifyTOTP(ctx, code, device)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Disable TOTP",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+				store.On("UseTOTPStep", mock.Anything, entity.UserID("userID"), step).Return(nil).Once()
+				store.On("DeleteTOTP", mock.Anything, entity.UserID("userID")).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, handlers.DisableTOTP(ctx, code, credentials, entity.SRPProof{}))
+			},
+		},
+		{
+			"Disable TOTP of SRP user",
+			func() {
+				salt, verifier, err := srp.NewVerifier("admin", "password")
+				assert.NoError(t, err)
+				srpStored := encodeSRPVerifier(entity.SRPVerifier{Salt: salt, Verifier: verifier})
+				srpStored.UserID = "userID"
+
+				store.On("GetPassword", mock.Anything, "admin").Return(srpStored, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+				store.On("UseBackupCode", mock.Anything, entity.UserID("userID"), hashBackupCode("abcdefgh")).Return(nil).Once()
+				store.On("DeleteTOTP", mock.Anything, entity.UserID("userID")).Return(nil).Once()
+			},
+			func() {
+				proof := proveSRP(t, handlers, "admin", "password")
+				assert.NoError(t, handlers.DisableTOTP(ctx, "abcdefgh", entity.UserCredentials{}, proof))
+			},
+		},
+		{
+			"Disable TOTP with wrong code",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+				store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(confirmed, nil).Once()
+			},
+			func() {
+				assert.Equal(t, storage.ErrWrongCredentials, handlers.DisableTOTP(ctx, "12", credentials, entity.SRPProof{}))
+			},
+		},
+		{
+			"Disable TOTP with wrong password",
+			func() {
+				store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+			},
+			func() {
+				err := handlers.DisableTOTP(ctx, code, entity.UserCredentials{Login: "admin", Password: "wrong"}, entity.SRPProof{})
+				assert.Equal(t, storage.ErrWrongCredentials, err)
+			},
+		},
+		{
+			"Disable TOTP without password",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DisableTOTP(ctx, code, entity.UserCredentials{Login: "admin"}, entity.SRPProof{}))
+			},
+		},
+		{
+			"Disable TOTP with empty code",
+			func() {},
+			func() {
+				assert.Equal(t, ErrFieldIsEmpty, handlers.DisableTOTP(ctx, "", credentials, entity.SRPProof{}))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_TOTPLockout(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+	handlers.Limiter = ratelimit.NewMemoryLimiter(ratelimit.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Minute, Window: time.Hour})
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "current", Scopes: []string{entity.ScopeRecords}})
+
+	secret, err := totp.GenerateSecret()
+	assert.NoError(t, err)
+
+	stored, err := hashPassword(context.Background(), "password")
+	assert.NoError(t, err)
+	stored.UserID = "userID"
+
+	store.On("GetTOTP", mock.Anything, entity.UserID("userID")).Return(entity.TOTP{UserID: "userID", Secret: secret}, nil).Twice()
+
+	assert.Equal(t, storage.ErrWrongCredentials, handlers.ConfirmTOTP(ctx, "000000x"))
+	assert.Equal(t, storage.ErrWrongCredentials, handlers.ConfirmTOTP(ctx, "000000x"))
+
+	var lockout *LockoutError
+	assert.ErrorAs(t, handlers.ConfirmTOTP(ctx, "000000x"), &lockout)
+
+	store.On("GetPassword", mock.Anything, "admin").Return(stored, nil).Once()
+
+	err = handlers.DisableTOTP(ctx, "000000x", entity.UserCredentials{Login: "admin", Password: "password"}, entity.SRPProof{})
+	assert.ErrorAs(t, err, &lockout, "disable shares lockout with confirm")
+
+	store.AssertExpectations(t)
+}
+
+func TestServer_GetRecordsInfo(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get all records with valid context",
+			func() {
+				store.On("GetRecordsInfo", mock.AnythingOfType("*context.valueCtx"), entity.RecordsQuery{PageSize: 10}).Return(entity.RecordsPage{}, nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				_, err := handlers.GetRecordsInfo(ctx, entity.RecordsQuery{PageSize: 10})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Get all records with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				_, err := handlers.GetRecordsInfo(ctx, entity.RecordsQuery{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_GetChanges(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get changes with valid context",
+			func() {
+				store.On("GetChanges", mock.AnythingOfType("*context.valueCtx"), int64(2)).Return(entity.Changes{Revision: 4}, nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				changes, err := handlers.GetChanges(ctx, 2)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), changes.Revision)
+			},
+		},
+		{
+			"Get changes with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				_, err := handlers.GetChanges(ctx, 2)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_GetRecord(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get record with valid context",
+			func() {
+				store.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(entity.Record{}, nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditGetRecord, "recordID", entity.AuditResultSuccess)).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				_, err := handlers.GetRecord(ctx, "recordID")
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Get not existing record, failure is audited, but audit log is broken",
+			func() {
+				store.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(entity.Record{}, storage.ErrNotFound).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditGetRecord, "recordID", storage.ErrNotFound.Error())).Return(storage.ErrUnknown).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				_, err := handlers.GetRecord(ctx, "recordID")
+				assert.Equal(t, storage.ErrNotFound, err)
+			},
+		},
+		{
+			"Get record with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				_, err := handlers.GetRecord(ctx, "recordID")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_ListAuditEvents(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+	query := entity.AuditQuery{From: time.Unix(1683000000, 0), Limit: 10}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"List audit events",
+			func() {
+				store.On("ListAuditEvents", ctx, query).Return([]entity.AuditEvent{{UserID: "userID", Action: entity.AuditLogin}}, nil).Once()
+			},
+			func() {
+				events, err := handlers.ListAuditEvents(ctx, query)
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.AuditEvent{{UserID: "userID", Action: entity.AuditLogin}}, events)
+			},
+		},
+		{
+			"List audit events without authentication",
+			func() {},
+			func() {
+				_, err := handlers.ListAuditEvents(context.Background(), query)
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+	}
+}
+
+func TestServer_CreateRecord(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Create record with valid context",
+			func() {
+				store.On("CreateRecord", mock.AnythingOfType("*context.valueCtx"), mock.AnythingOfType("entity.Record")).Return("", nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditCreateRecord, "", entity.AuditResultSuccess)).Return(nil).Once()
+				broker.On("Publish", mock.AnythingOfType("*context.valueCtx"), entity.RecordEvent{UserID: "userID", Type: entity.EventCreated}).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				err := handlers.CreateRecord(ctx, entity.Record{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Create record with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				_, err := handlers.GetRecord(ctx, "recordID")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_UpdateRecord(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Update record with valid context",
+			func() {
+				store.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{ID: "recordID", Revision: 1}).Return(int64(2), nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditUpdateRecord, "recordID", entity.AuditResultSuccess)).Return(nil).Once()
+				broker.On("Publish", mock.AnythingOfType("*context.valueCtx"), entity.RecordEvent{UserID: "userID", Type: entity.EventUpdated, RecordID: "recordID"}).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				revision, err := handlers.UpdateRecord(ctx, entity.Record{ID: "recordID", Revision: 1})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+			},
+		},
+		{
+			"Update record, but revision was changed",
+			func() {
+				store.On("UpdateRecord", mock.AnythingOfType("*context.valueCtx"), entity.Record{ID: "recordID", Revision: 1}).Return(int64(0), storage.ErrRevisionConflict).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditUpdateRecord, "recordID", storage.ErrRevisionConflict.Error())).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				_, err := handlers.UpdateRecord(ctx, entity.Record{ID: "recordID", Revision: 1})
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+			},
+		},
+		{
+			"Update record without ID",
+			func() {
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				_, err := handlers.UpdateRecord(ctx, entity.Record{})
+				assert.Equal(t, ErrFieldIsEmpty, err)
+			},
+		},
+		{
+			"Update record with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				_, err := handlers.UpdateRecord(ctx, entity.Record{ID: "recordID"})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_UploadFile(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Upload file with valid context",
+			func() {
+				files.On("UploadFile", mock.AnythingOfType("*context.valueCtx"), entity.Record{Type: entity.TypeFile}, mock.Anything).Return("recordID", nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditCreateRecord, "recordID", entity.AuditResultSuccess)).Return(nil).Once()
+				broker.On("Publish", mock.AnythingOfType("*context.valueCtx"), entity.RecordEvent{UserID: "userID", Type: entity.EventCreated, RecordID: "recordID"}).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				recordID, err := handlers.UploadFile(ctx, entity.Record{Type: entity.TypeFile}, strings.NewReader("data"))
+				assert.NoError(t, err)
+				assert.Equal(t, "recordID", recordID)
+			},
+		},
+		{
+			"Upload file with not valid context",
+			func() {},
+			func() {
+				_, err := handlers.UploadFile(context.Background(), entity.Record{Type: entity.TypeFile}, strings.NewReader("data"))
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		files.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_ReplaceRecords(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+
+	// batch returns records one by one.
+	batch := func(records ...entity.Record) func() (entity.Record, io.Reader, error) {
+		return func() (entity.Record, io.Reader, error) {
+			if len(records) == 0 {
+				return entity.Record{}, nil, io.EOF
+			}
+			record := records[0]
+			records = records[1:]
+			return record, nil, nil
+		}
+	}
+
+	// readAll reads all records from next, like storage does.
+	readAll := func(args mock.Arguments) {
+		next := args.Get(1).(func() (entity.Record, io.Reader, error))
+		for {
+			_, _, err := next()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Replace records, watchers are notified",
+			func() {
+				files.On("ReplaceAllRecords", ctx, mock.Anything).Run(readAll).Return(int64(7), nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditUpdateRecord, "1", entity.AuditResultSuccess)).Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditUpdateRecord, "2", entity.AuditResultSuccess)).Return(nil).Once()
+				broker.On("Publish", ctx, entity.RecordEvent{UserID: "userID", Type: entity.EventUpdated, RecordID: "1"}).Return(nil).Once()
+				broker.On("Publish", ctx, entity.RecordEvent{UserID: "userID", Type: entity.EventUpdated, RecordID: "2"}).Return(nil).Once()
+			},
+			func() {
+				revision, err := handlers.ReplaceRecords(ctx, batch(entity.Record{ID: "1"}, entity.Record{ID: "2"}))
+				assert.NoError(t, err)
+				assert.Equal(t, int64(7), revision)
+			},
+		},
+		{
+			"Replace records, but records were changed",
+			func() {
+				files.On("ReplaceAllRecords", ctx, mock.Anything).Run(readAll).Return(int64(0), storage.ErrRevisionConflict).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditUpdateRecord, "1", storage.ErrRevisionConflict.Error())).Return(nil).Once()
+			},
+			func() {
+				_, err := handlers.ReplaceRecords(ctx, batch(entity.Record{ID: "1"}))
+				assert.Equal(t, storage.ErrRevisionConflict, err)
+			},
+		},
+		{
+			"Replace records with not valid context",
+			func() {},
+			func() {
+				_, err := handlers.ReplaceRecords(context.Background(), batch())
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		files.AssertExpectations(t)
+		broker.AssertExpectations(t)
+	}
+}
+
+func TestServer_DownloadFile(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Download file with valid context",
+			func() {
+				files.On("DownloadFile", mock.AnythingOfType("*context.valueCtx"), "recordID", mock.Anything).Return(int64(4), nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditGetRecord, "recordID", entity.AuditResultSuccess)).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				err := handlers.DownloadFile(ctx, "recordID", &bytes.Buffer{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Download file with not valid context",
+			func() {},
+			func() {
+				err := handlers.DownloadFile(context.Background(), "recordID", &bytes.Buffer{})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		files.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_DeleteRecord(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete record with valid context",
+			func() {
+				store.On("DeleteRecord", mock.AnythingOfType("*context.valueCtx"), "recordID").Return(nil).Once()
+				store.On("SaveAuditEvent", mock.Anything, auditEventOf("userID", entity.AuditDeleteRecord, "recordID", entity.AuditResultSuccess)).Return(nil).Once()
+				broker.On("Publish", mock.AnythingOfType("*context.valueCtx"), entity.RecordEvent{UserID: "userID", Type: entity.EventDeleted, RecordID: "recordID"}).Return(nil).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				err := handlers.DeleteRecord(ctx, "recordID")
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Create record with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				err := handlers.DeleteRecord(ctx, "recordID")
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		store.AssertExpectations(t)
+		auth.AssertExpectations(t)
+	}
+}
+
+func TestServer_WatchRecords(t *testing.T) {
+	store := storagemocks.NewStorager(t)
+	files := storagemocks.NewFileStreamer(t)
+	auth := mocks.NewAuthenticator(t)
+	broker := eventsmocks.NewBroker(t)
+	handlers := NewServerHandlers(store, files, auth, broker)
+
+	event := entity.RecordEvent{UserID: "userID", Type: entity.EventUpdated, RecordID: "recordID"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Watch records with valid context",
+			func() {
+				recordEvents := make(chan entity.RecordEvent, 1)
+				recordEvents <- event
+				close(recordEvents)
+
+				broker.On("Subscribe", entity.UserID("userID")).Return((<-chan entity.RecordEvent)(recordEvents), func() {}).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				got := make([]entity.RecordEvent, 0)
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					got = append(got, event)
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.RecordEvent{event}, got)
+			},
+		},
+		{
+			"Watch records until context is done",
+			func() {
+				broker.On("Subscribe", entity.UserID("userID")).Return((<-chan entity.RecordEvent)(make(chan entity.RecordEvent)), func() {}).Once()
+			},
+			func() {
+				ctx, cancel := context.WithCancel(entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"}))
+				cancel()
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					return nil
+				})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Watch records until session is revoked, other session doesn't stop it",
+			func() {
+				recordEvents := make(chan entity.RecordEvent, 3)
+				recordEvents <- sessionRevokedEvent("userID", "other")
+				recordEvents <- event
+				recordEvents <- sessionRevokedEvent("userID", "sessionID")
+
+				broker.On("Subscribe", entity.UserID("userID")).Return((<-chan entity.RecordEvent)(recordEvents), func() {}).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", SessionID: "sessionID"})
+				got := make([]entity.RecordEvent, 0)
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					got = append(got, event)
+					return nil
+				})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+				assert.Equal(t, []entity.RecordEvent{event}, got)
+			},
+		},
+		{
+			"Watch records until all sessions of user are revoked",
+			func() {
+				recordEvents := make(chan entity.RecordEvent, 1)
+				recordEvents <- sessionRevokedEvent("userID", "")
+
+				broker.On("Subscribe", entity.UserID("userID")).Return((<-chan entity.RecordEvent)(recordEvents), func() {}).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					return nil
+				})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Watch records until access token expires",
+			func() {
+				broker.On("Subscribe", entity.UserID("userID")).Return((<-chan entity.RecordEvent)(make(chan entity.RecordEvent)), func() {}).Once()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID", ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					return nil
+				})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Watch records with not valid context",
+			func() {},
+			func() {
+				ctx := context.Background()
+				err := handlers.WatchRecords(ctx, func(event entity.RecordEvent) error {
+					return nil
+				})
+				assert.Equal(t, storage.ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+
+		auth.AssertExpectations(t)
+		broker.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/storage"
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+)
+
+// fileChunkSize is size of plain file part, which is sealed separately.
+const fileChunkSize = 64 * 1024
+
+// Encrypted file is a sequence of sealed chunks: nonce, then encrypted chunk with tag.
+// Chunk index and last chunk flag are authenticated, so chunks can't be reordered or cut off.
+
+// chunkAdditionalData returns authenticated data for chunk.
+func chunkAdditionalData(index uint64, last bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if last {
+		ad[8] = 1
+	}
+	return ad
+}
+
+// encryptReader encrypts plain data from source chunk by chunk.
+type encryptReader struct {
+	aead  cipher.AEAD
+	src   *bufio.Reader
+	plain []byte
+	out   []byte
+	index uint64
+	done  bool
+}
+
+// newEncryptReader returns reader, which gives encrypted data of source.
+func newEncryptReader(aead cipher.AEAD, src io.Reader) *encryptReader {
+	return &encryptReader{
+		aead:  aead,
+		src:   bufio.NewReaderSize(src, fileChunkSize),
+		plain: make([]byte, fileChunkSize),
+	}
+}
+
+// Read implementation of io.Reader interface.
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		err := r.sealNext()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealNext reads next plain chunk and seals it.
+func (r *encryptReader) sealNext() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	last := n < fileChunkSize
+	if !last {
+		_, err = r.src.Peek(1)
+		last = errors.Is(err, io.EOF)
+		if err != nil && !last {
+			return err
+		}
+	}
+
+	nonce, err := generateRandom(r.aead.NonceSize())
+	if err != nil {
+		return storage.ErrUnknown
+	}
+
+	r.out = r.aead.Seal(nonce, nonce, r.plain[:n], chunkAdditionalData(r.index, last))
+	r.index++
+	r.done = last
+	return nil
+}
+
+// decryptWriter decrypts data written to it and writes plain data to destination.
+// Close should be called after all data was written, it decrypts last chunk.
+type decryptWriter struct {
+	aead  cipher.AEAD
+	dst   io.Writer
+	buf   []byte
+	index uint64
+	// legacy is used for files, which were sealed as single blob before chunked format.
+	legacy func([]byte) ([]byte, error)
+	isOld  bool
+	// fallbacks are tried for first chunk, if it isn't opened by aead. The one, which opens it, is used for others.
+	fallbacks []cipher.AEAD
+}
+
+// newDecryptWriter returns writer, which decrypts data to destination. File can be sealed by aead or one of fallbacks.
+func newDecryptWriter(aead cipher.AEAD, dst io.Writer, legacy func([]byte) ([]byte, error), fallbacks ...cipher.AEAD) *decryptWriter {
+	return &decryptWriter{aead: aead, dst: dst, legacy: legacy, fallbacks: fallbacks}
+}
+
+// sealedChunkSize returns size of encrypted full chunk.
+func (w *decryptWriter) sealedChunkSize() int {
+	return w.aead.NonceSize() + fileChunkSize + w.aead.Overhead()
+}
+
+// Write implementation of io.Writer interface.
+func (w *decryptWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	// Chunk isn't last while there is data after it, last chunk is opened by Close.
+	for !w.isOld && len(w.buf) > w.sealedChunkSize() {
+		err := w.openNext(w.buf[:w.sealedChunkSize()], false)
+		if err != nil && w.index == 0 && w.legacy != nil {
+			w.isOld = true
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		w.buf = append(w.buf[:0], w.buf[w.sealedChunkSize():]...)
+	}
+
+	return len(p), nil
+}
+
+// Close decrypts last chunk.
+func (w *decryptWriter) Close() error {
+	if !w.isOld {
+		err := w.openNext(w.buf, true)
+		if err == nil || w.index != 0 || w.legacy == nil {
+			return err
+		}
+	}
+
+	plain, err := w.legacy(w.buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dst.Write(plain)
+	if err != nil {
+		return storage.ErrUnknown
+	}
+
+	return nil
+}
+
+// sealedBy checks, that file, which failed to open, is sealed by aead in chunked format. Its first chunk
+// is kept in buffer after failure, it isn't written to destination.
+func (w *decryptWriter) sealedBy(aead cipher.AEAD) bool {
+	if w.index != 0 || len(w.buf) < aead.NonceSize()+aead.Overhead() {
+		return false
+	}
+
+	chunk, last := w.buf, true
+	if len(w.buf) > w.sealedChunkSize() {
+		chunk, last = w.buf[:w.sealedChunkSize()], false
+	}
+
+	nonce := chunk[:aead.NonceSize()]
+	_, err := aead.Open(nil, nonce, chunk[aead.NonceSize():], chunkAdditionalData(0, last))
+	return err == nil
+}
+
+// openNext opens one sealed chunk and writes it to destination.
+func (w *decryptWriter) openNext(chunk []byte, last bool) error {
+	if len(chunk) < w.aead.NonceSize()+w.aead.Overhead() {
+		return storage.ErrUnknown
+	}
+
+	nonce := chunk[:w.aead.NonceSize()]
+
+	plain, err := w.aead.Open(nil, nonce, chunk[w.aead.NonceSize():], chunkAdditionalData(w.index, last))
+	for i := 0; err != nil && w.index == 0 && i < len(w.fallbacks); i++ {
+		plain, err = w.fallbacks[i].Open(nil, nonce, chunk[w.aead.NonceSize():], chunkAdditionalData(w.index, last))
+		if err == nil {
+			w.aead = w.fallbacks[i]
+		}
+	}
+
+	if err != nil {
+		return storage.ErrUnknown
+	}
+
+	_, err = w.dst.Write(plain)
+	if err != nil {
+		return storage.ErrUnknown
+	}
+
+	w.index++
+	return nil
+}
+
+// chunkReader reads data from stream of chunks.
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+// Read implementation of io.Reader interface.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// chunkWriter writes data as stream of chunks, which are not bigger than fileChunkSize.
+type chunkWriter struct {
+	send func([]byte) error
+}
+
+// Write implementation of io.Writer interface.
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + fileChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+
+		err := w.send(p[written:end])
+		if err != nil {
+			return written, err
+		}
+
+		written = end
+	}
+
+	return written, nil
+}
+
+// errNoRecordInfo is returned, when batch of records doesn't start with record info.
+var errNoRecordInfo = errors.New("chunk should contain record info")
+
+// recordsBatch reads records from stream of chunks. Info of file record is followed by its data chunks.
+type recordsBatch struct {
+	recv func() (*pb.FileChunk, error)
+	// info is read with data of previous file record, when its data ends.
+	info *pb.Record
+	file *chunkReader
+	done bool
+}
+
+// Next returns next record of batch, data of file record is read from returned reader. Returns io.EOF after last record.
+func (batch *recordsBatch) Next() (entity.Record, io.Reader, error) {
+	// Data of previous file, which wasn't read, is skipped.
+	if batch.file != nil {
+		_, err := io.Copy(io.Discard, batch.file)
+		if err != nil {
+			return entity.Record{}, nil, err
+		}
+		batch.file = nil
+	}
+
+	info := batch.info
+	batch.info = nil
+
+	if info == nil {
+		if batch.done {
+			return entity.Record{}, nil, io.EOF
+		}
+
+		chunk, err := batch.recv()
+		if err != nil {
+			return entity.Record{}, nil, err
+		}
+
+		info = chunk.GetInfo()
+		if info == nil {
+			return entity.Record{}, nil, errNoRecordInfo
+		}
+	}
+
+	record := entity.Record{
+		ID:       info.Id,
+		Metadata: info.Metadata,
+		Type:     entity.RecordType(info.Type),
+		Data:     info.StoredData,
+		Revision: info.Revision,
+	}
+
+	if record.Type != entity.TypeFile {
+		return record, nil, nil
+	}
+
+	batch.file = &chunkReader{recv: batch.recvData}
+	return record, batch.file, nil
+}
+
+// recvData returns next data chunk of current file. Returns io.EOF, when next record or end of stream is reached.
+func (batch *recordsBatch) recvData() ([]byte, error) {
+	if batch.info != nil || batch.done {
+		return nil, io.EOF
+	}
+
+	chunk, err := batch.recv()
+	if errors.Is(err, io.EOF) {
+		batch.done = true
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info := chunk.GetInfo(); info != nil {
+		batch.info = info
+		return nil, io.EOF
+	}
+
+	return chunk.GetData(), nil
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/storage"
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAEAD(t *testing.T) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+	return aead
+}
+
+func TestEncryptReader_DecryptWriter(t *testing.T) {
+	aead := testAEAD(t)
+
+	tc := []struct {
+		name string
+		size int
+	}{
+		{"Empty file", 0},
+		{"Small file", 10},
+		{"File of one chunk", fileChunkSize},
+		{"File bigger than one chunk", fileChunkSize + 1},
+		{"File of several chunks", 3*fileChunkSize + 100},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+
+		plain := bytes.Repeat([]byte("a"), test.size)
+
+		encrypted, err := io.ReadAll(newEncryptReader(aead, bytes.NewReader(plain)))
+		assert.NoError(t, err)
+
+		decrypted := &bytes.Buffer{}
+		w := newDecryptWriter(aead, decrypted, nil)
+
+		// Write with odd size to check chunks are joined back correctly.
+		_, err = io.CopyBuffer(w, bytes.NewReader(encrypted), make([]byte, 1000))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		assert.Equal(t, string(plain), decrypted.String())
+	}
+}
+
+func TestDecryptWriter_Truncated(t *testing.T) {
+	aead := testAEAD(t)
+
+	plain := bytes.Repeat([]byte("a"), 2*fileChunkSize+10)
+	encrypted, err := io.ReadAll(newEncryptReader(aead, bytes.NewReader(plain)))
+	assert.NoError(t, err)
+
+	sealedChunk := aead.NonceSize() + fileChunkSize + aead.Overhead()
+
+	w := newDecryptWriter(aead, io.Discard, nil)
+	_, err = w.Write(encrypted[:2*sealedChunk])
+	assert.NoError(t, err)
+	assert.Equal(t, storage.ErrUnknown, w.Close())
+}
+
+func TestDecryptWriter_Legacy(t *testing.T) {
+	aead := testAEAD(t)
+
+	client := NewClientHandlers(nil)
+	client.masterKey = bytes.Repeat([]byte{1}, 32)
+
+	plain := bytes.Repeat([]byte("b"), fileChunkSize*2)
+	sealed, err := client.encrypt(plain)
+	assert.NoError(t, err)
+
+	decrypted := &bytes.Buffer{}
+	w := newDecryptWriter(aead, decrypted, client.decrypt)
+
+	_, err = w.Write(sealed)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, plain, decrypted.Bytes())
+}
+
+func TestDecryptWriter_Fallback(t *testing.T) {
+	current, err := aeadOf(deriveMasterKey([]byte("current")))
+	assert.NoError(t, err)
+	legacy, err := aeadOf(legacyMasterKey)
+	assert.NoError(t, err)
+
+	plain := bytes.Repeat([]byte("c"), fileChunkSize+10)
+	encrypted, err := io.ReadAll(newEncryptReader(legacy, bytes.NewReader(plain)))
+	assert.NoError(t, err)
+
+	decrypted := &bytes.Buffer{}
+	w := newDecryptWriter(current, decrypted, nil, legacy)
+	_, err = w.Write(encrypted)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, plain, decrypted.Bytes())
+
+	w = newDecryptWriter(current, io.Discard, nil)
+	_, err = w.Write(encrypted)
+	assert.Equal(t, storage.ErrUnknown, err)
+}
+
+func TestChunkReader_ChunkWriter(t *testing.T) {
+	chunks := make([][]byte, 0)
+
+	w := &chunkWriter{send: func(data []byte) error {
+		chunks = append(chunks, append([]byte{}, data...))
+		return nil
+	}}
+
+	data := bytes.Repeat([]byte("c"), fileChunkSize*2+5)
+	n, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Len(t, chunks, 3)
+
+	r := &chunkReader{recv: func() ([]byte, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}}
+
+	read, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+}
+
+func TestRecordsBatch(t *testing.T) {
+	chunks := []*pb.FileChunk{
+		{Payload: &pb.FileChunk_Info{Info: &pb.Record{Id: "1", Type: pb.MessageType_TypeFile, Revision: 2}}},
+		{Payload: &pb.FileChunk_Data{Data: []byte("first ")}},
+		{Payload: &pb.FileChunk_Data{Data: []byte("file")}},
+		{Payload: &pb.FileChunk_Info{Info: &pb.Record{Id: "2", Type: pb.MessageType_TypeFile, Revision: 3}}},
+		{Payload: &pb.FileChunk_Data{Data: []byte("skipped")}},
+		{Payload: &pb.FileChunk_Info{Info: &pb.Record{Id: "3", Type: pb.MessageType_TypeText, StoredData: []byte("text")}}},
+	}
+
+	batch := &recordsBatch{recv: func() (*pb.FileChunk, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}}
+
+	record, r, err := batch.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, entity.Record{ID: "1", Type: entity.TypeFile, Revision: 2}, record)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "first file", string(data))
+
+	// Data of second file isn't read, it's skipped by next call.
+	record, _, err = batch.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", record.ID)
+
+	record, r, err = batch.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, entity.Record{ID: "3", Type: entity.TypeText, Data: []byte("text")}, record)
+	assert.Nil(t, r)
+
+	_, _, err = batch.Next()
+	assert.Equal(t, io.EOF, err)
+
+	chunks = []*pb.FileChunk{{Payload: &pb.FileChunk_Data{Data: []byte("data without info")}}}
+	_, _, err = (&recordsBatch{recv: batch.recv}).Next()
+	assert.Equal(t, errNoRecordInfo, err)
+}
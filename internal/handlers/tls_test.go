@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/size12/gophkeeper/internal/config"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/handlers/mocks"
+	pb "github.com/size12/gophkeeper/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testCertificates are PEM files of CA, server and client certificates.
+type testCertificates struct {
+	caFile, serverCertFile, serverKeyFile, clientCertFile, clientKeyFile string
+	serverPin                                                            string
+}
+
+// writeTestCertificates generates CA, server certificate for localhost and client certificate for login.
+func writeTestCertificates(t *testing.T, clientLogin string) testCertificates {
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gophkeeper test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	writeCert := func(name string, template *x509.Certificate) (string, string, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		assert.NoError(t, err)
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		assert.NoError(t, err)
+
+		certFile := filepath.Join(dir, name+".crt")
+		keyFile := filepath.Join(dir, name+".key")
+		assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+		assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+		return certFile, keyFile, der
+	}
+
+	certs := testCertificates{caFile: filepath.Join(dir, "ca.crt")}
+	assert.NoError(t, os.WriteFile(certs.caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+
+	var serverDER []byte
+	certs.serverCertFile, certs.serverKeyFile, serverDER = writeCert("server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pin := sha256.Sum256(serverDER)
+	certs.serverPin = hex.EncodeToString(pin[:])
+
+	certs.clientCertFile, certs.clientKeyFile, _ = writeCert("client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: clientLogin},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	return certs
+}
+
+func TestNewClientTLSConfig_BadPin(t *testing.T) {
+	_, err := NewClientTLSConfig("", "not hex", "", "")
+	assert.Error(t, err)
+
+	_, err = NewClientTLSConfig("", "abcd", "", "")
+	assert.Error(t, err)
+}
+
+func TestTLSConn(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	certs := writeTestCertificates(t, "login")
+
+	serverTLS, err := NewServerTLSConfig(certs.serverCertFile, certs.serverKeyFile, "")
+	assert.NoError(t, err)
+
+	handlers := mocks.NewServerHandlers(t)
+	server := NewServerConn(handlers, testAuthenticator(t), WithServerTLS(serverTLS))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	handlers.On("GetChanges", mock.Anything, int64(0)).Return(entity.Changes{Revision: 1}, nil)
+
+	wrongPin := make([]byte, sha256.Size)
+
+	tc := []struct {
+		name     string
+		caFile   string
+		pin      string
+		insecure bool
+		code     codes.Code
+	}{
+		{"Connect with CA", certs.caFile, "", false, codes.OK},
+		{"Connect with pinned certificate", "", certs.serverPin, false, codes.OK},
+		{"Connect with CA and pinned certificate", certs.caFile, certs.serverPin, false, codes.OK},
+		{"Connect with wrong pinned certificate", "", hex.EncodeToString(wrongPin), false, codes.Unavailable},
+		{"Connect without TLS", "", "", true, codes.Unavailable},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+
+		var opts []ClientOption
+		if !test.insecure {
+			clientTLS, err := NewClientTLSConfig(test.caFile, test.pin, "", "")
+			assert.NoError(t, err)
+			opts = append(opts, WithClientTLS(clientTLS))
+		}
+
+		client := NewClientConn("localhost"+serverCfg.RunAddress, opts...)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authToken", "token")
+		_, err := client.GophkeeperClient.GetChanges(ctx, &pb.ChangesRequest{})
+		assert.Equal(t, test.code, status.Code(err))
+	}
+}
+
+func TestTLSConn_ClientCertificate(t *testing.T) {
+	serverCfg := config.GetServerConfig()
+	certs := writeTestCertificates(t, "login")
+
+	serverTLS, err := NewServerTLSConfig(certs.serverCertFile, certs.serverKeyFile, certs.caFile)
+	assert.NoError(t, err)
+
+	handlers := mocks.NewServerHandlers(t)
+	users := mocks.NewCertificateUsers(t)
+	server := NewServerConn(handlers, testAuthenticator(t), WithServerTLS(serverTLS), WithCertificateUsers(users))
+	server.Run(context.Background(), serverCfg.RunAddress)
+	defer server.Stop()
+
+	users.On("GetUserID", mock.Anything, "login").Return(entity.UserID("userID"), nil)
+	handlers.On("GetChanges", mock.MatchedBy(func(ctx context.Context) bool {
+		userID, ok := entity.UserIDFromContext(ctx)
+		return ok && userID == "userID"
+	}), int64(0)).Return(entity.Changes{Revision: 1}, nil)
+
+	clientTLS, err := NewClientTLSConfig(certs.caFile, "", certs.clientCertFile, certs.clientKeyFile)
+	assert.NoError(t, err)
+
+	client := NewClientConn("localhost"+serverCfg.RunAddress, WithClientTLS(clientTLS))
+
+	t.Log("Request without token is authenticated by certificate")
+	changes, err := client.GetChanges("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), changes.Revision)
+
+	t.Log("Request without token and certificate is unauthenticated")
+	clientTLS, err = NewClientTLSConfig(certs.caFile, "", "", "")
+	assert.NoError(t, err)
+
+	client = NewClientConn("localhost"+serverCfg.RunAddress, WithClientTLS(clientTLS))
+	_, err = client.GophkeeperClient.GetChanges(context.Background(), &pb.ChangesRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// totpIssuer is name of service, which is shown by authenticator app.
+	totpIssuer = "Gophkeeper"
+	// backupCodesCount is number of backup codes, which are issued with TOTP secret.
+	backupCodesCount = 10
+	// backupCodeLength is length of backup code without separator.
+	backupCodeLength = 8
+)
+
+// backupCodeEncoding is alphabet of backup codes.
+var backupCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateBackupCodes returns random one-time backup codes, which can be used instead of TOTP code.
+func generateBackupCodes() ([]string, error) {
+	codes := make([]string, 0, backupCodesCount)
+
+	for i := 0; i < backupCodesCount; i++ {
+		b, err := generateRandom(backupCodeLength * 5 / 8)
+		if err != nil {
+			return nil, err
+		}
+
+		code := backupCodeEncoding.EncodeToString(b)
+		codes = append(codes, code[:backupCodeLength/2]+"-"+code[backupCodeLength/2:])
+	}
+
+	return codes, nil
+}
+
+// hashBackupCode returns hash of backup code, which is stored instead of code.
+func hashBackupCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeCode removes separators and spaces from code, which user typed.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateBackupCodes(t *testing.T) {
+	codes, err := generateBackupCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, backupCodesCount)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.Len(t, code, backupCodeLength+1)
+		assert.Len(t, normalizeCode(code), backupCodeLength)
+		assert.False(t, seen[code], "backup codes should be random")
+		seen[code] = true
+	}
+}
+
+func TestHashBackupCode(t *testing.T) {
+	assert.Equal(t, hashBackupCode("abcd-efgh"), hashBackupCode("ABCD EFGH"))
+	assert.NotEqual(t, hashBackupCode("abcd-efgh"), hashBackupCode("abcd-efgg"))
+}
@@ -0,0 +1,97 @@
+// Package logging configures structured logging of server. Records get request ID, RPC method and user ID from context.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// RequestIDKey is key of request ID in gRPC metadata and in log records.
+const RequestIDKey = "x-request-id"
+
+// Request is request, which is served by server.
+type Request struct {
+	ID     string
+	Method string
+}
+
+// requestKey is context key of request.
+type requestKey struct{}
+
+// WithRequest returns copy of context, which stores request.
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext gets request from context.
+func RequestFromContext(ctx context.Context) (Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(Request)
+	return request, ok
+}
+
+// userKey is context key of user, who isn't authenticated yet.
+type userKey struct{}
+
+// WithUserID returns copy of context, which stores ID of user for logging.
+// It's used during login, while context doesn't have principal yet.
+func WithUserID(ctx context.Context, userID entity.UserID) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// userIDFromContext gets ID of authenticated user or of user, who logs in.
+func userIDFromContext(ctx context.Context) (entity.UserID, bool) {
+	if userID, ok := entity.UserIDFromContext(ctx); ok {
+		return userID, true
+	}
+
+	userID, ok := ctx.Value(userKey{}).(entity.UserID)
+	return userID, ok && userID != ""
+}
+
+// ContextHandler adds request and user from context to records of wrapped handler.
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler returns handler, which adds request and user from context to records of handler.
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: handler}
+}
+
+// Handle adds request ID, RPC method and user ID to record, if context has them.
+func (handler *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if request, ok := RequestFromContext(ctx); ok {
+		record.AddAttrs(slog.String("request_id", request.ID), slog.String("method", request.Method))
+	}
+
+	if userID, ok := userIDFromContext(ctx); ok {
+		record.AddAttrs(slog.String("user_id", string(userID)))
+	}
+
+	return handler.Handler.Handle(ctx, record)
+}
+
+// WithAttrs returns context handler, which wraps handler with attributes.
+func (handler *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewContextHandler(handler.Handler.WithAttrs(attrs))
+}
+
+// WithGroup returns context handler, which wraps handler with group.
+func (handler *ContextHandler) WithGroup(name string) slog.Handler {
+	return NewContextHandler(handler.Handler.WithGroup(name))
+}
+
+// NewLogger returns logger, which writes JSON records of level and above to w.
+// Level is name of slog level, like "debug" or "warn". Unknown level is error.
+func NewLogger(w io.Writer, level string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	err := minLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, err
+	}
+
+	return slog.New(NewContextHandler(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: minLevel}))), nil
+}
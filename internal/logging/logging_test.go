@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(&buf, "info")
+	assert.NoError(t, err)
+
+	_, err = NewLogger(&buf, "verbose")
+	assert.Error(t, err)
+
+	decode := func() map[string]interface{} {
+		record := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		buf.Reset()
+		return record
+	}
+
+	tc := []struct {
+		name  string
+		valid func()
+	}{
+		{
+			"Log record with request and user",
+			func() {
+				ctx := WithRequest(context.Background(), Request{ID: "requestID", Method: "/gophkeeper.Gophkeeper/GetRecord"})
+				ctx = entity.WithPrincipal(ctx, entity.Principal{UserID: "userID"})
+
+				logger.With("component", "storage").ErrorContext(ctx, "Failed get record", "error", "some DB error")
+
+				record := decode()
+				assert.Equal(t, "ERROR", record["level"])
+				assert.Equal(t, "Failed get record", record["msg"])
+				assert.Equal(t, "some DB error", record["error"])
+				assert.Equal(t, "storage", record["component"])
+				assert.Equal(t, "requestID", record["request_id"])
+				assert.Equal(t, "/gophkeeper.Gophkeeper/GetRecord", record["method"])
+				assert.Equal(t, "userID", record["user_id"])
+			},
+		},
+		{
+			"Log record of user, who logs in",
+			func() {
+				ctx := WithUserID(context.Background(), "userID")
+
+				logger.InfoContext(ctx, "Started session")
+
+				record := decode()
+				assert.Equal(t, "userID", record["user_id"])
+			},
+		},
+		{
+			"Log record without request",
+			func() {
+				logger.Warn("Server runs without TLS")
+
+				record := decode()
+				assert.Equal(t, "WARN", record["level"])
+				assert.NotContains(t, record, "request_id")
+				assert.NotContains(t, record, "user_id")
+			},
+		},
+		{
+			"Skip record below level",
+			func() {
+				logger.DebugContext(context.Background(), "Checked health")
+				assert.Empty(t, buf.String())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.valid()
+	}
+}
@@ -0,0 +1,101 @@
+// Package metrics collects Prometheus metrics of server: RPCs, storage and authentication.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophkeeper"
+
+// Login results.
+const (
+	LoginSuccess      = "success"
+	LoginTOTPRequired = "totp_required"
+	LoginFailure      = "failure"
+	LoginLockedOut    = "locked_out"
+	LoginError        = "error"
+)
+
+// Directions of file storage traffic.
+const (
+	FileRead    = "read"
+	FileWritten = "written"
+)
+
+// Registry keeps all metrics of server. Go runtime and process metrics are included.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RPCDuration is latency of RPCs by method and status code.
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of gRPC methods.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	// RPCRequests is count of finished RPCs by method and status code.
+	RPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Count of finished gRPC methods.",
+	}, []string{"method", "code"})
+
+	// DBQueryDuration is duration of DB storage operations.
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of DB storage operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// FileBytes is count of bytes read from and written to file storage.
+	FileBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "file_storage_bytes_total",
+		Help:      "Bytes read from and written to file storage.",
+	}, []string{"direction"})
+
+	// Logins is count of login attempts by result.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RPCDuration,
+		RPCRequests,
+		DBQueryDuration,
+		FileBytes,
+		Logins,
+	)
+}
+
+// ObserveDBQuery records duration of DB storage operation, which started at start. Should be deferred.
+func ObserveDBQuery(operation string, start time.Time) {
+	DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// RegisterActiveSessions adds gauge of active sessions, which are counted by count on every scrape.
+func RegisterActiveSessions(count func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Sessions, which weren't revoked and can be refreshed.",
+	}, count))
+}
+
+// Handler returns HTTP handler of metrics in Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
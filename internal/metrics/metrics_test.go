@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/gophkeeper.Gophkeeper/GetRecord"}
+
+	tc := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"Count successful RPC", nil, codes.OK.String()},
+		{"Count failed RPC", status.Error(codes.NotFound, "not found"), codes.NotFound.String()},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		before := testutil.ToFloat64(RPCRequests.WithLabelValues(info.FullMethod, test.code))
+
+		_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, test.err
+		})
+		assert.Equal(t, test.err, err)
+		assert.Equal(t, before+1, testutil.ToFloat64(RPCRequests.WithLabelValues(info.FullMethod, test.code)))
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/gophkeeper.Gophkeeper/WatchRecords"}
+	code := codes.Canceled.String()
+
+	before := testutil.ToFloat64(RPCRequests.WithLabelValues(info.FullMethod, code))
+
+	err := interceptor(nil, nil, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return status.Error(codes.Canceled, "canceled")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(RPCRequests.WithLabelValues(info.FullMethod, code)))
+}
+
+func TestHandler(t *testing.T) {
+	RegisterActiveSessions(func() float64 { return 2 })
+	Logins.WithLabelValues(LoginSuccess).Inc()
+	FileBytes.WithLabelValues(FileWritten).Add(10)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "gophkeeper_active_sessions 2")
+	assert.Contains(t, body, `gophkeeper_logins_total{result="success"}`)
+	assert.Contains(t, body, `gophkeeper_file_storage_bytes_total{direction="written"}`)
+	assert.Contains(t, body, "go_goroutines")
+}
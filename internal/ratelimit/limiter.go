@@ -0,0 +1,165 @@
+// Package ratelimit counts failed attempts by key and locks key out with exponentially growing delay.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter counts failed attempts by key. Key is locked out for some time after too many failures.
+// Attempt is counted as failure, when it's acquired, so concurrent attempts can't pass lockout check together.
+//
+//go:generate mockery --name Limiter
+type Limiter interface {
+	// Acquire reserves attempt of key and counts it as failure. If key is locked out, attempt isn't reserved
+	// and time, which is left until lockout ends, is returned. Zero means attempt is allowed.
+	Acquire(ctx context.Context, key string) (time.Duration, error)
+	// Release takes back attempt of key, which didn't fail.
+	Release(ctx context.Context, key string) error
+	// Reset forgets failed attempts of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy describes when and how long key is locked out.
+type Policy struct {
+	// FreeAttempts is number of failures, which don't lock key out.
+	FreeAttempts int
+	// BaseDelay is lockout after the first failure over free attempts. Every next failure doubles it.
+	BaseDelay time.Duration
+	// MaxDelay limits lockout.
+	MaxDelay time.Duration
+	// Window is time after last failure, when failures of key are forgotten.
+	Window time.Duration
+}
+
+// DefaultPolicy allows 5 failures, then locks out for 1s, 2s, 4s and so on up to 15 minutes.
+var DefaultPolicy = Policy{
+	FreeAttempts: 5,
+	BaseDelay:    time.Second,
+	MaxDelay:     15 * time.Minute,
+	Window:       time.Hour,
+}
+
+// Delay returns lockout after given number of failures.
+func (policy Policy) Delay(failures int) time.Duration {
+	over := failures - policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	delay := policy.BaseDelay
+	for i := 1; i < over && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.MaxDelay {
+		return policy.MaxDelay
+	}
+	return delay
+}
+
+// attempts is failed attempts of key.
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// MemoryLimiter keeps failed attempts in memory of this server instance.
+type MemoryLimiter struct {
+	Policy    Policy
+	keys      map[string]attempts
+	lastSweep time.Time
+	now       func() time.Time
+	*sync.Mutex
+}
+
+// NewMemoryLimiter returns new in-memory limiter.
+func NewMemoryLimiter(policy Policy) *MemoryLimiter {
+	return &MemoryLimiter{
+		Policy: policy,
+		keys:   make(map[string]attempts),
+		now:    time.Now,
+		Mutex:  &sync.Mutex{},
+	}
+}
+
+// Acquire implementation of Limiter interface.
+func (limiter *MemoryLimiter) Acquire(_ context.Context, key string) (time.Duration, error) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	state := limiter.keys[key]
+	if wait := remaining(state.lockedUntil, now); wait > 0 {
+		return wait, nil
+	}
+
+	if now.Sub(state.lastFailure) > limiter.Policy.Window {
+		state = attempts{}
+	}
+
+	state.failures++
+	state.lastFailure = now
+
+	delay := limiter.Policy.Delay(state.failures)
+	if delay > 0 {
+		state.lockedUntil = now.Add(delay)
+	}
+
+	limiter.keys[key] = state
+	return 0, nil
+}
+
+// Release implementation of Limiter interface. Lockout is lifted, if key has no more failures than free ones.
+func (limiter *MemoryLimiter) Release(_ context.Context, key string) error {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	state, ok := limiter.keys[key]
+	if !ok || state.failures == 0 {
+		return nil
+	}
+
+	state.failures--
+	if limiter.Policy.Delay(state.failures) == 0 {
+		state.lockedUntil = time.Time{}
+	}
+
+	limiter.keys[key] = state
+	return nil
+}
+
+// Reset implementation of Limiter interface.
+func (limiter *MemoryLimiter) Reset(_ context.Context, key string) error {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	delete(limiter.keys, key)
+	return nil
+}
+
+// sweep forgets keys, which didn't fail during window. Runs not more often than once per window.
+func (limiter *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < limiter.Policy.Window {
+		return
+	}
+	limiter.lastSweep = now
+
+	for key, state := range limiter.keys {
+		if now.Sub(state.lastFailure) > limiter.Policy.Window && !now.Before(state.lockedUntil) {
+			delete(limiter.keys, key)
+		}
+	}
+}
+
+// remaining returns time left until lockout ends.
+func remaining(lockedUntil, now time.Time) time.Duration {
+	if !now.Before(lockedUntil) {
+		return 0
+	}
+	return lockedUntil.Sub(now)
+}
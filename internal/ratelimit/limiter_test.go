@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := Policy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Window: time.Hour}
+
+	tc := []struct {
+		name     string
+		failures int
+		delay    time.Duration
+	}{
+		{"Delay after free failure", 2, 0},
+		{"Delay after first locking failure", 3, time.Second},
+		{"Delay after second locking failure", 4, 2 * time.Second},
+		{"Delay after third locking failure", 5, 4 * time.Second},
+		{"Delay is limited", 100, 10 * time.Second},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		assert.Equal(t, test.delay, policy.Delay(test.failures))
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	limiter := NewMemoryLimiter(Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	limiter.now = func() time.Time { return now }
+
+	tc := []struct {
+		name  string
+		valid func()
+	}{
+		{
+			"Free failure doesn't lock key out",
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+
+				wait, err = limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+		{
+			"Next failures lock key out for longer time",
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Equal(t, time.Second, wait)
+
+				now = now.Add(time.Second)
+				wait, err = limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+
+				wait, err = limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Equal(t, 2*time.Second, wait)
+
+				wait, err = limiter.Acquire(ctx, "other")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+		{
+			"Lockout ends",
+			func() {
+				now = now.Add(4 * time.Second)
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+		{
+			"Failures are forgotten after window",
+			func() {
+				now = now.Add(2 * time.Hour)
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+		{
+			"Released attempt isn't failure",
+			func() {
+				assert.NoError(t, limiter.Release(ctx, "key"))
+
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+
+				assert.NoError(t, limiter.Release(ctx, "key"))
+				assert.NoError(t, limiter.Release(ctx, "unknown"))
+			},
+		},
+		{
+			"Released attempt lifts lockout of free failures",
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+
+				assert.NoError(t, limiter.Release(ctx, "key"))
+
+				wait, err = limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+		{
+			"Reset key",
+			func() {
+				_, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.NoError(t, limiter.Reset(ctx, "key"))
+
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.valid()
+	}
+}
+
+func TestMemoryLimiter_ConcurrentAcquire(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewMemoryLimiter(Policy{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+
+	var allowed atomic.Int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			wait, err := limiter.Acquire(ctx, "key")
+			assert.NoError(t, err)
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Free attempts and the one, which locks key out.
+	assert.Equal(t, int32(4), allowed.Load())
+}
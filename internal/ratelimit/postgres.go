@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PostgresLimiter keeps failed attempts in DB, so lockout is shared between server instances.
+type PostgresLimiter struct {
+	Policy    Policy
+	DB        *sql.DB
+	lastSweep time.Time
+	now       func() time.Time
+	*sync.Mutex
+}
+
+// NewPostgresLimiter returns limiter based on DB.
+func NewPostgresLimiter(db *sql.DB, policy Policy) *PostgresLimiter {
+	return &PostgresLimiter{
+		Policy: policy,
+		DB:     db,
+		now:    time.Now,
+		Mutex:  &sync.Mutex{},
+	}
+}
+
+// Acquire implementation of Limiter interface. Row of key stays locked until lockout is saved,
+// so concurrent attempts of key wait for it and see lockout.
+func (limiter *PostgresLimiter) Acquire(ctx context.Context, key string) (time.Duration, error) {
+	now := limiter.now()
+
+	err := limiter.sweep(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := limiter.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `INSERT INTO login_attempts (attempt_key, failures, last_failure, locked_until) VALUES ($1, 1, $2, $2)
+ON CONFLICT (attempt_key) DO UPDATE SET failures = CASE WHEN login_attempts.last_failure < $3 THEN 1 ELSE login_attempts.failures + 1 END, last_failure = $2
+WHERE login_attempts.locked_until <= $2
+RETURNING failures`, key, now, now.Add(-limiter.Policy.Window))
+
+	var failures int
+	err = row.Scan(&failures)
+
+	// Row isn't updated, when key is locked out.
+	if errors.Is(err, sql.ErrNoRows) {
+		var lockedUntil time.Time
+		err = tx.QueryRowContext(ctx, `SELECT locked_until FROM login_attempts WHERE attempt_key = $1`, key).Scan(&lockedUntil)
+		if err != nil {
+			return 0, err
+		}
+
+		return remaining(lockedUntil, now), nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	delay := limiter.Policy.Delay(failures)
+	if delay > 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE login_attempts SET locked_until = $1 WHERE attempt_key = $2`, now.Add(delay), key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, tx.Commit()
+}
+
+// Release implementation of Limiter interface. Lockout is lifted, if key has no more failures than free ones.
+func (limiter *PostgresLimiter) Release(ctx context.Context, key string) error {
+	_, err := limiter.DB.ExecContext(ctx, `UPDATE login_attempts SET failures = failures - 1,
+locked_until = CASE WHEN failures - 1 <= $2 THEN last_failure ELSE locked_until END WHERE attempt_key = $1 AND failures > 0`,
+		key, limiter.Policy.FreeAttempts)
+	return err
+}
+
+// Reset implementation of Limiter interface.
+func (limiter *PostgresLimiter) Reset(ctx context.Context, key string) error {
+	_, err := limiter.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE attempt_key = $1`, key)
+	return err
+}
+
+// sweep deletes keys, which didn't fail during window. Runs not more often than once per window on this instance.
+func (limiter *PostgresLimiter) sweep(ctx context.Context, now time.Time) error {
+	limiter.Lock()
+	if now.Sub(limiter.lastSweep) < limiter.Policy.Window {
+		limiter.Unlock()
+		return nil
+	}
+	limiter.lastSweep = now
+	limiter.Unlock()
+
+	_, err := limiter.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE last_failure < $1 AND locked_until < $2`, now.Add(-limiter.Policy.Window), now)
+	return err
+}
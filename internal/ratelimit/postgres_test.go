@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const acquireQuery = `INSERT INTO login_attempts (attempt_key, failures, last_failure, locked_until) VALUES ($1, 1, $2, $2)
+ON CONFLICT (attempt_key) DO UPDATE SET failures = CASE WHEN login_attempts.last_failure < $3 THEN 1 ELSE login_attempts.failures + 1 END, last_failure = $2
+WHERE login_attempts.locked_until <= $2
+RETURNING failures`
+
+const releaseQuery = `UPDATE login_attempts SET failures = failures - 1,
+locked_until = CASE WHEN failures - 1 <= $2 THEN last_failure ELSE locked_until END WHERE attempt_key = $1 AND failures > 0`
+
+func TestPostgresLimiter(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	limiter := NewPostgresLimiter(db, Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	limiter.now = func() time.Time { return now }
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Free failure, stale keys are deleted first",
+			func() {
+				mock.ExpectExec(`DELETE FROM login_attempts WHERE last_failure < $1 AND locked_until < $2`).
+					WithArgs(now.Add(-time.Hour), now).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(acquireQuery).
+					WithArgs("key", now, now.Add(-time.Hour)).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+				mock.ExpectCommit()
+			},
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Failure, which locks key out",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(acquireQuery).
+					WithArgs("key", now, now.Add(-time.Hour)).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+				mock.ExpectExec(`UPDATE login_attempts SET locked_until = $1 WHERE attempt_key = $2`).
+					WithArgs(now.Add(2*time.Second), "key").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Zero(t, wait)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Locked out key",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(acquireQuery).
+					WithArgs("key", now, now.Add(-time.Hour)).WillReturnRows(sqlmock.NewRows([]string{"failures"}))
+				mock.ExpectQuery(`SELECT locked_until FROM login_attempts WHERE attempt_key = $1`).
+					WithArgs("key").WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(now.Add(5 * time.Second)))
+				mock.ExpectRollback()
+			},
+			func() {
+				wait, err := limiter.Acquire(ctx, "key")
+				assert.NoError(t, err)
+				assert.Equal(t, 5*time.Second, wait)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Acquire, but DB will return error",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(acquireQuery).
+					WithArgs("key", now, now.Add(-time.Hour)).WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
+			},
+			func() {
+				_, err := limiter.Acquire(ctx, "key")
+				assert.Error(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Release key",
+			func() {
+				mock.ExpectExec(releaseQuery).
+					WithArgs("key", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, limiter.Release(ctx, "key"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Reset key",
+			func() {
+				mock.ExpectExec(`DELETE FROM login_attempts WHERE attempt_key = $1`).
+					WithArgs("key").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, limiter.Reset(ctx, "key"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
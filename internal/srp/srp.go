@@ -0,0 +1,268 @@
+// Package srp implements SRP-6a password-authenticated key exchange (RFC 5054) with SHA-256.
+// Server stores only salt and verifier of password and never sees password itself.
+package srp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Errors of SRP handshake.
+var (
+	ErrBadPublicKey = errors.New("bad SRP public key")
+	ErrBadProof     = errors.New("bad SRP proof")
+)
+
+// SaltSize is size of random salt of verifier.
+const SaltSize = 16
+
+// 2048-bit group from RFC 5054, appendix A.
+var (
+	groupN, _ = new(big.Int).SetString(strings.Join([]string{
+		"AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050",
+		"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50",
+		"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8",
+		"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B",
+		"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748",
+		"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6",
+		"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6",
+		"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73",
+	}, ""), 16)
+	groupG = big.NewInt(2)
+	// multiplier is k = H(N | PAD(g)).
+	multiplier = hashInt(groupN.Bytes(), pad(groupG))
+)
+
+// NewVerifier returns random salt and verifier of password, which are sent to server on registration.
+func NewVerifier(login, password string) (salt []byte, verifier []byte, err error) {
+	salt = make([]byte, SaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := new(big.Int).Exp(groupG, privateKey(login, password, salt), groupN)
+	return salt, pad(v), nil
+}
+
+// Client is client side of SRP handshake.
+type Client struct {
+	login    string
+	password string
+	a        *big.Int
+	bigA     *big.Int
+	proof    []byte
+	key      []byte
+}
+
+// NewClient starts handshake. Its public key should be sent to server.
+func NewClient(login, password string) (*Client, error) {
+	a, err := randomExponent()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		login:    login,
+		password: password,
+		a:        a,
+		bigA:     new(big.Int).Exp(groupG, a, groupN),
+	}, nil
+}
+
+// PublicKey returns public key A of client.
+func (client *Client) PublicKey() []byte {
+	return pad(client.bigA)
+}
+
+// Proof computes proof M1 of password from salt and public key B of server.
+func (client *Client) Proof(salt, serverPublicKey []byte) ([]byte, error) {
+	err := CheckPublicKey(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(big.Int).SetBytes(serverPublicKey)
+
+	u := hashInt(pad(client.bigA), pad(b))
+	if u.Sign() == 0 {
+		return nil, ErrBadPublicKey
+	}
+
+	x := privateKey(client.login, client.password, salt)
+
+	// S = (B - k * g^x) ^ (a + u * x) mod N
+	base := new(big.Int).Exp(groupG, x, groupN)
+	base.Mul(base, multiplier)
+	base.Sub(b, base)
+	base.Mod(base, groupN)
+
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, client.a)
+
+	s := new(big.Int).Exp(base, exp, groupN)
+
+	client.key = hash(pad(s))
+	client.proof = clientProof(client.login, salt, client.bigA, b, client.key)
+	return client.proof, nil
+}
+
+// VerifyServer checks proof M2 of server, so client knows server has verifier of password.
+func (client *Client) VerifyServer(serverProof []byte) error {
+	if client.proof == nil {
+		return ErrBadProof
+	}
+
+	want := hash(pad(client.bigA), client.proof, client.key)
+	if subtle.ConstantTimeCompare(want, serverProof) != 1 {
+		return ErrBadProof
+	}
+
+	return nil
+}
+
+// Key returns session key, which is known by client and server after handshake.
+func (client *Client) Key() []byte {
+	return client.key
+}
+
+// Server is server side of SRP handshake.
+type Server struct {
+	login    string
+	salt     []byte
+	verifier *big.Int
+	b        *big.Int
+	bigB     *big.Int
+	key      []byte
+}
+
+// NewServer starts handshake for user with salt and verifier.
+func NewServer(login string, salt, verifier []byte) (*Server, error) {
+	b, err := randomExponent()
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(big.Int).SetBytes(verifier)
+
+	// B = k * v + g^b mod N
+	bigB := new(big.Int).Exp(groupG, b, groupN)
+	bigB.Add(bigB, new(big.Int).Mul(multiplier, v))
+	bigB.Mod(bigB, groupN)
+
+	return &Server{
+		login:    login,
+		salt:     salt,
+		verifier: v,
+		b:        b,
+		bigB:     bigB,
+	}, nil
+}
+
+// PublicKey returns public key B of server.
+func (server *Server) PublicKey() []byte {
+	return pad(server.bigB)
+}
+
+// Verify checks client public key A and proof M1. Returns proof M2 of server.
+func (server *Server) Verify(clientPublicKey, clientProofM1 []byte) ([]byte, error) {
+	err := CheckPublicKey(clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	a := new(big.Int).SetBytes(clientPublicKey)
+
+	u := hashInt(pad(a), pad(server.bigB))
+	if u.Sign() == 0 {
+		return nil, ErrBadPublicKey
+	}
+
+	// S = (A * v^u) ^ b mod N
+	base := new(big.Int).Exp(server.verifier, u, groupN)
+	base.Mul(base, a)
+	base.Mod(base, groupN)
+
+	s := new(big.Int).Exp(base, server.b, groupN)
+	key := hash(pad(s))
+
+	want := clientProof(server.login, server.salt, a, server.bigB, key)
+	if subtle.ConstantTimeCompare(want, clientProofM1) != 1 {
+		return nil, ErrBadProof
+	}
+
+	server.key = key
+	return hash(pad(a), clientProofM1, key), nil
+}
+
+// Key returns session key after successful verification.
+func (server *Server) Key() []byte {
+	return server.key
+}
+
+// CheckPublicKey checks, that public key of other side is number in range (0, N) and isn't longer than N.
+// Public key should be checked before it's used, so handshake can't be broken by malicious value.
+func CheckPublicKey(publicKey []byte) error {
+	if len(publicKey) > publicKeySize {
+		return ErrBadPublicKey
+	}
+
+	n := new(big.Int).SetBytes(publicKey)
+	if n.Sign() == 0 || n.Cmp(groupN) >= 0 {
+		return ErrBadPublicKey
+	}
+
+	return nil
+}
+
+// privateKey returns x = H(s | H(I | ":" | P)).
+func privateKey(login, password string, salt []byte) *big.Int {
+	return hashInt(salt, hash([]byte(login+":"+password)))
+}
+
+// clientProof returns M1 = H(H(N) xor H(g) | H(I) | s | A | B | K).
+func clientProof(login string, salt []byte, a, b *big.Int, key []byte) []byte {
+	hn := hash(groupN.Bytes())
+	hg := hash(groupG.Bytes())
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+
+	return hash(hn, hash([]byte(login)), salt, pad(a), pad(b), key)
+}
+
+// randomExponent returns random secret exponent.
+func randomExponent() (*big.Int, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// publicKeySize is size of public keys, it's length of N.
+var publicKeySize = (groupN.BitLen() + 7) / 8
+
+// pad returns number as big-endian bytes of length of N.
+func pad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, publicKeySize))
+}
+
+// hash returns SHA-256 of concatenated data.
+func hash(data ...[]byte) []byte {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// hashInt returns hash of concatenated data as number.
+func hashInt(data ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(hash(data...))
+}
@@ -0,0 +1,90 @@
+package srp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup(t *testing.T) {
+	assert.Equal(t, 2048, groupN.BitLen())
+	assert.True(t, groupN.ProbablyPrime(20))
+
+	// N is safe prime: (N - 1) / 2 is prime too.
+	q := new(big.Int).Rsh(groupN, 1)
+	assert.True(t, q.ProbablyPrime(20))
+}
+
+func TestHandshake(t *testing.T) {
+	salt, verifier, err := NewVerifier("login", "password")
+	assert.NoError(t, err)
+	assert.Len(t, salt, SaltSize)
+
+	tc := []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{"Handshake with right password", "password", nil},
+		{"Handshake with wrong password", "wrong", ErrBadProof},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+
+		client, err := NewClient("login", test.password)
+		assert.NoError(t, err)
+
+		server, err := NewServer("login", salt, verifier)
+		assert.NoError(t, err)
+
+		proof, err := client.Proof(salt, server.PublicKey())
+		assert.NoError(t, err)
+
+		serverProof, err := server.Verify(client.PublicKey(), proof)
+		assert.Equal(t, test.err, err)
+		if err != nil {
+			continue
+		}
+
+		assert.NoError(t, client.VerifyServer(serverProof))
+		assert.Equal(t, client.Key(), server.Key())
+	}
+}
+
+func TestBadPublicKeys(t *testing.T) {
+	salt, verifier, err := NewVerifier("login", "password")
+	assert.NoError(t, err)
+
+	client, err := NewClient("login", "password")
+	assert.NoError(t, err)
+
+	_, err = client.Proof(salt, pad(groupN))
+	assert.Equal(t, ErrBadPublicKey, err)
+
+	server, err := NewServer("login", salt, verifier)
+	assert.NoError(t, err)
+
+	_, err = server.Verify(pad(big.NewInt(0)), []byte("proof"))
+	assert.Equal(t, ErrBadPublicKey, err)
+
+	// Values, which are longer than N or not less than it, are rejected instead of breaking padding.
+	tooLong := append([]byte{1}, pad(big.NewInt(2))...)
+	_, err = server.Verify(tooLong, []byte("proof"))
+	assert.Equal(t, ErrBadPublicKey, err)
+	_, err = server.Verify(pad(new(big.Int).Add(groupN, big.NewInt(2))), []byte("proof"))
+	assert.Equal(t, ErrBadPublicKey, err)
+	_, err = client.Proof(salt, tooLong)
+	assert.Equal(t, ErrBadPublicKey, err)
+
+	assert.NoError(t, CheckPublicKey(client.PublicKey()))
+	assert.Equal(t, ErrBadPublicKey, CheckPublicKey(nil))
+}
+
+func TestVerifyServer_WrongProof(t *testing.T) {
+	client, err := NewClient("login", "password")
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrBadProof, client.VerifyServer([]byte("proof")))
+}
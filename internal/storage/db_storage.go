@@ -3,28 +3,39 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/metrics"
 )
 
 // DBStorage for db storage.
 type DBStorage struct {
 	DB *sql.DB
+
+	// uniqueViolation checks errors of database driver for unique constraint violation.
+	// If it's nil, errors are checked as PostgreSQL errors.
+	uniqueViolation func(err error) bool
 }
 
 // NewDBStorage connects to DB.
 func NewDBStorage(connectionURL string) *DBStorage {
 	db, err := sql.Open("pgx", connectionURL)
 	if err != nil {
-		log.Fatalln("Failed open DB storage:", err)
-		return nil
+		slog.Error("Failed open DB storage", "error", err)
+		os.Exit(1)
 	}
 
 	return &DBStorage{DB: db}
@@ -32,38 +43,54 @@ func NewDBStorage(connectionURL string) *DBStorage {
 
 // MigrateUP migrates DB.
 func (storage *DBStorage) MigrateUP() {
+	err := storage.migrate("file://migrations")
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// migrate applies PostgreSQL migrations from source URL.
+func (storage *DBStorage) migrate(sourceURL string) error {
 	driver, err := postgres.WithInstance(storage.DB, &postgres.Config{})
 	if err != nil {
-		log.Fatalf("Failed create postgres instance: %v\n", err)
+		slog.Error("Failed create postgres instance", "error", err)
+		return err
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
-		"pgx", driver)
+	m, err := migrate.NewWithDatabaseInstance(sourceURL, "pgx", driver)
 	if err != nil {
-		log.Fatalf("Failed create migration instance: %v\n", err)
-		return
+		slog.Error("Failed create migration instance", "error", err)
+		return err
 	}
 
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
-		log.Fatalln("Failed migrate: ", err)
-		return
+		slog.Error("Failed migrate", "error", err)
+		return err
 	}
+
+	return nil
 }
 
-// CreateUser saves to DB new user.
-func (storage *DBStorage) CreateUser(credentials entity.UserCredentials) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Ping checks connection with DB.
+func (storage *DBStorage) Ping(ctx context.Context) error {
+	return storage.DB.PingContext(ctx)
+}
+
+// CreateUser saves to DB new user with password hash.
+func (storage *DBStorage) CreateUser(ctx context.Context, login string, password entity.StoredPassword) error {
+	defer metrics.ObserveDBQuery("CreateUser", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	row := storage.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE login = $1`, credentials.Login)
+	row := storage.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE login = $1`, login)
 
 	sameLoginCounter := 0
 	err := row.Scan(&sameLoginCounter)
 
 	if err != nil || row.Err() != nil {
-		log.Println("Failed get row while checking for login conflict:", err)
+		slog.ErrorContext(ctx, "Failed get row while checking for login conflict", "error", err)
 		return ErrUnknown
 	}
 
@@ -71,153 +98,1546 @@ func (storage *DBStorage) CreateUser(credentials entity.UserCredentials) error {
 		return ErrLoginExists
 	}
 
-	_, err = storage.DB.ExecContext(ctx, `INSERT INTO users (login, password) VALUES ($1, $2)`, credentials.Login, credentials.Password)
+	_, err = storage.DB.ExecContext(ctx, `INSERT INTO users (login, password, password_algorithm) VALUES ($1, $2, $3)`, login, password.Hash, password.Algorithm)
+	// Login can be taken by concurrent registration after check, then unique constraint fails insert.
+	if storage.isUniqueViolation(err) {
+		return ErrLoginExists
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed insert new user into table users", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// pgUniqueViolation is PostgreSQL error code of unique constraint violation.
+const pgUniqueViolation = "23505"
+
+// isUniqueViolation checks, that error is violation of unique constraint in database of storage.
+func (storage *DBStorage) isUniqueViolation(err error) bool {
+	if storage.uniqueViolation != nil {
+		return storage.uniqueViolation(err)
+	}
+
+	return isPostgresUniqueViolation(err)
+}
+
+// isPostgresUniqueViolation checks, that error is violation of unique constraint in PostgreSQL.
+func isPostgresUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+
+	return false
+}
+
+// GetPassword gets password hash of user by login. Password is verified by caller.
+func (storage *DBStorage) GetPassword(ctx context.Context, login string) (entity.StoredPassword, error) {
+	defer metrics.ObserveDBQuery("GetPassword", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	row := storage.DB.QueryRowContext(ctx, `SELECT user_id, password, password_algorithm FROM users WHERE login = $1`, login)
+
+	var password entity.StoredPassword
+	err := row.Scan(&password.UserID, &password.Hash, &password.Algorithm)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.StoredPassword{}, ErrWrongCredentials
+	}
+
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get password hash of user", "error", err)
+		return entity.StoredPassword{}, ErrUnknown
+	}
+
+	return password, nil
+}
+
+// UpdatePassword changes password hash of user.
+func (storage *DBStorage) UpdatePassword(ctx context.Context, password entity.StoredPassword) error {
+	defer metrics.ObserveDBQuery("UpdatePassword", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := storage.DB.ExecContext(ctx, `UPDATE users SET password = $1, password_algorithm = $2 WHERE user_id = $3`,
+		password.Hash, password.Algorithm, password.UserID)
 	if err != nil {
-		log.Println("Failed insert new user into table users:", err)
+		slog.ErrorContext(ctx, "Failed update password hash of user", "error", err)
 		return ErrUnknown
 	}
 
 	return nil
 }
 
-// LoginUser check if credentials are valid. Returns userID.
-func (storage *DBStorage) LoginUser(credentials entity.UserCredentials) (entity.UserID, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetUserID gets user ID by login.
+func (storage *DBStorage) GetUserID(ctx context.Context, login string) (entity.UserID, error) {
+	defer metrics.ObserveDBQuery("GetUserID", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	row := storage.DB.QueryRowContext(ctx, `SELECT user_id FROM users WHERE login = $1 AND password = $2`, credentials.Login, credentials.Password)
+	row := storage.DB.QueryRowContext(ctx, `SELECT user_id FROM users WHERE login = $1`, login)
 
 	var userID entity.UserID
 	err := row.Scan(&userID)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return userID, ErrWrongCredentials
+		return userID, ErrNotFound
 	}
 
 	if err != nil || row.Err() != nil {
-		log.Println("Failed get row while checking for correct user credentials:", err)
+		slog.ErrorContext(ctx, "Failed get user ID by login", "error", err)
 		return userID, ErrUnknown
 	}
 
 	return userID, nil
 }
 
-// GetRecordsInfo gets all DB record from this user.
-func (storage *DBStorage) GetRecordsInfo(ctx context.Context) ([]entity.Record, error) {
-	userID, ok := ctx.Value("userID").(entity.UserID)
+// SaveRefreshToken saves hash of refresh token.
+func (storage *DBStorage) SaveRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	defer metrics.ObserveDBQuery("SaveRefreshToken", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := storage.DB.ExecContext(ctx, `INSERT INTO refresh_tokens (token_hash, user_id, session_id, expires_at) VALUES ($1, $2, $3, $4)`,
+		token.Hash, token.UserID, token.SessionID, token.ExpiresAt.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed save refresh token", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// UseRefreshToken deletes refresh token by hash and returns it. Each refresh token can be used only once.
+func (storage *DBStorage) UseRefreshToken(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	defer metrics.ObserveDBQuery("UseRefreshToken", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	row := storage.DB.QueryRowContext(ctx, `DELETE FROM refresh_tokens WHERE token_hash = $1 RETURNING user_id, session_id, expires_at`, hash)
+
+	token := entity.RefreshToken{Hash: hash}
+	err := row.Scan(&token.UserID, &token.SessionID, &token.ExpiresAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.RefreshToken{}, ErrUserUnauthorized
+	}
+
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed use refresh token", "error", err)
+		return entity.RefreshToken{}, ErrUnknown
+	}
+
+	return token, nil
+}
+
+// DeleteSessionTokens deletes all refresh tokens of user session.
+func (storage *DBStorage) DeleteSessionTokens(ctx context.Context, sessionID string) error {
+	defer metrics.ObserveDBQuery("DeleteSessionTokens", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	_, err := storage.DB.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1 AND session_id = $2`, userID, sessionID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete refresh tokens of session", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// CreateSession saves new session of user.
+func (storage *DBStorage) CreateSession(ctx context.Context, session entity.SessionInfo) error {
+	defer metrics.ObserveDBQuery("CreateSession", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := storage.DB.ExecContext(ctx, `INSERT INTO sessions (session_id, user_id, device_name, ip, user_agent, created_at, last_seen_at) VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		session.ID, session.UserID, session.Device.Name, session.Device.IP, session.Device.UserAgent, session.CreatedAt.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed create session", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// sessionTouchInterval is how often last seen time of active session is updated, so not every request writes to DB.
+const sessionTouchInterval = time.Minute
+
+// TouchSession updates last seen time of session, if it's older than sessionTouchInterval.
+// Returns ErrUserUnauthorized, if session was revoked.
+func (storage *DBStorage) TouchSession(ctx context.Context, sessionID string) error {
+	defer metrics.ObserveDBQuery("TouchSession", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	var lastSeenAt time.Time
+	err := storage.DB.QueryRowContext(ctx, `SELECT last_seen_at FROM sessions WHERE session_id = $1 AND user_id = $2 AND NOT revoked`, sessionID, userID).Scan(&lastSeenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserUnauthorized
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get session", "error", err)
+		return ErrUnknown
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(lastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	result, err := storage.DB.ExecContext(ctx, `UPDATE sessions SET last_seen_at = $1 WHERE session_id = $2 AND user_id = $3 AND NOT revoked`, now, sessionID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed touch session", "error", err)
+		return ErrUnknown
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected rows of session", "error", err)
+		return ErrUnknown
+	}
+
+	if affected == 0 {
+		return ErrUserUnauthorized
+	}
+
+	return nil
+}
+
+// ListSessions gets not revoked sessions of user, recently seen first.
+func (storage *DBStorage) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	defer metrics.ObserveDBQuery("ListSessions", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	userID, ok := entity.UserIDFromContext(ctx)
 	if !ok {
-		log.Println("Failed get userID from context in getting all records")
 		return nil, ErrUserUnauthorized
 	}
 
-	rows, err := storage.DB.QueryContext(ctx, `SELECT record_id, record_type, metadata FROM users_data WHERE user_id = $1`, userID)
+	rows, err := storage.DB.QueryContext(ctx, `SELECT session_id, device_name, ip, user_agent, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND NOT revoked ORDER BY last_seen_at DESC`, userID)
 	if err != nil {
-		log.Println("Failed get rows in getting all records:", err)
+		slog.ErrorContext(ctx, "Failed get sessions of user", "error", err)
 		return nil, ErrUnknown
 	}
-
 	defer rows.Close()
 
-	result := make([]entity.Record, 0, 10)
-	var row entity.Record
+	sessions := make([]entity.SessionInfo, 0)
+
 	for rows.Next() {
-		err := rows.Scan(&row.ID, &row.Type, &row.Metadata)
+		session := entity.SessionInfo{UserID: userID}
+		err = rows.Scan(&session.ID, &session.Device.Name, &session.Device.IP, &session.Device.UserAgent, &session.CreatedAt, &session.LastSeenAt)
 		if err != nil {
-			log.Println("Failed get next row in getting all records:", err)
+			slog.ErrorContext(ctx, "Failed scan session", "error", err)
 			return nil, ErrUnknown
 		}
-
-		result = append(result, row)
+		sessions = append(sessions, session)
 	}
 
 	if rows.Err() != nil {
-		log.Println("Failed get rows in getting all records:", err)
+		slog.ErrorContext(ctx, "Failed get sessions of user", "error", rows.Err())
 		return nil, ErrUnknown
 	}
 
-	return result, nil
+	return sessions, nil
 }
 
-// CreateRecord saves new record to DB, returns recordID.
-func (storage *DBStorage) CreateRecord(ctx context.Context, record entity.Record) (string, error) {
-	userID, ok := ctx.Value("userID").(entity.UserID)
+// RevokeSession marks session of user as revoked.
+func (storage *DBStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	defer metrics.ObserveDBQuery("RevokeSession", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	userID, ok := entity.UserIDFromContext(ctx)
 	if !ok {
-		log.Println("Failed get userID from context in getting all records")
-		return "", ErrUserUnauthorized
+		return ErrUserUnauthorized
 	}
 
-	hexDataString := hex.EncodeToString(record.Data)
-
-	row := storage.DB.QueryRowContext(ctx, `INSERT INTO users_data (user_id, record_type, metadata, encoded_data) VALUES ($1, $2, $3, $4) RETURNING record_id`, userID, record.Type, record.Metadata, hexDataString)
+	result, err := storage.DB.ExecContext(ctx, `UPDATE sessions SET revoked = TRUE WHERE session_id = $1 AND user_id = $2 AND NOT revoked`, sessionID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed revoke session", "error", err)
+		return ErrUnknown
+	}
 
-	recordID := ""
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected rows of session", "error", err)
+		return ErrUnknown
+	}
 
-	err := row.Scan(&recordID)
-	if err != nil || row.Err() != nil {
-		return "", ErrUnknown
+	if affected == 0 {
+		return ErrNotFound
 	}
 
-	return recordID, nil
+	return nil
 }
 
-// GetRecord gets record from DB by ID.
-func (storage *DBStorage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
-	record := entity.Record{}
+// CountActiveSessions counts not revoked sessions of all users, which were seen after since.
+func (storage *DBStorage) CountActiveSessions(ctx context.Context, since time.Time) (int64, error) {
+	defer metrics.ObserveDBQuery("CountActiveSessions", time.Now())
 
-	userID, ok := ctx.Value("userID").(entity.UserID)
-	if !ok {
-		log.Println("Failed get userID from context in getting all records")
-		return record, ErrUserUnauthorized
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var count int64
+	err := storage.DB.QueryRowContext(ctx, `SELECT count(*) FROM sessions WHERE NOT revoked AND last_seen_at > $1`, since.UTC()).Scan(&count)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed count active sessions", "error", err)
+		return 0, ErrUnknown
 	}
 
-	row := storage.DB.QueryRowContext(ctx, `SELECT record_id, record_type, metadata, encoded_data FROM users_data WHERE record_id = $1 AND user_id = $2`, recordID, userID)
+	return count, nil
+}
+
+// GetTOTP gets TOTP secret of user. Returns ErrNotFound, if user didn't enable TOTP.
+func (storage *DBStorage) GetTOTP(ctx context.Context, userID entity.UserID) (entity.TOTP, error) {
+	defer metrics.ObserveDBQuery("GetTOTP", time.Now())
 
-	hexDataString := ""
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	row := storage.DB.QueryRowContext(ctx, `SELECT secret, confirmed, last_step FROM totp_secrets WHERE user_id = $1`, userID)
 
-	err := row.Scan(&record.ID, &record.Type, &record.Metadata, &hexDataString)
+	totp := entity.TOTP{UserID: userID}
+	err := row.Scan(&totp.Secret, &totp.Confirmed, &totp.LastStep)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return record, ErrNotFound
+		return entity.TOTP{}, ErrNotFound
 	}
 
 	if err != nil || row.Err() != nil {
-		log.Println("Failed scan rows to find needed record.", err)
-		return record, ErrUnknown
+		slog.ErrorContext(ctx, "Failed get TOTP secret of user", "error", err)
+		return entity.TOTP{}, ErrUnknown
 	}
 
-	record.Data, err = hex.DecodeString(hexDataString)
+	return totp, nil
+}
 
+// SaveTOTP saves new not confirmed TOTP secret of user and replaces backup codes by their hashes.
+func (storage *DBStorage) SaveTOTP(ctx context.Context, totp entity.TOTP, backupCodes []string) error {
+	defer metrics.ObserveDBQuery("SaveTOTP", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("Failed convert record data from hex to bytes:", err)
-		return record, ErrUnknown
+		slog.ErrorContext(ctx, "Failed begin transaction in saving TOTP secret", "error", err)
+		return ErrUnknown
 	}
+	defer tx.Rollback()
 
-	return record, nil
+	_, err = tx.ExecContext(ctx, `INSERT INTO totp_secrets (user_id, secret) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed = FALSE, last_step = 0`,
+		totp.UserID, totp.Secret)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed save TOTP secret", "error", err)
+		return ErrUnknown
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM totp_backup_codes WHERE user_id = $1`, totp.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete old backup codes", "error", err)
+		return ErrUnknown
+	}
+
+	for _, code := range backupCodes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO totp_backup_codes (user_id, code_hash) VALUES ($1, $2)`, totp.UserID, code)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed save backup code", "error", err)
+			return ErrUnknown
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in saving TOTP secret", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
 }
 
-// DeleteRecord deletes record from DB by ID.
-func (storage *DBStorage) DeleteRecord(ctx context.Context, recordID string) error {
-	userID, ok := ctx.Value("userID").(entity.UserID)
-	if !ok {
-		log.Println("Failed get userID from context in getting all records")
-		return ErrUserUnauthorized
+// UseTOTPStep confirms TOTP secret of user and saves time step of accepted code.
+// Returns ErrWrongCredentials, if code of same or later step was already accepted.
+func (storage *DBStorage) UseTOTPStep(ctx context.Context, userID entity.UserID, step int64) error {
+	defer metrics.ObserveDBQuery("UseTOTPStep", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := storage.DB.ExecContext(ctx, `UPDATE totp_secrets SET confirmed = TRUE, last_step = $1 WHERE user_id = $2 AND last_step < $1`, step, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed use TOTP step", "error", err)
+		return ErrUnknown
 	}
 
-	result, err := storage.DB.ExecContext(ctx, `DELETE FROM users_data WHERE record_id = $1 AND user_id = $2`, recordID, userID)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		log.Println("Failed delete record:", err)
+		slog.ErrorContext(ctx, "Failed get affected rows of TOTP secret", "error", err)
 		return ErrUnknown
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if affected == 0 {
+		return ErrWrongCredentials
+	}
+
+	return nil
+}
+
+// UseBackupCode deletes backup code of user by hash. Each backup code can be used only once.
+func (storage *DBStorage) UseBackupCode(ctx context.Context, userID entity.UserID, hash string) error {
+	defer metrics.ObserveDBQuery("UseBackupCode", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := storage.DB.ExecContext(ctx, `DELETE FROM totp_backup_codes WHERE user_id = $1 AND code_hash = $2`, userID, hash)
 	if err != nil {
-		log.Println("Failed get affected records:", err)
+		slog.ErrorContext(ctx, "Failed use backup code", "error", err)
 		return ErrUnknown
 	}
 
-	if rowsAffected == 0 {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected rows of backup code", "error", err)
+		return ErrUnknown
+	}
+
+	if affected == 0 {
+		return ErrWrongCredentials
+	}
+
+	return nil
+}
+
+// DeleteTOTP deletes TOTP secret and backup codes of user. Returns ErrNotFound, if user didn't enable TOTP.
+func (storage *DBStorage) DeleteTOTP(ctx context.Context, userID entity.UserID) error {
+	defer metrics.ObserveDBQuery("DeleteTOTP", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in deleting TOTP secret", "error", err)
+		return ErrUnknown
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM totp_secrets WHERE user_id = $1`, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete TOTP secret", "error", err)
+		return ErrUnknown
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected rows of TOTP secret", "error", err)
+		return ErrUnknown
+	}
+
+	if affected == 0 {
 		return ErrNotFound
 	}
 
+	_, err = tx.ExecContext(ctx, `DELETE FROM totp_backup_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete backup codes", "error", err)
+		return ErrUnknown
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in deleting TOTP secret", "error", err)
+		return ErrUnknown
+	}
+
 	return nil
 }
+
+// DeleteUser deletes user and all his records, sessions, TOTP secret, login attempts and audit log in one transaction.
+// File records of user are journaled as deleted in the same transaction. deleteFiles is called with their IDs
+// after commit, so files are deleted only with user. Files, which weren't deleted, are left in journal
+// and deleted later by sweep, they don't fail deleting. Deleting user, who doesn't exist, succeeds.
+func (storage *DBStorage) DeleteUser(ctx context.Context, deleteFiles func(recordIDs []string) error) error {
+	defer metrics.ObserveDBQuery("DeleteUser", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in deleting user", "error", err)
+		return ErrUnknown
+	}
+	defer tx.Rollback()
+
+	// User row is deleted first, so its lock stops concurrent changes of records until transaction ends.
+	var login string
+	err = tx.QueryRowContext(ctx, `DELETE FROM users WHERE user_id = $1 RETURNING login`, userID).Scan(&login)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(ctx, "Failed delete user", "error", err)
+		return ErrUnknown
+	}
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM users_data WHERE user_id = $1 RETURNING record_id, record_type`, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete records of user", "error", err)
+		return ErrUnknown
+	}
+	defer rows.Close()
+
+	files := make([]string, 0)
+
+	for rows.Next() {
+		var recordID string
+		var recordType entity.RecordType
+		err = rows.Scan(&recordID, &recordType)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed scan deleted record", "error", err)
+			return ErrUnknown
+		}
+
+		if recordType == entity.TypeFile {
+			files = append(files, recordID)
+		}
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed delete records of user", "error", rows.Err())
+		return ErrUnknown
+	}
+
+	for _, query := range []string{
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM refresh_tokens WHERE user_id = $1`,
+		`DELETE FROM totp_secrets WHERE user_id = $1`,
+		`DELETE FROM totp_backup_codes WHERE user_id = $1`,
+		`DELETE FROM audit_events WHERE user_id = $1`,
+	} {
+		_, err = tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed delete data of user", "error", err)
+			return ErrUnknown
+		}
+	}
+
+	// Login attempts are keyed by login, so new user with the same login doesn't inherit lockout.
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_attempts WHERE attempt_key = $1`, loginAttemptKey(login))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete login attempts of user", "error", err)
+		return ErrUnknown
+	}
+
+	for _, recordID := range files {
+		_, err = tx.ExecContext(ctx, `INSERT INTO deleted_files (record_id) VALUES ($1)`, recordID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed journal deleted file", "error", err)
+			return ErrUnknown
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in deleting user", "error", err)
+		return ErrUnknown
+	}
+
+	// User is already deleted, so files, which are left, are deleted from journal later.
+	err = deleteFiles(files)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete files of deleted user, they are left for sweep", "record_ids", files, "error", err)
+		return nil
+	}
+
+	err = storage.ForgetDeletedFiles(ctx, files)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed forget deleted files", "record_ids", files, "error", err)
+	}
+
+	return nil
+}
+
+// loginAttemptKey is key of login attempts of login in limiter, it matches key of login in handlers.
+func loginAttemptKey(login string) string {
+	return "login:" + login
+}
+
+// ListDeletedFiles gets IDs of file records of deleted users, which files weren't deleted yet.
+func (storage *DBStorage) ListDeletedFiles(ctx context.Context) ([]string, error) {
+	defer metrics.ObserveDBQuery("ListDeletedFiles", time.Now())
+
+	rows, err := storage.DB.QueryContext(ctx, `SELECT record_id FROM deleted_files`)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get deleted files", "error", err)
+		return nil, ErrUnknown
+	}
+	defer rows.Close()
+
+	files := make([]string, 0)
+
+	for rows.Next() {
+		var recordID string
+		err = rows.Scan(&recordID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed scan deleted file", "error", err)
+			return nil, ErrUnknown
+		}
+
+		files = append(files, recordID)
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get deleted files", "error", rows.Err())
+		return nil, ErrUnknown
+	}
+
+	return files, nil
+}
+
+// ForgetDeletedFiles removes file records from journal of deleted files after their files are deleted.
+func (storage *DBStorage) ForgetDeletedFiles(ctx context.Context, recordIDs []string) error {
+	defer metrics.ObserveDBQuery("ForgetDeletedFiles", time.Now())
+
+	for _, recordID := range recordIDs {
+		_, err := storage.DB.ExecContext(ctx, `DELETE FROM deleted_files WHERE record_id = $1`, recordID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed forget deleted file", "error", err)
+			return ErrUnknown
+		}
+	}
+
+	return nil
+}
+
+// SaveAuditEvent adds event to audit log of user.
+func (storage *DBStorage) SaveAuditEvent(ctx context.Context, event entity.AuditEvent) error {
+	defer metrics.ObserveDBQuery("SaveAuditEvent", time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := storage.DB.ExecContext(ctx, `INSERT INTO audit_events (user_id, action, record_id, ip, created_at, result) VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.UserID, event.Action, event.RecordID, event.IP, event.Time.UTC(), event.Result)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed save audit event", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// ListAuditEvents gets audit log of user in time range, newest events first.
+func (storage *DBStorage) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	defer metrics.ObserveDBQuery("ListAuditEvents", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return nil, ErrUserUnauthorized
+	}
+
+	if query.Limit < 0 || (!query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From)) {
+		return nil, ErrBadQuery
+	}
+
+	limit := int(query.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	args := []any{userID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	sqlQuery := strings.Builder{}
+	sqlQuery.WriteString(`SELECT action, record_id, ip, created_at, result FROM audit_events WHERE user_id = $1`)
+
+	if !query.From.IsZero() {
+		sqlQuery.WriteString(` AND created_at >= ` + arg(query.From.UTC()))
+	}
+
+	if !query.To.IsZero() {
+		sqlQuery.WriteString(` AND created_at < ` + arg(query.To.UTC()))
+	}
+
+	sqlQuery.WriteString(` ORDER BY created_at DESC, event_id DESC LIMIT ` + arg(limit))
+
+	rows, err := storage.DB.QueryContext(ctx, sqlQuery.String(), args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get audit events of user", "error", err)
+		return nil, ErrUnknown
+	}
+	defer rows.Close()
+
+	events := make([]entity.AuditEvent, 0)
+
+	for rows.Next() {
+		event := entity.AuditEvent{UserID: userID}
+		err = rows.Scan(&event.Action, &event.RecordID, &event.IP, &event.Time, &event.Result)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed scan audit event", "error", err)
+			return nil, ErrUnknown
+		}
+		events = append(events, event)
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get audit events of user", "error", rows.Err())
+		return nil, ErrUnknown
+	}
+
+	return events, nil
+}
+
+// Page size limits of records list.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// recordsSortColumns maps records sort to column, which is ordered by, and direction.
+var recordsSortColumns = map[entity.RecordsSort]struct {
+	column string
+	desc   bool
+}{
+	entity.SortByMetadata:     {"metadata", false},
+	entity.SortByMetadataDesc: {"metadata", true},
+	entity.SortByRevision:     {"revision", false},
+	entity.SortByRevisionDesc: {"revision", true},
+}
+
+// likeEscaper escapes special characters of LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// pageToken is position after last record of page. Key is value of sort column.
+type pageToken struct {
+	Key string `json:"key"`
+	ID  string `json:"id"`
+}
+
+// encodePageToken returns opaque token of position after record.
+func encodePageToken(sort entity.RecordsSort, record entity.Record) string {
+	token := pageToken{Key: record.Metadata, ID: record.ID}
+	if recordsSortColumns[sort].column == "revision" {
+		token.Key = strconv.FormatInt(record.Revision, 10)
+	}
+
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken returns position from token.
+func decodePageToken(sort entity.RecordsSort, encoded string) (pageToken, any, error) {
+	token := pageToken{}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return token, nil, ErrBadQuery
+	}
+
+	err = json.Unmarshal(data, &token)
+	if err != nil || token.ID == "" {
+		return token, nil, ErrBadQuery
+	}
+
+	if recordsSortColumns[sort].column == "revision" {
+		revision, err := strconv.ParseInt(token.Key, 10, 64)
+		if err != nil {
+			return token, nil, ErrBadQuery
+		}
+		return token, revision, nil
+	}
+
+	return token, token.Key, nil
+}
+
+// GetRecordsInfo gets one page of DB records from this user, which are matched by query.
+func (storage *DBStorage) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	defer metrics.ObserveDBQuery("GetRecordsInfo", time.Now())
+
+	page := entity.RecordsPage{}
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting all records")
+		return page, ErrUserUnauthorized
+	}
+
+	order, ok := recordsSortColumns[query.Sort]
+	if !ok || query.PageSize < 0 {
+		return page, ErrBadQuery
+	}
+
+	pageSize := int(query.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	sqlQuery := &strings.Builder{}
+	args := []any{userID}
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	sqlQuery.WriteString(`SELECT record_id, record_type, metadata, revision FROM users_data WHERE user_id = $1 AND NOT deleted`)
+
+	if len(query.Types) != 0 {
+		placeholders := make([]string, 0, len(query.Types))
+		for _, recordType := range query.Types {
+			placeholders = append(placeholders, arg(recordType))
+		}
+		sqlQuery.WriteString(` AND record_type IN (` + strings.Join(placeholders, ", ") + `)`)
+	}
+
+	if query.Metadata != "" {
+		// ILIKE is only in PostgreSQL, LOWER with LIKE works in SQLite too.
+		sqlQuery.WriteString(` AND LOWER(metadata) LIKE LOWER(` + arg("%"+likeEscaper.Replace(query.Metadata)+"%") + `) ESCAPE '\'`)
+	}
+
+	comparison, direction := ">", "ASC"
+	if order.desc {
+		comparison, direction = "<", "DESC"
+	}
+
+	if query.PageToken != "" {
+		token, key, err := decodePageToken(query.Sort, query.PageToken)
+		if err != nil {
+			return page, err
+		}
+		sqlQuery.WriteString(` AND (` + order.column + `, record_id) ` + comparison + ` (` + arg(key) + `, ` + arg(token.ID) + `)`)
+	}
+
+	sqlQuery.WriteString(` ORDER BY ` + order.column + ` ` + direction + `, record_id ` + direction + ` LIMIT ` + arg(pageSize+1))
+
+	rows, err := storage.DB.QueryContext(ctx, sqlQuery.String(), args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get rows in getting all records", "error", err)
+		return page, ErrUnknown
+	}
+
+	defer rows.Close()
+
+	page.Records = make([]entity.Record, 0, 10)
+	var row entity.Record
+	for rows.Next() {
+		err := rows.Scan(&row.ID, &row.Type, &row.Metadata, &row.Revision)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed get next row in getting all records", "error", err)
+			return page, ErrUnknown
+		}
+
+		page.Records = append(page.Records, row)
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get rows in getting all records", "error", rows.Err())
+		return page, ErrUnknown
+	}
+
+	// One extra record was requested to find out if there is next page.
+	if len(page.Records) > pageSize {
+		page.Records = page.Records[:pageSize]
+		page.NextPageToken = encodePageToken(query.Sort, page.Records[pageSize-1])
+	}
+
+	return page, nil
+}
+
+// CreateRecord saves new record to DB, returns recordID.
+func (storage *DBStorage) CreateRecord(ctx context.Context, record entity.Record) (string, error) {
+	defer metrics.ObserveDBQuery("CreateRecord", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting all records")
+		return "", ErrUserUnauthorized
+	}
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in creating record", "error", err)
+		return "", ErrUnknown
+	}
+	defer tx.Rollback()
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	hexDataString := hex.EncodeToString(record.Data)
+
+	row := tx.QueryRowContext(ctx, `INSERT INTO users_data (user_id, record_type, metadata, encoded_data, revision, created_revision, data_size) VALUES ($1, $2, $3, $4, $5, $5, $6) RETURNING record_id`, userID, record.Type, record.Metadata, hexDataString, revision, len(record.Data))
+
+	recordID := ""
+
+	err = row.Scan(&recordID)
+	if err != nil || row.Err() != nil {
+		return "", ErrUnknown
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in creating record", "error", err)
+		return "", ErrUnknown
+	}
+
+	return recordID, nil
+}
+
+// UpdateRecord replaces record data and metadata in DB if record revision wasn't changed since it was read. Returns new revision.
+// Type of record can't be changed, for record of other type ErrRecordType is returned.
+func (storage *DBStorage) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	return storage.updateRecord(ctx, record, nil)
+}
+
+// UpdateFileRecord updates file record like UpdateRecord. Staged file of record is journaled in the same transaction,
+// so record and its file are switched at once, file is moved in place from journal later.
+func (storage *DBStorage) UpdateFileRecord(ctx context.Context, record entity.Record, file entity.StagedFile) (int64, error) {
+	return storage.updateRecord(ctx, record, []entity.StagedFile{file})
+}
+
+// updateRecord updates record and journals staged files in one transaction.
+func (storage *DBStorage) updateRecord(ctx context.Context, record entity.Record, files []entity.StagedFile) (int64, error) {
+	defer metrics.ObserveDBQuery("UpdateRecord", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in updating record")
+		return 0, ErrUserUnauthorized
+	}
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in updating record", "error", err)
+		return 0, ErrUnknown
+	}
+	defer tx.Rollback()
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	hexDataString := hex.EncodeToString(record.Data)
+
+	result, err := tx.ExecContext(ctx, `UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted`, record.Metadata, hexDataString, revision, len(record.Data), record.ID, userID, record.Revision, record.Type)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed update record", "error", err)
+		return 0, ErrUnknown
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected records", "error", err)
+		return 0, ErrUnknown
+	}
+
+	if rowsAffected == 0 {
+		return 0, updateMissReason(ctx, tx, userID, record.ID, record.Type)
+	}
+
+	err = stageFiles(ctx, tx, files)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in updating record", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return revision, nil
+}
+
+// ReplaceRecords replaces data of all records of user in one transaction. Every record should have revision, which was read,
+// and there should be all records of user, otherwise nothing is replaced. Returns new revision.
+func (storage *DBStorage) ReplaceRecords(ctx context.Context, records []entity.Record) (int64, error) {
+	return storage.ReplaceFileRecords(ctx, records, nil)
+}
+
+// ReplaceFileRecords replaces records like ReplaceRecords. Staged files of file records are journaled in the same
+// transaction, so records and their files are switched at once, files are moved in place from journal later.
+func (storage *DBStorage) ReplaceFileRecords(ctx context.Context, records []entity.Record, files []entity.StagedFile) (int64, error) {
+	defer metrics.ObserveDBQuery("ReplaceRecords", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in replacing records")
+		return 0, ErrUserUnauthorized
+	}
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in replacing records", "error", err)
+		return 0, ErrUnknown
+	}
+	defer tx.Rollback()
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, record := range records {
+		hexDataString := hex.EncodeToString(record.Data)
+
+		result, err := tx.ExecContext(ctx, `UPDATE users_data SET encoded_data = $1, revision = $2, data_size = $3 WHERE record_id = $4 AND user_id = $5 AND revision = $6 AND record_type = $7 AND NOT deleted`, hexDataString, revision, len(record.Data), record.ID, userID, record.Revision, record.Type)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed replace record", "error", err)
+			return 0, ErrUnknown
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed get affected records", "error", err)
+			return 0, ErrUnknown
+		}
+
+		if rowsAffected == 0 {
+			return 0, updateMissReason(ctx, tx, userID, record.ID, record.Type)
+		}
+	}
+
+	// Record created while batch was prepared isn't replaced, so whole batch is stale.
+	row := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users_data WHERE user_id = $1 AND NOT deleted`, userID)
+
+	counter := 0
+	err = row.Scan(&counter)
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed count records of user", "error", err)
+		return 0, ErrUnknown
+	}
+
+	if counter != len(records) {
+		return 0, ErrRevisionConflict
+	}
+
+	err = stageFiles(ctx, tx, files)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in replacing records", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return revision, nil
+}
+
+// SetRecordSize sets size of record data, which is kept in file storage. Revision of record isn't changed.
+func (storage *DBStorage) SetRecordSize(ctx context.Context, recordID string, size int64) error {
+	defer metrics.ObserveDBQuery("SetRecordSize", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in setting record size")
+		return ErrUserUnauthorized
+	}
+
+	result, err := storage.DB.ExecContext(ctx, `UPDATE users_data SET data_size = $1 WHERE record_id = $2 AND user_id = $3 AND NOT deleted`, size, recordID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed set record size", "error", err)
+		return ErrUnknown
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected records", "error", err)
+		return ErrUnknown
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetRecordSize gets size of record data, which is counted in usage.
+func (storage *DBStorage) GetRecordSize(ctx context.Context, recordID string) (int64, error) {
+	defer metrics.ObserveDBQuery("GetRecordSize", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting record size")
+		return 0, ErrUserUnauthorized
+	}
+
+	var size int64
+	err := storage.DB.QueryRowContext(ctx, `SELECT data_size FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted`, recordID, userID).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get record size", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return size, nil
+}
+
+// ListUnsizedFiles gets file records of all users with zero size, record IDs are mapped to their owners.
+func (storage *DBStorage) ListUnsizedFiles(ctx context.Context) (map[string]entity.UserID, error) {
+	defer metrics.ObserveDBQuery("ListUnsizedFiles", time.Now())
+
+	rows, err := storage.DB.QueryContext(ctx, `SELECT record_id, user_id FROM users_data WHERE record_type = $1 AND data_size = 0 AND NOT deleted`, entity.TypeFile)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get file records without size", "error", err)
+		return nil, ErrUnknown
+	}
+	defer rows.Close()
+
+	files := make(map[string]entity.UserID)
+
+	for rows.Next() {
+		var recordID string
+		var userID entity.UserID
+		err = rows.Scan(&recordID, &userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed scan file record without size", "error", err)
+			return nil, ErrUnknown
+		}
+
+		files[recordID] = userID
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get file records without size", "error", rows.Err())
+		return nil, ErrUnknown
+	}
+
+	return files, nil
+}
+
+// GetUsage gets count of records of user and total size of their data. Quota isn't known to DB, so it's empty.
+func (storage *DBStorage) GetUsage(ctx context.Context) (entity.Usage, error) {
+	defer metrics.ObserveDBQuery("GetUsage", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting usage")
+		return entity.Usage{}, ErrUserUnauthorized
+	}
+
+	usage := entity.Usage{}
+
+	row := storage.DB.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(data_size), 0) FROM users_data WHERE user_id = $1 AND NOT deleted`, userID)
+	err := row.Scan(&usage.Records, &usage.Bytes)
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get usage of user", "error", err)
+		return entity.Usage{}, ErrUnknown
+	}
+
+	return usage, nil
+}
+
+// GetStagedFile gets staged file of record from journal. Returns ErrNotFound, if file of record was moved in place.
+func (storage *DBStorage) GetStagedFile(ctx context.Context, recordID string) (entity.StagedFile, error) {
+	defer metrics.ObserveDBQuery("GetStagedFile", time.Now())
+
+	file := entity.StagedFile{RecordID: recordID}
+
+	row := storage.DB.QueryRowContext(ctx, `SELECT staged FROM staged_files WHERE record_id = $1`, recordID)
+	err := row.Scan(&file.Name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.StagedFile{}, ErrNotFound
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get staged file of record", "error", err)
+		return entity.StagedFile{}, ErrUnknown
+	}
+
+	return file, nil
+}
+
+// ListStagedFiles gets staged files of all users from journal.
+func (storage *DBStorage) ListStagedFiles(ctx context.Context) ([]entity.StagedFile, error) {
+	defer metrics.ObserveDBQuery("ListStagedFiles", time.Now())
+
+	rows, err := storage.DB.QueryContext(ctx, `SELECT record_id, staged FROM staged_files`)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get staged files", "error", err)
+		return nil, ErrUnknown
+	}
+	defer rows.Close()
+
+	files := make([]entity.StagedFile, 0)
+
+	for rows.Next() {
+		var file entity.StagedFile
+		err = rows.Scan(&file.RecordID, &file.Name)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed scan staged file", "error", err)
+			return nil, ErrUnknown
+		}
+
+		files = append(files, file)
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get staged files", "error", rows.Err())
+		return nil, ErrUnknown
+	}
+
+	return files, nil
+}
+
+// DeleteStagedFile deletes staged file from journal after it's moved in place. Newer staged file of record is kept.
+func (storage *DBStorage) DeleteStagedFile(ctx context.Context, file entity.StagedFile) error {
+	defer metrics.ObserveDBQuery("DeleteStagedFile", time.Now())
+
+	_, err := storage.DB.ExecContext(ctx, `DELETE FROM staged_files WHERE record_id = $1 AND staged = $2`, file.RecordID, file.Name)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete staged file", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// stageFiles journals staged files of updated records and sets sizes of records to sizes of staged data.
+func stageFiles(ctx context.Context, tx *sql.Tx, files []entity.StagedFile) error {
+	for _, file := range files {
+		_, err := tx.ExecContext(ctx, `UPDATE users_data SET data_size = $1 WHERE record_id = $2`, file.Size, file.RecordID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed set size of staged record", "error", err)
+			return ErrUnknown
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO staged_files (record_id, staged) VALUES ($1, $2) ON CONFLICT (record_id) DO UPDATE SET staged = excluded.staged`, file.RecordID, file.Name)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed journal staged file", "error", err)
+			return ErrUnknown
+		}
+	}
+
+	return nil
+}
+
+// nextRevision increments revision counter of user. Row lock keeps user changes ordered until transaction ends.
+func nextRevision(ctx context.Context, tx *sql.Tx, userID entity.UserID) (int64, error) {
+	row := tx.QueryRowContext(ctx, `UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision`, userID)
+
+	var revision int64
+	err := row.Scan(&revision)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserUnauthorized
+	}
+
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed increment user revision", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return revision, nil
+}
+
+// updateMissReason finds out why update didn't change any row: record doesn't exist or it has another revision.
+func updateMissReason(ctx context.Context, tx *sql.Tx, userID entity.UserID, recordID string, recordType entity.RecordType) error {
+	row := tx.QueryRowContext(ctx, `SELECT record_type FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted`, recordID, userID)
+
+	var storedType entity.RecordType
+	err := row.Scan(&storedType)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get row while checking for record existence", "error", err)
+		return ErrUnknown
+	}
+
+	if storedType != recordType {
+		return ErrRecordType
+	}
+
+	return ErrRevisionConflict
+}
+
+// GetRecord gets record from DB by ID.
+func (storage *DBStorage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
+	defer metrics.ObserveDBQuery("GetRecord", time.Now())
+
+	record := entity.Record{}
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting all records")
+		return record, ErrUserUnauthorized
+	}
+
+	row := storage.DB.QueryRowContext(ctx, `SELECT record_id, record_type, metadata, encoded_data, revision FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted`, recordID, userID)
+
+	hexDataString := ""
+
+	err := row.Scan(&record.ID, &record.Type, &record.Metadata, &hexDataString, &record.Revision)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrNotFound
+	}
+
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed scan rows to find needed record", "error", err)
+		return record, ErrUnknown
+	}
+
+	record.Data, err = hex.DecodeString(hexDataString)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed convert record data from hex to bytes", "error", err)
+		return record, ErrUnknown
+	}
+
+	return record, nil
+}
+
+// DeleteRecord deletes record from DB by ID. Record is left as tombstone, so other clients can find out about deletion.
+func (storage *DBStorage) DeleteRecord(ctx context.Context, recordID string) error {
+	defer metrics.ObserveDBQuery("DeleteRecord", time.Now())
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting all records")
+		return ErrUserUnauthorized
+	}
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in deleting record", "error", err)
+		return ErrUnknown
+	}
+	defer tx.Rollback()
+
+	revision, err := nextRevision(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE users_data SET deleted = TRUE, deleted_at = $1, metadata = '', encoded_data = '', data_size = 0, revision = $2 WHERE record_id = $3 AND user_id = $4 AND NOT deleted`, time.Now().UTC(), revision, recordID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete record", "error", err)
+		return ErrUnknown
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get affected records", "error", err)
+		return ErrUnknown
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in deleting record", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// GetChanges gets records of this user, which were created, updated or deleted after given revision.
+// Returns ErrResyncRequired, if tombstones of records deleted after revision were pruned. Changes since zero revision
+// are all records, so they never require resync.
+func (storage *DBStorage) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	defer metrics.ObserveDBQuery("GetChanges", time.Now())
+
+	changes := entity.Changes{}
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get userID from context in getting changes")
+		return changes, ErrUserUnauthorized
+	}
+
+	// Revision is read first: every change up to it is already committed, later ones will come with next sync.
+	row := storage.DB.QueryRowContext(ctx, `SELECT revision FROM users WHERE user_id = $1`, userID)
+
+	err := row.Scan(&changes.Revision)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return changes, ErrUserUnauthorized
+	}
+
+	if err != nil || row.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get user revision", "error", err)
+		return changes, ErrUnknown
+	}
+
+	rows, err := storage.DB.QueryContext(ctx, `SELECT record_id, record_type, metadata, revision, created_revision, deleted FROM users_data WHERE user_id = $1 AND revision > $2 AND revision <= $3 ORDER BY revision`, userID, sinceRevision, changes.Revision)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get rows in getting changes", "error", err)
+		return changes, ErrUnknown
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var record entity.Record
+		var createdRevision int64
+		var deleted bool
+
+		err := rows.Scan(&record.ID, &record.Type, &record.Metadata, &record.Revision, &createdRevision, &deleted)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed get next row in getting changes", "error", err)
+			return changes, ErrUnknown
+		}
+
+		switch {
+		case deleted:
+			changes.Deleted = append(changes.Deleted, record.ID)
+		case createdRevision > sinceRevision:
+			changes.Created = append(changes.Created, record)
+		default:
+			changes.Updated = append(changes.Updated, record)
+		}
+	}
+
+	if rows.Err() != nil {
+		slog.ErrorContext(ctx, "Failed get rows in getting changes", "error", rows.Err())
+		return changes, ErrUnknown
+	}
+
+	if sinceRevision == 0 {
+		return changes, nil
+	}
+
+	// Pruned revision is read after changes: tombstones are deleted in the same transaction, which moves it,
+	// so changes without pruned tombstones always see it.
+	var prunedRevision int64
+	err = storage.DB.QueryRowContext(ctx, `SELECT pruned_revision FROM users WHERE user_id = $1`, userID).Scan(&prunedRevision)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get pruned revision of user", "error", err)
+		return entity.Changes{}, ErrUnknown
+	}
+
+	if sinceRevision < prunedRevision {
+		return entity.Changes{}, ErrResyncRequired
+	}
+
+	return changes, nil
+}
+
+// PruneTombstones deletes tombstones of records of all users, which were deleted before given time.
+// Pruned revision of user is moved to the last pruned tombstone, so clients, which synced before it, resync all records.
+// Returns count of deleted tombstones.
+func (storage *DBStorage) PruneTombstones(ctx context.Context, before time.Time) (int64, error) {
+	defer metrics.ObserveDBQuery("PruneTombstones", time.Now())
+
+	tx, err := storage.DB.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed begin transaction in pruning tombstones", "error", err)
+		return 0, ErrUnknown
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, MAX(revision) FROM users_data WHERE deleted AND deleted_at < $1 GROUP BY user_id`, before.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get tombstones to prune", "error", err)
+		return 0, ErrUnknown
+	}
+
+	revisions := make(map[string]int64)
+
+	for rows.Next() {
+		var userID string
+		var revision int64
+		err = rows.Scan(&userID, &revision)
+		if err != nil {
+			rows.Close()
+			slog.ErrorContext(ctx, "Failed scan tombstones to prune", "error", err)
+			return 0, ErrUnknown
+		}
+
+		revisions[userID] = revision
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		slog.ErrorContext(ctx, "Failed get tombstones to prune", "error", rows.Err())
+		return 0, ErrUnknown
+	}
+	rows.Close()
+
+	var pruned int64
+
+	for userID, revision := range revisions {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET pruned_revision = $1 WHERE user_id = $2 AND pruned_revision < $1`, revision, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed update pruned revision of user", "error", err)
+			return 0, ErrUnknown
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM users_data WHERE user_id = $1 AND deleted AND revision <= $2`, userID, revision)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed delete tombstones", "error", err)
+			return 0, ErrUnknown
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed get deleted tombstones", "error", err)
+			return 0, ErrUnknown
+		}
+
+		pruned += rowsAffected
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed commit transaction in pruning tombstones", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return pruned, nil
+}
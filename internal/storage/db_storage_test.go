@@ -2,11 +2,14 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/size12/gophkeeper/internal/config"
 	"github.com/size12/gophkeeper/internal/entity"
@@ -20,6 +23,22 @@ func TestNewDBStorage(t *testing.T) {
 	})
 }
 
+func TestDBStorage_Ping(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	mock.ExpectPing()
+	assert.NoError(t, storage.Ping(context.Background()))
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	assert.Error(t, storage.Ping(context.Background()))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestDBStorage_CreateUser(t *testing.T) {
 	cfg := config.GetServerConfig()
 	storage := NewDBStorage(cfg.DBConnectionURL)
@@ -36,12 +55,12 @@ func TestDBStorage_CreateUser(t *testing.T) {
 			"Create user with good credentials (doesn't exists)",
 			func() {
 				mock.ExpectQuery(`SELECT COUNT(*) FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-				mock.ExpectExec(`INSERT INTO users (login, password) VALUES ($1, $2)`).WithArgs("my_login", "my_password").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO users (login, password, password_algorithm) VALUES ($1, $2, $3)`).WithArgs("my_login", "my_password", entity.PasswordArgon2id).WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 			func() {
-				err := storage.CreateUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
+				err := storage.CreateUser(context.Background(), "my_login", entity.StoredPassword{
+					Hash:      "my_password",
+					Algorithm: entity.PasswordArgon2id,
 				})
 				assert.NoError(t, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
@@ -51,26 +70,42 @@ func TestDBStorage_CreateUser(t *testing.T) {
 			"Create user with good credentials (doesn't exists), but DB will return error",
 			func() {
 				mock.ExpectQuery(`SELECT COUNT(*) FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-				mock.ExpectExec(`INSERT INTO users (login, password) VALUES ($1, $2)`).WithArgs("my_login", "my_password").WillReturnError(errors.New("some DB error"))
+				mock.ExpectExec(`INSERT INTO users (login, password, password_algorithm) VALUES ($1, $2, $3)`).WithArgs("my_login", "my_password", entity.PasswordArgon2id).WillReturnError(errors.New("some DB error"))
 			},
 			func() {
-				err := storage.CreateUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
+				err := storage.CreateUser(context.Background(), "my_login", entity.StoredPassword{
+					Hash:      "my_password",
+					Algorithm: entity.PasswordArgon2id,
 				})
 				assert.Equal(t, ErrUnknown, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
+		{
+			"Create user, but same login is created concurrently",
+			func() {
+				mock.ExpectQuery(`SELECT COUNT(*) FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(`INSERT INTO users (login, password, password_algorithm) VALUES ($1, $2, $3)`).WithArgs("my_login", "my_password", entity.PasswordArgon2id).
+					WillReturnError(&pgconn.PgError{Code: pgUniqueViolation})
+			},
+			func() {
+				err := storage.CreateUser(context.Background(), "my_login", entity.StoredPassword{
+					Hash:      "my_password",
+					Algorithm: entity.PasswordArgon2id,
+				})
+				assert.Equal(t, ErrLoginExists, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
 		{
 			"Create user with good credentials (already exists)",
 			func() {
 				mock.ExpectQuery(`SELECT COUNT(*) FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 			},
 			func() {
-				err := storage.CreateUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
+				err := storage.CreateUser(context.Background(), "my_login", entity.StoredPassword{
+					Hash:      "my_password",
+					Algorithm: entity.PasswordArgon2id,
 				})
 				assert.Equal(t, ErrLoginExists, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
@@ -85,7 +120,958 @@ func TestDBStorage_CreateUser(t *testing.T) {
 	}
 }
 
-func TestDBStorage_LoginUser(t *testing.T) {
+func TestDBStorage_GetPassword(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get password of existing user",
+			func() {
+				mock.ExpectQuery(`SELECT user_id, password, password_algorithm FROM users WHERE login = $1`).WithArgs("my_login").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "password", "password_algorithm"}).AddRow("6584c88d-1bb4-4686-83be-925abb24fc20", "hash", entity.PasswordSHA256))
+			},
+			func() {
+				password, err := storage.GetPassword(context.Background(), "my_login")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.StoredPassword{
+					UserID:    "6584c88d-1bb4-4686-83be-925abb24fc20",
+					Hash:      "hash",
+					Algorithm: entity.PasswordSHA256,
+				}, password)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get password of user, but DB will return error",
+			func() {
+				mock.ExpectQuery(`SELECT user_id, password, password_algorithm FROM users WHERE login = $1`).WithArgs("my_login").WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				_, err := storage.GetPassword(context.Background(), "my_login")
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get password of not existing user",
+			func() {
+				mock.ExpectQuery(`SELECT user_id, password, password_algorithm FROM users WHERE login = $1`).WithArgs("my_login").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "password", "password_algorithm"}))
+			},
+			func() {
+				_, err := storage.GetPassword(context.Background(), "my_login")
+				assert.Equal(t, ErrWrongCredentials, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_UpdatePassword(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	password := entity.StoredPassword{UserID: "userID", Hash: "hash", Algorithm: entity.PasswordArgon2id}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Update password",
+			func() {
+				mock.ExpectExec(`UPDATE users SET password = $1, password_algorithm = $2 WHERE user_id = $3`).
+					WithArgs("hash", entity.PasswordArgon2id, "userID").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.UpdatePassword(context.Background(), password))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update password, but DB will return error",
+			func() {
+				mock.ExpectExec(`UPDATE users SET password = $1, password_algorithm = $2 WHERE user_id = $3`).
+					WithArgs("hash", entity.PasswordArgon2id, "userID").WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				assert.Equal(t, ErrUnknown, storage.UpdatePassword(context.Background(), password))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_GetUserID(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get ID of existing user",
+			func() {
+				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("6584c88d-1bb4-4686-83be-925abb24fc20"))
+			},
+			func() {
+				userID, err := storage.GetUserID(context.Background(), "my_login")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"), userID)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get ID of not existing user",
+			func() {
+				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1`).WithArgs("my_login").WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			},
+			func() {
+				_, err := storage.GetUserID(context.Background(), "my_login")
+				assert.Equal(t, ErrNotFound, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get ID of user, but DB will return error",
+			func() {
+				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1`).WithArgs("my_login").WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				_, err := storage.GetUserID(context.Background(), "my_login")
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_RefreshTokens(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	expiresAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := entity.RefreshToken{Hash: "hash", UserID: "userID", SessionID: "sessionID", ExpiresAt: expiresAt}
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Save refresh token",
+			func() {
+				mock.ExpectExec(`INSERT INTO refresh_tokens (token_hash, user_id, session_id, expires_at) VALUES ($1, $2, $3, $4)`).
+					WithArgs("hash", "userID", "sessionID", expiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.SaveRefreshToken(context.Background(), token))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Save refresh token, but DB will return error",
+			func() {
+				mock.ExpectExec(`INSERT INTO refresh_tokens (token_hash, user_id, session_id, expires_at) VALUES ($1, $2, $3, $4)`).
+					WithArgs("hash", "userID", "sessionID", expiresAt).WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				assert.Equal(t, ErrUnknown, storage.SaveRefreshToken(context.Background(), token))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use refresh token",
+			func() {
+				mock.ExpectQuery(`DELETE FROM refresh_tokens WHERE token_hash = $1 RETURNING user_id, session_id, expires_at`).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "session_id", "expires_at"}).AddRow("userID", "sessionID", expiresAt))
+			},
+			func() {
+				got, err := storage.UseRefreshToken(context.Background(), "hash")
+				assert.NoError(t, err)
+				assert.Equal(t, token, got)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use unknown refresh token",
+			func() {
+				mock.ExpectQuery(`DELETE FROM refresh_tokens WHERE token_hash = $1 RETURNING user_id, session_id, expires_at`).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "session_id", "expires_at"}))
+			},
+			func() {
+				_, err := storage.UseRefreshToken(context.Background(), "hash")
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete session tokens",
+			func() {
+				mock.ExpectExec(`DELETE FROM refresh_tokens WHERE user_id = $1 AND session_id = $2`).WithArgs("userID", "sessionID").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			func() {
+				assert.NoError(t, storage.DeleteSessionTokens(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete session tokens without user",
+			func() {},
+			func() {
+				assert.Equal(t, ErrUserUnauthorized, storage.DeleteSessionTokens(context.Background(), "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_Sessions(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	createdAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := entity.SessionInfo{
+		ID:         "sessionID",
+		UserID:     "userID",
+		Device:     entity.Device{Name: "laptop", IP: "127.0.0.1", UserAgent: "gophkeeper-client"},
+		CreatedAt:  createdAt,
+		LastSeenAt: createdAt,
+	}
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Create session",
+			func() {
+				mock.ExpectExec(`INSERT INTO sessions (session_id, user_id, device_name, ip, user_agent, created_at, last_seen_at) VALUES ($1, $2, $3, $4, $5, $6, $6)`).
+					WithArgs("sessionID", "userID", "laptop", "127.0.0.1", "gophkeeper-client", createdAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.CreateSession(context.Background(), session))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Touch active session, which wasn't seen recently",
+			func() {
+				mock.ExpectQuery(`SELECT last_seen_at FROM sessions WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnRows(sqlmock.NewRows([]string{"last_seen_at"}).AddRow(createdAt))
+				mock.ExpectExec(`UPDATE sessions SET last_seen_at = $1 WHERE session_id = $2 AND user_id = $3 AND NOT revoked`).
+					WithArgs(sqlmock.AnyArg(), "sessionID", "userID").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.TouchSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Touch recently seen session, last seen time isn't updated",
+			func() {
+				mock.ExpectQuery(`SELECT last_seen_at FROM sessions WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnRows(sqlmock.NewRows([]string{"last_seen_at"}).AddRow(time.Now().UTC()))
+			},
+			func() {
+				assert.NoError(t, storage.TouchSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Touch revoked session",
+			func() {
+				mock.ExpectQuery(`SELECT last_seen_at FROM sessions WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnRows(sqlmock.NewRows([]string{"last_seen_at"}))
+			},
+			func() {
+				assert.Equal(t, ErrUserUnauthorized, storage.TouchSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Touch session, which was revoked after check",
+			func() {
+				mock.ExpectQuery(`SELECT last_seen_at FROM sessions WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnRows(sqlmock.NewRows([]string{"last_seen_at"}).AddRow(createdAt))
+				mock.ExpectExec(`UPDATE sessions SET last_seen_at = $1 WHERE session_id = $2 AND user_id = $3 AND NOT revoked`).
+					WithArgs(sqlmock.AnyArg(), "sessionID", "userID").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() {
+				assert.Equal(t, ErrUserUnauthorized, storage.TouchSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List sessions",
+			func() {
+				mock.ExpectQuery(`SELECT session_id, device_name, ip, user_agent, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND NOT revoked ORDER BY last_seen_at DESC`).
+					WithArgs("userID").
+					WillReturnRows(sqlmock.NewRows([]string{"session_id", "device_name", "ip", "user_agent", "created_at", "last_seen_at"}).
+						AddRow("sessionID", "laptop", "127.0.0.1", "gophkeeper-client", createdAt, createdAt))
+			},
+			func() {
+				sessions, err := storage.ListSessions(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.SessionInfo{session}, sessions)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List sessions, but DB will return error",
+			func() {
+				mock.ExpectQuery(`SELECT session_id, device_name, ip, user_agent, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND NOT revoked ORDER BY last_seen_at DESC`).
+					WithArgs("userID").WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				_, err := storage.ListSessions(ctx)
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Revoke session",
+			func() {
+				mock.ExpectExec(`UPDATE sessions SET revoked = TRUE WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.RevokeSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Revoke not existing session",
+			func() {
+				mock.ExpectExec(`UPDATE sessions SET revoked = TRUE WHERE session_id = $1 AND user_id = $2 AND NOT revoked`).
+					WithArgs("sessionID", "userID").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() {
+				assert.Equal(t, ErrNotFound, storage.RevokeSession(ctx, "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Revoke session without user",
+			func() {},
+			func() {
+				assert.Equal(t, ErrUserUnauthorized, storage.RevokeSession(context.Background(), "sessionID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Count active sessions",
+			func() {
+				mock.ExpectQuery(`SELECT count(*) FROM sessions WHERE NOT revoked AND last_seen_at > $1`).
+					WithArgs(createdAt).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+			},
+			func() {
+				count, err := storage.CountActiveSessions(context.Background(), createdAt)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), count)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_TOTP(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get TOTP secret",
+			func() {
+				mock.ExpectQuery(`SELECT secret, confirmed, last_step FROM totp_secrets WHERE user_id = $1`).
+					WithArgs("userID").
+					WillReturnRows(sqlmock.NewRows([]string{"secret", "confirmed", "last_step"}).AddRow("SECRET", true, 100))
+			},
+			func() {
+				totp, err := storage.GetTOTP(context.Background(), "userID")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.TOTP{UserID: "userID", Secret: "SECRET", Confirmed: true, LastStep: 100}, totp)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get TOTP secret of user without TOTP",
+			func() {
+				mock.ExpectQuery(`SELECT secret, confirmed, last_step FROM totp_secrets WHERE user_id = $1`).
+					WithArgs("userID").WillReturnError(sql.ErrNoRows)
+			},
+			func() {
+				_, err := storage.GetTOTP(context.Background(), "userID")
+				assert.Equal(t, ErrNotFound, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Save TOTP secret",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO totp_secrets (user_id, secret) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed = FALSE, last_step = 0`).
+					WithArgs("userID", "SECRET").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM totp_backup_codes WHERE user_id = $1`).
+					WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO totp_backup_codes (user_id, code_hash) VALUES ($1, $2)`).
+					WithArgs("userID", "hash1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO totp_backup_codes (user_id, code_hash) VALUES ($1, $2)`).
+					WithArgs("userID", "hash2").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			func() {
+				err := storage.SaveTOTP(context.Background(), entity.TOTP{UserID: "userID", Secret: "SECRET"}, []string{"hash1", "hash2"})
+				assert.NoError(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Save TOTP secret, but DB will return error",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO totp_secrets (user_id, secret) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed = FALSE, last_step = 0`).
+					WithArgs("userID", "SECRET").WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
+			},
+			func() {
+				err := storage.SaveTOTP(context.Background(), entity.TOTP{UserID: "userID", Secret: "SECRET"}, nil)
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use TOTP step",
+			func() {
+				mock.ExpectExec(`UPDATE totp_secrets SET confirmed = TRUE, last_step = $1 WHERE user_id = $2 AND last_step < $1`).
+					WithArgs(int64(101), "userID").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.UseTOTPStep(context.Background(), "userID", 101))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use TOTP step, which was already used",
+			func() {
+				mock.ExpectExec(`UPDATE totp_secrets SET confirmed = TRUE, last_step = $1 WHERE user_id = $2 AND last_step < $1`).
+					WithArgs(int64(100), "userID").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() {
+				assert.Equal(t, ErrWrongCredentials, storage.UseTOTPStep(context.Background(), "userID", 100))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use backup code",
+			func() {
+				mock.ExpectExec(`DELETE FROM totp_backup_codes WHERE user_id = $1 AND code_hash = $2`).
+					WithArgs("userID", "hash1").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				assert.NoError(t, storage.UseBackupCode(context.Background(), "userID", "hash1"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Use unknown backup code",
+			func() {
+				mock.ExpectExec(`DELETE FROM totp_backup_codes WHERE user_id = $1 AND code_hash = $2`).
+					WithArgs("userID", "hash1").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() {
+				assert.Equal(t, ErrWrongCredentials, storage.UseBackupCode(context.Background(), "userID", "hash1"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete TOTP secret",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM totp_secrets WHERE user_id = $1`).
+					WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM totp_backup_codes WHERE user_id = $1`).
+					WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 10))
+				mock.ExpectCommit()
+			},
+			func() {
+				assert.NoError(t, storage.DeleteTOTP(context.Background(), "userID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete TOTP secret of user without TOTP",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM totp_secrets WHERE user_id = $1`).
+					WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			func() {
+				assert.Equal(t, ErrNotFound, storage.DeleteTOTP(context.Background(), "userID"))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_DeleteUser(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+
+	expectDelete := func(login *sqlmock.Rows, rows *sqlmock.Rows, files ...string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM users WHERE user_id = $1 RETURNING login`).
+			WithArgs("userID").WillReturnRows(login)
+		mock.ExpectQuery(`DELETE FROM users_data WHERE user_id = $1 RETURNING record_id, record_type`).
+			WithArgs("userID").WillReturnRows(rows)
+		mock.ExpectExec(`DELETE FROM sessions WHERE user_id = $1`).
+			WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`DELETE FROM refresh_tokens WHERE user_id = $1`).
+			WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`DELETE FROM totp_secrets WHERE user_id = $1`).
+			WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM totp_backup_codes WHERE user_id = $1`).
+			WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM audit_events WHERE user_id = $1`).
+			WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.ExpectExec(`DELETE FROM login_attempts WHERE attempt_key = $1`).
+			WithArgs("login:login").WillReturnResult(sqlmock.NewResult(0, 1))
+		for _, recordID := range files {
+			mock.ExpectExec(`INSERT INTO deleted_files (record_id) VALUES ($1)`).
+				WithArgs(recordID).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+	loginRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"login"}).AddRow("login")
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete user, file records are passed to deleteFiles",
+			func() {
+				expectDelete(loginRows(), sqlmock.NewRows([]string{"record_id", "record_type"}).
+					AddRow("1", entity.TypeText).AddRow("2", entity.TypeFile), "2")
+				mock.ExpectCommit()
+				mock.ExpectExec(`DELETE FROM deleted_files WHERE record_id = $1`).
+					WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				var deleted []string
+				err := storage.DeleteUser(ctx, func(recordIDs []string) error {
+					deleted = recordIDs
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"2"}, deleted)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete user, but files weren't deleted, user is deleted anyway and files are left in journal",
+			func() {
+				expectDelete(loginRows(), sqlmock.NewRows([]string{"record_id", "record_type"}).AddRow("2", entity.TypeFile), "2")
+				mock.ExpectCommit()
+			},
+			func() {
+				err := storage.DeleteUser(ctx, func(recordIDs []string) error {
+					return ErrUnknown
+				})
+				assert.NoError(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete user, but commit fails, so files are kept",
+			func() {
+				expectDelete(loginRows(), sqlmock.NewRows([]string{"record_id", "record_type"}).AddRow("2", entity.TypeFile), "2")
+				mock.ExpectCommit().WillReturnError(errors.New("connection lost"))
+			},
+			func() {
+				err := storage.DeleteUser(ctx, func(recordIDs []string) error {
+					t.Error("files are deleted before commit")
+					return nil
+				})
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete user, who is already deleted",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`DELETE FROM users WHERE user_id = $1 RETURNING login`).
+					WithArgs("userID").WillReturnRows(sqlmock.NewRows([]string{"login"}))
+				mock.ExpectQuery(`DELETE FROM users_data WHERE user_id = $1 RETURNING record_id, record_type`).
+					WithArgs("userID").WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type"}))
+				for _, table := range []string{"sessions", "refresh_tokens", "totp_secrets", "totp_backup_codes", "audit_events"} {
+					mock.ExpectExec(`DELETE FROM ` + table + ` WHERE user_id = $1`).
+						WithArgs("userID").WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(`DELETE FROM login_attempts WHERE attempt_key = $1`).
+					WithArgs("login:").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			func() {
+				err := storage.DeleteUser(ctx, func(recordIDs []string) error {
+					assert.Empty(t, recordIDs)
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Delete user without authentication",
+			func() {},
+			func() {
+				err := storage.DeleteUser(context.Background(), func(recordIDs []string) error { return nil })
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_AuditEvents(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+
+	from := time.Unix(1683000000, 0).UTC()
+	to := from.Add(time.Hour)
+	event := entity.AuditEvent{
+		UserID:   "userID",
+		Action:   entity.AuditDeleteRecord,
+		RecordID: "recordID",
+		IP:       "127.0.0.1",
+		Time:     from,
+		Result:   entity.AuditResultSuccess,
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Save audit event",
+			func() {
+				mock.ExpectExec(`INSERT INTO audit_events (user_id, action, record_id, ip, created_at, result) VALUES ($1, $2, $3, $4, $5, $6)`).
+					WithArgs(event.UserID, event.Action, event.RecordID, event.IP, event.Time, event.Result).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			func() {
+				assert.NoError(t, storage.SaveAuditEvent(context.Background(), event))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Save audit event, but DB will return error",
+			func() {
+				mock.ExpectExec(`INSERT INTO audit_events (user_id, action, record_id, ip, created_at, result) VALUES ($1, $2, $3, $4, $5, $6)`).
+					WithArgs(event.UserID, event.Action, event.RecordID, event.IP, event.Time, event.Result).
+					WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				assert.Equal(t, ErrUnknown, storage.SaveAuditEvent(context.Background(), event))
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List audit events in time range",
+			func() {
+				mock.ExpectQuery(`SELECT action, record_id, ip, created_at, result FROM audit_events WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 ORDER BY created_at DESC, event_id DESC LIMIT $4`).
+					WithArgs("userID", from, to, 10).
+					WillReturnRows(sqlmock.NewRows([]string{"action", "record_id", "ip", "created_at", "result"}).
+						AddRow(event.Action, event.RecordID, event.IP, event.Time, event.Result))
+			},
+			func() {
+				events, err := storage.ListAuditEvents(ctx, entity.AuditQuery{From: from, To: to, Limit: 10})
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.AuditEvent{event}, events)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List all audit events, default limit is used",
+			func() {
+				mock.ExpectQuery(`SELECT action, record_id, ip, created_at, result FROM audit_events WHERE user_id = $1 ORDER BY created_at DESC, event_id DESC LIMIT $2`).
+					WithArgs("userID", defaultPageSize).
+					WillReturnRows(sqlmock.NewRows([]string{"action", "record_id", "ip", "created_at", "result"}))
+			},
+			func() {
+				events, err := storage.ListAuditEvents(ctx, entity.AuditQuery{})
+				assert.NoError(t, err)
+				assert.Empty(t, events)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List audit events, range ends before it starts",
+			func() {},
+			func() {
+				_, err := storage.ListAuditEvents(ctx, entity.AuditQuery{From: to, To: from})
+				assert.Equal(t, ErrBadQuery, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List audit events without authentication",
+			func() {},
+			func() {
+				_, err := storage.ListAuditEvents(context.Background(), entity.AuditQuery{})
+				assert.Equal(t, ErrUserUnauthorized, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_GetRecordsInfo(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	nextPageToken := encodePageToken(entity.SortByRevisionDesc, entity.Record{ID: "2", Revision: 3})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get all info from unauthorized user",
+			func() {},
+			func() {
+				page, err := storage.GetRecordsInfo(context.Background(), entity.RecordsQuery{})
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.Empty(t, page)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get all info from authorized user",
+			func() {
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision FROM users_data WHERE user_id = $1 AND NOT deleted ORDER BY metadata ASC, record_id ASC LIMIT $2").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", 101).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "revision"}).AddRow("1", entity.TypeLoginAndPassword, "login and password", 1).AddRow("2", entity.TypeText, "custom text", 3))
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				page, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{})
+				assert.NoError(t, err)
+
+				assert.Equal(t, entity.RecordsPage{
+					Records: []entity.Record{
+						{
+							ID:       "1",
+							Type:     entity.TypeLoginAndPassword,
+							Metadata: "login and password",
+							Revision: 1,
+						},
+						{
+							ID:       "2",
+							Type:     entity.TypeText,
+							Metadata: "custom text",
+							Revision: 3,
+						},
+					},
+				}, page)
+
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get first page of filtered info",
+			func() {
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision FROM users_data WHERE user_id = $1 AND NOT deleted AND record_type IN ($2, $3) AND LOWER(metadata) LIKE LOWER($4) ESCAPE '\\' ORDER BY revision DESC, record_id DESC LIMIT $5").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", entity.TypeText, entity.TypeFile, `%50\%\_off%`, 3).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "revision"}).
+						AddRow("1", entity.TypeText, "50%_off", 5).AddRow("2", entity.TypeFile, "50%_off.png", 3).AddRow("3", entity.TypeText, "50%_off!", 2))
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				page, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{
+					PageSize: 2,
+					Types:    []entity.RecordType{entity.TypeText, entity.TypeFile},
+					Metadata: "50%_off",
+					Sort:     entity.SortByRevisionDesc,
+				})
+				assert.NoError(t, err)
+
+				assert.Equal(t, entity.RecordsPage{
+					Records: []entity.Record{
+						{ID: "1", Type: entity.TypeText, Metadata: "50%_off", Revision: 5},
+						{ID: "2", Type: entity.TypeFile, Metadata: "50%_off.png", Revision: 3},
+					},
+					NextPageToken: nextPageToken,
+				}, page)
+
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get next page of info",
+			func() {
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision FROM users_data WHERE user_id = $1 AND NOT deleted AND (revision, record_id) < ($2, $3) ORDER BY revision DESC, record_id DESC LIMIT $4").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", int64(3), "2", 3).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "revision"}).AddRow("3", entity.TypeText, "50%_off!", 2))
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				page, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{
+					PageSize:  2,
+					PageToken: nextPageToken,
+					Sort:      entity.SortByRevisionDesc,
+				})
+				assert.NoError(t, err)
+
+				assert.Equal(t, entity.RecordsPage{
+					Records: []entity.Record{{ID: "3", Type: entity.TypeText, Metadata: "50%_off!", Revision: 2}},
+				}, page)
+
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get info with bad query",
+			func() {},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+
+				_, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{PageToken: "bad token"})
+				assert.Equal(t, ErrBadQuery, err)
+
+				_, err = storage.GetRecordsInfo(ctx, entity.RecordsQuery{PageToken: nextPageToken, Sort: entity.SortByRevision + 100})
+				assert.Equal(t, ErrBadQuery, err)
+
+				_, err = storage.GetRecordsInfo(ctx, entity.RecordsQuery{PageSize: -1})
+				assert.Equal(t, ErrBadQuery, err)
+
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get all info from authorized user, but DB will return error",
+			func() {
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision FROM users_data WHERE user_id = $1 AND NOT deleted ORDER BY metadata ASC, record_id ASC LIMIT $2").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", 1001).
+					WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				page, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{PageSize: 5000})
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, page)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_GetChanges(t *testing.T) {
 	cfg := config.GetServerConfig()
 	storage := NewDBStorage(cfg.DBConnectionURL)
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -98,47 +1084,77 @@ func TestDBStorage_LoginUser(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Login user with good credentials",
+			"Get changes from unauthorized user",
+			func() {},
 			func() {
-				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1 AND password = $2`).WithArgs("my_login", "my_password").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				changes, err := storage.GetChanges(context.Background(), 0)
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.Empty(t, changes)
+				assert.NoError(t, mock.ExpectationsWereMet())
 			},
+		},
+		{
+			"Get changes from authorized user",
 			func() {
-				userID, err := storage.LoginUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
-				})
+				mock.ExpectQuery("SELECT revision FROM users WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(7))
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision, created_revision, deleted FROM users_data WHERE user_id = $1 AND revision > $2 AND revision <= $3 ORDER BY revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", int64(3), int64(7)).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "revision", "created_revision", "deleted"}).
+						AddRow("1", entity.TypeText, "old text", 4, 1, false).
+						AddRow("2", entity.TypeText, "new text", 5, 5, false).
+						AddRow("3", entity.TypeText, "", 7, 2, true))
+				mock.ExpectQuery("SELECT pruned_revision FROM users WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"pruned_revision"}).AddRow(3))
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				changes, err := storage.GetChanges(ctx, 3)
 				assert.NoError(t, err)
-				assert.Equal(t, entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"), userID)
+
+				assert.Equal(t, entity.Changes{
+					Revision: 7,
+					Created:  []entity.Record{{ID: "2", Type: entity.TypeText, Metadata: "new text", Revision: 5}},
+					Updated:  []entity.Record{{ID: "1", Type: entity.TypeText, Metadata: "old text", Revision: 4}},
+					Deleted:  []string{"3"},
+				}, changes)
+
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
 		{
-			"Login user with good credentials, but DB will return error",
+			"Get changes since revision, which deleted records are pruned",
 			func() {
-				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1 AND password = $2`).WithArgs("my_login", "my_password").WillReturnError(errors.New("some DB error"))
+				mock.ExpectQuery("SELECT revision FROM users WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(7))
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision, created_revision, deleted FROM users_data WHERE user_id = $1 AND revision > $2 AND revision <= $3 ORDER BY revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", int64(3), int64(7)).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "revision", "created_revision", "deleted"}).
+						AddRow("1", entity.TypeText, "old text", 6, 1, false))
+				mock.ExpectQuery("SELECT pruned_revision FROM users WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"pruned_revision"}).AddRow(5))
 			},
 			func() {
-				userID, err := storage.LoginUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
-				})
-				assert.Equal(t, ErrUnknown, err)
-				assert.Equal(t, entity.UserID(""), userID)
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				changes, err := storage.GetChanges(ctx, 3)
+				assert.Equal(t, ErrResyncRequired, err)
+				assert.Empty(t, changes)
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
 		{
-			"Login user with bad credentials",
+			"Get changes from authorized user, but DB will return error",
 			func() {
-				mock.ExpectQuery(`SELECT user_id FROM users WHERE login = $1 AND password = $2`).WithArgs("my_login", "my_password").WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectQuery("SELECT revision FROM users WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(7))
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, revision, created_revision, deleted FROM users_data WHERE user_id = $1 AND revision > $2 AND revision <= $3 ORDER BY revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", int64(3), int64(7)).
+					WillReturnError(errors.New("some DB error"))
 			},
 			func() {
-				userID, err := storage.LoginUser(entity.UserCredentials{
-					Login:    "my_login",
-					Password: "my_password",
-				})
-				assert.Equal(t, ErrWrongCredentials, err)
-				assert.Equal(t, entity.UserID(""), userID)
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				_, err := storage.GetChanges(ctx, 3)
+				assert.Equal(t, ErrUnknown, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
@@ -151,65 +1167,52 @@ func TestDBStorage_LoginUser(t *testing.T) {
 	}
 }
 
-func TestDBStorage_GetRecordsInfo(t *testing.T) {
+func TestDBStorage_PruneTombstones(t *testing.T) {
 	cfg := config.GetServerConfig()
 	storage := NewDBStorage(cfg.DBConnectionURL)
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	assert.NoError(t, err)
 	storage.DB = db
 
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
 	tc := []struct {
 		name  string
 		mock  func()
 		valid func()
 	}{
 		{
-			"Get all info from unauthorized user",
-			func() {},
-			func() {
-				records, err := storage.GetRecordsInfo(context.Background())
-				assert.Equal(t, ErrUserUnauthorized, err)
-				assert.Empty(t, records)
-				assert.NoError(t, mock.ExpectationsWereMet())
-			},
-		},
-		{
-			"Get all info from authorized user",
+			"Prune tombstones, pruned revision of user is moved",
 			func() {
-				mock.ExpectQuery("SELECT record_id, record_type, metadata FROM users_data WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
-					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata"}).AddRow("1", entity.TypeLoginAndPassword, "login and password").AddRow("2", entity.TypeText, "custom text"))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT user_id, MAX(revision) FROM users_data WHERE deleted AND deleted_at < $1 GROUP BY user_id").
+					WithArgs(before).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "max"}).AddRow("userID", 7))
+				mock.ExpectExec("UPDATE users SET pruned_revision = $1 WHERE user_id = $2 AND pruned_revision < $1").
+					WithArgs(int64(7), "userID").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM users_data WHERE user_id = $1 AND deleted AND revision <= $2").
+					WithArgs("userID", int64(7)).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
-				records, err := storage.GetRecordsInfo(ctx)
+				pruned, err := storage.PruneTombstones(context.Background(), before)
 				assert.NoError(t, err)
-
-				assert.Equal(t, []entity.Record{
-					{
-						ID:       "1",
-						Type:     entity.TypeLoginAndPassword,
-						Metadata: "login and password",
-					},
-					{
-						ID:       "2",
-						Type:     entity.TypeText,
-						Metadata: "custom text",
-					},
-				}, records)
-
+				assert.Equal(t, int64(2), pruned)
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
 		{
-			"Get all info from authorized user, but DB will return error",
+			"Prune tombstones, but DB will return error",
 			func() {
-				mock.ExpectQuery("SELECT record_id, record_type, metadata FROM users_data WHERE user_id = $1").WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").WillReturnError(errors.New("some DB error"))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT user_id, MAX(revision) FROM users_data WHERE deleted AND deleted_at < $1 GROUP BY user_id").
+					WithArgs(before).WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
-				records, err := storage.GetRecordsInfo(ctx)
+				_, err := storage.PruneTombstones(context.Background(), before)
 				assert.Equal(t, ErrUnknown, err)
-				assert.Empty(t, records)
+				assert.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
 	}
@@ -246,12 +1249,17 @@ func TestDBStorage_CreateRecord(t *testing.T) {
 		{
 			"Create record with authorized user",
 			func() {
-				mock.ExpectQuery("INSERT INTO users_data (user_id, record_type, metadata, encoded_data) VALUES ($1, $2, $3, $4) RETURNING record_id").
-					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!"))).
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(5))
+				mock.ExpectQuery("INSERT INTO users_data (user_id, record_type, metadata, encoded_data, revision, created_revision, data_size) VALUES ($1, $2, $3, $4, $5, $5, $6) RETURNING record_id").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!")), int64(5), 6).
 					WillReturnRows(sqlmock.NewRows([]string{"record_id"}).AddRow("1"))
+				mock.ExpectCommit()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				recordID, err := storage.CreateRecord(ctx, entity.Record{
 					Metadata: "my text",
 					Type:     entity.TypeText,
@@ -265,12 +1273,17 @@ func TestDBStorage_CreateRecord(t *testing.T) {
 		{
 			"Create record with authorized user, but DB will return error",
 			func() {
-				mock.ExpectQuery("INSERT INTO users_data (user_id, record_type, metadata, encoded_data) VALUES ($1, $2, $3, $4) RETURNING record_id").
-					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!"))).
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(5))
+				mock.ExpectQuery("INSERT INTO users_data (user_id, record_type, metadata, encoded_data, revision, created_revision, data_size) VALUES ($1, $2, $3, $4, $5, $5, $6) RETURNING record_id").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!")), int64(5), 6).
 					WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				recordID, err := storage.CreateRecord(ctx, entity.Record{
 					Metadata: "my text",
 					Type:     entity.TypeText,
@@ -315,13 +1328,13 @@ func TestDBStorage_GetRecord(t *testing.T) {
 		{
 			"Get record with authorized user",
 			func() {
-				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data FROM users_data WHERE record_id = $1 AND user_id = $2").
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data, revision FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
 					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
-					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "encoded_data"}).
-						AddRow("1", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!"))))
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "encoded_data", "revision"}).
+						AddRow("1", entity.TypeText, "my text", hex.EncodeToString([]byte("hello!")), 2))
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				record, err := storage.GetRecord(ctx, "1")
 				assert.NoError(t, err)
 				assert.Equal(t, entity.Record{
@@ -329,6 +1342,7 @@ func TestDBStorage_GetRecord(t *testing.T) {
 					Metadata: "my text",
 					Type:     entity.TypeText,
 					Data:     []byte("hello!"),
+					Revision: 2,
 				}, record)
 				assert.NoError(t, mock.ExpectationsWereMet())
 			},
@@ -336,12 +1350,12 @@ func TestDBStorage_GetRecord(t *testing.T) {
 		{
 			"Get non existed record with authorized user",
 			func() {
-				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data FROM users_data WHERE record_id = $1 AND user_id = $2").
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data, revision FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
 					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
-					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "encoded_data"}))
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "record_type", "metadata", "encoded_data", "revision"}))
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				record, err := storage.GetRecord(ctx, "1")
 				assert.Equal(t, ErrNotFound, err)
 				assert.Empty(t, record)
@@ -351,12 +1365,12 @@ func TestDBStorage_GetRecord(t *testing.T) {
 		{
 			"Get record with authorized user, but DB will return error",
 			func() {
-				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data FROM users_data WHERE record_id = $1 AND user_id = $2").
+				mock.ExpectQuery("SELECT record_id, record_type, metadata, encoded_data, revision FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
 					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
 					WillReturnError(errors.New("some DB error"))
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				record, err := storage.GetRecord(ctx, "1")
 				assert.Equal(t, ErrUnknown, err)
 				assert.Empty(t, record)
@@ -372,6 +1386,260 @@ func TestDBStorage_GetRecord(t *testing.T) {
 	}
 }
 
+func TestDBStorage_UpdateRecord(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	record := entity.Record{
+		ID:       "1",
+		Metadata: "my text",
+		Type:     entity.TypeText,
+		Data:     []byte("hello!"),
+		Revision: 2,
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Update record with unauthorized user",
+			func() {},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), record)
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update record with authorized user",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(3))
+				mock.ExpectExec("UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted").
+					WithArgs("my text", hex.EncodeToString([]byte("hello!")), int64(3), 6, "1", "6584c88d-1bb4-4686-83be-925abb24fc20", int64(2), entity.TypeText).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update record, which was changed by another client",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(3))
+				mock.ExpectExec("UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted").
+					WithArgs("my text", hex.EncodeToString([]byte("hello!")), int64(3), 6, "1", "6584c88d-1bb4-4686-83be-925abb24fc20", int64(2), entity.TypeText).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT record_type FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"record_type"}).AddRow(entity.TypeText))
+				mock.ExpectRollback()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrRevisionConflict, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update record with other type",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(3))
+				mock.ExpectExec("UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted").
+					WithArgs("my text", hex.EncodeToString([]byte("hello!")), int64(3), 6, "1", "6584c88d-1bb4-4686-83be-925abb24fc20", int64(2), entity.TypeText).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT record_type FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"record_type"}).AddRow(entity.TypeFile))
+				mock.ExpectRollback()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrRecordType, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update non existed record",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(3))
+				mock.ExpectExec("UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted").
+					WithArgs("my text", hex.EncodeToString([]byte("hello!")), int64(3), 6, "1", "6584c88d-1bb4-4686-83be-925abb24fc20", int64(2), entity.TypeText).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT record_type FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"record_type"}))
+				mock.ExpectRollback()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrNotFound, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Update record with authorized user, but DB will return error",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(3))
+				mock.ExpectExec("UPDATE users_data SET metadata = $1, encoded_data = $2, revision = $3, data_size = $4 WHERE record_id = $5 AND user_id = $6 AND revision = $7 AND record_type = $8 AND NOT deleted").
+					WithArgs("my text", hex.EncodeToString([]byte("hello!")), int64(3), 6, "1", "6584c88d-1bb4-4686-83be-925abb24fc20", int64(2), entity.TypeText).
+					WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
+			},
+			func() {
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestDBStorage_ReplaceRecords(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	userID := "6584c88d-1bb4-4686-83be-925abb24fc20"
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: entity.UserID(userID)})
+
+	records := []entity.Record{
+		{ID: "1", Type: entity.TypeText, Data: []byte("sealed"), Revision: 2},
+		{ID: "2", Type: entity.TypeFile, Revision: 5},
+	}
+
+	expectReplace := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(7))
+		mock.ExpectExec("UPDATE users_data SET encoded_data = $1, revision = $2, data_size = $3 WHERE record_id = $4 AND user_id = $5 AND revision = $6 AND record_type = $7 AND NOT deleted").
+			WithArgs(hex.EncodeToString([]byte("sealed")), int64(7), 6, "1", userID, int64(2), entity.TypeText).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE users_data SET encoded_data = $1, revision = $2, data_size = $3 WHERE record_id = $4 AND user_id = $5 AND revision = $6 AND record_type = $7 AND NOT deleted").
+			WithArgs("", int64(7), 0, "2", userID, int64(5), entity.TypeFile).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Replace records with unauthorized user",
+			func() {},
+			func() {
+				revision, err := storage.ReplaceRecords(context.Background(), records)
+				assert.Equal(t, ErrUserUnauthorized, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Replace all records of user",
+			func() {
+				expectReplace()
+				mock.ExpectQuery("SELECT COUNT(*) FROM users_data WHERE user_id = $1 AND NOT deleted").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectCommit()
+			},
+			func() {
+				revision, err := storage.ReplaceRecords(ctx, records)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(7), revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Replace records, but user has record, which isn't in batch",
+			func() {
+				expectReplace()
+				mock.ExpectQuery("SELECT COUNT(*) FROM users_data WHERE user_id = $1 AND NOT deleted").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				mock.ExpectRollback()
+			},
+			func() {
+				revision, err := storage.ReplaceRecords(ctx, records)
+				assert.Equal(t, ErrRevisionConflict, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Replace records, but record was changed by another client",
+			func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(7))
+				mock.ExpectExec("UPDATE users_data SET encoded_data = $1, revision = $2, data_size = $3 WHERE record_id = $4 AND user_id = $5 AND revision = $6 AND record_type = $7 AND NOT deleted").
+					WithArgs(hex.EncodeToString([]byte("sealed")), int64(7), 6, "1", userID, int64(2), entity.TypeText).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT record_type FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("1", userID).
+					WillReturnRows(sqlmock.NewRows([]string{"record_type"}).AddRow(entity.TypeText))
+				mock.ExpectRollback()
+			},
+			func() {
+				revision, err := storage.ReplaceRecords(ctx, records)
+				assert.Equal(t, ErrRevisionConflict, err)
+				assert.Empty(t, revision)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
 func TestDBStorage_DeleteRecord(t *testing.T) {
 	cfg := config.GetServerConfig()
 	storage := NewDBStorage(cfg.DBConnectionURL)
@@ -396,12 +1664,17 @@ func TestDBStorage_DeleteRecord(t *testing.T) {
 		{
 			"Delete record with authorized user",
 			func() {
-				mock.ExpectExec("DELETE FROM users_data WHERE record_id = $1 AND user_id = $2").
-					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+				mock.ExpectExec("UPDATE users_data SET deleted = TRUE, deleted_at = $1, metadata = '', encoded_data = '', data_size = 0, revision = $2 WHERE record_id = $3 AND user_id = $4 AND NOT deleted").
+					WithArgs(sqlmock.AnyArg(), int64(4), "1", "6584c88d-1bb4-4686-83be-925abb24fc20").
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				err := storage.DeleteRecord(ctx, "1")
 				assert.NoError(t, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
@@ -410,12 +1683,17 @@ func TestDBStorage_DeleteRecord(t *testing.T) {
 		{
 			"Delete record with authorized user, but DB will return error",
 			func() {
-				mock.ExpectExec("DELETE FROM users_data WHERE record_id = $1 AND user_id = $2").
-					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+				mock.ExpectExec("UPDATE users_data SET deleted = TRUE, deleted_at = $1, metadata = '', encoded_data = '', data_size = 0, revision = $2 WHERE record_id = $3 AND user_id = $4 AND NOT deleted").
+					WithArgs(sqlmock.AnyArg(), int64(4), "1", "6584c88d-1bb4-4686-83be-925abb24fc20").
 					WillReturnError(errors.New("some DB error"))
+				mock.ExpectRollback()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				err := storage.DeleteRecord(ctx, "1")
 				assert.Equal(t, ErrUnknown, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
@@ -424,12 +1702,17 @@ func TestDBStorage_DeleteRecord(t *testing.T) {
 		{
 			"Delete non existed record with authorized user",
 			func() {
-				mock.ExpectExec("DELETE FROM users_data WHERE record_id = $1 AND user_id = $2").
-					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE users SET revision = revision + 1 WHERE user_id = $1 RETURNING revision").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+				mock.ExpectExec("UPDATE users_data SET deleted = TRUE, deleted_at = $1, metadata = '', encoded_data = '', data_size = 0, revision = $2 WHERE record_id = $3 AND user_id = $4 AND NOT deleted").
+					WithArgs(sqlmock.AnyArg(), int64(4), "1", "6584c88d-1bb4-4686-83be-925abb24fc20").
 					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
 			},
 			func() {
-				ctx := context.WithValue(context.Background(), "userID", entity.UserID("6584c88d-1bb4-4686-83be-925abb24fc20"))
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
 				err := storage.DeleteRecord(ctx, "1")
 				assert.Equal(t, ErrNotFound, err)
 				assert.NoError(t, mock.ExpectationsWereMet())
@@ -443,3 +1726,128 @@ func TestDBStorage_DeleteRecord(t *testing.T) {
 		test.valid()
 	}
 }
+
+func TestDBStorage_Usage(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewDBStorage(cfg.DBConnectionURL)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	storage.DB = db
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "6584c88d-1bb4-4686-83be-925abb24fc20"})
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get usage with unauthorized user",
+			func() {},
+			func() {
+				_, err := storage.GetUsage(context.Background())
+				assert.Equal(t, ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Get usage of user",
+			func() {
+				mock.ExpectQuery("SELECT COUNT(*), COALESCE(SUM(data_size), 0) FROM users_data WHERE user_id = $1 AND NOT deleted").
+					WithArgs("6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(3, 1024))
+			},
+			func() {
+				usage, err := storage.GetUsage(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Usage{Bytes: 1024, Records: 3}, usage)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List file records without size of all users",
+			func() {
+				mock.ExpectQuery("SELECT record_id, user_id FROM users_data WHERE record_type = $1 AND data_size = 0 AND NOT deleted").
+					WithArgs(entity.TypeFile).
+					WillReturnRows(sqlmock.NewRows([]string{"record_id", "user_id"}).AddRow("1", "user1").AddRow("2", "user2"))
+			},
+			func() {
+				files, err := storage.ListUnsizedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]entity.UserID{"1": "user1", "2": "user2"}, files)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"List file records without size, but DB returns error",
+			func() {
+				mock.ExpectQuery("SELECT record_id, user_id FROM users_data WHERE record_type = $1 AND data_size = 0 AND NOT deleted").
+					WithArgs(entity.TypeFile).
+					WillReturnError(errors.New("some DB error"))
+			},
+			func() {
+				_, err := storage.ListUnsizedFiles(context.Background())
+				assert.Equal(t, ErrUnknown, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Set size of file record",
+			func() {
+				mock.ExpectExec("UPDATE users_data SET data_size = $1 WHERE record_id = $2 AND user_id = $3 AND NOT deleted").
+					WithArgs(int64(512), "1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			func() {
+				err := storage.SetRecordSize(ctx, "1", 512)
+				assert.NoError(t, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Set size of non existed record",
+			func() {
+				mock.ExpectExec("UPDATE users_data SET data_size = $1 WHERE record_id = $2 AND user_id = $3 AND NOT deleted").
+					WithArgs(int64(512), "2", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() {
+				err := storage.SetRecordSize(ctx, "2", 512)
+				assert.Equal(t, ErrNotFound, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get size of record",
+			func() {
+				mock.ExpectQuery("SELECT data_size FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("1", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"data_size"}).AddRow(512))
+			},
+			func() {
+				size, err := storage.GetRecordSize(ctx, "1")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(512), size)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			"Get size of non existed record",
+			func() {
+				mock.ExpectQuery("SELECT data_size FROM users_data WHERE record_id = $1 AND user_id = $2 AND NOT deleted").
+					WithArgs("2", "6584c88d-1bb4-4686-83be-925abb24fc20").
+					WillReturnRows(sqlmock.NewRows([]string{"data_size"}))
+			},
+			func() {
+				_, err := storage.GetRecordSize(ctx, "2")
+				assert.Equal(t, ErrNotFound, err)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
@@ -8,5 +8,11 @@ var (
 	ErrWrongCredentials = errors.New("wrong login or password")
 	ErrLoginExists      = errors.New("this login already exists")
 	ErrNotFound         = errors.New("not found record with such id")
+	ErrRevisionConflict = errors.New("record was changed by another client")
+	ErrRecordType       = errors.New("type of record can't be changed")
+	ErrNotFile          = errors.New("record is not a file")
+	ErrBadQuery         = errors.New("bad records query")
+	ErrQuotaExceeded    = errors.New("storage quota exceeded")
+	ErrResyncRequired   = errors.New("deleted records are pruned, full resync is required")
 	ErrUnknown          = errors.New("internal server error")
 )
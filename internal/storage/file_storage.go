@@ -1,13 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/size12/gophkeeper/internal/metrics"
 )
 
 // FileStorage keeps records on disk.
@@ -19,17 +21,32 @@ type FileStorage struct {
 func NewFileStorage(directory string) *FileStorage {
 	err := os.Mkdir(directory, os.ModePerm)
 	if err != nil && !os.IsExist(err) {
-		log.Fatalln("Failed open directory for file storage")
+		slog.Error("Failed open directory for file storage", "error", err)
+		os.Exit(1)
 		return nil
 	}
 	return &FileStorage{directory: directory}
 }
 
+// Ping checks directory of file storage is writable.
+func (storage *FileStorage) Ping(_ context.Context) error {
+	file, err := os.CreateTemp(storage.directory, ".ping-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write([]byte("ping"))
+	closeErr := file.Close()
+	removeErr := os.Remove(file.Name())
+
+	return errors.Join(err, closeErr, removeErr)
+}
+
 // GetRecord reads file with record data.
 func (storage *FileStorage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
 	metadata, ok := ctx.Value("recordMetadata").(string)
 	if !ok {
-		log.Println("Failed get record metadata from context in getting file record")
+		slog.ErrorContext(ctx, "Failed get record metadata from context in getting file record")
 		return entity.Record{}, ErrUnknown
 	}
 
@@ -42,8 +59,10 @@ func (storage *FileStorage) GetRecord(ctx context.Context, recordID string) (ent
 	if err != nil {
 		return entity.Record{}, ErrUnknown
 	}
+	defer file.Close()
 
 	data, err := io.ReadAll(file)
+	metrics.FileBytes.WithLabelValues(metrics.FileRead).Add(float64(len(data)))
 	if err != nil {
 		return entity.Record{}, ErrUnknown
 	}
@@ -79,11 +98,145 @@ func (storage *FileStorage) CreateRecord(_ context.Context, record entity.Record
 	if err != nil {
 		return "", ErrUnknown
 	}
+	defer file.Close()
 
-	_, err = file.Write(record.Data)
+	written, err := file.Write(record.Data)
+	metrics.FileBytes.WithLabelValues(metrics.FileWritten).Add(float64(written))
 	if err != nil {
 		return "", ErrUnknown
 	}
 
 	return record.ID, nil
 }
+
+// UpdateRecord rewrites existing file with new record data. Data is staged first,
+// so reader never sees partially written file.
+func (storage *FileStorage) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	filename := storage.directory + "/" + record.ID
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+
+	staged, err := storage.StageFile(ctx, record.ID, bytes.NewReader(record.Data))
+	if err != nil {
+		return 0, err
+	}
+
+	err = storage.CommitFile(ctx, record.ID, staged)
+	if err != nil {
+		storage.DiscardFile(ctx, staged)
+		return 0, err
+	}
+
+	return record.Revision, nil
+}
+
+// WriteFile streams record data from reader to file. File appears only after whole stream was written.
+func (storage *FileStorage) WriteFile(ctx context.Context, recordID string, r io.Reader) (int64, error) {
+	staged, err := storage.StageFile(ctx, recordID, r)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(staged)
+	if err != nil {
+		storage.DiscardFile(ctx, staged)
+		slog.ErrorContext(ctx, "Failed get size of file with record data", "error", err)
+		return 0, ErrUnknown
+	}
+
+	err = storage.CommitFile(ctx, recordID, staged)
+	if err != nil {
+		storage.DiscardFile(ctx, staged)
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// StageFile streams record data from reader to temporary file. Returns its name, record file is replaced by CommitFile.
+func (storage *FileStorage) StageFile(ctx context.Context, recordID string, r io.Reader) (string, error) {
+	file, err := os.CreateTemp(storage.directory, recordID+"-*.part")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed create temporary file for record", "error", err)
+		return "", ErrUnknown
+	}
+
+	written, err := io.Copy(file, r)
+	metrics.FileBytes.WithLabelValues(metrics.FileWritten).Add(float64(written))
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		slog.ErrorContext(ctx, "Failed write record data to file", "error", err)
+		return "", ErrUnknown
+	}
+
+	err = file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		slog.ErrorContext(ctx, "Failed close file with record data", "error", err)
+		return "", ErrUnknown
+	}
+
+	return file.Name(), nil
+}
+
+// CommitFile replaces record file with staged one.
+func (storage *FileStorage) CommitFile(ctx context.Context, recordID string, staged string) error {
+	err := os.Rename(staged, storage.directory+"/"+recordID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed move file with record data", "error", err)
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// DiscardFile deletes staged file, which wasn't committed.
+func (storage *FileStorage) DiscardFile(_ context.Context, staged string) error {
+	err := os.Remove(staged)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ErrUnknown
+	}
+
+	return nil
+}
+
+// FileSize gets size of file with record data.
+func (storage *FileStorage) FileSize(ctx context.Context, recordID string) (int64, error) {
+	info, err := os.Stat(storage.directory + "/" + recordID)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed get size of file with record data", "error", err)
+		return 0, ErrUnknown
+	}
+
+	return info.Size(), nil
+}
+
+// ReadFile streams record data from file to writer.
+func (storage *FileStorage) ReadFile(ctx context.Context, recordID string, w io.Writer) (int64, error) {
+	file, err := os.Open(storage.directory + "/" + recordID)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, ErrUnknown
+	}
+	defer file.Close()
+
+	read, err := io.Copy(w, file)
+	metrics.FileBytes.WithLabelValues(metrics.FileRead).Add(float64(read))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed read record data from file", "error", err)
+		return read, ErrUnknown
+	}
+
+	return read, nil
+}
@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/size12/gophkeeper/internal/config"
@@ -132,6 +135,179 @@ func TestFileStorage_GetRecord(t *testing.T) {
 	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
 }
 
+func TestFileStorage_UpdateRecord(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewFileStorage(cfg.FilesDirectory)
+
+	tc := []struct {
+		name    string
+		prepare func()
+		valid   func()
+	}{
+		{
+			"Update existed file record",
+			func() {
+				id, err := storage.CreateRecord(context.Background(), entity.Record{
+					ID:   "1",
+					Type: entity.TypeFile,
+					Data: []byte("text"),
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, "1", id)
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{
+					ID:       "1",
+					Type:     entity.TypeFile,
+					Data:     []byte("new text"),
+					Revision: 2,
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+
+				data, err := os.ReadFile(cfg.FilesDirectory + "/1")
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("new text"), data)
+
+				staged, err := filepath.Glob(cfg.FilesDirectory + "/1-*.part")
+				assert.NoError(t, err)
+				assert.Empty(t, staged)
+			},
+		},
+		{
+			"Update non existed file record",
+			func() {},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{
+					ID:   "2",
+					Type: entity.TypeFile,
+					Data: []byte("new text"),
+				})
+				assert.Equal(t, ErrNotFound, err)
+				assert.Empty(t, revision)
+				assert.NoFileExists(t, cfg.FilesDirectory+"/2")
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.prepare()
+		test.valid()
+	}
+
+	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
+}
+
+func TestFileStorage_WriteFile(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewFileStorage(cfg.FilesDirectory)
+
+	written, err := storage.WriteFile(context.Background(), "1", strings.NewReader("streamed text"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("streamed text")), written)
+
+	data, err := os.ReadFile(cfg.FilesDirectory + "/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("streamed text"), data)
+
+	entries, err := os.ReadDir(cfg.FilesDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
+}
+
+func TestFileStorage_StageFile(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewFileStorage(cfg.FilesDirectory)
+
+	_, err := storage.WriteFile(context.Background(), "1", strings.NewReader("old text"))
+	assert.NoError(t, err)
+
+	staged, err := storage.StageFile(context.Background(), "1", strings.NewReader("new text"))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(cfg.FilesDirectory + "/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old text"), data, "record file isn't changed until staged file is committed")
+
+	assert.NoError(t, storage.CommitFile(context.Background(), "1", staged))
+
+	data, err = os.ReadFile(cfg.FilesDirectory + "/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new text"), data)
+
+	discarded, err := storage.StageFile(context.Background(), "1", strings.NewReader("discarded text"))
+	assert.NoError(t, err)
+	assert.NoError(t, storage.DiscardFile(context.Background(), discarded))
+
+	entries, err := os.ReadDir(cfg.FilesDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
+}
+
+func TestFileStorage_ReadFile(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewFileStorage(cfg.FilesDirectory)
+
+	tc := []struct {
+		name    string
+		prepare func()
+		valid   func()
+	}{
+		{
+			"Read existed file record",
+			func() {
+				_, err := storage.WriteFile(context.Background(), "1", strings.NewReader("text"))
+				assert.NoError(t, err)
+			},
+			func() {
+				buf := &bytes.Buffer{}
+				read, err := storage.ReadFile(context.Background(), "1", buf)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), read)
+				assert.Equal(t, "text", buf.String())
+			},
+		},
+		{
+			"Read non existed file record",
+			func() {},
+			func() {
+				_, err := storage.ReadFile(context.Background(), "2", &bytes.Buffer{})
+				assert.Equal(t, ErrNotFound, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.prepare()
+		test.valid()
+	}
+
+	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
+}
+
+func TestFileStorage_FileSize(t *testing.T) {
+	cfg := config.GetServerConfig()
+	storage := NewFileStorage(cfg.FilesDirectory)
+
+	_, err := storage.WriteFile(context.Background(), "1", strings.NewReader("text"))
+	assert.NoError(t, err)
+
+	size, err := storage.FileSize(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+
+	_, err = storage.FileSize(context.Background(), "2")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
+}
+
 func TestFileStorage_DeleteRecord(t *testing.T) {
 	cfg := config.GetServerConfig()
 	storage := NewFileStorage(cfg.FilesDirectory)
@@ -185,3 +361,17 @@ func TestFileStorage_DeleteRecord(t *testing.T) {
 
 	assert.NoError(t, os.RemoveAll(cfg.FilesDirectory))
 }
+
+func TestFileStorage_Ping(t *testing.T) {
+	directory := t.TempDir()
+	storage := NewFileStorage(directory)
+
+	assert.NoError(t, storage.Ping(context.Background()))
+
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	broken := &FileStorage{directory: directory + "/missing"}
+	assert.Error(t, broken.Ping(context.Background()))
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// MemoryFileStorage keeps data of file records in memory of this server instance. Data is lost on restart,
+// so it's only for development and tests. It behaves like FileStorage.
+type MemoryFileStorage struct {
+	files map[string][]byte
+	// staged keeps files, which were staged, but aren't committed yet.
+	staged     map[string][]byte
+	stagedNext int
+	*sync.Mutex
+}
+
+// NewMemoryFileStorage returns new empty memory file storage.
+func NewMemoryFileStorage() *MemoryFileStorage {
+	return &MemoryFileStorage{
+		files:  make(map[string][]byte),
+		staged: make(map[string][]byte),
+		Mutex:  &sync.Mutex{},
+	}
+}
+
+// Ping checks memory file storage, it's always available.
+func (storage *MemoryFileStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+// GetRecord gets record data.
+func (storage *MemoryFileStorage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
+	metadata, ok := ctx.Value("recordMetadata").(string)
+	if !ok {
+		slog.ErrorContext(ctx, "Failed get record metadata from context in getting file record")
+		return entity.Record{}, ErrUnknown
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	data, ok := storage.files[recordID]
+	if !ok {
+		return entity.Record{}, ErrNotFound
+	}
+
+	record := entity.Record{
+		ID:       recordID,
+		Metadata: metadata,
+		Type:     entity.TypeFile,
+		Data:     cloneBytes(data),
+	}
+
+	return record, nil
+}
+
+// DeleteRecord deletes record data.
+func (storage *MemoryFileStorage) DeleteRecord(_ context.Context, recordID string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.files[recordID]; !ok {
+		return ErrNotFound
+	}
+
+	delete(storage.files, recordID)
+	return nil
+}
+
+// CreateRecord saves record data.
+func (storage *MemoryFileStorage) CreateRecord(_ context.Context, record entity.Record) (string, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.files[record.ID] = cloneBytes(record.Data)
+	return record.ID, nil
+}
+
+// UpdateRecord rewrites existing record data.
+func (storage *MemoryFileStorage) UpdateRecord(_ context.Context, record entity.Record) (int64, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.files[record.ID]; !ok {
+		return 0, ErrNotFound
+	}
+
+	storage.files[record.ID] = cloneBytes(record.Data)
+	return record.Revision, nil
+}
+
+// WriteFile reads record data from reader. Data appears only after whole stream was read.
+func (storage *MemoryFileStorage) WriteFile(ctx context.Context, recordID string, r io.Reader) (int64, error) {
+	staged, err := storage.StageFile(ctx, recordID, r)
+	if err != nil {
+		return 0, err
+	}
+
+	storage.Lock()
+	size := int64(len(storage.staged[staged]))
+	storage.Unlock()
+
+	err = storage.CommitFile(ctx, recordID, staged)
+	if err != nil {
+		storage.DiscardFile(ctx, staged)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// StageFile reads record data from reader to staged file. Returns its name, record data is replaced by CommitFile.
+func (storage *MemoryFileStorage) StageFile(ctx context.Context, recordID string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed read record data", "error", err)
+		return "", ErrUnknown
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.stagedNext++
+	name := fmt.Sprintf("%s-%d.part", recordID, storage.stagedNext)
+	storage.staged[name] = data
+
+	return name, nil
+}
+
+// CommitFile replaces record data with staged file.
+func (storage *MemoryFileStorage) CommitFile(ctx context.Context, recordID string, staged string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	data, ok := storage.staged[staged]
+	if !ok {
+		slog.ErrorContext(ctx, "Failed find staged file with record data", "name", staged)
+		return ErrUnknown
+	}
+
+	delete(storage.staged, staged)
+	storage.files[recordID] = data
+
+	return nil
+}
+
+// DiscardFile deletes staged file, which wasn't committed.
+func (storage *MemoryFileStorage) DiscardFile(_ context.Context, staged string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	delete(storage.staged, staged)
+	return nil
+}
+
+// FileSize gets size of record data.
+func (storage *MemoryFileStorage) FileSize(_ context.Context, recordID string) (int64, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	data, ok := storage.files[recordID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return int64(len(data)), nil
+}
+
+// ReadFile writes record data to writer.
+func (storage *MemoryFileStorage) ReadFile(ctx context.Context, recordID string, w io.Writer) (int64, error) {
+	storage.Lock()
+	data, ok := storage.files[recordID]
+	storage.Unlock()
+
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	// Data is never changed in place, it's replaced by new slice, so it can be read without lock.
+	read, err := io.Copy(w, bytes.NewReader(data))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed read record data", "error", err)
+		return read, ErrUnknown
+	}
+
+	return read, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryFileStorage_Records(t *testing.T) {
+	storage := NewMemoryFileStorage()
+	ctx := context.WithValue(context.Background(), "recordMetadata", "photo.png")
+
+	id, err := storage.CreateRecord(ctx, entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("text")})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+
+	record, err := storage.GetRecord(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.Record{ID: "1", Metadata: "photo.png", Type: entity.TypeFile, Data: []byte("text")}, record)
+
+	_, err = storage.GetRecord(context.Background(), "1")
+	assert.Equal(t, ErrUnknown, err)
+
+	_, err = storage.UpdateRecord(ctx, entity.Record{ID: "1", Data: []byte("new text")})
+	assert.NoError(t, err)
+	_, err = storage.UpdateRecord(ctx, entity.Record{ID: "2", Data: []byte("new text")})
+	assert.Equal(t, ErrNotFound, err)
+
+	buf := &bytes.Buffer{}
+	read, err := storage.ReadFile(ctx, "1", buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("new text")), read)
+	assert.Equal(t, "new text", buf.String())
+
+	assert.NoError(t, storage.DeleteRecord(ctx, "1"))
+	assert.Equal(t, ErrNotFound, storage.DeleteRecord(ctx, "1"))
+
+	_, err = storage.ReadFile(ctx, "1", buf)
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, storage.Ping(ctx))
+}
+
+func TestMemoryFileStorage_StageFile(t *testing.T) {
+	storage := NewMemoryFileStorage()
+	ctx := context.Background()
+
+	written, err := storage.WriteFile(ctx, "1", strings.NewReader("old text"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("old text")), written)
+
+	staged, err := storage.StageFile(ctx, "1", strings.NewReader("new text"))
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	_, err = storage.ReadFile(ctx, "1", buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "old text", buf.String(), "record data isn't changed until staged file is committed")
+
+	assert.NoError(t, storage.CommitFile(ctx, "1", staged))
+	assert.Equal(t, ErrUnknown, storage.CommitFile(ctx, "1", staged))
+
+	discarded, err := storage.StageFile(ctx, "1", strings.NewReader("discarded text"))
+	assert.NoError(t, err)
+	assert.NoError(t, storage.DiscardFile(ctx, discarded))
+	assert.NoError(t, storage.DiscardFile(ctx, discarded))
+
+	buf.Reset()
+	_, err = storage.ReadFile(ctx, "1", buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "new text", buf.String())
+	assert.Empty(t, storage.staged)
+}
+
+func TestStorage_Memory(t *testing.T) {
+	storage := NewStorage(NewMemoryStorage(), NewMemoryFileStorage())
+	require.NoError(t, storage.CreateUser(context.Background(), "login", entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordArgon2id}))
+	password, err := storage.GetPassword(context.Background(), "login")
+	require.NoError(t, err)
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: password.UserID})
+
+	id, err := storage.UploadFile(ctx, entity.Record{Metadata: "photo.png", Type: entity.TypeFile}, strings.NewReader("image"))
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	_, err = storage.DownloadFile(ctx, id, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "image", buf.String())
+
+	usage, err := storage.GetUsage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("image")), usage.Bytes)
+
+	// Size of file, which was written before sizes were counted, is read from file storage.
+	assert.NoError(t, storage.DBStorage.SetRecordSize(ctx, id, 0))
+	updated, err := storage.BackfillFileSizes(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	usage, err = storage.GetUsage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("image")), usage.Bytes)
+
+	assert.NoError(t, storage.DeleteRecord(ctx, id))
+	_, err = storage.DownloadFile(ctx, id, buf)
+	assert.Equal(t, ErrNotFound, err)
+}
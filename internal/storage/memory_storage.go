@@ -0,0 +1,1036 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/size12/gophkeeper/internal/entity"
+)
+
+// MemoryStorage keeps users, sessions and records in memory of this server instance. Data is lost on restart,
+// so it's only for development and tests. It behaves like DBStorage.
+type MemoryStorage struct {
+	users         map[entity.UserID]*memoryUser
+	logins        map[string]entity.UserID
+	records       map[string]*memoryRecord
+	refreshTokens map[string]entity.RefreshToken
+	sessions      map[string]*memorySession
+	totp          map[entity.UserID]entity.TOTP
+	backupCodes   map[entity.UserID]map[string]struct{}
+	auditEvents   []entity.AuditEvent
+	// staged is journal of staged files, which aren't moved in place yet, by record IDs.
+	staged map[string]entity.StagedFile
+	// deletedFiles is journal of file records of deleted users, which files aren't deleted yet.
+	deletedFiles map[string]struct{}
+	*sync.Mutex
+}
+
+// memoryUser is user of memory storage. Revision grows on every change of his records.
+type memoryUser struct {
+	password entity.StoredPassword
+	login    string
+	revision int64
+	// prunedRevision is revision of the last pruned tombstone of his records.
+	prunedRevision int64
+}
+
+// memoryRecord is record of memory storage. Deleted record is kept to be returned in changes.
+type memoryRecord struct {
+	record          entity.Record
+	userID          entity.UserID
+	createdRevision int64
+	deleted         bool
+	deletedAt       time.Time
+	size            int64
+}
+
+// memorySession is session of memory storage.
+type memorySession struct {
+	info    entity.SessionInfo
+	revoked bool
+}
+
+// NewMemoryStorage returns new empty memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:         make(map[entity.UserID]*memoryUser),
+		logins:        make(map[string]entity.UserID),
+		records:       make(map[string]*memoryRecord),
+		refreshTokens: make(map[string]entity.RefreshToken),
+		sessions:      make(map[string]*memorySession),
+		totp:          make(map[entity.UserID]entity.TOTP),
+		backupCodes:   make(map[entity.UserID]map[string]struct{}),
+		staged:        make(map[string]entity.StagedFile),
+		deletedFiles:  make(map[string]struct{}),
+		Mutex:         &sync.Mutex{},
+	}
+}
+
+// newMemoryID returns random UUID v4 like IDs, which are generated by DB.
+func newMemoryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Ping checks memory storage, it's always available.
+func (storage *MemoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+// CreateUser saves new user with password hash.
+func (storage *MemoryStorage) CreateUser(_ context.Context, login string, password entity.StoredPassword) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.logins[login]; ok {
+		return ErrLoginExists
+	}
+
+	userID := entity.UserID(newMemoryID())
+	password.UserID = userID
+	storage.users[userID] = &memoryUser{password: password, login: login}
+	storage.logins[login] = userID
+
+	return nil
+}
+
+// GetPassword gets password hash of user by login.
+func (storage *MemoryStorage) GetPassword(_ context.Context, login string) (entity.StoredPassword, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	userID, ok := storage.logins[login]
+	if !ok {
+		return entity.StoredPassword{}, ErrWrongCredentials
+	}
+
+	return storage.users[userID].password, nil
+}
+
+// UpdatePassword changes password hash of user.
+func (storage *MemoryStorage) UpdatePassword(_ context.Context, password entity.StoredPassword) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if user, ok := storage.users[password.UserID]; ok {
+		user.password = password
+	}
+
+	return nil
+}
+
+// GetUserID gets ID of user by login.
+func (storage *MemoryStorage) GetUserID(_ context.Context, login string) (entity.UserID, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	userID, ok := storage.logins[login]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return userID, nil
+}
+
+// SaveRefreshToken saves hash of refresh token.
+func (storage *MemoryStorage) SaveRefreshToken(_ context.Context, token entity.RefreshToken) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.refreshTokens[token.Hash]; ok {
+		return ErrUnknown
+	}
+
+	storage.refreshTokens[token.Hash] = token
+	return nil
+}
+
+// UseRefreshToken deletes refresh token by hash and returns it. Each refresh token can be used only once.
+func (storage *MemoryStorage) UseRefreshToken(_ context.Context, hash string) (entity.RefreshToken, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	token, ok := storage.refreshTokens[hash]
+	if !ok {
+		return entity.RefreshToken{}, ErrUserUnauthorized
+	}
+
+	delete(storage.refreshTokens, hash)
+	return token, nil
+}
+
+// DeleteSessionTokens deletes all refresh tokens of user session.
+func (storage *MemoryStorage) DeleteSessionTokens(ctx context.Context, sessionID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	for hash, token := range storage.refreshTokens {
+		if token.UserID == userID && token.SessionID == sessionID {
+			delete(storage.refreshTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// CreateSession saves new session of user.
+func (storage *MemoryStorage) CreateSession(_ context.Context, session entity.SessionInfo) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.sessions[session.ID]; ok {
+		return ErrUnknown
+	}
+
+	session.LastSeenAt = session.CreatedAt
+	session.Current = false
+	storage.sessions[session.ID] = &memorySession{info: session}
+
+	return nil
+}
+
+// TouchSession updates last seen time of session, if it's older than sessionTouchInterval.
+// Returns ErrUserUnauthorized, if session was revoked.
+func (storage *MemoryStorage) TouchSession(ctx context.Context, sessionID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	session, ok := storage.sessions[sessionID]
+	if !ok || session.info.UserID != userID || session.revoked {
+		return ErrUserUnauthorized
+	}
+
+	now := time.Now()
+	if now.Sub(session.info.LastSeenAt) >= sessionTouchInterval {
+		session.info.LastSeenAt = now
+	}
+
+	return nil
+}
+
+// ListSessions gets not revoked sessions of user, recently seen first.
+func (storage *MemoryStorage) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return nil, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	sessions := make([]entity.SessionInfo, 0)
+	for _, session := range storage.sessions {
+		if session.info.UserID == userID && !session.revoked {
+			sessions = append(sessions, session.info)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession revokes session of user. Returns ErrNotFound, if user has no such active session.
+func (storage *MemoryStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	session, ok := storage.sessions[sessionID]
+	if !ok || session.info.UserID != userID || session.revoked {
+		return ErrNotFound
+	}
+
+	session.revoked = true
+	return nil
+}
+
+// CountActiveSessions counts not revoked sessions of all users, which were seen after since.
+func (storage *MemoryStorage) CountActiveSessions(_ context.Context, since time.Time) (int64, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	var count int64
+	for _, session := range storage.sessions {
+		if !session.revoked && session.info.LastSeenAt.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetTOTP gets TOTP secret of user. Returns ErrNotFound, if user has no TOTP secret.
+func (storage *MemoryStorage) GetTOTP(_ context.Context, userID entity.UserID) (entity.TOTP, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	totp, ok := storage.totp[userID]
+	if !ok {
+		return entity.TOTP{}, ErrNotFound
+	}
+
+	return totp, nil
+}
+
+// SaveTOTP saves new not confirmed TOTP secret of user with hashes of backup codes. Previous secret and codes are replaced.
+func (storage *MemoryStorage) SaveTOTP(_ context.Context, totp entity.TOTP, backupCodes []string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.totp[totp.UserID] = entity.TOTP{UserID: totp.UserID, Secret: totp.Secret}
+
+	codes := make(map[string]struct{}, len(backupCodes))
+	for _, code := range backupCodes {
+		codes[code] = struct{}{}
+	}
+	storage.backupCodes[totp.UserID] = codes
+
+	return nil
+}
+
+// UseTOTPStep confirms TOTP secret and saves time step of accepted code.
+// Returns ErrWrongCredentials, if code of this or later step was already used.
+func (storage *MemoryStorage) UseTOTPStep(_ context.Context, userID entity.UserID, step int64) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	totp, ok := storage.totp[userID]
+	if !ok || totp.LastStep >= step {
+		return ErrWrongCredentials
+	}
+
+	totp.Confirmed = true
+	totp.LastStep = step
+	storage.totp[userID] = totp
+
+	return nil
+}
+
+// UseBackupCode deletes backup code by hash. Returns ErrWrongCredentials, if there is no such code.
+func (storage *MemoryStorage) UseBackupCode(_ context.Context, userID entity.UserID, hash string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.backupCodes[userID][hash]; !ok {
+		return ErrWrongCredentials
+	}
+
+	delete(storage.backupCodes[userID], hash)
+	return nil
+}
+
+// DeleteTOTP deletes TOTP secret and backup codes of user. Returns ErrNotFound, if user has no TOTP secret.
+func (storage *MemoryStorage) DeleteTOTP(_ context.Context, userID entity.UserID) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.totp[userID]; !ok {
+		return ErrNotFound
+	}
+
+	delete(storage.totp, userID)
+	delete(storage.backupCodes, userID)
+
+	return nil
+}
+
+// DeleteUser deletes user and all his records, sessions, TOTP secret and audit log.
+// File records of user are journaled as deleted, deleteFiles is called with their IDs after deleting,
+// so files are deleted only with user. Files, which weren't deleted, are left in journal and deleted later by sweep,
+// they don't fail deleting. Deleting user, who doesn't exist, succeeds.
+func (storage *MemoryStorage) DeleteUser(ctx context.Context, deleteFiles func(recordIDs []string) error) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+
+	files := make([]string, 0)
+	for id, record := range storage.records {
+		if record.userID == userID && record.record.Type == entity.TypeFile {
+			files = append(files, id)
+		}
+	}
+	sort.Strings(files)
+
+	if user, ok := storage.users[userID]; ok {
+		delete(storage.logins, user.login)
+		delete(storage.users, userID)
+	}
+
+	for id, record := range storage.records {
+		if record.userID == userID {
+			delete(storage.records, id)
+		}
+	}
+
+	for id, session := range storage.sessions {
+		if session.info.UserID == userID {
+			delete(storage.sessions, id)
+		}
+	}
+
+	for hash, token := range storage.refreshTokens {
+		if token.UserID == userID {
+			delete(storage.refreshTokens, hash)
+		}
+	}
+
+	delete(storage.totp, userID)
+	delete(storage.backupCodes, userID)
+
+	events := storage.auditEvents[:0]
+	for _, event := range storage.auditEvents {
+		if event.UserID != userID {
+			events = append(events, event)
+		}
+	}
+	storage.auditEvents = events
+
+	for _, id := range files {
+		storage.deletedFiles[id] = struct{}{}
+	}
+
+	// Files are deleted without lock, because deleting can read journal of staged files.
+	storage.Unlock()
+
+	err := deleteFiles(files)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed delete files of deleted user, they are left for sweep", "record_ids", files, "error", err)
+		return nil
+	}
+
+	return storage.ForgetDeletedFiles(ctx, files)
+}
+
+// ListDeletedFiles gets IDs of file records of deleted users, which files weren't deleted yet.
+func (storage *MemoryStorage) ListDeletedFiles(_ context.Context) ([]string, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	files := make([]string, 0, len(storage.deletedFiles))
+	for id := range storage.deletedFiles {
+		files = append(files, id)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// ForgetDeletedFiles removes file records from journal of deleted files after their files are deleted.
+func (storage *MemoryStorage) ForgetDeletedFiles(_ context.Context, recordIDs []string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	for _, id := range recordIDs {
+		delete(storage.deletedFiles, id)
+	}
+
+	return nil
+}
+
+// SaveAuditEvent adds event to audit log of user.
+func (storage *MemoryStorage) SaveAuditEvent(_ context.Context, event entity.AuditEvent) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.auditEvents = append(storage.auditEvents, event)
+	return nil
+}
+
+// ListAuditEvents gets audit log of user in time range, newest events first.
+func (storage *MemoryStorage) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return nil, ErrUserUnauthorized
+	}
+
+	if query.Limit < 0 || (!query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From)) {
+		return nil, ErrBadQuery
+	}
+
+	limit := int(query.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	events := make([]entity.AuditEvent, 0)
+
+	// Events are appended in order of saving, so newer of events with same time go later.
+	for i := len(storage.auditEvents) - 1; i >= 0; i-- {
+		event := storage.auditEvents[i]
+		if event.UserID != userID ||
+			!query.From.IsZero() && event.Time.Before(query.From) ||
+			!query.To.IsZero() && !event.Time.Before(query.To) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	return events, nil
+}
+
+// GetRecordsInfo gets one page of records of this user without data, which are matched by query.
+func (storage *MemoryStorage) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	page := entity.RecordsPage{}
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return page, ErrUserUnauthorized
+	}
+
+	order, ok := recordsSortColumns[query.Sort]
+	if !ok || query.PageSize < 0 {
+		return page, ErrBadQuery
+	}
+
+	pageSize := int(query.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	var token pageToken
+	var key any
+	if query.PageToken != "" {
+		var err error
+		token, key, err = decodePageToken(query.Sort, query.PageToken)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	types := make(map[entity.RecordType]bool, len(query.Types))
+	for _, recordType := range query.Types {
+		types[recordType] = true
+	}
+
+	// sortKey returns value of sort column of record.
+	sortKey := func(record entity.Record) any {
+		if order.column == "revision" {
+			return record.Revision
+		}
+		return record.Metadata
+	}
+
+	// compare returns sign of order of record and position, which is sort key and record ID.
+	compare := func(record entity.Record, key any, id string) int {
+		result := 0
+		if order.column == "revision" {
+			result = compareValues(record.Revision, key.(int64))
+		} else {
+			result = strings.Compare(record.Metadata, key.(string))
+		}
+
+		if result == 0 {
+			result = strings.Compare(record.ID, id)
+		}
+
+		if order.desc {
+			return -result
+		}
+		return result
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	page.Records = make([]entity.Record, 0, 10)
+	for _, stored := range storage.records {
+		record := stored.record
+		if stored.userID != userID || stored.deleted {
+			continue
+		}
+
+		if len(types) != 0 && !types[record.Type] {
+			continue
+		}
+
+		if query.Metadata != "" && !strings.Contains(strings.ToLower(record.Metadata), strings.ToLower(query.Metadata)) {
+			continue
+		}
+
+		if query.PageToken != "" && compare(record, key, token.ID) <= 0 {
+			continue
+		}
+
+		page.Records = append(page.Records, entity.Record{ID: record.ID, Type: record.Type, Metadata: record.Metadata, Revision: record.Revision})
+	}
+
+	sort.Slice(page.Records, func(i, j int) bool {
+		return compare(page.Records[i], sortKey(page.Records[j]), page.Records[j].ID) < 0
+	})
+
+	if len(page.Records) > pageSize {
+		page.Records = page.Records[:pageSize]
+		page.NextPageToken = encodePageToken(query.Sort, page.Records[pageSize-1])
+	}
+
+	return page, nil
+}
+
+// compareValues returns -1, 0 or 1, if a is less, equal or greater than b.
+func compareValues(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// GetChanges gets records of user, which were created, updated or deleted after revision.
+func (storage *MemoryStorage) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	changes := entity.Changes{}
+
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return changes, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	user, ok := storage.users[userID]
+	if !ok {
+		return changes, ErrUserUnauthorized
+	}
+	changes.Revision = user.revision
+
+	changed := make([]*memoryRecord, 0)
+	for _, stored := range storage.records {
+		if stored.userID == userID && stored.record.Revision > sinceRevision {
+			changed = append(changed, stored)
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i].record.Revision < changed[j].record.Revision
+	})
+
+	if sinceRevision > 0 && sinceRevision < user.prunedRevision {
+		return entity.Changes{}, ErrResyncRequired
+	}
+
+	for _, stored := range changed {
+		record := entity.Record{ID: stored.record.ID, Type: stored.record.Type, Metadata: stored.record.Metadata, Revision: stored.record.Revision}
+
+		switch {
+		case stored.deleted:
+			changes.Deleted = append(changes.Deleted, record.ID)
+		case stored.createdRevision > sinceRevision:
+			changes.Created = append(changes.Created, record)
+		default:
+			changes.Updated = append(changes.Updated, record)
+		}
+	}
+
+	return changes, nil
+}
+
+// PruneTombstones deletes tombstones of records of all users, which were deleted before given time.
+// Pruned revision of user is moved to the last pruned tombstone. Returns count of deleted tombstones.
+func (storage *MemoryStorage) PruneTombstones(_ context.Context, before time.Time) (int64, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	revisions := make(map[entity.UserID]int64)
+	for _, stored := range storage.records {
+		if stored.deleted && stored.deletedAt.Before(before) && stored.record.Revision > revisions[stored.userID] {
+			revisions[stored.userID] = stored.record.Revision
+		}
+	}
+
+	var pruned int64
+
+	for id, stored := range storage.records {
+		revision, ok := revisions[stored.userID]
+		if ok && stored.deleted && stored.record.Revision <= revision {
+			delete(storage.records, id)
+			pruned++
+		}
+	}
+
+	for userID, revision := range revisions {
+		if user, ok := storage.users[userID]; ok && user.prunedRevision < revision {
+			user.prunedRevision = revision
+		}
+	}
+
+	return pruned, nil
+}
+
+// ReplaceRecords rewrites data of all records of user at once. Each record should have its current revision and
+// type, and records should be all records of user, otherwise nothing is changed and error is returned.
+func (storage *MemoryStorage) ReplaceRecords(ctx context.Context, records []entity.Record) (int64, error) {
+	return storage.ReplaceFileRecords(ctx, records, nil)
+}
+
+// ReplaceFileRecords replaces records like ReplaceRecords and journals staged files of file records at once.
+func (storage *MemoryStorage) ReplaceFileRecords(ctx context.Context, records []entity.Record, files []entity.StagedFile) (int64, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return 0, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	user, ok := storage.users[userID]
+	if !ok {
+		return 0, ErrUserUnauthorized
+	}
+
+	for _, record := range records {
+		stored, err := storage.activeRecord(userID, record.ID)
+		if err != nil {
+			return 0, err
+		}
+
+		if stored.record.Type != record.Type {
+			return 0, ErrRecordType
+		}
+
+		if stored.record.Revision != record.Revision {
+			return 0, ErrRevisionConflict
+		}
+	}
+
+	count := 0
+	for _, stored := range storage.records {
+		if stored.userID == userID && !stored.deleted {
+			count++
+		}
+	}
+
+	if count != len(records) {
+		return 0, ErrRevisionConflict
+	}
+
+	user.revision++
+	for _, record := range records {
+		stored := storage.records[record.ID]
+		stored.record.Data = cloneBytes(record.Data)
+		stored.record.Revision = user.revision
+		stored.size = int64(len(record.Data))
+	}
+	storage.stageFiles(files)
+
+	return user.revision, nil
+}
+
+// GetStagedFile gets staged file of record from journal. Returns ErrNotFound, if file of record was moved in place.
+func (storage *MemoryStorage) GetStagedFile(_ context.Context, recordID string) (entity.StagedFile, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	file, ok := storage.staged[recordID]
+	if !ok {
+		return entity.StagedFile{}, ErrNotFound
+	}
+
+	return file, nil
+}
+
+// ListStagedFiles gets staged files of all users from journal.
+func (storage *MemoryStorage) ListStagedFiles(_ context.Context) ([]entity.StagedFile, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	files := make([]entity.StagedFile, 0, len(storage.staged))
+	for _, file := range storage.staged {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].RecordID < files[j].RecordID })
+
+	return files, nil
+}
+
+// DeleteStagedFile deletes staged file from journal after it's moved in place. Newer staged file of record is kept.
+func (storage *MemoryStorage) DeleteStagedFile(_ context.Context, file entity.StagedFile) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if staged, ok := storage.staged[file.RecordID]; ok && staged.Name == file.Name {
+		delete(storage.staged, file.RecordID)
+	}
+
+	return nil
+}
+
+// stageFiles journals staged files of updated records and sets sizes of records to sizes of staged data.
+// Should be called under lock.
+func (storage *MemoryStorage) stageFiles(files []entity.StagedFile) {
+	for _, file := range files {
+		if stored, ok := storage.records[file.RecordID]; ok {
+			stored.size = file.Size
+		}
+		storage.staged[file.RecordID] = entity.StagedFile{RecordID: file.RecordID, Name: file.Name}
+	}
+}
+
+// SetRecordSize sets size of record data, which is kept in file storage. Revision of record isn't changed.
+func (storage *MemoryStorage) SetRecordSize(ctx context.Context, recordID string, size int64) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	stored, err := storage.activeRecord(userID, recordID)
+	if err != nil {
+		return err
+	}
+
+	stored.size = size
+	return nil
+}
+
+// ListUnsizedFiles gets file records of all users with zero size, record IDs are mapped to their owners.
+func (storage *MemoryStorage) ListUnsizedFiles(_ context.Context) (map[string]entity.UserID, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	files := make(map[string]entity.UserID)
+	for id, stored := range storage.records {
+		if !stored.deleted && stored.record.Type == entity.TypeFile && stored.size == 0 {
+			files[id] = stored.userID
+		}
+	}
+
+	return files, nil
+}
+
+// GetRecordSize gets size of record data, which is counted in usage.
+func (storage *MemoryStorage) GetRecordSize(ctx context.Context, recordID string) (int64, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return 0, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	stored, err := storage.activeRecord(userID, recordID)
+	if err != nil {
+		return 0, err
+	}
+
+	return stored.size, nil
+}
+
+// GetUsage gets count of records of user and total size of their data.
+func (storage *MemoryStorage) GetUsage(ctx context.Context) (entity.Usage, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.Usage{}, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	usage := entity.Usage{}
+	for _, stored := range storage.records {
+		if stored.userID == userID && !stored.deleted {
+			usage.Records++
+			usage.Bytes += stored.size
+		}
+	}
+
+	return usage, nil
+}
+
+// GetRecord gets record of this user by ID.
+func (storage *MemoryStorage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return entity.Record{}, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	stored, err := storage.activeRecord(userID, recordID)
+	if err != nil {
+		return entity.Record{}, err
+	}
+
+	record := stored.record
+	record.Data = cloneBytes(record.Data)
+	return record, nil
+}
+
+// CreateRecord saves new record of this user. Returns ID of record.
+func (storage *MemoryStorage) CreateRecord(ctx context.Context, record entity.Record) (string, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return "", ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	user, ok := storage.users[userID]
+	if !ok {
+		return "", ErrUserUnauthorized
+	}
+
+	user.revision++
+	record.ID = newMemoryID()
+	record.Data = cloneBytes(record.Data)
+	record.Revision = user.revision
+
+	storage.records[record.ID] = &memoryRecord{
+		record:          record,
+		userID:          userID,
+		createdRevision: user.revision,
+		size:            int64(len(record.Data)),
+	}
+
+	return record.ID, nil
+}
+
+// UpdateRecord updates metadata and data of record, if it wasn't changed since record.Revision. Returns new revision.
+// Type of record can't be changed, for record of other type ErrRecordType is returned.
+func (storage *MemoryStorage) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	return storage.updateRecord(ctx, record, nil)
+}
+
+// UpdateFileRecord updates file record like UpdateRecord and journals its staged file at once.
+func (storage *MemoryStorage) UpdateFileRecord(ctx context.Context, record entity.Record, file entity.StagedFile) (int64, error) {
+	return storage.updateRecord(ctx, record, []entity.StagedFile{file})
+}
+
+// updateRecord updates record and journals staged files.
+func (storage *MemoryStorage) updateRecord(ctx context.Context, record entity.Record, files []entity.StagedFile) (int64, error) {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return 0, ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	user, ok := storage.users[userID]
+	if !ok {
+		return 0, ErrUserUnauthorized
+	}
+
+	stored, err := storage.activeRecord(userID, record.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if stored.record.Type != record.Type {
+		return 0, ErrRecordType
+	}
+
+	if stored.record.Revision != record.Revision {
+		return 0, ErrRevisionConflict
+	}
+
+	user.revision++
+	stored.record.Metadata = record.Metadata
+	stored.record.Data = cloneBytes(record.Data)
+	stored.record.Revision = user.revision
+	stored.size = int64(len(record.Data))
+	storage.stageFiles(files)
+
+	return user.revision, nil
+}
+
+// DeleteRecord marks record of this user as deleted, so it's returned in changes.
+func (storage *MemoryStorage) DeleteRecord(ctx context.Context, recordID string) error {
+	userID, ok := entity.UserIDFromContext(ctx)
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	user, ok := storage.users[userID]
+	if !ok {
+		return ErrUserUnauthorized
+	}
+
+	stored, err := storage.activeRecord(userID, recordID)
+	if err != nil {
+		return err
+	}
+
+	user.revision++
+	stored.deleted = true
+	stored.deletedAt = time.Now()
+	stored.record.Metadata = ""
+	stored.record.Data = nil
+	stored.record.Revision = user.revision
+	stored.size = 0
+
+	return nil
+}
+
+// activeRecord gets not deleted record of user. Storage should be locked.
+func (storage *MemoryStorage) activeRecord(userID entity.UserID, recordID string) (*memoryRecord, error) {
+	stored, ok := storage.records[recordID]
+	if !ok || stored.userID != userID || stored.deleted {
+		return nil, ErrNotFound
+	}
+
+	return stored, nil
+}
+
+// cloneBytes returns copy of data, so callers can't change stored data.
+func cloneBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	return append([]byte{}, data...)
+}
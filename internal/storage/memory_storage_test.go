@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_Behaviour(t *testing.T) {
+	testStorager(t, NewMemoryStorage())
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	storage := NewMemoryStorage()
+	require.NoError(t, storage.CreateUser(context.Background(), "login", entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordArgon2id}))
+	password, err := storage.GetPassword(context.Background(), "login")
+	require.NoError(t, err)
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: password.UserID})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := storage.CreateRecord(ctx, entity.Record{Metadata: "text", Type: entity.TypeText, Data: []byte("data")})
+				assert.NoError(t, err)
+				_, err = storage.GetRecordsInfo(ctx, entity.RecordsQuery{})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	changes, err := storage.GetChanges(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), changes.Revision)
+	assert.Len(t, changes.Created, 100)
+}
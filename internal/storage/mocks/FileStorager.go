@@ -4,8 +4,10 @@ package mocks
 
 import (
 	context "context"
+	io "io"
 
 	entity "github.com/size12/gophkeeper/internal/entity"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -14,6 +16,20 @@ type FileStorager struct {
 	mock.Mock
 }
 
+// CommitFile provides a mock function with given fields: ctx, recordID, staged
+func (_m *FileStorager) CommitFile(ctx context.Context, recordID string, staged string) error {
+	ret := _m.Called(ctx, recordID, staged)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, recordID, staged)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateRecord provides a mock function with given fields: ctx, record
 func (_m *FileStorager) CreateRecord(ctx context.Context, record entity.Record) (string, error) {
 	ret := _m.Called(ctx, record)
@@ -52,6 +68,44 @@ func (_m *FileStorager) DeleteRecord(ctx context.Context, recordID string) error
 	return r0
 }
 
+// DiscardFile provides a mock function with given fields: ctx, staged
+func (_m *FileStorager) DiscardFile(ctx context.Context, staged string) error {
+	ret := _m.Called(ctx, staged)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, staged)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FileSize provides a mock function with given fields: ctx, recordID
+func (_m *FileStorager) FileSize(ctx context.Context, recordID string) (int64, error) {
+	ret := _m.Called(ctx, recordID)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int64, error)); ok {
+		return rf(ctx, recordID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, recordID)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, recordID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRecord provides a mock function with given fields: ctx, recordID
 func (_m *FileStorager) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
 	ret := _m.Called(ctx, recordID)
@@ -76,6 +130,102 @@ func (_m *FileStorager) GetRecord(ctx context.Context, recordID string) (entity.
 	return r0, r1
 }
 
+// ReadFile provides a mock function with given fields: ctx, recordID, w
+func (_m *FileStorager) ReadFile(ctx context.Context, recordID string, w io.Writer) (int64, error) {
+	ret := _m.Called(ctx, recordID, w)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Writer) (int64, error)); ok {
+		return rf(ctx, recordID, w)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Writer) int64); ok {
+		r0 = rf(ctx, recordID, w)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, io.Writer) error); ok {
+		r1 = rf(ctx, recordID, w)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StageFile provides a mock function with given fields: ctx, recordID, r
+func (_m *FileStorager) StageFile(ctx context.Context, recordID string, r io.Reader) (string, error) {
+	ret := _m.Called(ctx, recordID, r)
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Reader) (string, error)); ok {
+		return rf(ctx, recordID, r)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Reader) string); ok {
+		r0 = rf(ctx, recordID, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, io.Reader) error); ok {
+		r1 = rf(ctx, recordID, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateRecord provides a mock function with given fields: ctx, record
+func (_m *FileStorager) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	ret := _m.Called(ctx, record)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) (int64, error)); ok {
+		return rf(ctx, record)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) int64); ok {
+		r0 = rf(ctx, record)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.Record) error); ok {
+		r1 = rf(ctx, record)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WriteFile provides a mock function with given fields: ctx, recordID, r
+func (_m *FileStorager) WriteFile(ctx context.Context, recordID string, r io.Reader) (int64, error) {
+	ret := _m.Called(ctx, recordID, r)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Reader) (int64, error)); ok {
+		return rf(ctx, recordID, r)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.Reader) int64); ok {
+		r0 = rf(ctx, recordID, r)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, io.Reader) error); ok {
+		r1 = rf(ctx, recordID, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewFileStorager interface {
 	mock.TestingT
 	Cleanup(func())
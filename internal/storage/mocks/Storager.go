@@ -7,6 +7,8 @@ import (
 
 	entity "github.com/size12/gophkeeper/internal/entity"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // Storager is an autogenerated mock type for the Storager type
@@ -38,13 +40,27 @@ func (_m *Storager) CreateRecord(ctx context.Context, record entity.Record) (str
 	return r0, r1
 }
 
-// CreateUser provides a mock function with given fields: credentials
-func (_m *Storager) CreateUser(credentials entity.UserCredentials) error {
-	ret := _m.Called(credentials)
+// CreateSession provides a mock function with given fields: ctx, session
+func (_m *Storager) CreateSession(ctx context.Context, session entity.SessionInfo) error {
+	ret := _m.Called(ctx, session)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) error); ok {
-		r0 = rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, entity.SessionInfo) error); ok {
+		r0 = rf(ctx, session)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUser provides a mock function with given fields: ctx, login, password
+func (_m *Storager) CreateUser(ctx context.Context, login string, password entity.StoredPassword) error {
+	ret := _m.Called(ctx, login, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, entity.StoredPassword) error); ok {
+		r0 = rf(ctx, login, password)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -66,6 +82,124 @@ func (_m *Storager) DeleteRecord(ctx context.Context, recordID string) error {
 	return r0
 }
 
+// DeleteSessionTokens provides a mock function with given fields: ctx, sessionID
+func (_m *Storager) DeleteSessionTokens(ctx context.Context, sessionID string) error {
+	ret := _m.Called(ctx, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteStagedFile provides a mock function with given fields: ctx, file
+func (_m *Storager) DeleteStagedFile(ctx context.Context, file entity.StagedFile) error {
+	ret := _m.Called(ctx, file)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.StagedFile) error); ok {
+		r0 = rf(ctx, file)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTOTP provides a mock function with given fields: ctx, userID
+func (_m *Storager) DeleteTOTP(ctx context.Context, userID entity.UserID) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserID) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, deleteFiles
+func (_m *Storager) DeleteUser(ctx context.Context, deleteFiles func([]string) error) error {
+	ret := _m.Called(ctx, deleteFiles)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func([]string) error) error); ok {
+		r0 = rf(ctx, deleteFiles)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ForgetDeletedFiles provides a mock function with given fields: ctx, recordIDs
+func (_m *Storager) ForgetDeletedFiles(ctx context.Context, recordIDs []string) error {
+	ret := _m.Called(ctx, recordIDs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) error); ok {
+		r0 = rf(ctx, recordIDs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetChanges provides a mock function with given fields: ctx, sinceRevision
+func (_m *Storager) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	ret := _m.Called(ctx, sinceRevision)
+
+	var r0 entity.Changes
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (entity.Changes, error)); ok {
+		return rf(ctx, sinceRevision)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) entity.Changes); ok {
+		r0 = rf(ctx, sinceRevision)
+	} else {
+		r0 = ret.Get(0).(entity.Changes)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, sinceRevision)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPassword provides a mock function with given fields: ctx, login
+func (_m *Storager) GetPassword(ctx context.Context, login string) (entity.StoredPassword, error) {
+	ret := _m.Called(ctx, login)
+
+	var r0 entity.StoredPassword
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entity.StoredPassword, error)); ok {
+		return rf(ctx, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) entity.StoredPassword); ok {
+		r0 = rf(ctx, login)
+	} else {
+		r0 = ret.Get(0).(entity.StoredPassword)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRecord provides a mock function with given fields: ctx, recordID
 func (_m *Storager) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
 	ret := _m.Called(ctx, recordID)
@@ -90,21 +224,115 @@ func (_m *Storager) GetRecord(ctx context.Context, recordID string) (entity.Reco
 	return r0, r1
 }
 
-// GetRecordsInfo provides a mock function with given fields: ctx
-func (_m *Storager) GetRecordsInfo(ctx context.Context) ([]entity.Record, error) {
+// GetRecordSize provides a mock function with given fields: ctx, recordID
+func (_m *Storager) GetRecordSize(ctx context.Context, recordID string) (int64, error) {
+	ret := _m.Called(ctx, recordID)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int64, error)); ok {
+		return rf(ctx, recordID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, recordID)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, recordID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRecordsInfo provides a mock function with given fields: ctx, query
+func (_m *Storager) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 entity.RecordsPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.RecordsQuery) (entity.RecordsPage, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.RecordsQuery) entity.RecordsPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		r0 = ret.Get(0).(entity.RecordsPage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.RecordsQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetStagedFile provides a mock function with given fields: ctx, recordID
+func (_m *Storager) GetStagedFile(ctx context.Context, recordID string) (entity.StagedFile, error) {
+	ret := _m.Called(ctx, recordID)
+
+	var r0 entity.StagedFile
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entity.StagedFile, error)); ok {
+		return rf(ctx, recordID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) entity.StagedFile); ok {
+		r0 = rf(ctx, recordID)
+	} else {
+		r0 = ret.Get(0).(entity.StagedFile)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, recordID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTOTP provides a mock function with given fields: ctx, userID
+func (_m *Storager) GetTOTP(ctx context.Context, userID entity.UserID) (entity.TOTP, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 entity.TOTP
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserID) (entity.TOTP, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserID) entity.TOTP); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(entity.TOTP)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.UserID) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsage provides a mock function with given fields: ctx
+func (_m *Storager) GetUsage(ctx context.Context) (entity.Usage, error) {
 	ret := _m.Called(ctx)
 
-	var r0 []entity.Record
+	var r0 entity.Usage
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) ([]entity.Record, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context) (entity.Usage, error)); ok {
 		return rf(ctx)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) []entity.Record); ok {
+	if rf, ok := ret.Get(0).(func(context.Context) entity.Usage); ok {
 		r0 = rf(ctx)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]entity.Record)
-		}
+		r0 = ret.Get(0).(entity.Usage)
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
@@ -116,23 +344,177 @@ func (_m *Storager) GetRecordsInfo(ctx context.Context) ([]entity.Record, error)
 	return r0, r1
 }
 
-// LoginUser provides a mock function with given fields: credentials
-func (_m *Storager) LoginUser(credentials entity.UserCredentials) (entity.UserID, error) {
-	ret := _m.Called(credentials)
+// GetUserID provides a mock function with given fields: ctx, login
+func (_m *Storager) GetUserID(ctx context.Context, login string) (entity.UserID, error) {
+	ret := _m.Called(ctx, login)
 
 	var r0 entity.UserID
 	var r1 error
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) (entity.UserID, error)); ok {
-		return rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entity.UserID, error)); ok {
+		return rf(ctx, login)
 	}
-	if rf, ok := ret.Get(0).(func(entity.UserCredentials) entity.UserID); ok {
-		r0 = rf(credentials)
+	if rf, ok := ret.Get(0).(func(context.Context, string) entity.UserID); ok {
+		r0 = rf(ctx, login)
 	} else {
 		r0 = ret.Get(0).(entity.UserID)
 	}
 
-	if rf, ok := ret.Get(1).(func(entity.UserCredentials) error); ok {
-		r1 = rf(credentials)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAuditEvents provides a mock function with given fields: ctx, query
+func (_m *Storager) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 []entity.AuditEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuditQuery) ([]entity.AuditEvent, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuditQuery) []entity.AuditEvent); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.AuditEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.AuditQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeletedFiles provides a mock function with given fields: ctx
+func (_m *Storager) ListDeletedFiles(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]string, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListSessions provides a mock function with given fields: ctx
+func (_m *Storager) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []entity.SessionInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]entity.SessionInfo, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []entity.SessionInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.SessionInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListStagedFiles provides a mock function with given fields: ctx
+func (_m *Storager) ListStagedFiles(ctx context.Context) ([]entity.StagedFile, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []entity.StagedFile
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]entity.StagedFile, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []entity.StagedFile); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]entity.StagedFile)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUnsizedFiles provides a mock function with given fields: ctx
+func (_m *Storager) ListUnsizedFiles(ctx context.Context) (map[string]entity.UserID, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]entity.UserID
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (map[string]entity.UserID, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]entity.UserID); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]entity.UserID)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PruneTombstones provides a mock function with given fields: ctx, before
+func (_m *Storager) PruneTombstones(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int64, error)); ok {
+		return rf(ctx, before)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -140,6 +522,252 @@ func (_m *Storager) LoginUser(credentials entity.UserCredentials) (entity.UserID
 	return r0, r1
 }
 
+// ReplaceFileRecords provides a mock function with given fields: ctx, records, files
+func (_m *Storager) ReplaceFileRecords(ctx context.Context, records []entity.Record, files []entity.StagedFile) (int64, error) {
+	ret := _m.Called(ctx, records, files)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []entity.Record, []entity.StagedFile) (int64, error)); ok {
+		return rf(ctx, records, files)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []entity.Record, []entity.StagedFile) int64); ok {
+		r0 = rf(ctx, records, files)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []entity.Record, []entity.StagedFile) error); ok {
+		r1 = rf(ctx, records, files)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceRecords provides a mock function with given fields: ctx, records
+func (_m *Storager) ReplaceRecords(ctx context.Context, records []entity.Record) (int64, error) {
+	ret := _m.Called(ctx, records)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []entity.Record) (int64, error)); ok {
+		return rf(ctx, records)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []entity.Record) int64); ok {
+		r0 = rf(ctx, records)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []entity.Record) error); ok {
+		r1 = rf(ctx, records)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeSession provides a mock function with given fields: ctx, sessionID
+func (_m *Storager) RevokeSession(ctx context.Context, sessionID string) error {
+	ret := _m.Called(ctx, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveAuditEvent provides a mock function with given fields: ctx, event
+func (_m *Storager) SaveAuditEvent(ctx context.Context, event entity.AuditEvent) error {
+	ret := _m.Called(ctx, event)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.AuditEvent) error); ok {
+		r0 = rf(ctx, event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveRefreshToken provides a mock function with given fields: ctx, token
+func (_m *Storager) SaveRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	ret := _m.Called(ctx, token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.RefreshToken) error); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveTOTP provides a mock function with given fields: ctx, totp, backupCodes
+func (_m *Storager) SaveTOTP(ctx context.Context, totp entity.TOTP, backupCodes []string) error {
+	ret := _m.Called(ctx, totp, backupCodes)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.TOTP, []string) error); ok {
+		r0 = rf(ctx, totp, backupCodes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetRecordSize provides a mock function with given fields: ctx, recordID, size
+func (_m *Storager) SetRecordSize(ctx context.Context, recordID string, size int64) error {
+	ret := _m.Called(ctx, recordID, size)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, recordID, size)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TouchSession provides a mock function with given fields: ctx, sessionID
+func (_m *Storager) TouchSession(ctx context.Context, sessionID string) error {
+	ret := _m.Called(ctx, sessionID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateFileRecord provides a mock function with given fields: ctx, record, file
+func (_m *Storager) UpdateFileRecord(ctx context.Context, record entity.Record, file entity.StagedFile) (int64, error) {
+	ret := _m.Called(ctx, record, file)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record, entity.StagedFile) (int64, error)); ok {
+		return rf(ctx, record, file)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record, entity.StagedFile) int64); ok {
+		r0 = rf(ctx, record, file)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.Record, entity.StagedFile) error); ok {
+		r1 = rf(ctx, record, file)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePassword provides a mock function with given fields: ctx, password
+func (_m *Storager) UpdatePassword(ctx context.Context, password entity.StoredPassword) error {
+	ret := _m.Called(ctx, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.StoredPassword) error); ok {
+		r0 = rf(ctx, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateRecord provides a mock function with given fields: ctx, record
+func (_m *Storager) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	ret := _m.Called(ctx, record)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) (int64, error)); ok {
+		return rf(ctx, record)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, entity.Record) int64); ok {
+		r0 = rf(ctx, record)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, entity.Record) error); ok {
+		r1 = rf(ctx, record)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseBackupCode provides a mock function with given fields: ctx, userID, hash
+func (_m *Storager) UseBackupCode(ctx context.Context, userID entity.UserID, hash string) error {
+	ret := _m.Called(ctx, userID, hash)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserID, string) error); ok {
+		r0 = rf(ctx, userID, hash)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseRefreshToken provides a mock function with given fields: ctx, hash
+func (_m *Storager) UseRefreshToken(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	ret := _m.Called(ctx, hash)
+
+	var r0 entity.RefreshToken
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entity.RefreshToken, error)); ok {
+		return rf(ctx, hash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) entity.RefreshToken); ok {
+		r0 = rf(ctx, hash)
+	} else {
+		r0 = ret.Get(0).(entity.RefreshToken)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, hash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UseTOTPStep provides a mock function with given fields: ctx, userID, step
+func (_m *Storager) UseTOTPStep(ctx context.Context, userID entity.UserID, step int64) error {
+	ret := _m.Called(ctx, userID, step)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, entity.UserID, int64) error); ok {
+		r0 = rf(ctx, userID, step)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewStorager interface {
 	mock.TestingT
 	Cleanup(func())
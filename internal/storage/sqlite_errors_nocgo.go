@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package storage
+
+// isSQLiteUniqueViolation always returns false: without cgo SQLite driver isn't built and returns no SQLite errors.
+func isSQLiteUniqueViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"database/sql"
+	"log/slog"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteOptions are options of SQLite connection. Write transactions take lock at begin and wait for each other,
+// so concurrent requests don't fail with "database is locked".
+const sqliteOptions = "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// SQLiteStorage is DB storage on embedded SQLite database for single server.
+// Queries of DBStorage work with both databases, only migrations are different.
+type SQLiteStorage struct {
+	*DBStorage
+}
+
+// NewSQLiteStorage opens SQLite database file. File is created, if it doesn't exist.
+func NewSQLiteStorage(path string) *SQLiteStorage {
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+sqliteOptions)
+	if err != nil {
+		slog.Error("Failed open SQLite storage", "error", err)
+		os.Exit(1)
+	}
+
+	return &SQLiteStorage{DBStorage: &DBStorage{DB: db, uniqueViolation: isSQLiteUniqueViolation}}
+}
+
+// MigrateUP migrates DB.
+func (storage *SQLiteStorage) MigrateUP() {
+	err := storage.migrate("file://migrations/sqlite")
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// migrate applies SQLite migrations from source URL.
+func (storage *SQLiteStorage) migrate(sourceURL string) error {
+	driver, err := sqlite3.WithInstance(storage.DB, &sqlite3.Config{})
+	if err != nil {
+		slog.Error("Failed create sqlite instance", "error", err)
+		return err
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(sourceURL, "sqlite3", driver)
+	if err != nil {
+		slog.Error("Failed create migration instance", "error", err)
+		return err
+	}
+
+	err = m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		slog.Error("Failed migrate", "error", err)
+		return err
+	}
+
+	return nil
+}
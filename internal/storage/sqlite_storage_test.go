@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_Behaviour(t *testing.T) {
+	storage := NewSQLiteStorage(filepath.Join(t.TempDir(), "gophkeeper.db"))
+	defer storage.DB.Close()
+	require.NoError(t, storage.migrate("file://../../migrations/sqlite"))
+
+	assert.NoError(t, storage.Ping(context.Background()))
+
+	testStorager(t, storage)
+}
+
+func TestSQLiteStorage_UniqueLogin(t *testing.T) {
+	storage := NewSQLiteStorage(filepath.Join(t.TempDir(), "gophkeeper.db"))
+	defer storage.DB.Close()
+	require.NoError(t, storage.migrate("file://../../migrations/sqlite"))
+
+	_, err := storage.DB.Exec(`INSERT INTO users (login, password) VALUES ('login', 'hash')`)
+	require.NoError(t, err)
+	_, err = storage.DB.Exec(`INSERT INTO users (login, password) VALUES ('login', 'hash')`)
+	assert.True(t, storage.isUniqueViolation(err), "login should be unique in schema")
+
+	results := make(chan error, 10)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			results <- storage.CreateUser(context.Background(), "concurrent", entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordArgon2id})
+		}()
+	}
+
+	created := 0
+	for i := 0; i < cap(results); i++ {
+		err := <-results
+		if err == nil {
+			created++
+			continue
+		}
+		assert.Equal(t, ErrLoginExists, err)
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestSQLiteStorage_MigrateTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gophkeeper.db")
+
+	for i := 0; i < 2; i++ {
+		storage := NewSQLiteStorage(path)
+		assert.NoError(t, storage.migrate("file://../../migrations/sqlite"))
+		assert.NoError(t, storage.DB.Close())
+	}
+}
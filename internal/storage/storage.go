@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"log/slog"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
 )
@@ -11,6 +15,9 @@ import (
 type Storage struct {
 	DBStorage   Storager
 	FileStorage FileStorager
+	// Quota limits records of each user. Quota is checked before record is created, so concurrent requests
+	// of one user can exceed it a little.
+	Quota entity.Quota
 }
 
 // NewStorage returns new storage.
@@ -22,24 +29,352 @@ func NewStorage(DBStorage Storager, fileStorage FileStorager) *Storage {
 }
 
 // CreateUser creates new user and saves to DB storage.
-func (storage *Storage) CreateUser(credentials entity.UserCredentials) error {
-	return storage.DBStorage.CreateUser(credentials)
+func (storage *Storage) CreateUser(ctx context.Context, login string, password entity.StoredPassword) error {
+	return storage.DBStorage.CreateUser(ctx, login, password)
 }
 
-// LoginUser check user login using DB storage.
-func (storage *Storage) LoginUser(credentials entity.UserCredentials) (entity.UserID, error) {
-	return storage.DBStorage.LoginUser(credentials)
+// GetPassword gets password hash of user from DB storage.
+func (storage *Storage) GetPassword(ctx context.Context, login string) (entity.StoredPassword, error) {
+	return storage.DBStorage.GetPassword(ctx, login)
 }
 
-// GetRecordsInfo gets all records from user from DB storage.
-func (storage *Storage) GetRecordsInfo(ctx context.Context) ([]entity.Record, error) {
-	return storage.DBStorage.GetRecordsInfo(ctx)
+// UpdatePassword changes password hash of user in DB storage.
+func (storage *Storage) UpdatePassword(ctx context.Context, password entity.StoredPassword) error {
+	return storage.DBStorage.UpdatePassword(ctx, password)
+}
+
+// GetUserID gets user ID by login from DB storage.
+func (storage *Storage) GetUserID(ctx context.Context, login string) (entity.UserID, error) {
+	return storage.DBStorage.GetUserID(ctx, login)
+}
+
+// SaveRefreshToken saves refresh token to DB storage.
+func (storage *Storage) SaveRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	return storage.DBStorage.SaveRefreshToken(ctx, token)
+}
+
+// UseRefreshToken takes refresh token from DB storage.
+func (storage *Storage) UseRefreshToken(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	return storage.DBStorage.UseRefreshToken(ctx, hash)
+}
+
+// DeleteSessionTokens deletes refresh tokens of session from DB storage.
+func (storage *Storage) DeleteSessionTokens(ctx context.Context, sessionID string) error {
+	return storage.DBStorage.DeleteSessionTokens(ctx, sessionID)
+}
+
+// CreateSession saves new session to DB storage.
+func (storage *Storage) CreateSession(ctx context.Context, session entity.SessionInfo) error {
+	return storage.DBStorage.CreateSession(ctx, session)
+}
+
+// TouchSession checks session in DB storage and updates its last seen time.
+func (storage *Storage) TouchSession(ctx context.Context, sessionID string) error {
+	return storage.DBStorage.TouchSession(ctx, sessionID)
+}
+
+// ListSessions gets active sessions of user from DB storage.
+func (storage *Storage) ListSessions(ctx context.Context) ([]entity.SessionInfo, error) {
+	return storage.DBStorage.ListSessions(ctx)
+}
+
+// RevokeSession revokes session in DB storage.
+func (storage *Storage) RevokeSession(ctx context.Context, sessionID string) error {
+	return storage.DBStorage.RevokeSession(ctx, sessionID)
+}
+
+// GetTOTP gets TOTP secret of user from DB storage.
+func (storage *Storage) GetTOTP(ctx context.Context, userID entity.UserID) (entity.TOTP, error) {
+	return storage.DBStorage.GetTOTP(ctx, userID)
+}
+
+// SaveTOTP saves TOTP secret and backup codes of user to DB storage.
+func (storage *Storage) SaveTOTP(ctx context.Context, totp entity.TOTP, backupCodes []string) error {
+	return storage.DBStorage.SaveTOTP(ctx, totp, backupCodes)
+}
+
+// UseTOTPStep saves accepted TOTP step of user to DB storage.
+func (storage *Storage) UseTOTPStep(ctx context.Context, userID entity.UserID, step int64) error {
+	return storage.DBStorage.UseTOTPStep(ctx, userID, step)
+}
+
+// UseBackupCode deletes used backup code of user from DB storage.
+func (storage *Storage) UseBackupCode(ctx context.Context, userID entity.UserID, hash string) error {
+	return storage.DBStorage.UseBackupCode(ctx, userID, hash)
+}
+
+// DeleteTOTP deletes TOTP secret of user from DB storage.
+func (storage *Storage) DeleteTOTP(ctx context.Context, userID entity.UserID) error {
+	return storage.DBStorage.DeleteTOTP(ctx, userID)
+}
+
+// DeleteUser deletes user from DB storage, deleteFiles is called with his file records after commit.
+// File records are journaled as deleted, so files, which weren't deleted, are deleted by PurgeDeletedFiles.
+func (storage *Storage) DeleteUser(ctx context.Context, deleteFiles func(recordIDs []string) error) error {
+	return storage.DBStorage.DeleteUser(ctx, deleteFiles)
+}
+
+// SaveAuditEvent adds event to audit log in DB storage.
+func (storage *Storage) SaveAuditEvent(ctx context.Context, event entity.AuditEvent) error {
+	return storage.DBStorage.SaveAuditEvent(ctx, event)
+}
+
+// ListAuditEvents gets audit log of user from DB storage.
+func (storage *Storage) ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	return storage.DBStorage.ListAuditEvents(ctx, query)
+}
+
+// GetRecordsInfo gets page of records from user from DB storage.
+func (storage *Storage) GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error) {
+	return storage.DBStorage.GetRecordsInfo(ctx, query)
+}
+
+// GetChanges gets changed records since revision from DB storage.
+func (storage *Storage) GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error) {
+	return storage.DBStorage.GetChanges(ctx, sinceRevision)
+}
+
+// PruneTombstones deletes tombstones of records, which were deleted before given time, from DB storage.
+func (storage *Storage) PruneTombstones(ctx context.Context, before time.Time) (int64, error) {
+	return storage.DBStorage.PruneTombstones(ctx, before)
+}
+
+// SetRecordSize sets size of file record data in DB storage.
+func (storage *Storage) SetRecordSize(ctx context.Context, recordID string, size int64) error {
+	return storage.DBStorage.SetRecordSize(ctx, recordID, size)
+}
+
+// GetRecordSize gets size of record data from DB storage.
+func (storage *Storage) GetRecordSize(ctx context.Context, recordID string) (int64, error) {
+	return storage.DBStorage.GetRecordSize(ctx, recordID)
+}
+
+// ListUnsizedFiles gets file records of all users with zero size from DB storage.
+func (storage *Storage) ListUnsizedFiles(ctx context.Context) (map[string]entity.UserID, error) {
+	return storage.DBStorage.ListUnsizedFiles(ctx)
+}
+
+// ReplaceFileRecords replaces records and journals staged files in DB storage. Files aren't moved in place.
+func (storage *Storage) ReplaceFileRecords(ctx context.Context, records []entity.Record, files []entity.StagedFile) (int64, error) {
+	return storage.DBStorage.ReplaceFileRecords(ctx, records, files)
+}
+
+// UpdateFileRecord updates file record and journals its staged file in DB storage. File isn't moved in place.
+func (storage *Storage) UpdateFileRecord(ctx context.Context, record entity.Record, file entity.StagedFile) (int64, error) {
+	return storage.DBStorage.UpdateFileRecord(ctx, record, file)
+}
+
+// GetStagedFile gets staged file of record from DB storage.
+func (storage *Storage) GetStagedFile(ctx context.Context, recordID string) (entity.StagedFile, error) {
+	return storage.DBStorage.GetStagedFile(ctx, recordID)
+}
+
+// ListStagedFiles gets staged files of all users from DB storage.
+func (storage *Storage) ListStagedFiles(ctx context.Context) ([]entity.StagedFile, error) {
+	return storage.DBStorage.ListStagedFiles(ctx)
+}
+
+// DeleteStagedFile deletes staged file from journal in DB storage.
+func (storage *Storage) DeleteStagedFile(ctx context.Context, file entity.StagedFile) error {
+	return storage.DBStorage.DeleteStagedFile(ctx, file)
+}
+
+// ListDeletedFiles gets file records of deleted users, which files weren't deleted yet, from DB storage.
+func (storage *Storage) ListDeletedFiles(ctx context.Context) ([]string, error) {
+	return storage.DBStorage.ListDeletedFiles(ctx)
+}
+
+// ForgetDeletedFiles removes file records from journal of deleted files in DB storage.
+func (storage *Storage) ForgetDeletedFiles(ctx context.Context, recordIDs []string) error {
+	return storage.DBStorage.ForgetDeletedFiles(ctx, recordIDs)
+}
+
+// CommitStagedFiles moves in place staged files, which were journaled with updated records, but weren't moved,
+// because server failed or stopped after commit of records. Returns count of moved files.
+func (storage *Storage) CommitStagedFiles(ctx context.Context) (int, error) {
+	files, err := storage.DBStorage.ListStagedFiles(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	committed := 0
+
+	for _, file := range files {
+		err = storage.commitStagedFile(ctx, file)
+		if err != nil {
+			return committed, err
+		}
+
+		committed++
+	}
+
+	return committed, nil
+}
+
+// resolveFile moves staged file of record in place, if it's journaled, so record file matches record in DB.
+func (storage *Storage) resolveFile(ctx context.Context, recordID string) error {
+	file, err := storage.DBStorage.GetStagedFile(ctx, recordID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return storage.commitStagedFile(ctx, file)
+}
+
+// commitStagedFile moves journaled staged file in place of record file and deletes it from journal.
+func (storage *Storage) commitStagedFile(ctx context.Context, file entity.StagedFile) error {
+	err := storage.FileStorage.CommitFile(ctx, file.RecordID, file.Name)
+	if err != nil {
+		// File could be moved by concurrent request, then it isn't in journal anymore.
+		staged, getErr := storage.DBStorage.GetStagedFile(ctx, file.RecordID)
+		if errors.Is(getErr, ErrNotFound) || getErr == nil && staged.Name != file.Name {
+			return nil
+		}
+
+		slog.ErrorContext(ctx, "Failed commit staged file of record", "record_id", file.RecordID, "staged", file.Name, "error", err)
+		return err
+	}
+
+	return storage.DBStorage.DeleteStagedFile(ctx, file)
+}
+
+// BackfillFileSizes sets sizes of file records, which were created before sizes were counted, from file storage.
+// Records with empty files are checked again on each run, it's cheap. Returns count of updated records.
+func (storage *Storage) BackfillFileSizes(ctx context.Context) (int, error) {
+	files, err := storage.DBStorage.ListUnsizedFiles(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+
+	for recordID, userID := range files {
+		size, err := storage.FileStorage.FileSize(ctx, recordID)
+		if errors.Is(err, ErrNotFound) {
+			slog.WarnContext(ctx, "File of record is missing, size isn't set", "record_id", recordID)
+			continue
+		}
+
+		if err != nil {
+			return updated, err
+		}
+
+		if size == 0 {
+			continue
+		}
+
+		err = storage.DBStorage.SetRecordSize(entity.WithPrincipal(ctx, entity.Principal{UserID: userID}), recordID, size)
+		if errors.Is(err, ErrNotFound) {
+			// Record was deleted after it was listed.
+			continue
+		}
+
+		if err != nil {
+			return updated, err
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+// GetUsage gets usage of user from DB storage with quota of user.
+func (storage *Storage) GetUsage(ctx context.Context) (entity.Usage, error) {
+	usage, err := storage.DBStorage.GetUsage(ctx)
+	if err != nil {
+		return entity.Usage{}, err
+	}
+
+	usage.Quota = storage.Quota
+	return usage, nil
+}
+
+// checkQuota checks if user can create new record with data of size. Returns count of bytes, which user can still add,
+// or -1, if total size isn't limited.
+func (storage *Storage) checkQuota(ctx context.Context, size int64) (int64, error) {
+	quota := storage.Quota
+	if quota.MaxRecordSize > 0 && size > quota.MaxRecordSize {
+		return 0, ErrQuotaExceeded
+	}
+
+	left := int64(-1)
+	if quota.MaxBytes == 0 && quota.MaxRecords == 0 {
+		return left, nil
+	}
+
+	usage, err := storage.DBStorage.GetUsage(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if quota.MaxRecords > 0 && usage.Records >= quota.MaxRecords {
+		return 0, ErrQuotaExceeded
+	}
+
+	if quota.MaxBytes > 0 {
+		left = quota.MaxBytes - usage.Bytes - size
+		if left < 0 {
+			return 0, ErrQuotaExceeded
+		}
+	}
+
+	return left, nil
+}
+
+// checkUpdateQuota checks if record can be rewritten by data of size. Record can't be enlarged above total size,
+// but it can be shrunk, even if user exceeds quota.
+func (storage *Storage) checkUpdateQuota(ctx context.Context, recordID string, size int64) error {
+	quota := storage.Quota
+	if quota.MaxRecordSize > 0 && size > quota.MaxRecordSize {
+		return ErrQuotaExceeded
+	}
+
+	if quota.MaxBytes == 0 {
+		return nil
+	}
+
+	usage, err := storage.DBStorage.GetUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldSize, err := storage.DBStorage.GetRecordSize(ctx, recordID)
+	if err != nil {
+		return err
+	}
+
+	if size > oldSize && usage.Bytes-oldSize+size > quota.MaxBytes {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// limitFile returns reader of file record data, which fails after limit bytes. Limit -1 means no limit.
+// MaxRecordSize is applied too.
+func (storage *Storage) limitFile(r io.Reader, limit int64) *quotaReader {
+	if storage.Quota.MaxRecordSize > 0 && (limit < 0 || storage.Quota.MaxRecordSize < limit) {
+		limit = storage.Quota.MaxRecordSize
+	}
+
+	return &quotaReader{r: r, left: limit}
 }
 
 // CreateRecord creates record, saves to DB. If record type is file, saves to file storage too.
+// Record isn't created, if it exceeds quota of user.
 func (storage *Storage) CreateRecord(ctx context.Context, record entity.Record) (string, error) {
 	data := record.Data
 
+	_, err := storage.checkQuota(ctx, int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
 	if record.Type == entity.TypeFile {
 		record.Data = nil
 	}
@@ -53,15 +388,300 @@ func (storage *Storage) CreateRecord(ctx context.Context, record entity.Record)
 		record.ID = id
 		record.Data = data
 		_, err = storage.FileStorage.CreateRecord(ctx, record)
+		if err != nil {
+			return "", err
+		}
+
+		err = storage.DBStorage.SetRecordSize(ctx, id, int64(len(data)))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// UploadFile creates file record in DB and streams its data to file storage.
+// Upload is stopped, when data exceeds quota of user.
+func (storage *Storage) UploadFile(ctx context.Context, record entity.Record, r io.Reader) (string, error) {
+	record.Type = entity.TypeFile
+	record.Data = nil
+
+	left, err := storage.checkQuota(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := storage.DBStorage.CreateRecord(ctx, record)
+	if err != nil {
+		return "", err
+	}
+
+	limited := storage.limitFile(r, left)
+	size, err := storage.FileStorage.WriteFile(ctx, id, limited)
+	if err != nil {
+		if deleteErr := storage.DBStorage.DeleteRecord(ctx, id); deleteErr != nil {
+			slog.ErrorContext(ctx, "Failed delete record after failed upload", "error", deleteErr)
+		}
+
+		if limited.exceeded {
+			return "", ErrQuotaExceeded
+		}
+		return "", err
+	}
+
+	err = storage.DBStorage.SetRecordSize(ctx, id, size)
+	if err != nil {
+		// File is already written, so it's deleted with record.
+		if deleteErr := storage.DeleteRecord(ctx, id); deleteErr != nil {
+			slog.ErrorContext(ctx, "Failed delete record after failed upload", "error", deleteErr)
+		}
 		return "", err
 	}
 
 	return id, nil
 }
 
+// DownloadFile streams file record data from file storage to writer. Staged file of updated record is moved
+// in place first, so old data of record isn't read.
+func (storage *Storage) DownloadFile(ctx context.Context, recordID string, w io.Writer) (int64, error) {
+	record, err := storage.DBStorage.GetRecord(ctx, recordID)
+	if err != nil {
+		return 0, err
+	}
+
+	if record.Type != entity.TypeFile {
+		return 0, ErrNotFile
+	}
+
+	err = storage.resolveFile(ctx, recordID)
+	if err != nil {
+		return 0, err
+	}
+
+	return storage.FileStorage.ReadFile(ctx, recordID, w)
+}
+
+// DeleteFiles deletes data of file records from file storage. Files, which are already deleted, are skipped,
+// so deletion can be retried after failure. Failed file doesn't stop deleting of other ones.
+func (storage *Storage) DeleteFiles(ctx context.Context, recordIDs []string) error {
+	var result error
+
+	for _, recordID := range recordIDs {
+		err := storage.deleteFile(ctx, recordID)
+		if err != nil {
+			result = ErrUnknown
+		}
+	}
+
+	return result
+}
+
+// deleteFile deletes data of file record from file storage. Staged file of record is moved in place first,
+// so it isn't moved in place of deleted file later.
+func (storage *Storage) deleteFile(ctx context.Context, recordID string) error {
+	err := storage.resolveFile(ctx, recordID)
+	if err != nil {
+		return err
+	}
+
+	err = storage.FileStorage.DeleteRecord(ctx, recordID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		slog.ErrorContext(ctx, "Failed delete file", "record_id", recordID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeDeletedFiles deletes files of deleted users, which weren't deleted with users, because file storage failed
+// or server stopped. Returns count of deleted files, files, which fail again, are left for next run.
+func (storage *Storage) PurgeDeletedFiles(ctx context.Context) (int, error) {
+	files, err := storage.DBStorage.ListDeletedFiles(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := make([]string, 0, len(files))
+
+	for _, recordID := range files {
+		err = storage.deleteFile(ctx, recordID)
+		if err != nil {
+			continue
+		}
+
+		deleted = append(deleted, recordID)
+	}
+
+	err = storage.DBStorage.ForgetDeletedFiles(ctx, deleted)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(deleted), nil
+}
+
+// ReplaceRecords replaces data of all records of user at once. Data of file records is written to file storage.
+func (storage *Storage) ReplaceRecords(ctx context.Context, records []entity.Record) (int64, error) {
+	i := 0
+	return storage.ReplaceAllRecords(ctx, func() (entity.Record, io.Reader, error) {
+		if i == len(records) {
+			return entity.Record{}, nil, io.EOF
+		}
+
+		record := records[i]
+		i++
+		return record, bytes.NewReader(record.Data), nil
+	})
+}
+
+// ReplaceAllRecords replaces data of all records of user at once, records are read by next.
+// Files are staged first and journaled in the same DB transaction, which replaces records, so records and their files
+// are switched together. Staged files are moved in place right after commit. If it fails, they are moved
+// by next reader of record or on startup, so old data of replaced record isn't read.
+// New records are limited by quota like created ones.
+func (storage *Storage) ReplaceAllRecords(ctx context.Context, next func() (entity.Record, io.Reader, error)) (int64, error) {
+	var records []entity.Record
+	var files []entity.StagedFile
+	var total int64
+	staged := make(map[string]string)
+
+	defer func() {
+		for _, name := range staged {
+			if err := storage.FileStorage.DiscardFile(ctx, name); err != nil {
+				slog.ErrorContext(ctx, "Failed discard staged file", "error", err)
+			}
+		}
+	}()
+
+	for {
+		record, r, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if record.Type == entity.TypeFile {
+			if _, ok := staged[record.ID]; ok {
+				return 0, ErrRevisionConflict
+			}
+
+			// Staged file of previous update is moved first, otherwise it's replaced in journal and left on disk.
+			err = storage.resolveFile(ctx, record.ID)
+			if err != nil {
+				return 0, err
+			}
+
+			left := int64(-1)
+			if storage.Quota.MaxBytes > 0 {
+				left = storage.Quota.MaxBytes - total
+			}
+
+			limited := storage.limitFile(r, left)
+			name, err := storage.FileStorage.StageFile(ctx, record.ID, limited)
+			if limited.exceeded {
+				return 0, ErrQuotaExceeded
+			}
+
+			if err != nil {
+				return 0, err
+			}
+
+			staged[record.ID] = name
+			files = append(files, entity.StagedFile{RecordID: record.ID, Name: name, Size: limited.read})
+			total += limited.read
+			record.Data = nil
+		} else if storage.Quota.MaxRecordSize > 0 && int64(len(record.Data)) > storage.Quota.MaxRecordSize {
+			return 0, ErrQuotaExceeded
+		} else {
+			total += int64(len(record.Data))
+		}
+
+		records = append(records, record)
+
+		if storage.Quota.MaxRecords > 0 && int64(len(records)) > storage.Quota.MaxRecords ||
+			storage.Quota.MaxBytes > 0 && total > storage.Quota.MaxBytes {
+			return 0, ErrQuotaExceeded
+		}
+	}
+
+	revision, err := storage.DBStorage.ReplaceFileRecords(ctx, records, files)
+	if err != nil {
+		return 0, err
+	}
+
+	// Staged files are in journal now, so they aren't discarded, even if they can't be moved yet.
+	staged = nil
+
+	for _, file := range files {
+		err = storage.commitStagedFile(ctx, file)
+		if err != nil {
+			slog.WarnContext(ctx, "Staged file of replaced record is left in journal", "record_id", file.RecordID, "error", err)
+		}
+	}
+
+	return revision, nil
+}
+
+// UpdateRecord updates record in DB storage. If record type is file, rewrites it in file storage too.
+// New file is staged before record is updated, so failed write doesn't change revision of record. Staged file
+// is journaled with updated record and moved in place right after that. If it fails, it's moved by next reader
+// of record or on startup, so old data of updated record isn't read. Record isn't updated, if new data exceeds
+// quota of user.
+func (storage *Storage) UpdateRecord(ctx context.Context, record entity.Record) (int64, error) {
+	size := int64(len(record.Data))
+
+	err := storage.checkUpdateQuota(ctx, record.ID, size)
+	if err != nil {
+		return 0, err
+	}
+
+	if record.Type != entity.TypeFile {
+		return storage.DBStorage.UpdateRecord(ctx, record)
+	}
+
+	// Staged file of previous update is moved first, otherwise it's replaced in journal and left on disk.
+	err = storage.resolveFile(ctx, record.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	staged, err := storage.FileStorage.StageFile(ctx, record.ID, bytes.NewReader(record.Data))
+	if err != nil {
+		return 0, err
+	}
+
+	file := entity.StagedFile{RecordID: record.ID, Name: staged, Size: size}
+
+	record.Data = nil
+	revision, err := storage.DBStorage.UpdateFileRecord(ctx, record, file)
+	if err != nil {
+		if err := storage.FileStorage.DiscardFile(ctx, staged); err != nil {
+			slog.ErrorContext(ctx, "Failed discard staged file", "error", err)
+		}
+		return 0, err
+	}
+
+	err = storage.commitStagedFile(ctx, file)
+	if err != nil {
+		slog.WarnContext(ctx, "Staged file of updated record is left in journal", "record_id", record.ID, "error", err)
+	}
+
+	return revision, nil
+}
+
 // DeleteRecord deletes record from DB storage. If record type is file, deletes from file storage too.
+// Staged file of record is moved in place first, so it isn't left after record file is deleted.
 func (storage *Storage) DeleteRecord(ctx context.Context, recordID string) error {
-	err := storage.DBStorage.DeleteRecord(ctx, recordID)
+	err := storage.resolveFile(ctx, recordID)
+	if err != nil {
+		return err
+	}
+
+	err = storage.DBStorage.DeleteRecord(ctx, recordID)
 	if err != nil {
 		return err
 	}
@@ -75,7 +695,7 @@ func (storage *Storage) DeleteRecord(ctx context.Context, recordID string) error
 	return nil
 }
 
-// GetRecord gets record from DB or file storage.
+// GetRecord gets record from DB. File records come without data, it should be read by DownloadFile.
 func (storage *Storage) GetRecord(ctx context.Context, recordID string) (entity.Record, error) {
 	record, err := storage.DBStorage.GetRecord(ctx, recordID)
 	if err != nil {
@@ -83,9 +703,33 @@ func (storage *Storage) GetRecord(ctx context.Context, recordID string) (entity.
 	}
 
 	if record.Type == entity.TypeFile {
-		ctx = context.WithValue(ctx, "recordMetadata", record.Metadata)
-		return storage.FileStorage.GetRecord(ctx, recordID)
+		record.Data = nil
 	}
 
 	return record, nil
 }
+
+// quotaReader reads file record data until limit. Reading more data fails and marks reader as exceeded.
+type quotaReader struct {
+	r io.Reader
+	// left is count of bytes, which can be read yet, -1 means no limit.
+	left     int64
+	read     int64
+	exceeded bool
+}
+
+// Read implementation of io.Reader interface.
+func (reader *quotaReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.read += int64(n)
+
+	if reader.left >= 0 {
+		reader.left -= int64(n)
+		if reader.left < 0 {
+			reader.exceeded = true
+			return n, ErrQuotaExceeded
+		}
+	}
+
+	return n, err
+}
@@ -1,13 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/size12/gophkeeper/internal/entity"
 	"github.com/size12/gophkeeper/internal/storage/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewStorage(t *testing.T) {
@@ -30,12 +34,12 @@ func TestStorage_CreateUser(t *testing.T) {
 		{
 			"Create user",
 			func() {
-				db.On("CreateUser", mock.AnythingOfType("entity.UserCredentials")).Return(nil)
+				db.On("CreateUser", context.Background(), "login", mock.AnythingOfType("entity.StoredPassword")).Return(nil)
 			},
 			func() {
-				storage.CreateUser(entity.UserCredentials{
-					Login:    "login",
-					Password: "password",
+				storage.CreateUser(context.Background(), "login", entity.StoredPassword{
+					Hash:      "hash",
+					Algorithm: entity.PasswordArgon2id,
 				})
 				db.AssertExpectations(t)
 			},
@@ -62,10 +66,10 @@ func TestStorage_GetRecordsInfo(t *testing.T) {
 		{
 			"Get all records info",
 			func() {
-				db.On("GetRecordsInfo", context.Background()).Return([]entity.Record{}, nil)
+				db.On("GetRecordsInfo", context.Background(), entity.RecordsQuery{}).Return(entity.RecordsPage{}, nil)
 			},
 			func() {
-				storage.GetRecordsInfo(context.Background())
+				storage.GetRecordsInfo(context.Background(), entity.RecordsQuery{})
 				db.AssertExpectations(t)
 			},
 		},
@@ -78,7 +82,7 @@ func TestStorage_GetRecordsInfo(t *testing.T) {
 	}
 }
 
-func TestStorage_LoginUser(t *testing.T) {
+func TestStorage_GetChanges(t *testing.T) {
 	db := mocks.NewStorager(t)
 	file := mocks.NewFileStorager(t)
 	storage := NewStorage(db, file)
@@ -89,17 +93,176 @@ func TestStorage_LoginUser(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Login user",
+			"Get changes",
 			func() {
-				db.On("LoginUser", mock.AnythingOfType("entity.UserCredentials")).Return(entity.UserID(""), nil)
+				db.On("GetChanges", context.Background(), int64(2)).Return(entity.Changes{Revision: 3}, nil)
 			},
 			func() {
-				storage.LoginUser(entity.UserCredentials{
-					Login:    "login",
-					Password: "password",
-				})
+				changes, err := storage.GetChanges(context.Background(), 2)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), changes.Revision)
+				db.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_Passwords(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	password := entity.StoredPassword{UserID: "userID", Hash: "hash", Algorithm: entity.PasswordArgon2id}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get password",
+			func() {
+				db.On("GetPassword", context.Background(), "login").Return(password, nil).Once()
+			},
+			func() {
+				got, err := storage.GetPassword(context.Background(), "login")
+				assert.NoError(t, err)
+				assert.Equal(t, password, got)
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"Update password",
+			func() {
+				db.On("UpdatePassword", context.Background(), password).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.UpdatePassword(context.Background(), password))
+				db.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_RefreshTokens(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+	token := entity.RefreshToken{Hash: "hash", UserID: "userID", SessionID: "sessionID"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Save refresh token",
+			func() {
+				db.On("SaveRefreshToken", context.Background(), token).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.SaveRefreshToken(context.Background(), token))
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"Use refresh token",
+			func() {
+				db.On("UseRefreshToken", context.Background(), "hash").Return(token, nil).Once()
+			},
+			func() {
+				got, err := storage.UseRefreshToken(context.Background(), "hash")
+				assert.NoError(t, err)
+				assert.Equal(t, token, got)
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"Delete session tokens",
+			func() {
+				db.On("DeleteSessionTokens", ctx, "sessionID").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.DeleteSessionTokens(ctx, "sessionID"))
+				db.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_Sessions(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: "userID"})
+	session := entity.SessionInfo{ID: "sessionID", UserID: "userID"}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Create session",
+			func() {
+				db.On("CreateSession", context.Background(), session).Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.CreateSession(context.Background(), session))
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"Touch session",
+			func() {
+				db.On("TouchSession", ctx, "sessionID").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.TouchSession(ctx, "sessionID"))
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"List sessions",
+			func() {
+				db.On("ListSessions", ctx).Return([]entity.SessionInfo{session}, nil).Once()
+			},
+			func() {
+				sessions, err := storage.ListSessions(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.SessionInfo{session}, sessions)
+				db.AssertExpectations(t)
+			},
+		},
+		{
+			"Revoke session",
+			func() {
+				db.On("RevokeSession", ctx, "sessionID").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.RevokeSession(ctx, "sessionID"))
 				db.AssertExpectations(t)
-				file.AssertExpectations(t)
 			},
 		},
 	}
@@ -142,6 +305,7 @@ func TestStorage_CreateRecord(t *testing.T) {
 			func() {
 				db.On("CreateRecord", context.Background(), mock.AnythingOfType("entity.Record")).Return("", nil)
 				file.On("CreateRecord", context.Background(), mock.AnythingOfType("entity.Record")).Return("", nil)
+				db.On("SetRecordSize", context.Background(), "", int64(0)).Return(nil).Once()
 			},
 			func() {
 				storage.CreateRecord(context.Background(), entity.Record{
@@ -176,11 +340,12 @@ func TestStorage_GetRecord(t *testing.T) {
 		{
 			"Get file record",
 			func() {
-				db.On("GetRecord", context.Background(), "").Return(entity.Record{Type: entity.TypeFile}, nil)
-				file.On("GetRecord", mock.AnythingOfType("*context.valueCtx"), "").Return(entity.Record{}, nil)
+				db.On("GetRecord", context.Background(), "").Return(entity.Record{Type: entity.TypeFile}, nil).Once()
 			},
 			func() {
-				storage.GetRecord(context.Background(), "")
+				record, err := storage.GetRecord(context.Background(), "")
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Record{Type: entity.TypeFile}, record)
 				db.AssertExpectations(t)
 				file.AssertExpectations(t)
 			},
@@ -203,10 +368,11 @@ func TestStorage_GetRecord(t *testing.T) {
 	}
 }
 
-func TestStorage_DeleteRecord(t *testing.T) {
+func TestStorage_UpdateRecord(t *testing.T) {
 	db := mocks.NewStorager(t)
 	file := mocks.NewFileStorager(t)
 	storage := NewStorage(db, file)
+	staged := entity.StagedFile{RecordID: "1", Name: "1-staged.part", Size: 4}
 
 	tc := []struct {
 		name  string
@@ -214,24 +380,768 @@ func TestStorage_DeleteRecord(t *testing.T) {
 		valid func()
 	}{
 		{
-			"Delete file record",
+			"Update text record",
 			func() {
-				db.On("DeleteRecord", context.Background(), "").Return(nil)
-				file.On("DeleteRecord", context.Background(), "").Return(nil)
+				db.On("UpdateRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("text"), Revision: 1}).Return(int64(2), nil).Once()
 			},
 			func() {
-				storage.DeleteRecord(context.Background(), "")
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("text"), Revision: 1})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
 				db.AssertExpectations(t)
 				file.AssertExpectations(t)
 			},
 		},
 		{
-			"Delete text record",
+			"Update file record",
 			func() {
-				db.On("DeleteRecord", context.Background(), "").Return(entity.Record{}, nil)
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "1", mock.Anything).Return("1-staged.part", nil).Once()
+				db.On("UpdateFileRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Revision: 1}, staged).Return(int64(2), nil).Once()
+				file.On("CommitFile", context.Background(), "1", "1-staged.part").Return(nil).Once()
+				db.On("DeleteStagedFile", context.Background(), staged).Return(nil).Once()
 			},
 			func() {
-				storage.DeleteRecord(context.Background(), "")
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("file"), Revision: 1})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Update file record with conflict",
+			func() {
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "1", mock.Anything).Return("1-staged.part", nil).Once()
+				db.On("UpdateFileRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Revision: 1}, staged).Return(int64(0), ErrRevisionConflict).Once()
+				file.On("DiscardFile", context.Background(), "1-staged.part").Return(nil).Once()
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("file"), Revision: 1})
+				assert.Equal(t, ErrRevisionConflict, err)
+				assert.Empty(t, revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Update file record, but staged file can't be moved, so it's left in journal",
+			func() {
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "1", mock.Anything).Return("1-staged.part", nil).Once()
+				db.On("UpdateFileRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Revision: 1}, staged).Return(int64(2), nil).Once()
+				file.On("CommitFile", context.Background(), "1", "1-staged.part").Return(ErrUnknown).Once()
+				db.On("GetStagedFile", context.Background(), "1").Return(staged, nil).Once()
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("file"), Revision: 1})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Update file record, but staged file of previous update can't be moved, so record isn't updated",
+			func() {
+				previous := entity.StagedFile{RecordID: "1", Name: "1-previous.part"}
+				db.On("GetStagedFile", context.Background(), "1").Return(previous, nil).Twice()
+				file.On("CommitFile", context.Background(), "1", "1-previous.part").Return(ErrUnknown).Once()
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("file"), Revision: 1})
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Update file record, but file can't be staged, so revision isn't changed",
+			func() {
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "1", mock.Anything).Return("", ErrUnknown).Once()
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeFile, Data: []byte("file"), Revision: 1})
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_UploadFile(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Upload file",
+			func() {
+				db.On("CreateRecord", context.Background(), entity.Record{Type: entity.TypeFile, Metadata: "file.txt"}).Return("1", nil).Once()
+				file.On("WriteFile", context.Background(), "1", mock.Anything).Return(int64(4), nil).Once()
+				db.On("SetRecordSize", context.Background(), "1", int64(4)).Return(nil).Once()
+			},
+			func() {
+				id, err := storage.UploadFile(context.Background(), entity.Record{Metadata: "file.txt"}, strings.NewReader("text"))
+				assert.NoError(t, err)
+				assert.Equal(t, "1", id)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Upload file, but file storage will return error",
+			func() {
+				db.On("CreateRecord", context.Background(), entity.Record{Type: entity.TypeFile, Metadata: "file.txt"}).Return("1", nil).Once()
+				file.On("WriteFile", context.Background(), "1", mock.Anything).Return(int64(0), ErrUnknown).Once()
+				db.On("DeleteRecord", context.Background(), "1").Return(nil).Once()
+			},
+			func() {
+				id, err := storage.UploadFile(context.Background(), entity.Record{Metadata: "file.txt"}, strings.NewReader("text"))
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, id)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_ReplaceAllRecords(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	records := []entity.Record{
+		{ID: "1", Type: entity.TypeText, Data: []byte("sealed"), Revision: 2},
+		{ID: "2", Type: entity.TypeFile, Data: []byte("sealed file"), Revision: 5},
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Replace records, file is committed after records",
+			func() {
+				staged := entity.StagedFile{RecordID: "2", Name: "2-staged.part"}
+				db.On("GetStagedFile", context.Background(), "2").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "2", mock.Anything).Return("2-staged.part", nil).Once()
+				db.On("ReplaceFileRecords", context.Background(), []entity.Record{
+					records[0],
+					{ID: "2", Type: entity.TypeFile, Revision: 5},
+				}, []entity.StagedFile{staged}).Return(int64(7), nil).Once()
+				file.On("CommitFile", context.Background(), "2", "2-staged.part").Return(nil).Once()
+				db.On("DeleteStagedFile", context.Background(), staged).Return(nil).Once()
+			},
+			func() {
+				revision, err := storage.ReplaceRecords(context.Background(), records)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(7), revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Replace records, but records were changed, so staged file is discarded",
+			func() {
+				db.On("GetStagedFile", context.Background(), "2").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "2", mock.Anything).Return("2-staged.part", nil).Once()
+				db.On("ReplaceFileRecords", context.Background(), mock.Anything, mock.Anything).Return(int64(0), ErrRevisionConflict).Once()
+				file.On("DiscardFile", context.Background(), "2-staged.part").Return(nil).Once()
+			},
+			func() {
+				revision, err := storage.ReplaceRecords(context.Background(), records)
+				assert.Equal(t, ErrRevisionConflict, err)
+				assert.Empty(t, revision)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Replace records, but batch can't be read",
+			func() {},
+			func() {
+				revision, err := storage.ReplaceAllRecords(context.Background(), func() (entity.Record, io.Reader, error) {
+					return entity.Record{}, nil, ErrUnknown
+				})
+				assert.Equal(t, ErrUnknown, err)
+				assert.Empty(t, revision)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+// failingCommitStorage is memory file storage, which fails to move staged files in place while fail is set.
+type failingCommitStorage struct {
+	*MemoryFileStorage
+	fail bool
+}
+
+// CommitFile fails while fail is set, otherwise moves staged file in place.
+func (storage *failingCommitStorage) CommitFile(ctx context.Context, recordID string, staged string) error {
+	if storage.fail {
+		return ErrUnknown
+	}
+
+	return storage.MemoryFileStorage.CommitFile(ctx, recordID, staged)
+}
+
+func TestStorage_CommitFileFailure(t *testing.T) {
+	db := NewMemoryStorage()
+	files := &failingCommitStorage{MemoryFileStorage: NewMemoryFileStorage()}
+	storage := NewStorage(db, files)
+
+	require.NoError(t, db.CreateUser(context.Background(), "user", entity.StoredPassword{}))
+	userID, err := db.GetUserID(context.Background(), "user")
+	require.NoError(t, err)
+	ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: userID})
+
+	textID, err := storage.CreateRecord(ctx, entity.Record{Type: entity.TypeText, Data: []byte("old text")})
+	require.NoError(t, err)
+	fileID, err := storage.UploadFile(ctx, entity.Record{Metadata: "file"}, strings.NewReader("old file"))
+	require.NoError(t, err)
+
+	// vault reads text and file record, file is empty, if it can't be read.
+	vault := func() (string, string) {
+		text, err := storage.GetRecord(ctx, textID)
+		require.NoError(t, err)
+
+		file := &bytes.Buffer{}
+		_, err = storage.DownloadFile(ctx, fileID, file)
+		if err != nil {
+			file.Reset()
+		}
+
+		return string(text.Data), file.String()
+	}
+
+	replace := func() {
+		text, err := storage.GetRecord(ctx, textID)
+		require.NoError(t, err)
+		file, err := storage.GetRecord(ctx, fileID)
+		require.NoError(t, err)
+
+		_, err = storage.ReplaceRecords(ctx, []entity.Record{
+			{ID: textID, Type: entity.TypeText, Data: []byte("new text"), Revision: text.Revision},
+			{ID: fileID, Type: entity.TypeFile, Data: []byte("new file"), Revision: file.Revision},
+		})
+		require.NoError(t, err, "records are replaced, file is moved from journal later")
+	}
+
+	tc := []struct {
+		name  string
+		valid func()
+	}{
+		{
+			"Staged file isn't moved, so old file isn't read, it's moved by next reader",
+			func() {
+				files.fail = true
+				replace()
+
+				text, file := vault()
+				assert.Equal(t, "new text", text)
+				assert.Empty(t, file, "old file isn't read with new records")
+
+				files.fail = false
+				text, file = vault()
+				assert.Equal(t, "new text", text)
+				assert.Equal(t, "new file", file)
+
+				staged, err := db.ListStagedFiles(ctx)
+				assert.NoError(t, err)
+				assert.Empty(t, staged)
+			},
+		},
+		{
+			"Staged file isn't moved, it's moved on startup",
+			func() {
+				files.fail = true
+				replace()
+
+				files.fail = false
+				committed, err := storage.CommitStagedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, 1, committed)
+
+				data := &bytes.Buffer{}
+				_, err = files.ReadFile(ctx, fileID, data)
+				assert.NoError(t, err)
+				assert.Equal(t, "new file", data.String())
+
+				usage, err := storage.GetUsage(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(len("new text")+len("new file")), usage.Bytes)
+			},
+		},
+		{
+			"Updated file isn't moved, so old file isn't read, it's moved by next reader",
+			func() {
+				file, err := storage.GetRecord(ctx, fileID)
+				require.NoError(t, err)
+
+				files.fail = true
+				revision, err := storage.UpdateRecord(ctx, entity.Record{ID: fileID, Type: entity.TypeFile, Data: []byte("updated file"), Revision: file.Revision})
+				assert.NoError(t, err)
+				assert.Greater(t, revision, file.Revision)
+
+				_, data := vault()
+				assert.Empty(t, data, "old file isn't read with updated record")
+
+				files.fail = false
+				_, data = vault()
+				assert.Equal(t, "updated file", data)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.valid()
+	}
+}
+
+func TestStorage_DownloadFile(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Download file",
+			func() {
+				db.On("GetRecord", context.Background(), "1").Return(entity.Record{ID: "1", Type: entity.TypeFile}, nil).Once()
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("ReadFile", context.Background(), "1", mock.Anything).Return(int64(4), nil).Once()
+			},
+			func() {
+				n, err := storage.DownloadFile(context.Background(), "1", &bytes.Buffer{})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), n)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Download text record",
+			func() {
+				db.On("GetRecord", context.Background(), "2").Return(entity.Record{ID: "2", Type: entity.TypeText}, nil).Once()
+			},
+			func() {
+				_, err := storage.DownloadFile(context.Background(), "2", &bytes.Buffer{})
+				assert.Equal(t, ErrNotFile, err)
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_DeleteRecord(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete file record",
+			func() {
+				db.On("GetStagedFile", context.Background(), "").Return(entity.StagedFile{}, ErrNotFound)
+				db.On("DeleteRecord", context.Background(), "").Return(nil)
+				file.On("DeleteRecord", context.Background(), "").Return(nil)
+			},
+			func() {
+				storage.DeleteRecord(context.Background(), "")
+				db.AssertExpectations(t)
+				file.AssertExpectations(t)
+			},
+		},
+		{
+			"Delete text record",
+			func() {
+				db.On("GetStagedFile", context.Background(), "").Return(entity.StagedFile{}, ErrNotFound)
+				db.On("DeleteRecord", context.Background(), "").Return(entity.Record{}, nil)
+			},
+			func() {
+				storage.DeleteRecord(context.Background(), "")
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+	}
+}
+
+func TestStorage_DeleteFiles(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Delete files, some of them are already deleted",
+			func() {
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				db.On("GetStagedFile", context.Background(), "2").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("DeleteRecord", context.Background(), "1").Return(ErrNotFound).Once()
+				file.On("DeleteRecord", context.Background(), "2").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.DeleteFiles(context.Background(), []string{"1", "2"}))
+			},
+		},
+		{
+			"Delete files, but file storage will return error, other files are deleted anyway",
+			func() {
+				db.On("GetStagedFile", context.Background(), "1").Return(entity.StagedFile{}, ErrNotFound).Once()
+				db.On("GetStagedFile", context.Background(), "2").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("DeleteRecord", context.Background(), "1").Return(ErrUnknown).Once()
+				file.On("DeleteRecord", context.Background(), "2").Return(nil).Once()
+			},
+			func() {
+				assert.Equal(t, ErrUnknown, storage.DeleteFiles(context.Background(), []string{"1", "2"}))
+			},
+		},
+		{
+			"Delete file, which has staged file, staged file is moved in place before deleting",
+			func() {
+				staged := entity.StagedFile{RecordID: "1", Name: "1-staged.part"}
+				db.On("GetStagedFile", context.Background(), "1").Return(staged, nil).Once()
+				file.On("CommitFile", context.Background(), "1", "1-staged.part").Return(nil).Once()
+				db.On("DeleteStagedFile", context.Background(), staged).Return(nil).Once()
+				file.On("DeleteRecord", context.Background(), "1").Return(nil).Once()
+			},
+			func() {
+				assert.NoError(t, storage.DeleteFiles(context.Background(), []string{"1"}))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		file.AssertExpectations(t)
+		db.AssertExpectations(t)
+	}
+}
+
+func TestStorage_PurgeDeletedFiles(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Purge deleted files, failed file is left in journal",
+			func() {
+				db.On("ListDeletedFiles", context.Background()).Return([]string{"1", "2", "3"}, nil).Once()
+				db.On("GetStagedFile", context.Background(), mock.Anything).Return(entity.StagedFile{}, ErrNotFound).Times(3)
+				file.On("DeleteRecord", context.Background(), "1").Return(nil).Once()
+				file.On("DeleteRecord", context.Background(), "2").Return(ErrUnknown).Once()
+				file.On("DeleteRecord", context.Background(), "3").Return(ErrNotFound).Once()
+				db.On("ForgetDeletedFiles", context.Background(), []string{"1", "3"}).Return(nil).Once()
+			},
+			func() {
+				deleted, err := storage.PurgeDeletedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, 2, deleted)
+			},
+		},
+		{
+			"Purge deleted files, but DB storage will return error",
+			func() {
+				db.On("ListDeletedFiles", context.Background()).Return(nil, ErrUnknown).Once()
+			},
+			func() {
+				_, err := storage.PurgeDeletedFiles(context.Background())
+				assert.Equal(t, ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		file.AssertExpectations(t)
+		db.AssertExpectations(t)
+	}
+}
+
+func TestStorage_BackfillFileSizes(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+
+	ownedBy := func(userID entity.UserID) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			id, ok := entity.UserIDFromContext(ctx)
+			return ok && id == userID
+		})
+	}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Backfill sizes, missing and empty files are skipped",
+			func() {
+				db.On("ListUnsizedFiles", context.Background()).Return(map[string]entity.UserID{
+					"1": "user1", "2": "user2", "3": "user1", "4": "user2",
+				}, nil).Once()
+				file.On("FileSize", context.Background(), "1").Return(int64(4), nil).Once()
+				file.On("FileSize", context.Background(), "2").Return(int64(10), nil).Once()
+				file.On("FileSize", context.Background(), "3").Return(int64(0), ErrNotFound).Once()
+				file.On("FileSize", context.Background(), "4").Return(int64(0), nil).Once()
+				db.On("SetRecordSize", ownedBy("user1"), "1", int64(4)).Return(nil).Once()
+				db.On("SetRecordSize", ownedBy("user2"), "2", int64(10)).Return(nil).Once()
+			},
+			func() {
+				updated, err := storage.BackfillFileSizes(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, 2, updated)
+			},
+		},
+		{
+			"Backfill sizes, but DB returns error",
+			func() {
+				db.On("ListUnsizedFiles", context.Background()).Return(nil, ErrUnknown).Once()
+			},
+			func() {
+				_, err := storage.BackfillFileSizes(context.Background())
+				assert.Equal(t, ErrUnknown, err)
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		test.mock()
+		test.valid()
+		db.AssertExpectations(t)
+		file.AssertExpectations(t)
+	}
+}
+
+func TestStorage_Quota(t *testing.T) {
+	db := mocks.NewStorager(t)
+	file := mocks.NewFileStorager(t)
+	storage := NewStorage(db, file)
+	storage.Quota = entity.Quota{MaxBytes: 100, MaxRecords: 3, MaxRecordSize: 10}
+
+	tc := []struct {
+		name  string
+		mock  func()
+		valid func()
+	}{
+		{
+			"Get usage with quota",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 20, Records: 2}, nil).Once()
+			},
+			func() {
+				usage, err := storage.GetUsage(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Usage{Bytes: 20, Records: 2, Quota: storage.Quota}, usage)
+			},
+		},
+		{
+			"Create record, which is larger than max record size",
+			func() {},
+			func() {
+				_, err := storage.CreateRecord(context.Background(), entity.Record{Type: entity.TypeText, Data: []byte("eleven char")})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Create record, when user has max count of records",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 20, Records: 3}, nil).Once()
+			},
+			func() {
+				_, err := storage.CreateRecord(context.Background(), entity.Record{Type: entity.TypeText, Data: []byte("text")})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Create record, which exceeds total size",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 98, Records: 2}, nil).Once()
+			},
+			func() {
+				_, err := storage.CreateRecord(context.Background(), entity.Record{Type: entity.TypeText, Data: []byte("text")})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Create record within quota",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 20, Records: 2}, nil).Once()
+				db.On("CreateRecord", context.Background(), entity.Record{Type: entity.TypeText, Data: []byte("text")}).Return("1", nil).Once()
+			},
+			func() {
+				id, err := storage.CreateRecord(context.Background(), entity.Record{Type: entity.TypeText, Data: []byte("text")})
+				assert.NoError(t, err)
+				assert.Equal(t, "1", id)
+			},
+		},
+		{
+			"Upload file, which exceeds max record size",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 20, Records: 2}, nil).Once()
+				db.On("CreateRecord", context.Background(), entity.Record{Type: entity.TypeFile}).Return("2", nil).Once()
+				file.On("WriteFile", context.Background(), "2", mock.Anything).Return(func(_ context.Context, _ string, r io.Reader) (int64, error) {
+					n, err := io.Copy(io.Discard, r)
+					if err != nil {
+						return n, ErrUnknown
+					}
+					return n, nil
+				}).Once()
+				db.On("DeleteRecord", context.Background(), "2").Return(nil).Once()
+			},
+			func() {
+				_, err := storage.UploadFile(context.Background(), entity.Record{}, strings.NewReader("file larger than ten bytes"))
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Update record, which is larger than max record size",
+			func() {},
+			func() {
+				_, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("eleven char")})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Update record, which exceeds total size",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 97, Records: 2}, nil).Once()
+				db.On("GetRecordSize", context.Background(), "1").Return(int64(4), nil).Once()
+			},
+			func() {
+				_, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("ten chars!")})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Update record, which is enlarged within total size",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 94, Records: 2}, nil).Once()
+				db.On("GetRecordSize", context.Background(), "1").Return(int64(4), nil).Once()
+				db.On("UpdateRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("ten chars!")}).Return(int64(2), nil).Once()
+			},
+			func() {
+				revision, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("ten chars!")})
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+			},
+		},
+		{
+			"Update record, which is shrunk, when user exceeds total size",
+			func() {
+				db.On("GetUsage", context.Background()).Return(entity.Usage{Bytes: 120, Records: 2}, nil).Once()
+				db.On("GetRecordSize", context.Background(), "1").Return(int64(10), nil).Once()
+				db.On("UpdateRecord", context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("text")}).Return(int64(2), nil).Once()
+			},
+			func() {
+				_, err := storage.UpdateRecord(context.Background(), entity.Record{ID: "1", Type: entity.TypeText, Data: []byte("text")})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			"Replace records, which are more than max count of records",
+			func() {},
+			func() {
+				_, err := storage.ReplaceRecords(context.Background(), []entity.Record{
+					{ID: "1", Type: entity.TypeText, Data: []byte("1")},
+					{ID: "2", Type: entity.TypeText, Data: []byte("2")},
+					{ID: "3", Type: entity.TypeText, Data: []byte("3")},
+					{ID: "4", Type: entity.TypeText, Data: []byte("4")},
+				})
+				assert.Equal(t, ErrQuotaExceeded, err)
+			},
+		},
+		{
+			"Replace records, which exceed total size",
+			func() {
+				db.On("GetStagedFile", context.Background(), "2").Return(entity.StagedFile{}, ErrNotFound).Once()
+				file.On("StageFile", context.Background(), "2", mock.Anything).Return(func(_ context.Context, _ string, r io.Reader) (string, error) {
+					_, err := io.Copy(io.Discard, r)
+					return "2-staged.part", err
+				}).Once()
+			},
+			func() {
+				limited := NewStorage(db, file)
+				limited.Quota = entity.Quota{MaxBytes: 15}
+
+				_, err := limited.ReplaceRecords(context.Background(), []entity.Record{
+					{ID: "1", Type: entity.TypeText, Data: []byte("ten chars!")},
+					{ID: "2", Type: entity.TypeFile, Data: []byte("ten chars!")},
+				})
+				assert.Equal(t, ErrQuotaExceeded, err, "file is stopped after total size")
+
+				_, err = limited.ReplaceRecords(context.Background(), []entity.Record{
+					{ID: "1", Type: entity.TypeText, Data: []byte("ten chars!")},
+					{ID: "2", Type: entity.TypeText, Data: []byte("ten chars!")},
+				})
+				assert.Equal(t, ErrQuotaExceeded, err)
 			},
 		},
 	}
@@ -240,5 +1150,7 @@ func TestStorage_DeleteRecord(t *testing.T) {
 		t.Log(test.name)
 		test.mock()
 		test.valid()
+		db.AssertExpectations(t)
+		file.AssertExpectations(t)
 	}
 }
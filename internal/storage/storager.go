@@ -2,25 +2,94 @@ package storage
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/size12/gophkeeper/internal/entity"
 )
 
+// RecordStorager interface for storage, which can storage records.
+type RecordStorager interface {
+	GetRecord(ctx context.Context, recordID string) (entity.Record, error)
+	CreateRecord(ctx context.Context, record entity.Record) (string, error)
+	UpdateRecord(ctx context.Context, record entity.Record) (int64, error)
+	DeleteRecord(ctx context.Context, recordID string) error
+}
+
 // FileStorager interface for storage, which can storage files.
 //
 //go:generate mockery --name FileStorager
 type FileStorager interface {
-	GetRecord(ctx context.Context, recordID string) (entity.Record, error)
-	CreateRecord(ctx context.Context, record entity.Record) (string, error)
-	DeleteRecord(ctx context.Context, recordID string) error
+	RecordStorager
+	WriteFile(ctx context.Context, recordID string, r io.Reader) (int64, error)
+	ReadFile(ctx context.Context, recordID string, w io.Writer) (int64, error)
+	StageFile(ctx context.Context, recordID string, r io.Reader) (string, error)
+	CommitFile(ctx context.Context, recordID string, staged string) error
+	DiscardFile(ctx context.Context, staged string) error
+	FileSize(ctx context.Context, recordID string) (int64, error)
 }
 
 // Storager interface for storage, which can storage only text data.
 //
 //go:generate mockery --name Storager
 type Storager interface {
-	CreateUser(credentials entity.UserCredentials) error
-	LoginUser(credentials entity.UserCredentials) (entity.UserID, error)
-	GetRecordsInfo(ctx context.Context) ([]entity.Record, error)
-	FileStorager
+	CreateUser(ctx context.Context, login string, password entity.StoredPassword) error
+	GetPassword(ctx context.Context, login string) (entity.StoredPassword, error)
+	UpdatePassword(ctx context.Context, password entity.StoredPassword) error
+	GetUserID(ctx context.Context, login string) (entity.UserID, error)
+	SaveRefreshToken(ctx context.Context, token entity.RefreshToken) error
+	UseRefreshToken(ctx context.Context, hash string) (entity.RefreshToken, error)
+	DeleteSessionTokens(ctx context.Context, sessionID string) error
+	CreateSession(ctx context.Context, session entity.SessionInfo) error
+	TouchSession(ctx context.Context, sessionID string) error
+	ListSessions(ctx context.Context) ([]entity.SessionInfo, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	GetTOTP(ctx context.Context, userID entity.UserID) (entity.TOTP, error)
+	SaveTOTP(ctx context.Context, totp entity.TOTP, backupCodes []string) error
+	UseTOTPStep(ctx context.Context, userID entity.UserID, step int64) error
+	UseBackupCode(ctx context.Context, userID entity.UserID, hash string) error
+	DeleteTOTP(ctx context.Context, userID entity.UserID) error
+	DeleteUser(ctx context.Context, deleteFiles func(recordIDs []string) error) error
+	SaveAuditEvent(ctx context.Context, event entity.AuditEvent) error
+	ListAuditEvents(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error)
+	GetRecordsInfo(ctx context.Context, query entity.RecordsQuery) (entity.RecordsPage, error)
+	GetChanges(ctx context.Context, sinceRevision int64) (entity.Changes, error)
+	ReplaceRecords(ctx context.Context, records []entity.Record) (int64, error)
+	// PruneTombstones deletes tombstones of records, which were deleted before given time.
+	PruneTombstones(ctx context.Context, before time.Time) (int64, error)
+	// ReplaceFileRecords replaces records and journals staged files of file records in the same transaction.
+	ReplaceFileRecords(ctx context.Context, records []entity.Record, files []entity.StagedFile) (int64, error)
+	// UpdateFileRecord updates file record and journals its staged file in the same transaction.
+	UpdateFileRecord(ctx context.Context, record entity.Record, file entity.StagedFile) (int64, error)
+	// GetStagedFile gets staged file of record, which isn't moved in place yet.
+	GetStagedFile(ctx context.Context, recordID string) (entity.StagedFile, error)
+	// ListStagedFiles gets staged files of all users, which aren't moved in place yet.
+	ListStagedFiles(ctx context.Context) ([]entity.StagedFile, error)
+	// DeleteStagedFile deletes staged file from journal after it's moved in place.
+	DeleteStagedFile(ctx context.Context, file entity.StagedFile) error
+	// ListDeletedFiles gets file records of deleted users, which files weren't deleted yet.
+	ListDeletedFiles(ctx context.Context) ([]string, error)
+	// ForgetDeletedFiles removes file records from journal of deleted files after their files are deleted.
+	ForgetDeletedFiles(ctx context.Context, recordIDs []string) error
+	// SetRecordSize sets size of record data, which is kept in file storage, so it's counted in usage.
+	SetRecordSize(ctx context.Context, recordID string, size int64) error
+	// GetRecordSize gets size of record data, which is counted in usage.
+	GetRecordSize(ctx context.Context, recordID string) (int64, error)
+	// ListUnsizedFiles gets file records of all users with zero size, record IDs are mapped to their owners.
+	ListUnsizedFiles(ctx context.Context) (map[string]entity.UserID, error)
+	GetUsage(ctx context.Context) (entity.Usage, error)
+	RecordStorager
+}
+
+// FileStreamer interface for storage, which can stream file records without keeping them in memory.
+//
+//go:generate mockery --name FileStreamer
+type FileStreamer interface {
+	UploadFile(ctx context.Context, record entity.Record, r io.Reader) (string, error)
+	DownloadFile(ctx context.Context, recordID string, w io.Writer) (int64, error)
+	// ReplaceAllRecords replaces all records of user, next returns them one by one and io.EOF after the last one.
+	// Data of file record is read from returned reader.
+	ReplaceAllRecords(ctx context.Context, next func() (entity.Record, io.Reader, error)) (int64, error)
+	// DeleteFiles deletes data of file records. Missing files are skipped.
+	DeleteFiles(ctx context.Context, recordIDs []string) error
 }
@@ -0,0 +1,560 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/size12/gophkeeper/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDBURLEnv is environment variable with URL of PostgreSQL database for behaviour tests of DBStorage.
+const testDBURLEnv = "GOPHKEEPER_TEST_DB_URL"
+
+func TestDBStorage_Behaviour(t *testing.T) {
+	url := os.Getenv(testDBURLEnv)
+	if url == "" {
+		t.Skipf("%s isn't set", testDBURLEnv)
+	}
+
+	storage := NewDBStorage(url)
+	defer storage.DB.Close()
+	require.NoError(t, storage.migrate("file://../../migrations"))
+
+	testStorager(t, storage)
+}
+
+// testStorager checks behaviour of Storager, which is same for all implementations.
+// Users have unique logins, so it can be run on DB, which has data of previous runs.
+func testStorager(t *testing.T, storage Storager) {
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	newUser := func(login string) context.Context {
+		login += suffix
+		require.NoError(t, storage.CreateUser(context.Background(), login, entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordArgon2id}))
+		password, err := storage.GetPassword(context.Background(), login)
+		require.NoError(t, err)
+		return entity.WithPrincipal(context.Background(), entity.Principal{UserID: password.UserID})
+	}
+
+	tc := []struct {
+		name  string
+		valid func(t *testing.T)
+	}{
+		{
+			"Users",
+			func(t *testing.T) {
+				login := "user" + suffix
+				assert.NoError(t, storage.CreateUser(context.Background(), login, entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordSHA256}))
+				assert.Equal(t, ErrLoginExists, storage.CreateUser(context.Background(), login, entity.StoredPassword{Hash: "other", Algorithm: entity.PasswordSHA256}))
+
+				password, err := storage.GetPassword(context.Background(), login)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, password.UserID)
+				assert.Equal(t, "hash", password.Hash)
+				assert.Equal(t, entity.PasswordSHA256, password.Algorithm)
+
+				password.Hash, password.Algorithm = "new hash", entity.PasswordArgon2id
+				assert.NoError(t, storage.UpdatePassword(context.Background(), password))
+
+				updated, err := storage.GetPassword(context.Background(), login)
+				assert.NoError(t, err)
+				assert.Equal(t, password, updated)
+
+				userID, err := storage.GetUserID(context.Background(), login)
+				assert.NoError(t, err)
+				assert.Equal(t, password.UserID, userID)
+
+				_, err = storage.GetPassword(context.Background(), "unknown"+suffix)
+				assert.Equal(t, ErrWrongCredentials, err)
+
+				_, err = storage.GetUserID(context.Background(), "unknown"+suffix)
+				assert.Equal(t, ErrNotFound, err)
+			},
+		},
+		{
+			"Refresh tokens",
+			func(t *testing.T) {
+				ctx := newUser("tokens")
+				userID, _ := entity.UserIDFromContext(ctx)
+				expiresAt := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+				for _, token := range []entity.RefreshToken{
+					{Hash: "first" + suffix, UserID: userID, SessionID: "session", ExpiresAt: expiresAt},
+					{Hash: "second" + suffix, UserID: userID, SessionID: "session", ExpiresAt: expiresAt},
+				} {
+					assert.NoError(t, storage.SaveRefreshToken(ctx, token))
+				}
+
+				token, err := storage.UseRefreshToken(ctx, "first"+suffix)
+				assert.NoError(t, err)
+				assert.Equal(t, userID, token.UserID)
+				assert.Equal(t, "session", token.SessionID)
+				assert.True(t, expiresAt.Equal(token.ExpiresAt))
+
+				_, err = storage.UseRefreshToken(ctx, "first"+suffix)
+				assert.Equal(t, ErrUserUnauthorized, err)
+
+				assert.NoError(t, storage.DeleteSessionTokens(ctx, "session"))
+				_, err = storage.UseRefreshToken(ctx, "second"+suffix)
+				assert.Equal(t, ErrUserUnauthorized, err)
+			},
+		},
+		{
+			"Sessions",
+			func(t *testing.T) {
+				ctx := newUser("sessions")
+				userID, _ := entity.UserIDFromContext(ctx)
+				createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+				for _, id := range []string{"laptop" + suffix, "phone" + suffix} {
+					assert.NoError(t, storage.CreateSession(ctx, entity.SessionInfo{
+						ID:        id,
+						UserID:    userID,
+						Device:    entity.Device{Name: id, IP: "127.0.0.1", UserAgent: "gophkeeper-client"},
+						CreatedAt: createdAt,
+					}))
+				}
+
+				assert.NoError(t, storage.TouchSession(ctx, "phone"+suffix))
+
+				sessions, err := storage.ListSessions(ctx)
+				assert.NoError(t, err)
+				if assert.Len(t, sessions, 2) {
+					assert.Equal(t, "phone"+suffix, sessions[0].ID)
+					assert.True(t, sessions[0].LastSeenAt.After(createdAt))
+					assert.Equal(t, "laptop"+suffix, sessions[1].ID)
+					assert.Equal(t, entity.Device{Name: "laptop" + suffix, IP: "127.0.0.1", UserAgent: "gophkeeper-client"}, sessions[1].Device)
+					assert.True(t, createdAt.Equal(sessions[1].CreatedAt))
+
+					// Recently seen session isn't updated by every request.
+					lastSeenAt := sessions[0].LastSeenAt
+					assert.NoError(t, storage.TouchSession(ctx, "phone"+suffix))
+					sessions, err = storage.ListSessions(ctx)
+					assert.NoError(t, err)
+					assert.True(t, lastSeenAt.Equal(sessions[0].LastSeenAt))
+				}
+
+				assert.NoError(t, storage.RevokeSession(ctx, "phone"+suffix))
+				assert.Equal(t, ErrNotFound, storage.RevokeSession(ctx, "phone"+suffix))
+				assert.Equal(t, ErrUserUnauthorized, storage.TouchSession(ctx, "phone"+suffix))
+
+				sessions, err = storage.ListSessions(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, sessions, 1)
+			},
+		},
+		{
+			"TOTP",
+			func(t *testing.T) {
+				ctx := newUser("totp")
+				userID, _ := entity.UserIDFromContext(ctx)
+
+				_, err := storage.GetTOTP(ctx, userID)
+				assert.Equal(t, ErrNotFound, err)
+
+				assert.NoError(t, storage.SaveTOTP(ctx, entity.TOTP{UserID: userID, Secret: "secret"}, []string{"code1", "code2"}))
+
+				totp, err := storage.GetTOTP(ctx, userID)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.TOTP{UserID: userID, Secret: "secret"}, totp)
+
+				assert.NoError(t, storage.UseTOTPStep(ctx, userID, 10))
+				assert.Equal(t, ErrWrongCredentials, storage.UseTOTPStep(ctx, userID, 10))
+
+				totp, err = storage.GetTOTP(ctx, userID)
+				assert.NoError(t, err)
+				assert.True(t, totp.Confirmed)
+				assert.Equal(t, int64(10), totp.LastStep)
+
+				assert.NoError(t, storage.UseBackupCode(ctx, userID, "code1"))
+				assert.Equal(t, ErrWrongCredentials, storage.UseBackupCode(ctx, userID, "code1"))
+
+				assert.NoError(t, storage.SaveTOTP(ctx, entity.TOTP{UserID: userID, Secret: "new secret"}, []string{"code3"}))
+				assert.Equal(t, ErrWrongCredentials, storage.UseBackupCode(ctx, userID, "code2"))
+
+				totp, err = storage.GetTOTP(ctx, userID)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.TOTP{UserID: userID, Secret: "new secret"}, totp)
+
+				assert.NoError(t, storage.DeleteTOTP(ctx, userID))
+				assert.Equal(t, ErrNotFound, storage.DeleteTOTP(ctx, userID))
+				assert.Equal(t, ErrWrongCredentials, storage.UseBackupCode(ctx, userID, "code3"))
+			},
+		},
+		{
+			"Records",
+			func(t *testing.T) {
+				ctx := newUser("records")
+
+				id, err := storage.CreateRecord(ctx, entity.Record{Metadata: "mail", Type: entity.TypeLoginAndPassword, Data: []byte("login:password")})
+				assert.NoError(t, err)
+
+				record, err := storage.GetRecord(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Record{ID: id, Metadata: "mail", Type: entity.TypeLoginAndPassword, Data: []byte("login:password"), Revision: 1}, record)
+
+				record.Metadata, record.Data = "work mail", []byte("login:new password")
+				revision, err := storage.UpdateRecord(ctx, record)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), revision)
+
+				_, err = storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrRevisionConflict, err)
+
+				retyped := record
+				retyped.Type, retyped.Revision = entity.TypeFile, revision
+				_, err = storage.UpdateRecord(ctx, retyped)
+				assert.Equal(t, ErrRecordType, err)
+
+				retyped.Revision = 1
+				_, err = storage.UpdateRecord(ctx, retyped)
+				assert.Equal(t, ErrRecordType, err)
+
+				record.Revision = revision
+				updated, err := storage.GetRecord(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, record, updated)
+
+				assert.NoError(t, storage.DeleteRecord(ctx, id))
+				assert.Equal(t, ErrNotFound, storage.DeleteRecord(ctx, id))
+
+				_, err = storage.GetRecord(ctx, id)
+				assert.Equal(t, ErrNotFound, err)
+
+				_, err = storage.UpdateRecord(ctx, record)
+				assert.Equal(t, ErrNotFound, err)
+
+				_, err = storage.GetRecord(newUser("stranger"), id)
+				assert.Equal(t, ErrNotFound, err)
+			},
+		},
+		{
+			"Records query",
+			func(t *testing.T) {
+				ctx := newUser("query")
+
+				for _, record := range []entity.Record{
+					{Metadata: "bank", Type: entity.TypeCreditCard},
+					{Metadata: "50%_off", Type: entity.TypeText},
+					{Metadata: "memo", Type: entity.TypeText},
+					{Metadata: "photo 50%_OFF.png", Type: entity.TypeFile},
+					{Metadata: "notes", Type: entity.TypeText},
+				} {
+					_, err := storage.CreateRecord(ctx, record)
+					assert.NoError(t, err)
+				}
+
+				page, err := storage.GetRecordsInfo(ctx, entity.RecordsQuery{Metadata: "50%_off"})
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"50%_off", "photo 50%_OFF.png"}, recordsMetadata(page.Records))
+				assert.Empty(t, page.NextPageToken)
+
+				page, err = storage.GetRecordsInfo(ctx, entity.RecordsQuery{Types: []entity.RecordType{entity.TypeText}, Sort: entity.SortByMetadataDesc})
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"notes", "memo", "50%_off"}, recordsMetadata(page.Records))
+
+				var metadata []string
+				query := entity.RecordsQuery{PageSize: 2, Sort: entity.SortByRevisionDesc}
+				for {
+					page, err = storage.GetRecordsInfo(ctx, query)
+					if !assert.NoError(t, err) {
+						break
+					}
+					assert.LessOrEqual(t, len(page.Records), 2)
+					metadata = append(metadata, recordsMetadata(page.Records)...)
+
+					if page.NextPageToken == "" {
+						break
+					}
+					query.PageToken = page.NextPageToken
+				}
+				assert.Equal(t, []string{"notes", "photo 50%_OFF.png", "memo", "50%_off", "bank"}, metadata)
+
+				_, err = storage.GetRecordsInfo(ctx, entity.RecordsQuery{PageToken: "bad token"})
+				assert.Equal(t, ErrBadQuery, err)
+			},
+		},
+		{
+			"Changes",
+			func(t *testing.T) {
+				ctx := newUser("changes")
+
+				first, err := storage.CreateRecord(ctx, entity.Record{Metadata: "first", Type: entity.TypeText, Data: []byte("1")})
+				assert.NoError(t, err)
+				second, err := storage.CreateRecord(ctx, entity.Record{Metadata: "second", Type: entity.TypeText, Data: []byte("2")})
+				assert.NoError(t, err)
+
+				changes, err := storage.GetChanges(ctx, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), changes.Revision)
+				assert.Len(t, changes.Created, 2)
+
+				_, err = storage.UpdateRecord(ctx, entity.Record{ID: first, Metadata: "first", Type: entity.TypeText, Data: []byte("one"), Revision: 1})
+				assert.NoError(t, err)
+				assert.NoError(t, storage.DeleteRecord(ctx, second))
+				third, err := storage.CreateRecord(ctx, entity.Record{Metadata: "third", Type: entity.TypeText, Data: []byte("3")})
+				assert.NoError(t, err)
+
+				changes, err = storage.GetChanges(ctx, 2)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(5), changes.Revision)
+				assert.Equal(t, []entity.Record{{ID: third, Metadata: "third", Type: entity.TypeText, Revision: 5}}, changes.Created)
+				assert.Equal(t, []entity.Record{{ID: first, Metadata: "first", Type: entity.TypeText, Revision: 3}}, changes.Updated)
+				assert.Equal(t, []string{second}, changes.Deleted)
+
+				changes, err = storage.GetChanges(ctx, 5)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Changes{Revision: 5}, changes)
+			},
+		},
+		{
+			"Pruned tombstones",
+			func(t *testing.T) {
+				ctx := newUser("pruned")
+
+				kept, err := storage.CreateRecord(ctx, entity.Record{Metadata: "kept", Type: entity.TypeText, Data: []byte("1")})
+				assert.NoError(t, err)
+				deleted, err := storage.CreateRecord(ctx, entity.Record{Metadata: "deleted", Type: entity.TypeText, Data: []byte("2")})
+				assert.NoError(t, err)
+				assert.NoError(t, storage.DeleteRecord(ctx, deleted))
+
+				_, err = storage.PruneTombstones(context.Background(), time.Now().Add(-time.Hour))
+				assert.NoError(t, err)
+				changes, err := storage.GetChanges(ctx, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{deleted}, changes.Deleted, "tombstone should be kept during retention")
+
+				pruned, err := storage.PruneTombstones(context.Background(), time.Now().Add(time.Second))
+				assert.NoError(t, err)
+				assert.GreaterOrEqual(t, pruned, int64(1))
+
+				_, err = storage.GetChanges(ctx, 1)
+				assert.Equal(t, ErrResyncRequired, err, "client, which didn't see pruned tombstone, should resync")
+
+				changes, err = storage.GetChanges(ctx, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, []entity.Record{{ID: kept, Metadata: "kept", Type: entity.TypeText, Revision: 1}}, changes.Created)
+				assert.Empty(t, changes.Deleted)
+
+				changes, err = storage.GetChanges(ctx, 3)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Changes{Revision: 3}, changes)
+			},
+		},
+		{
+			"Staged files",
+			func(t *testing.T) {
+				ctx := newUser("staged")
+
+				id, err := storage.CreateRecord(ctx, entity.Record{Metadata: "file", Type: entity.TypeFile})
+				assert.NoError(t, err)
+
+				_, err = storage.GetStagedFile(ctx, id)
+				assert.Equal(t, ErrNotFound, err)
+
+				staged := entity.StagedFile{RecordID: id, Name: id + "-1.part", Size: 4}
+				_, err = storage.ReplaceFileRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeFile, Revision: 2}}, []entity.StagedFile{staged})
+				assert.Equal(t, ErrRevisionConflict, err)
+
+				_, err = storage.GetStagedFile(ctx, id)
+				assert.Equal(t, ErrNotFound, err, "staged file isn't journaled with failed replace")
+
+				_, err = storage.ReplaceFileRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeFile, Revision: 1}}, []entity.StagedFile{staged})
+				assert.NoError(t, err)
+
+				size, err := storage.GetRecordSize(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), size)
+
+				staged.Size = 0
+				file, err := storage.GetStagedFile(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, staged, file)
+
+				files, err := storage.ListStagedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.Contains(t, files, staged)
+
+				assert.NoError(t, storage.DeleteStagedFile(ctx, entity.StagedFile{RecordID: id, Name: "other.part"}))
+				_, err = storage.GetStagedFile(ctx, id)
+				assert.NoError(t, err, "newer staged file isn't deleted")
+
+				assert.NoError(t, storage.DeleteStagedFile(ctx, staged))
+				_, err = storage.GetStagedFile(ctx, id)
+				assert.Equal(t, ErrNotFound, err)
+
+				updated := entity.StagedFile{RecordID: id, Name: id + "-2.part", Size: 8}
+				revision, err := storage.UpdateFileRecord(ctx, entity.Record{ID: id, Metadata: "file", Type: entity.TypeFile, Revision: 2}, updated)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), revision)
+
+				size, err = storage.GetRecordSize(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(8), size)
+
+				file, err = storage.GetStagedFile(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, id+"-2.part", file.Name)
+			},
+		},
+		{
+			"Replace records",
+			func(t *testing.T) {
+				ctx := newUser("replace")
+
+				id, err := storage.CreateRecord(ctx, entity.Record{Metadata: "text", Type: entity.TypeText, Data: []byte("old")})
+				assert.NoError(t, err)
+
+				_, err = storage.ReplaceRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeText, Data: []byte("new"), Revision: 2}})
+				assert.Equal(t, ErrRevisionConflict, err)
+
+				_, err = storage.ReplaceRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeFile, Data: []byte("new"), Revision: 1}})
+				assert.Equal(t, ErrRecordType, err)
+
+				revision, err := storage.ReplaceRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeText, Data: []byte("new"), Revision: 1}})
+				assert.NoError(t, err)
+
+				record, err := storage.GetRecord(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Record{ID: id, Metadata: "text", Type: entity.TypeText, Data: []byte("new"), Revision: revision}, record)
+
+				_, err = storage.CreateRecord(ctx, entity.Record{Metadata: "another", Type: entity.TypeText})
+				assert.NoError(t, err)
+
+				_, err = storage.ReplaceRecords(ctx, []entity.Record{{ID: id, Type: entity.TypeText, Data: []byte("newer"), Revision: revision}})
+				assert.Equal(t, ErrRevisionConflict, err)
+			},
+		},
+		{
+			"Usage",
+			func(t *testing.T) {
+				ctx := newUser("usage")
+
+				text, err := storage.CreateRecord(ctx, entity.Record{Metadata: "text", Type: entity.TypeText, Data: []byte("12345")})
+				assert.NoError(t, err)
+				file, err := storage.CreateRecord(ctx, entity.Record{Metadata: "file", Type: entity.TypeFile})
+				assert.NoError(t, err)
+
+				assert.NoError(t, storage.SetRecordSize(ctx, file, 1000))
+				assert.Equal(t, ErrNotFound, storage.SetRecordSize(ctx, "00000000-0000-4000-8000-000000000000", 1000))
+
+				size, err := storage.GetRecordSize(ctx, text)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(5), size)
+				_, err = storage.GetRecordSize(ctx, "00000000-0000-4000-8000-000000000000")
+				assert.Equal(t, ErrNotFound, err)
+
+				usage, err := storage.GetUsage(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Usage{Bytes: 1005, Records: 2}, usage)
+
+				assert.NoError(t, storage.DeleteRecord(ctx, text))
+
+				usage, err = storage.GetUsage(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, entity.Usage{Bytes: 1000, Records: 1}, usage)
+			},
+		},
+		{
+			"Audit events",
+			func(t *testing.T) {
+				ctx := newUser("audit")
+				userID, _ := entity.UserIDFromContext(ctx)
+				at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+				for i, action := range []entity.AuditAction{entity.AuditLogin, entity.AuditCreateRecord, entity.AuditGetRecord} {
+					assert.NoError(t, storage.SaveAuditEvent(ctx, entity.AuditEvent{
+						UserID:   userID,
+						Action:   action,
+						RecordID: "recordID",
+						IP:       "127.0.0.1",
+						Time:     at.Add(time.Duration(i) * time.Hour),
+						Result:   entity.AuditResultSuccess,
+					}))
+				}
+
+				events, err := storage.ListAuditEvents(ctx, entity.AuditQuery{})
+				assert.NoError(t, err)
+				if assert.Len(t, events, 3) {
+					assert.Equal(t, entity.AuditGetRecord, events[0].Action)
+					assert.True(t, at.Add(2*time.Hour).Equal(events[0].Time))
+					assert.Equal(t, entity.AuditLogin, events[2].Action)
+				}
+
+				events, err = storage.ListAuditEvents(ctx, entity.AuditQuery{From: at.Add(time.Hour), To: at.Add(2 * time.Hour)})
+				assert.NoError(t, err)
+				if assert.Len(t, events, 1) {
+					assert.Equal(t, entity.AuditCreateRecord, events[0].Action)
+				}
+
+				events, err = storage.ListAuditEvents(ctx, entity.AuditQuery{Limit: 2})
+				assert.NoError(t, err)
+				assert.Len(t, events, 2)
+			},
+		},
+		{
+			"Delete user",
+			func(t *testing.T) {
+				login := "deleted" + suffix
+				assert.NoError(t, storage.CreateUser(context.Background(), login, entity.StoredPassword{Hash: "hash", Algorithm: entity.PasswordArgon2id}))
+				password, err := storage.GetPassword(context.Background(), login)
+				assert.NoError(t, err)
+				ctx := entity.WithPrincipal(context.Background(), entity.Principal{UserID: password.UserID})
+
+				file, err := storage.CreateRecord(ctx, entity.Record{Metadata: "file", Type: entity.TypeFile})
+				assert.NoError(t, err)
+				_, err = storage.CreateRecord(ctx, entity.Record{Metadata: "text", Type: entity.TypeText})
+				assert.NoError(t, err)
+				assert.NoError(t, storage.SaveAuditEvent(ctx, entity.AuditEvent{UserID: password.UserID, Action: entity.AuditLogin, Time: time.Now(), Result: entity.AuditResultSuccess}))
+
+				var deletedFiles []string
+				assert.NoError(t, storage.DeleteUser(ctx, func(recordIDs []string) error {
+					deletedFiles = recordIDs
+					return ErrUnknown
+				}), "user should be deleted, even if files aren't")
+				assert.Equal(t, []string{file}, deletedFiles)
+
+				journal, err := storage.ListDeletedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.Contains(t, journal, file, "file, which wasn't deleted, should be left for sweep")
+				assert.NoError(t, storage.ForgetDeletedFiles(context.Background(), []string{file}))
+				journal, err = storage.ListDeletedFiles(context.Background())
+				assert.NoError(t, err)
+				assert.NotContains(t, journal, file)
+
+				_, err = storage.GetPassword(context.Background(), login)
+				assert.Equal(t, ErrWrongCredentials, err)
+
+				_, err = storage.GetRecord(ctx, file)
+				assert.Equal(t, ErrNotFound, err)
+
+				events, err := storage.ListAuditEvents(ctx, entity.AuditQuery{})
+				assert.NoError(t, err)
+				assert.Empty(t, events)
+
+				assert.NoError(t, storage.DeleteUser(ctx, func(recordIDs []string) error {
+					assert.Empty(t, recordIDs)
+					return nil
+				}))
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, test.valid)
+	}
+}
+
+// recordsMetadata returns metadata of records in their order.
+func recordsMetadata(records []entity.Record) []string {
+	metadata := make([]string, 0, len(records))
+	for _, record := range records {
+		metadata = append(metadata, record.Metadata)
+	}
+	return metadata
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	// Test vectors from RFC 6238, appendix B, truncated to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tc := []struct {
+		name string
+		time int64
+		code string
+	}{
+		{"Code at 59", 59, "287082"},
+		{"Code at 1111111109", 1111111109, "081804"},
+		{"Code at 1234567890", 1234567890, "005924"},
+		{"Code at 2000000000", 2000000000, "279037"},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		code, err := Code(secret, Step(time.Unix(test.time, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, test.code, code)
+	}
+
+	_, err := Code("not base32!", 1)
+	assert.Equal(t, ErrBadSecret, err)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	current := Step(now)
+
+	tc := []struct {
+		name  string
+		step  int64
+		valid bool
+	}{
+		{"Validate code of current step", current, true},
+		{"Validate code of previous step", current - 1, true},
+		{"Validate code of next step", current + 1, true},
+		{"Validate too old code", current - 2, false},
+		{"Validate code from future", current + 2, false},
+	}
+
+	for _, test := range tc {
+		t.Log(test.name)
+		code, err := Code(secret, test.step)
+		assert.NoError(t, err)
+
+		step, ok := Validate(secret, code, now)
+		assert.Equal(t, test.valid, ok)
+		if test.valid {
+			assert.Equal(t, test.step, step)
+		}
+	}
+
+	_, ok := Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Gophkeeper", "user", "SECRET"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Gophkeeper:user", uri.Path)
+	assert.Equal(t, "SECRET", uri.Query().Get("secret"))
+	assert.Equal(t, "Gophkeeper", uri.Query().Get("issuer"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
@@ -0,0 +1 @@
+ALTER TABLE users_data DROP COLUMN IF EXISTS revision;
@@ -0,0 +1 @@
+ALTER TABLE users_data ADD COLUMN revision BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+DELETE FROM users_data WHERE deleted;
+
+ALTER TABLE users_data DROP COLUMN IF EXISTS deleted;
+ALTER TABLE users_data DROP COLUMN IF EXISTS created_revision;
+ALTER TABLE users DROP COLUMN IF EXISTS revision;
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE users_data ADD COLUMN created_revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users_data ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users_data SET created_revision = revision;
+UPDATE users SET revision = COALESCE((SELECT MAX(revision) FROM users_data WHERE users_data.user_id = users.user_id::text), 0);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_data_revision_idx;
+DROP INDEX IF EXISTS users_data_metadata_idx;
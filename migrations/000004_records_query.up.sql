@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS users_data_metadata_idx ON users_data (user_id, metadata, record_id) WHERE NOT deleted;
+CREATE INDEX IF NOT EXISTS users_data_revision_idx ON users_data (user_id, revision, record_id);
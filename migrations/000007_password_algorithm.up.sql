@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN password_algorithm VARCHAR(32) NOT NULL DEFAULT 'sha256';
@@ -0,0 +1,12 @@
+CREATE TABLE totp_secrets (
+    user_id VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE totp_backup_codes (
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
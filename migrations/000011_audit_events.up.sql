@@ -0,0 +1,10 @@
+CREATE TABLE audit_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    record_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    result VARCHAR(255) NOT NULL
+);
+CREATE INDEX audit_events_user_idx ON audit_events (user_id, created_at);
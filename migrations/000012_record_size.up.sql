@@ -0,0 +1,4 @@
+ALTER TABLE users_data ADD COLUMN data_size BIGINT NOT NULL DEFAULT 0;
+
+-- Data of file records is kept in file storage, so their size is set from files by server on startup.
+UPDATE users_data SET data_size = length(encoded_data) / 2 WHERE NOT deleted;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_login_key;
+ALTER TABLE users ALTER COLUMN login DROP NOT NULL;
@@ -0,0 +1,25 @@
+-- Login was checked only before insert, so concurrent registrations could create users with same login.
+-- Users can't be merged or renamed automatically: login is part of SRP verifier and users sign in by it,
+-- so migration fails with list of conflicts, and administrator resolves them, see README.
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('%s: %s', coalesce(login, '<null>'), user_ids), '; ' ORDER BY login NULLS FIRST)
+    INTO conflicts
+    FROM (
+        SELECT login, string_agg(user_id::TEXT, ', ' ORDER BY user_id) AS user_ids
+        FROM users
+        GROUP BY login
+        HAVING count(*) > 1 OR login IS NULL
+    ) AS duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'users have duplicate or empty logins, unique login can''t be added: %', conflicts
+            USING HINT = 'Delete or rename users, so each login has one user, then run "migrate force 12" and restart server.';
+    END IF;
+END
+$$;
+
+ALTER TABLE users ALTER COLUMN login SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
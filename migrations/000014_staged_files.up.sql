@@ -0,0 +1,5 @@
+-- Journal of staged files, which are moved in place of record files after records are updated.
+CREATE TABLE staged_files (
+    record_id VARCHAR(255) PRIMARY KEY,
+    staged TEXT NOT NULL
+);
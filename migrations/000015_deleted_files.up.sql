@@ -0,0 +1,4 @@
+-- Journal of file records of deleted users, which files are deleted by sweep, if they weren't deleted with user.
+CREATE TABLE deleted_files (
+    record_id VARCHAR(255) PRIMARY KEY
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS pruned_revision;
+ALTER TABLE users_data DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS totp_backup_codes;
+DROP TABLE IF EXISTS totp_secrets;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users_data;
+DROP TABLE IF EXISTS users;
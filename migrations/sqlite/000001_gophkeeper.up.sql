@@ -0,0 +1,71 @@
+CREATE TABLE users (
+    user_id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    login VARCHAR(255) UNIQUE NOT NULL,
+    password TEXT,
+    password_algorithm VARCHAR(32) NOT NULL DEFAULT 'sha256',
+    revision BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE users_data (
+    record_id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    user_id VARCHAR(255),
+    record_type INT,
+    metadata VARCHAR(255),
+    encoded_data TEXT,
+    revision BIGINT NOT NULL DEFAULT 1,
+    created_revision BIGINT NOT NULL DEFAULT 0,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    data_size BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX users_data_metadata_idx ON users_data (user_id, metadata, record_id) WHERE NOT deleted;
+CREATE INDEX users_data_revision_idx ON users_data (user_id, revision, record_id);
+
+CREATE TABLE refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    session_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX refresh_tokens_session_idx ON refresh_tokens (user_id, session_id);
+
+CREATE TABLE sessions (
+    session_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    device_name VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, last_seen_at) WHERE NOT revoked;
+
+CREATE TABLE totp_secrets (
+    user_id VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE totp_backup_codes (
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE audit_events (
+    event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(255) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    record_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    result VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX audit_events_user_idx ON audit_events (user_id, created_at);
@@ -0,0 +1,12 @@
+-- Journal of file records of deleted users, which files are deleted by sweep, if they weren't deleted with user.
+CREATE TABLE deleted_files (
+    record_id VARCHAR(255) PRIMARY KEY
+);
+
+-- Login attempts are kept by limiter of Postgres only, but they are deleted with user, so table is shared.
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(255) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NOT NULL
+);
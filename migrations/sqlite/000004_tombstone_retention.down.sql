@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN pruned_revision;
+ALTER TABLE users_data DROP COLUMN deleted_at;
@@ -0,0 +1,5 @@
+-- Tombstones of deleted records are pruned after retention period. Clients, which synced before the last pruned
+-- tombstone of user, list all records again. Tombstones, which were deleted before, are kept for full period.
+ALTER TABLE users_data ADD COLUMN deleted_at TIMESTAMP;
+UPDATE users_data SET deleted_at = CURRENT_TIMESTAMP WHERE deleted;
+ALTER TABLE users ADD COLUMN pruned_revision BIGINT NOT NULL DEFAULT 0;
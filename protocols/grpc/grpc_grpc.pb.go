@@ -20,12 +20,36 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Gophkeeper_Register_FullMethodName       = "/gophkeeper.Gophkeeper/Register"
-	Gophkeeper_Login_FullMethodName          = "/gophkeeper.Gophkeeper/Login"
-	Gophkeeper_GetRecordsInfo_FullMethodName = "/gophkeeper.Gophkeeper/GetRecordsInfo"
-	Gophkeeper_GetRecord_FullMethodName      = "/gophkeeper.Gophkeeper/GetRecord"
-	Gophkeeper_CreateRecord_FullMethodName   = "/gophkeeper.Gophkeeper/CreateRecord"
-	Gophkeeper_DeleteRecord_FullMethodName   = "/gophkeeper.Gophkeeper/DeleteRecord"
+	Gophkeeper_Register_FullMethodName          = "/gophkeeper.Gophkeeper/Register"
+	Gophkeeper_Login_FullMethodName             = "/gophkeeper.Gophkeeper/Login"
+	Gophkeeper_RegisterSRP_FullMethodName       = "/gophkeeper.Gophkeeper/RegisterSRP"
+	Gophkeeper_StartLoginSRP_FullMethodName     = "/gophkeeper.Gophkeeper/StartLoginSRP"
+	Gophkeeper_FinishLoginSRP_FullMethodName    = "/gophkeeper.Gophkeeper/FinishLoginSRP"
+	Gophkeeper_RefreshSession_FullMethodName    = "/gophkeeper.Gophkeeper/RefreshSession"
+	Gophkeeper_GetSigningKeys_FullMethodName    = "/gophkeeper.Gophkeeper/GetSigningKeys"
+	Gophkeeper_ChangePassword_FullMethodName    = "/gophkeeper.Gophkeeper/ChangePassword"
+	Gophkeeper_ChangePasswordSRP_FullMethodName = "/gophkeeper.Gophkeeper/ChangePasswordSRP"
+	Gophkeeper_DeleteAccount_FullMethodName     = "/gophkeeper.Gophkeeper/DeleteAccount"
+	Gophkeeper_DeleteAccountSRP_FullMethodName  = "/gophkeeper.Gophkeeper/DeleteAccountSRP"
+	Gophkeeper_Logout_FullMethodName            = "/gophkeeper.Gophkeeper/Logout"
+	Gophkeeper_ListSessions_FullMethodName      = "/gophkeeper.Gophkeeper/ListSessions"
+	Gophkeeper_RevokeSession_FullMethodName     = "/gophkeeper.Gophkeeper/RevokeSession"
+	Gophkeeper_ListAuditEvents_FullMethodName   = "/gophkeeper.Gophkeeper/ListAuditEvents"
+	Gophkeeper_EnableTOTP_FullMethodName        = "/gophkeeper.Gophkeeper/EnableTOTP"
+	Gophkeeper_ConfirmTOTP_FullMethodName       = "/gophkeeper.Gophkeeper/ConfirmTOTP"
+	Gophkeeper_DisableTOTP_FullMethodName       = "/gophkeeper.Gophkeeper/DisableTOTP"
+	Gophkeeper_VerifyTOTP_FullMethodName        = "/gophkeeper.Gophkeeper/VerifyTOTP"
+	Gophkeeper_GetRecordsInfo_FullMethodName    = "/gophkeeper.Gophkeeper/GetRecordsInfo"
+	Gophkeeper_GetChanges_FullMethodName        = "/gophkeeper.Gophkeeper/GetChanges"
+	Gophkeeper_GetRecord_FullMethodName         = "/gophkeeper.Gophkeeper/GetRecord"
+	Gophkeeper_CreateRecord_FullMethodName      = "/gophkeeper.Gophkeeper/CreateRecord"
+	Gophkeeper_UpdateRecord_FullMethodName      = "/gophkeeper.Gophkeeper/UpdateRecord"
+	Gophkeeper_DeleteRecord_FullMethodName      = "/gophkeeper.Gophkeeper/DeleteRecord"
+	Gophkeeper_GetUsage_FullMethodName          = "/gophkeeper.Gophkeeper/GetUsage"
+	Gophkeeper_UploadFile_FullMethodName        = "/gophkeeper.Gophkeeper/UploadFile"
+	Gophkeeper_DownloadFile_FullMethodName      = "/gophkeeper.Gophkeeper/DownloadFile"
+	Gophkeeper_ReplaceRecords_FullMethodName    = "/gophkeeper.Gophkeeper/ReplaceRecords"
+	Gophkeeper_WatchRecords_FullMethodName      = "/gophkeeper.Gophkeeper/WatchRecords"
 )
 
 // GophkeeperClient is the client API for Gophkeeper service.
@@ -34,10 +58,42 @@ const (
 type GophkeeperClient interface {
 	Register(ctx context.Context, in *UserCredentials, opts ...grpc.CallOption) (*Session, error)
 	Login(ctx context.Context, in *UserCredentials, opts ...grpc.CallOption) (*Session, error)
-	GetRecordsInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RecordsList, error)
+	RegisterSRP(ctx context.Context, in *SRPRegistration, opts ...grpc.CallOption) (*Session, error)
+	StartLoginSRP(ctx context.Context, in *SRPStart, opts ...grpc.CallOption) (*SRPChallenge, error)
+	FinishLoginSRP(ctx context.Context, in *SRPFinish, opts ...grpc.CallOption) (*SRPSession, error)
+	RefreshSession(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Session, error)
+	// GetSigningKeys gets public keys of access tokens, so other services can verify tokens without secret.
+	GetSigningKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*JWKS, error)
+	ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ChangePasswordSRP changes password of SRP user, passwords aren't sent to server.
+	ChangePasswordSRP(ctx context.Context, in *SRPPasswordChange, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// DeleteAccount deletes user with all records and files. Password of user is checked by credentials.
+	DeleteAccount(ctx context.Context, in *UserCredentials, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// DeleteAccountSRP deletes SRP user with all records and files, password isn't sent to server.
+	DeleteAccountSRP(ctx context.Context, in *SRPProof, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Logout(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ListSessions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SessionsList, error)
+	RevokeSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ListAuditEvents gets logins and record operations of user, newest first.
+	ListAuditEvents(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditEvents, error)
+	EnableTOTP(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, in *TOTPCode, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DisableTOTP(ctx context.Context, in *DisableTOTPRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// VerifyTOTP finishes login, which returned session with totp_required, and starts new session.
+	VerifyTOTP(ctx context.Context, in *TOTPCode, opts ...grpc.CallOption) (*Session, error)
+	GetRecordsInfo(ctx context.Context, in *RecordsQuery, opts ...grpc.CallOption) (*RecordsList, error)
+	GetChanges(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (*Changes, error)
 	GetRecord(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (*Record, error)
 	CreateRecord(ctx context.Context, in *Record, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	UpdateRecord(ctx context.Context, in *Record, opts ...grpc.CallOption) (*Record, error)
 	DeleteRecord(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetUsage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Usage, error)
+	UploadFile(ctx context.Context, opts ...grpc.CallOption) (Gophkeeper_UploadFileClient, error)
+	DownloadFile(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (Gophkeeper_DownloadFileClient, error)
+	// ReplaceRecords replaces data of all user records at once. Every record is sent as info chunk with revision,
+	// which was read, info of file record is followed by its data chunks. Returns new revision.
+	ReplaceRecords(ctx context.Context, opts ...grpc.CallOption) (Gophkeeper_ReplaceRecordsClient, error)
+	WatchRecords(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Gophkeeper_WatchRecordsClient, error)
 }
 
 type gophkeeperClient struct {
@@ -66,7 +122,160 @@ func (c *gophkeeperClient) Login(ctx context.Context, in *UserCredentials, opts
 	return out, nil
 }
 
-func (c *gophkeeperClient) GetRecordsInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*RecordsList, error) {
+func (c *gophkeeperClient) RegisterSRP(ctx context.Context, in *SRPRegistration, opts ...grpc.CallOption) (*Session, error) {
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Gophkeeper_RegisterSRP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) StartLoginSRP(ctx context.Context, in *SRPStart, opts ...grpc.CallOption) (*SRPChallenge, error) {
+	out := new(SRPChallenge)
+	err := c.cc.Invoke(ctx, Gophkeeper_StartLoginSRP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) FinishLoginSRP(ctx context.Context, in *SRPFinish, opts ...grpc.CallOption) (*SRPSession, error) {
+	out := new(SRPSession)
+	err := c.cc.Invoke(ctx, Gophkeeper_FinishLoginSRP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) RefreshSession(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*Session, error) {
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Gophkeeper_RefreshSession_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) GetSigningKeys(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*JWKS, error) {
+	out := new(JWKS)
+	err := c.cc.Invoke(ctx, Gophkeeper_GetSigningKeys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_ChangePassword_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) ChangePasswordSRP(ctx context.Context, in *SRPPasswordChange, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_ChangePasswordSRP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) DeleteAccount(ctx context.Context, in *UserCredentials, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_DeleteAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) DeleteAccountSRP(ctx context.Context, in *SRPProof, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_DeleteAccountSRP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) Logout(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_Logout_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) ListSessions(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SessionsList, error) {
+	out := new(SessionsList)
+	err := c.cc.Invoke(ctx, Gophkeeper_ListSessions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) RevokeSession(ctx context.Context, in *SessionID, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_RevokeSession_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) ListAuditEvents(ctx context.Context, in *AuditQuery, opts ...grpc.CallOption) (*AuditEvents, error) {
+	out := new(AuditEvents)
+	err := c.cc.Invoke(ctx, Gophkeeper_ListAuditEvents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) EnableTOTP(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TOTPEnrollment, error) {
+	out := new(TOTPEnrollment)
+	err := c.cc.Invoke(ctx, Gophkeeper_EnableTOTP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) ConfirmTOTP(ctx context.Context, in *TOTPCode, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_ConfirmTOTP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) DisableTOTP(ctx context.Context, in *DisableTOTPRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Gophkeeper_DisableTOTP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) VerifyTOTP(ctx context.Context, in *TOTPCode, opts ...grpc.CallOption) (*Session, error) {
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Gophkeeper_VerifyTOTP_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) GetRecordsInfo(ctx context.Context, in *RecordsQuery, opts ...grpc.CallOption) (*RecordsList, error) {
 	out := new(RecordsList)
 	err := c.cc.Invoke(ctx, Gophkeeper_GetRecordsInfo_FullMethodName, in, out, opts...)
 	if err != nil {
@@ -75,6 +284,15 @@ func (c *gophkeeperClient) GetRecordsInfo(ctx context.Context, in *emptypb.Empty
 	return out, nil
 }
 
+func (c *gophkeeperClient) GetChanges(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (*Changes, error) {
+	out := new(Changes)
+	err := c.cc.Invoke(ctx, Gophkeeper_GetChanges_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *gophkeeperClient) GetRecord(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (*Record, error) {
 	out := new(Record)
 	err := c.cc.Invoke(ctx, Gophkeeper_GetRecord_FullMethodName, in, out, opts...)
@@ -93,6 +311,15 @@ func (c *gophkeeperClient) CreateRecord(ctx context.Context, in *Record, opts ..
 	return out, nil
 }
 
+func (c *gophkeeperClient) UpdateRecord(ctx context.Context, in *Record, opts ...grpc.CallOption) (*Record, error) {
+	out := new(Record)
+	err := c.cc.Invoke(ctx, Gophkeeper_UpdateRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *gophkeeperClient) DeleteRecord(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, Gophkeeper_DeleteRecord_FullMethodName, in, out, opts...)
@@ -102,16 +329,189 @@ func (c *gophkeeperClient) DeleteRecord(ctx context.Context, in *RecordID, opts
 	return out, nil
 }
 
+func (c *gophkeeperClient) GetUsage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Usage, error) {
+	out := new(Usage)
+	err := c.cc.Invoke(ctx, Gophkeeper_GetUsage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophkeeperClient) UploadFile(ctx context.Context, opts ...grpc.CallOption) (Gophkeeper_UploadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gophkeeper_ServiceDesc.Streams[0], Gophkeeper_UploadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gophkeeperUploadFileClient{stream}
+	return x, nil
+}
+
+type Gophkeeper_UploadFileClient interface {
+	Send(*FileChunk) error
+	CloseAndRecv() (*RecordID, error)
+	grpc.ClientStream
+}
+
+type gophkeeperUploadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *gophkeeperUploadFileClient) Send(m *FileChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gophkeeperUploadFileClient) CloseAndRecv() (*RecordID, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RecordID)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gophkeeperClient) DownloadFile(ctx context.Context, in *RecordID, opts ...grpc.CallOption) (Gophkeeper_DownloadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gophkeeper_ServiceDesc.Streams[1], Gophkeeper_DownloadFile_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gophkeeperDownloadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gophkeeper_DownloadFileClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type gophkeeperDownloadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *gophkeeperDownloadFileClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gophkeeperClient) ReplaceRecords(ctx context.Context, opts ...grpc.CallOption) (Gophkeeper_ReplaceRecordsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gophkeeper_ServiceDesc.Streams[2], Gophkeeper_ReplaceRecords_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gophkeeperReplaceRecordsClient{stream}
+	return x, nil
+}
+
+type Gophkeeper_ReplaceRecordsClient interface {
+	Send(*FileChunk) error
+	CloseAndRecv() (*Record, error)
+	grpc.ClientStream
+}
+
+type gophkeeperReplaceRecordsClient struct {
+	grpc.ClientStream
+}
+
+func (x *gophkeeperReplaceRecordsClient) Send(m *FileChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gophkeeperReplaceRecordsClient) CloseAndRecv() (*Record, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Record)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gophkeeperClient) WatchRecords(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Gophkeeper_WatchRecordsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gophkeeper_ServiceDesc.Streams[3], Gophkeeper_WatchRecords_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gophkeeperWatchRecordsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gophkeeper_WatchRecordsClient interface {
+	Recv() (*RecordEvent, error)
+	grpc.ClientStream
+}
+
+type gophkeeperWatchRecordsClient struct {
+	grpc.ClientStream
+}
+
+func (x *gophkeeperWatchRecordsClient) Recv() (*RecordEvent, error) {
+	m := new(RecordEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GophkeeperServer is the server API for Gophkeeper service.
 // All implementations must embed UnimplementedGophkeeperServer
 // for forward compatibility
 type GophkeeperServer interface {
 	Register(context.Context, *UserCredentials) (*Session, error)
 	Login(context.Context, *UserCredentials) (*Session, error)
-	GetRecordsInfo(context.Context, *emptypb.Empty) (*RecordsList, error)
+	RegisterSRP(context.Context, *SRPRegistration) (*Session, error)
+	StartLoginSRP(context.Context, *SRPStart) (*SRPChallenge, error)
+	FinishLoginSRP(context.Context, *SRPFinish) (*SRPSession, error)
+	RefreshSession(context.Context, *RefreshRequest) (*Session, error)
+	// GetSigningKeys gets public keys of access tokens, so other services can verify tokens without secret.
+	GetSigningKeys(context.Context, *emptypb.Empty) (*JWKS, error)
+	ChangePassword(context.Context, *ChangePasswordRequest) (*emptypb.Empty, error)
+	// ChangePasswordSRP changes password of SRP user, passwords aren't sent to server.
+	ChangePasswordSRP(context.Context, *SRPPasswordChange) (*emptypb.Empty, error)
+	// DeleteAccount deletes user with all records and files. Password of user is checked by credentials.
+	DeleteAccount(context.Context, *UserCredentials) (*emptypb.Empty, error)
+	// DeleteAccountSRP deletes SRP user with all records and files, password isn't sent to server.
+	DeleteAccountSRP(context.Context, *SRPProof) (*emptypb.Empty, error)
+	Logout(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	ListSessions(context.Context, *emptypb.Empty) (*SessionsList, error)
+	RevokeSession(context.Context, *SessionID) (*emptypb.Empty, error)
+	// ListAuditEvents gets logins and record operations of user, newest first.
+	ListAuditEvents(context.Context, *AuditQuery) (*AuditEvents, error)
+	EnableTOTP(context.Context, *emptypb.Empty) (*TOTPEnrollment, error)
+	ConfirmTOTP(context.Context, *TOTPCode) (*emptypb.Empty, error)
+	DisableTOTP(context.Context, *DisableTOTPRequest) (*emptypb.Empty, error)
+	// VerifyTOTP finishes login, which returned session with totp_required, and starts new session.
+	VerifyTOTP(context.Context, *TOTPCode) (*Session, error)
+	GetRecordsInfo(context.Context, *RecordsQuery) (*RecordsList, error)
+	GetChanges(context.Context, *ChangesRequest) (*Changes, error)
 	GetRecord(context.Context, *RecordID) (*Record, error)
 	CreateRecord(context.Context, *Record) (*emptypb.Empty, error)
+	UpdateRecord(context.Context, *Record) (*Record, error)
 	DeleteRecord(context.Context, *RecordID) (*emptypb.Empty, error)
+	GetUsage(context.Context, *emptypb.Empty) (*Usage, error)
+	UploadFile(Gophkeeper_UploadFileServer) error
+	DownloadFile(*RecordID, Gophkeeper_DownloadFileServer) error
+	// ReplaceRecords replaces data of all user records at once. Every record is sent as info chunk with revision,
+	// which was read, info of file record is followed by its data chunks. Returns new revision.
+	ReplaceRecords(Gophkeeper_ReplaceRecordsServer) error
+	WatchRecords(*emptypb.Empty, Gophkeeper_WatchRecordsServer) error
 	mustEmbedUnimplementedGophkeeperServer()
 }
 
@@ -125,18 +525,90 @@ func (UnimplementedGophkeeperServer) Register(context.Context, *UserCredentials)
 func (UnimplementedGophkeeperServer) Login(context.Context, *UserCredentials) (*Session, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
 }
-func (UnimplementedGophkeeperServer) GetRecordsInfo(context.Context, *emptypb.Empty) (*RecordsList, error) {
+func (UnimplementedGophkeeperServer) RegisterSRP(context.Context, *SRPRegistration) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterSRP not implemented")
+}
+func (UnimplementedGophkeeperServer) StartLoginSRP(context.Context, *SRPStart) (*SRPChallenge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartLoginSRP not implemented")
+}
+func (UnimplementedGophkeeperServer) FinishLoginSRP(context.Context, *SRPFinish) (*SRPSession, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishLoginSRP not implemented")
+}
+func (UnimplementedGophkeeperServer) RefreshSession(context.Context, *RefreshRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefreshSession not implemented")
+}
+func (UnimplementedGophkeeperServer) GetSigningKeys(context.Context, *emptypb.Empty) (*JWKS, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSigningKeys not implemented")
+}
+func (UnimplementedGophkeeperServer) ChangePassword(context.Context, *ChangePasswordRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedGophkeeperServer) ChangePasswordSRP(context.Context, *SRPPasswordChange) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePasswordSRP not implemented")
+}
+func (UnimplementedGophkeeperServer) DeleteAccount(context.Context, *UserCredentials) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAccount not implemented")
+}
+func (UnimplementedGophkeeperServer) DeleteAccountSRP(context.Context, *SRPProof) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAccountSRP not implemented")
+}
+func (UnimplementedGophkeeperServer) Logout(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
+func (UnimplementedGophkeeperServer) ListSessions(context.Context, *emptypb.Empty) (*SessionsList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedGophkeeperServer) RevokeSession(context.Context, *SessionID) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeSession not implemented")
+}
+func (UnimplementedGophkeeperServer) ListAuditEvents(context.Context, *AuditQuery) (*AuditEvents, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
+func (UnimplementedGophkeeperServer) EnableTOTP(context.Context, *emptypb.Empty) (*TOTPEnrollment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableTOTP not implemented")
+}
+func (UnimplementedGophkeeperServer) ConfirmTOTP(context.Context, *TOTPCode) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmTOTP not implemented")
+}
+func (UnimplementedGophkeeperServer) DisableTOTP(context.Context, *DisableTOTPRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableTOTP not implemented")
+}
+func (UnimplementedGophkeeperServer) VerifyTOTP(context.Context, *TOTPCode) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyTOTP not implemented")
+}
+func (UnimplementedGophkeeperServer) GetRecordsInfo(context.Context, *RecordsQuery) (*RecordsList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetRecordsInfo not implemented")
 }
+func (UnimplementedGophkeeperServer) GetChanges(context.Context, *ChangesRequest) (*Changes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChanges not implemented")
+}
 func (UnimplementedGophkeeperServer) GetRecord(context.Context, *RecordID) (*Record, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetRecord not implemented")
 }
 func (UnimplementedGophkeeperServer) CreateRecord(context.Context, *Record) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateRecord not implemented")
 }
+func (UnimplementedGophkeeperServer) UpdateRecord(context.Context, *Record) (*Record, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRecord not implemented")
+}
 func (UnimplementedGophkeeperServer) DeleteRecord(context.Context, *RecordID) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteRecord not implemented")
 }
+func (UnimplementedGophkeeperServer) GetUsage(context.Context, *emptypb.Empty) (*Usage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
+func (UnimplementedGophkeeperServer) UploadFile(Gophkeeper_UploadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
+}
+func (UnimplementedGophkeeperServer) DownloadFile(*RecordID, Gophkeeper_DownloadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedGophkeeperServer) ReplaceRecords(Gophkeeper_ReplaceRecordsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReplaceRecords not implemented")
+}
+func (UnimplementedGophkeeperServer) WatchRecords(*emptypb.Empty, Gophkeeper_WatchRecordsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRecords not implemented")
+}
 func (UnimplementedGophkeeperServer) mustEmbedUnimplementedGophkeeperServer() {}
 
 // UnsafeGophkeeperServer may be embedded to opt out of forward compatibility for this service.
@@ -186,97 +658,623 @@ func _Gophkeeper_Login_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Gophkeeper_GetRecordsInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(emptypb.Empty)
+func _Gophkeeper_RegisterSRP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SRPRegistration)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GophkeeperServer).GetRecordsInfo(ctx, in)
+		return srv.(GophkeeperServer).RegisterSRP(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Gophkeeper_GetRecordsInfo_FullMethodName,
+		FullMethod: Gophkeeper_RegisterSRP_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GophkeeperServer).GetRecordsInfo(ctx, req.(*emptypb.Empty))
+		return srv.(GophkeeperServer).RegisterSRP(ctx, req.(*SRPRegistration))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Gophkeeper_GetRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RecordID)
+func _Gophkeeper_StartLoginSRP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SRPStart)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GophkeeperServer).GetRecord(ctx, in)
+		return srv.(GophkeeperServer).StartLoginSRP(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Gophkeeper_GetRecord_FullMethodName,
+		FullMethod: Gophkeeper_StartLoginSRP_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GophkeeperServer).GetRecord(ctx, req.(*RecordID))
+		return srv.(GophkeeperServer).StartLoginSRP(ctx, req.(*SRPStart))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Gophkeeper_CreateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Record)
+func _Gophkeeper_FinishLoginSRP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SRPFinish)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GophkeeperServer).CreateRecord(ctx, in)
+		return srv.(GophkeeperServer).FinishLoginSRP(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Gophkeeper_CreateRecord_FullMethodName,
+		FullMethod: Gophkeeper_FinishLoginSRP_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GophkeeperServer).CreateRecord(ctx, req.(*Record))
+		return srv.(GophkeeperServer).FinishLoginSRP(ctx, req.(*SRPFinish))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Gophkeeper_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RecordID)
+func _Gophkeeper_RefreshSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GophkeeperServer).DeleteRecord(ctx, in)
+		return srv.(GophkeeperServer).RefreshSession(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Gophkeeper_DeleteRecord_FullMethodName,
+		FullMethod: Gophkeeper_RefreshSession_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GophkeeperServer).DeleteRecord(ctx, req.(*RecordID))
+		return srv.(GophkeeperServer).RefreshSession(ctx, req.(*RefreshRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-// Gophkeeper_ServiceDesc is the grpc.ServiceDesc for Gophkeeper service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var Gophkeeper_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "gophkeeper.Gophkeeper",
-	HandlerType: (*GophkeeperServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Register",
-			Handler:    _Gophkeeper_Register_Handler,
-		},
-		{
-			MethodName: "Login",
+func _Gophkeeper_GetSigningKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).GetSigningKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_GetSigningKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).GetSigningKeys(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangePasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_ChangePassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).ChangePassword(ctx, req.(*ChangePasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_ChangePasswordSRP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SRPPasswordChange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).ChangePasswordSRP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_ChangePasswordSRP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).ChangePasswordSRP(ctx, req.(*SRPPasswordChange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_DeleteAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserCredentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).DeleteAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_DeleteAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).DeleteAccount(ctx, req.(*UserCredentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_DeleteAccountSRP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SRPProof)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).DeleteAccountSRP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_DeleteAccountSRP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).DeleteAccountSRP(ctx, req.(*SRPProof))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).Logout(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).ListSessions(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_RevokeSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).RevokeSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_RevokeSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).RevokeSession(ctx, req.(*SessionID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_ListAuditEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).ListAuditEvents(ctx, req.(*AuditQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_EnableTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).EnableTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_EnableTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).EnableTOTP(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_ConfirmTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPCode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).ConfirmTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_ConfirmTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).ConfirmTOTP(ctx, req.(*TOTPCode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_DisableTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableTOTPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).DisableTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_DisableTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).DisableTOTP(ctx, req.(*DisableTOTPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_VerifyTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPCode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).VerifyTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_VerifyTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).VerifyTOTP(ctx, req.(*TOTPCode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_GetRecordsInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordsQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).GetRecordsInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_GetRecordsInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).GetRecordsInfo(ctx, req.(*RecordsQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_GetChanges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).GetChanges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_GetChanges_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).GetChanges(ctx, req.(*ChangesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_GetRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).GetRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_GetRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).GetRecord(ctx, req.(*RecordID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_CreateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Record)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).CreateRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_CreateRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).CreateRecord(ctx, req.(*Record))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_UpdateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Record)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).UpdateRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_UpdateRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).UpdateRecord(ctx, req.(*Record))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).DeleteRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_DeleteRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).DeleteRecord(ctx, req.(*RecordID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophkeeperServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gophkeeper_GetUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophkeeperServer).GetUsage(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gophkeeper_UploadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GophkeeperServer).UploadFile(&gophkeeperUploadFileServer{stream})
+}
+
+type Gophkeeper_UploadFileServer interface {
+	SendAndClose(*RecordID) error
+	Recv() (*FileChunk, error)
+	grpc.ServerStream
+}
+
+type gophkeeperUploadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *gophkeeperUploadFileServer) SendAndClose(m *RecordID) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gophkeeperUploadFileServer) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Gophkeeper_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RecordID)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GophkeeperServer).DownloadFile(m, &gophkeeperDownloadFileServer{stream})
+}
+
+type Gophkeeper_DownloadFileServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type gophkeeperDownloadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *gophkeeperDownloadFileServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Gophkeeper_ReplaceRecords_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GophkeeperServer).ReplaceRecords(&gophkeeperReplaceRecordsServer{stream})
+}
+
+type Gophkeeper_ReplaceRecordsServer interface {
+	SendAndClose(*Record) error
+	Recv() (*FileChunk, error)
+	grpc.ServerStream
+}
+
+type gophkeeperReplaceRecordsServer struct {
+	grpc.ServerStream
+}
+
+func (x *gophkeeperReplaceRecordsServer) SendAndClose(m *Record) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gophkeeperReplaceRecordsServer) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Gophkeeper_WatchRecords_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GophkeeperServer).WatchRecords(m, &gophkeeperWatchRecordsServer{stream})
+}
+
+type Gophkeeper_WatchRecordsServer interface {
+	Send(*RecordEvent) error
+	grpc.ServerStream
+}
+
+type gophkeeperWatchRecordsServer struct {
+	grpc.ServerStream
+}
+
+func (x *gophkeeperWatchRecordsServer) Send(m *RecordEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Gophkeeper_ServiceDesc is the grpc.ServiceDesc for Gophkeeper service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gophkeeper_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gophkeeper.Gophkeeper",
+	HandlerType: (*GophkeeperServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Gophkeeper_Register_Handler,
+		},
+		{
+			MethodName: "Login",
 			Handler:    _Gophkeeper_Login_Handler,
 		},
+		{
+			MethodName: "RegisterSRP",
+			Handler:    _Gophkeeper_RegisterSRP_Handler,
+		},
+		{
+			MethodName: "StartLoginSRP",
+			Handler:    _Gophkeeper_StartLoginSRP_Handler,
+		},
+		{
+			MethodName: "FinishLoginSRP",
+			Handler:    _Gophkeeper_FinishLoginSRP_Handler,
+		},
+		{
+			MethodName: "RefreshSession",
+			Handler:    _Gophkeeper_RefreshSession_Handler,
+		},
+		{
+			MethodName: "GetSigningKeys",
+			Handler:    _Gophkeeper_GetSigningKeys_Handler,
+		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    _Gophkeeper_ChangePassword_Handler,
+		},
+		{
+			MethodName: "ChangePasswordSRP",
+			Handler:    _Gophkeeper_ChangePasswordSRP_Handler,
+		},
+		{
+			MethodName: "DeleteAccount",
+			Handler:    _Gophkeeper_DeleteAccount_Handler,
+		},
+		{
+			MethodName: "DeleteAccountSRP",
+			Handler:    _Gophkeeper_DeleteAccountSRP_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _Gophkeeper_Logout_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _Gophkeeper_ListSessions_Handler,
+		},
+		{
+			MethodName: "RevokeSession",
+			Handler:    _Gophkeeper_RevokeSession_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _Gophkeeper_ListAuditEvents_Handler,
+		},
+		{
+			MethodName: "EnableTOTP",
+			Handler:    _Gophkeeper_EnableTOTP_Handler,
+		},
+		{
+			MethodName: "ConfirmTOTP",
+			Handler:    _Gophkeeper_ConfirmTOTP_Handler,
+		},
+		{
+			MethodName: "DisableTOTP",
+			Handler:    _Gophkeeper_DisableTOTP_Handler,
+		},
+		{
+			MethodName: "VerifyTOTP",
+			Handler:    _Gophkeeper_VerifyTOTP_Handler,
+		},
 		{
 			MethodName: "GetRecordsInfo",
 			Handler:    _Gophkeeper_GetRecordsInfo_Handler,
 		},
+		{
+			MethodName: "GetChanges",
+			Handler:    _Gophkeeper_GetChanges_Handler,
+		},
 		{
 			MethodName: "GetRecord",
 			Handler:    _Gophkeeper_GetRecord_Handler,
@@ -285,11 +1283,40 @@ var Gophkeeper_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateRecord",
 			Handler:    _Gophkeeper_CreateRecord_Handler,
 		},
+		{
+			MethodName: "UpdateRecord",
+			Handler:    _Gophkeeper_UpdateRecord_Handler,
+		},
 		{
 			MethodName: "DeleteRecord",
 			Handler:    _Gophkeeper_DeleteRecord_Handler,
 		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _Gophkeeper_GetUsage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadFile",
+			Handler:       _Gophkeeper_UploadFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _Gophkeeper_DownloadFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReplaceRecords",
+			Handler:       _Gophkeeper_ReplaceRecords_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchRecords",
+			Handler:       _Gophkeeper_WatchRecords_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "protocols/grpc/grpc.proto",
 }